@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/spf13/cobra"
+	"go-server-template/internal/bootstrap"
+	"go-server-template/internal/service"
+	"os"
+)
+
+var auditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "audit log tools",
+	Long:  "tools to inspect the hash-chained audit log",
+}
+
+var auditVerifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "verify the audit log hash chain",
+	Long:  "recomputes every audit log hash and reports the first tampered entry",
+	Run: func(cmd *cobra.Command, args []string) {
+		bootstrap.Init()
+
+		checked, err := service.Get().Audit().VerifyChain(context.Background())
+		if err != nil {
+			fmt.Printf("audit chain verification failed after %d entries: %s\n", checked, err.Error())
+			os.Exit(1)
+		}
+
+		fmt.Printf("audit chain ok, %d entries verified\n", checked)
+	},
+}
+
+func init() {
+	auditCmd.AddCommand(auditVerifyCmd)
+	RootCmd.AddCommand(auditCmd)
+}
@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/spf13/cobra"
+	"go-server-template/internal/bootstrap"
+	"go-server-template/internal/service"
+	"os"
+)
+
+var dbCmd = &cobra.Command{
+	Use:   "db",
+	Short: "database tools",
+	Long:  "tools to maintain the data of the database",
+}
+
+var (
+	reencryptDryRun    bool
+	reencryptBatchSize int
+)
+
+var dbReencryptCmd = &cobra.Command{
+	Use:   "reencrypt",
+	Short: "encrypt the encrypted columns again under the primary key",
+	Long: "encrypts again under encryption.primary the values of the encrypted columns sealed by another key " +
+		"or still in plaintext, and recomputes their blind indexes. Keep the former keys configured until it succeeds",
+	Run: func(cmd *cobra.Command, args []string) {
+		if reencryptBatchSize <= 0 {
+			fmt.Println("--batch-size must be positive")
+			os.Exit(1)
+		}
+
+		bootstrap.Init()
+
+		stats, err := service.Get().Database().Reencrypt(context.Background(), reencryptBatchSize, reencryptDryRun, bootstrap.Tables()...)
+		if stats != nil {
+			verb := "re-encrypted"
+			if reencryptDryRun {
+				verb = "would re-encrypt"
+			}
+			fmt.Printf("%d tables, %d rows: %s %d values and %d blind indexes, %d rows changed meanwhile\n",
+				stats.Tables, stats.Rows, verb, stats.Values, stats.Indexes, stats.Conflicts)
+		}
+		if err != nil {
+			fmt.Printf("reencrypt failed: %s\n", err.Error())
+			os.Exit(1)
+		}
+		if stats.Conflicts > 0 {
+			os.Exit(2)
+		}
+	},
+}
+
+func init() {
+	dbReencryptCmd.Flags().BoolVar(&reencryptDryRun, "dry-run", false, "count the values to re-encrypt without writing them")
+	dbReencryptCmd.Flags().IntVar(&reencryptBatchSize, "batch-size", 500, "rows read per query")
+
+	dbCmd.AddCommand(dbReencryptCmd)
+	RootCmd.AddCommand(dbCmd)
+}
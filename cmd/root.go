@@ -70,4 +70,14 @@ func saveToViper(cfg *conf.Config) {
 	viper.Set("database", cfg.Database)
 	viper.Set("logger", cfg.Logger)
 	viper.Set("jwt", cfg.JWT)
+	viper.Set("storage", cfg.Storage)
+	viper.Set("querybudget", cfg.QueryBudget)
+	viper.Set("outbox", cfg.Outbox)
+	viper.Set("jobs", cfg.Jobs)
+	viper.Set("scheduler", cfg.Scheduler)
+	viper.Set("lock", cfg.Lock)
+	viper.Set("settings", cfg.Settings)
+	viper.Set("flags", cfg.Flags)
+	viper.Set("cache", cfg.Cache)
+	viper.Set("encryption", cfg.Encryption)
 }
@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"context"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 	"go-server-template/internal/bootstrap"
@@ -12,9 +13,7 @@ var serverCmd = &cobra.Command{
 	Short: "start http server with configured api",
 	Long:  "starts a http server and serves the configured api",
 	Run: func(cmd *cobra.Command, args []string) {
-		bootstrap.Init()
-
-		core.RunServer()
+		core.RunServer(bootstrap.InitAsync(context.Background()))
 	},
 }
 
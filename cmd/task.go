@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/spf13/cobra"
+	"go-server-template/internal/bootstrap"
+	"go-server-template/internal/schedule"
+	"os"
+)
+
+var taskCmd = &cobra.Command{
+	Use:   "task",
+	Short: "scheduled task tools",
+	Long:  "tools to inspect and run the scheduled tasks",
+}
+
+var taskListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "list the scheduled tasks",
+	Long:  "lists the scheduled tasks with their last and next run",
+	Run: func(cmd *cobra.Command, args []string) {
+		bootstrap.Init()
+
+		status, err := schedule.GetStatus(context.Background())
+		if err != nil {
+			fmt.Printf("failed to read the scheduler status: %s\n", err.Error())
+			os.Exit(1)
+		}
+
+		leader := status.Leader
+		if leader == "" {
+			leader = "none"
+		}
+		fmt.Printf("leader: %s\n", leader)
+		for _, t := range status.Tasks {
+			last, next := "never", "unscheduled"
+			if t.LastRunAt != nil {
+				last = fmt.Sprintf("%s (%s)", t.LastRunAt.Format("2006-01-02 15:04:05"), t.LastStatus)
+			}
+			if t.NextRunAt != nil {
+				next = t.NextRunAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%-24s %-16s last: %-34s next: %s\n", t.Name, t.Spec, last, next)
+		}
+	},
+}
+
+var taskRunCmd = &cobra.Command{
+	Use:   "run <name>",
+	Short: "run a scheduled task now",
+	Long:  "runs a scheduled task once in this process, regardless of the scheduler leader",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		bootstrap.Init()
+
+		err := schedule.RunNow(context.Background(), args[0])
+		if errors.Is(err, schedule.ErrTaskNotFound) {
+			fmt.Printf("task %s not found\n", args[0])
+			os.Exit(1)
+		}
+		if err != nil {
+			fmt.Printf("task %s failed: %s\n", args[0], err.Error())
+			os.Exit(1)
+		}
+
+		fmt.Printf("task %s done\n", args[0])
+	},
+}
+
+func init() {
+	taskCmd.AddCommand(taskListCmd)
+	taskCmd.AddCommand(taskRunCmd)
+	RootCmd.AddCommand(taskCmd)
+}
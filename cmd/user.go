@@ -0,0 +1,177 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/spf13/cobra"
+	"go-server-template/internal/bootstrap"
+	"go-server-template/internal/db"
+	"go-server-template/internal/service"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var userCmd = &cobra.Command{
+	Use:   "user",
+	Short: "user tools",
+	Long:  "tools to import and export the users in bulk",
+}
+
+var (
+	importFormat    string
+	importDryRun    bool
+	importBatchSize int
+)
+
+var userImportCmd = &cobra.Command{
+	Use:   "import <file>",
+	Short: "import users from a CSV or NDJSON file",
+	Long: "creates the users of a CSV file with username and password columns, or of an NDJSON file, " +
+		"by batches of a transaction each. Rows failing validation are reported and skipped. " +
+		"The file is read from stdin when it is -",
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		format, err := transferFormat(importFormat, args[0])
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+
+		var r io.Reader = os.Stdin
+		if args[0] != "-" {
+			f, err := os.Open(args[0])
+			if err != nil {
+				fmt.Printf("failed to open %s: %s\n", args[0], err.Error())
+				os.Exit(1)
+			}
+			defer f.Close()
+			r = f
+		}
+
+		bootstrap.Init()
+
+		report, err := service.Get().User().ImportUsers(context.Background(), r, service.ImportOptions{
+			Format:    format,
+			DryRun:    importDryRun,
+			BatchSize: importBatchSize,
+		})
+		if report != nil {
+			for _, e := range report.Errors {
+				fmt.Printf("line %d %s: %s\n", e.Line, e.Username, e.Error)
+			}
+			if report.Truncated {
+				fmt.Printf("... %d more errors\n", report.Failed-len(report.Errors))
+			}
+			verb := "created"
+			if report.DryRun {
+				verb = "would create"
+			}
+			fmt.Printf("%d rows, %s %d users, %d failed\n", report.Rows, verb, report.Created, report.Failed)
+		}
+		if err != nil {
+			fmt.Printf("import failed: %s\n", err.Error())
+			os.Exit(1)
+		}
+		if report.Failed > 0 {
+			os.Exit(2)
+		}
+	},
+}
+
+var (
+	exportFormat         string
+	exportUsernamePrefix string
+	exportFrom           string
+	exportTo             string
+	exportDeleted        bool
+)
+
+var userExportCmd = &cobra.Command{
+	Use:   "export <file>",
+	Short: "export users to a CSV or NDJSON file",
+	Long:  "writes the users, without their credentials, to a CSV or NDJSON file in id order",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		format, err := transferFormat(exportFormat, args[0])
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		filter := db.UserFilter{UsernamePrefix: exportUsernamePrefix, Deleted: exportDeleted}
+		if filter.CreatedFrom, err = parseDate(exportFrom); err != nil {
+			fmt.Printf("invalid --from: %s\n", err.Error())
+			os.Exit(1)
+		}
+		if filter.CreatedTo, err = parseDate(exportTo); err != nil {
+			fmt.Printf("invalid --to: %s\n", err.Error())
+			os.Exit(1)
+		}
+
+		f, err := os.Create(args[0])
+		if err != nil {
+			fmt.Printf("failed to create %s: %s\n", args[0], err.Error())
+			os.Exit(1)
+		}
+		defer f.Close()
+
+		bootstrap.Init()
+
+		n, err := service.Get().User().ExportUsers(context.Background(), f, service.ExportOptions{Format: format, Filter: filter})
+		if err == nil {
+			err = f.Sync()
+		}
+		if err != nil {
+			fmt.Printf("export failed after %d users: %s\n", n, err.Error())
+			os.Exit(1)
+		}
+		fmt.Printf("%d users exported to %s\n", n, args[0])
+	},
+}
+
+// transferFormat returns format, or else the one of the extension of file.
+func transferFormat(format, file string) (string, error) {
+	switch format {
+	case service.FormatCSV, service.FormatNDJSON:
+		return format, nil
+	case "":
+	default:
+		return "", fmt.Errorf("unsupported format %s", format)
+	}
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".csv":
+		return service.FormatCSV, nil
+	case ".ndjson", ".jsonl":
+		return service.FormatNDJSON, nil
+	}
+	return "", fmt.Errorf("unknown format of %s, set --format", file)
+}
+
+// parseDate parses an RFC3339 time or a date, empty is the zero time.
+func parseDate(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation("2006-01-02", value, time.Local)
+}
+
+func init() {
+	userImportCmd.Flags().StringVar(&importFormat, "format", "", "csv or ndjson (default by the file extension)")
+	userImportCmd.Flags().BoolVar(&importDryRun, "dry-run", false, "validate the rows without creating any user")
+	userImportCmd.Flags().IntVar(&importBatchSize, "batch-size", 100, "rows created per transaction, at most 1000")
+
+	userExportCmd.Flags().StringVar(&exportFormat, "format", "", "csv or ndjson (default by the file extension)")
+	userExportCmd.Flags().StringVar(&exportUsernamePrefix, "username-prefix", "", "only the users whose username starts with it")
+	userExportCmd.Flags().StringVar(&exportFrom, "from", "", "only the users created from this date or RFC3339 time")
+	userExportCmd.Flags().StringVar(&exportTo, "to", "", "only the users created before this date or RFC3339 time")
+	userExportCmd.Flags().BoolVar(&exportDeleted, "deleted", false, "include the soft deleted users")
+
+	userCmd.AddCommand(userImportCmd)
+	userCmd.AddCommand(userExportCmd)
+	RootCmd.AddCommand(userCmd)
+}
@@ -70,10 +70,6 @@ var doc = `{
                     "type": "integer",
                     "example": 1
                 },
-                "password": {
-                    "type": "string",
-                    "example": "xxxxxxx"
-                },
                 "username": {
                     "type": "string",
                     "example": "JohnDoe"
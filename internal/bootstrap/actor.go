@@ -0,0 +1,81 @@
+package bootstrap
+
+import (
+	"go-server-template/pkg/context"
+	"reflect"
+
+	"gorm.io/gorm"
+)
+
+const (
+	actorCallbackName = "actor:stamp"
+	createdByColumn   = "created_by"
+	updatedByColumn   = "updated_by"
+)
+
+// ActorPlugin fills created_by and updated_by with the user id found in the
+// statement context, either a *gin.Context or a context from context.WithUserID.
+type ActorPlugin struct{}
+
+func (op *ActorPlugin) Name() string {
+	return "actorPlugin"
+}
+
+func (op *ActorPlugin) Initialize(db *gorm.DB) (err error) {
+	_ = db.Callback().Create().Before("gorm:create").Register(actorCallbackName, stampCreate)
+	_ = db.Callback().Update().Before("gorm:update").Register(actorCallbackName, stampUpdate)
+	return
+}
+
+var _ gorm.Plugin = &ActorPlugin{}
+
+func stampCreate(db *gorm.DB) {
+	if db.Error != nil || db.Statement.Schema == nil {
+		return
+	}
+
+	actor := context.UserIDFrom(db.Statement.Context)
+	if actor == 0 {
+		return
+	}
+
+	stmt := db.Statement
+	stamp := func(rv reflect.Value) {
+		for _, name := range []string{createdByColumn, updatedByColumn} {
+			field := stmt.Schema.LookUpField(name)
+			if field == nil {
+				continue
+			}
+			if _, zero := field.ValueOf(stmt.Context, rv); zero {
+				_ = field.Set(stmt.Context, rv, actor)
+			}
+		}
+	}
+
+	rv := reflect.Indirect(stmt.ReflectValue)
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			stamp(reflect.Indirect(rv.Index(i)))
+		}
+	case reflect.Struct:
+		stamp(rv)
+	}
+}
+
+func stampUpdate(db *gorm.DB) {
+	if db.Error != nil || db.Statement.Schema == nil {
+		return
+	}
+
+	if db.Statement.Schema.LookUpField(updatedByColumn) == nil {
+		return
+	}
+
+	actor := context.UserIDFrom(db.Statement.Context)
+	if actor == 0 {
+		return
+	}
+
+	db.Statement.SetColumn(updatedByColumn, actor, true)
+}
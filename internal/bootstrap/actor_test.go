@@ -0,0 +1,71 @@
+package bootstrap
+
+import (
+	stdctx "context"
+	"errors"
+	"go-server-template/internal/db"
+	"go-server-template/internal/model"
+	"go-server-template/pkg/context"
+	"go-server-template/pkg/ulid"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+func TestActorPlugin(t *testing.T) {
+	dB := openTestDB(t)
+	ctx := context.WithUserID(stdctx.Background(), 7)
+
+	user := &model.User{Username: "alice"}
+	if err := dB.WithContext(ctx).Create(user).Error; err != nil {
+		t.Fatal(err)
+	}
+	if user.CreatedBy != 7 || user.UpdatedBy != 7 {
+		t.Fatalf("expected created_by and updated_by 7, got %d and %d", user.CreatedBy, user.UpdatedBy)
+	}
+
+	ctx = context.WithUserID(stdctx.Background(), 8)
+	if err := db.Users().DeleteByPublicID(ctx, user.PublicID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Users().Get(ctx, user.ID); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Fatalf("expected deleted user to be hidden, got %v", err)
+	}
+
+	if err := db.Users().Restore(ctx, user.PublicID); err != nil {
+		t.Fatal(err)
+	}
+	restored, err := db.Users().Get(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored.CreatedBy != 7 || restored.UpdatedBy != 8 {
+		t.Fatalf("expected created_by 7 and updated_by 8, got %d and %d", restored.CreatedBy, restored.UpdatedBy)
+	}
+
+	if err = db.Users().Purge(ctx, user.PublicID); err != nil {
+		t.Fatal(err)
+	}
+	if err = db.Users().Restore(ctx, user.PublicID); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Fatalf("expected purged user to be gone, got %v", err)
+	}
+}
+
+func TestBackfillPublicIDs(t *testing.T) {
+	dB := openTestDB(t)
+
+	if err := dB.Exec("INSERT INTO users (username) VALUES ('legacy')").Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.BackfillPublicIDs(stdctx.Background(), new(model.User)); err != nil {
+		t.Fatal(err)
+	}
+
+	var user model.User
+	if err := dB.Where("username = ?", "legacy").First(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ulid.Parse(user.PublicID); err != nil {
+		t.Fatalf("expected a backfilled public id, got %q", user.PublicID)
+	}
+}
@@ -0,0 +1,315 @@
+package bootstrap
+
+import (
+	"encoding/json"
+	"fmt"
+	"go-server-template/internal/db"
+	"go-server-template/internal/model"
+	"go-server-template/pkg/context"
+	"go-server-template/pkg/logger"
+	"reflect"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+const (
+	auditBeforeName = "audit:before"
+	auditAfterName  = "audit:after"
+	auditSnapshot   = "_audit_snapshot"
+	auditRedacted   = "[REDACTED]"
+)
+
+// AuditPlugin records every create, update and delete on model.Auditable
+// models into the hash-chained audit_logs table.
+//
+// An entry is written in the transaction of the change it describes, see
+// db.AppendAuditLog.
+type AuditPlugin struct{}
+
+func (op *AuditPlugin) Name() string {
+	return "auditPlugin"
+}
+
+func (op *AuditPlugin) Initialize(db *gorm.DB) (err error) {
+	// 开始前, 记录变更前的数据
+	_ = db.Callback().Update().Before("gorm:update").Register(auditBeforeName, op.snapshot)
+	_ = db.Callback().Delete().Before("gorm:delete").Register(auditBeforeName, op.snapshot)
+
+	// 结束后, 写入审计日志
+	_ = db.Callback().Create().After("gorm:create").Register(auditAfterName, op.afterCreate)
+	_ = db.Callback().Update().After("gorm:update").Register(auditAfterName, op.afterChange(model.AuditActionUpdate))
+	_ = db.Callback().Delete().After("gorm:delete").Register(auditAfterName, op.afterChange(model.AuditActionDelete))
+	return
+}
+
+var _ gorm.Plugin = &AuditPlugin{}
+
+type auditRow map[string]interface{}
+
+func audited(db *gorm.DB) bool {
+	if db.Error != nil || db.Statement.Schema == nil {
+		return false
+	}
+	_, ok := reflect.New(db.Statement.Schema.ModelType).Interface().(model.Auditable)
+	return ok
+}
+
+// snapshot loads the rows targeted by an update or delete before they change.
+func (op *AuditPlugin) snapshot(db *gorm.DB) {
+	if !audited(db) {
+		return
+	}
+
+	stmt := db.Statement
+	tx := newAuditQuery(db)
+
+	conditions := 0
+	if c, ok := stmt.Clauses["WHERE"]; ok {
+		if where, ok := c.Expression.(clause.Where); ok && len(where.Exprs) > 0 {
+			tx = tx.Clauses(where)
+			conditions++
+		}
+	}
+	if pks := primaryKeys(db); len(pks) > 0 {
+		tx = tx.Where(clause.IN{Column: clause.Column{Name: stmt.Schema.PrioritizedPrimaryField.DBName}, Values: pks})
+		conditions++
+	}
+	if conditions == 0 {
+		return
+	}
+
+	var rows []map[string]interface{}
+	if err := tx.Find(&rows).Error; err != nil {
+		logger.GetLogger().Warnf("audit: failed to snapshot %s: %s", stmt.Table, err.Error())
+		return
+	}
+
+	db.InstanceSet(auditSnapshot, rows)
+}
+
+func (op *AuditPlugin) afterCreate(db *gorm.DB) {
+	if !audited(db) || db.Statement.RowsAffected == 0 {
+		return
+	}
+
+	for _, after := range reflectRows(db) {
+		op.record(db, model.AuditActionCreate, nil, after)
+	}
+}
+
+func (op *AuditPlugin) afterChange(action string) func(db *gorm.DB) {
+	return func(db *gorm.DB) {
+		if !audited(db) || db.Statement.RowsAffected == 0 {
+			return
+		}
+
+		v, ok := db.InstanceGet(auditSnapshot)
+		if !ok {
+			return
+		}
+		snapshot, _ := v.([]map[string]interface{})
+		if len(snapshot) == 0 {
+			return
+		}
+
+		pkName := db.Statement.Schema.PrioritizedPrimaryField.DBName
+		pks := make([]interface{}, 0, len(snapshot))
+		for _, row := range snapshot {
+			pks = append(pks, row[pkName])
+		}
+
+		// reload the rows to get what was actually written, a hard delete
+		// leaves nothing behind
+		var current []map[string]interface{}
+		err := newAuditQuery(db).
+			Where(clause.IN{Column: clause.Column{Name: pkName}, Values: pks}).
+			Find(&current).Error
+		if err != nil {
+			logger.GetLogger().Warnf("audit: failed to reload %s: %s", db.Statement.Table, err.Error())
+		}
+
+		afterByPK := make(map[string]auditRow, len(current))
+		for _, row := range current {
+			afterByPK[fmt.Sprint(row[pkName])] = normalizeRow(row)
+		}
+
+		for _, row := range snapshot {
+			before := normalizeRow(row)
+			after := afterByPK[fmt.Sprint(row[pkName])]
+			if action == model.AuditActionUpdate && len(diffRows(before, after)) == 0 {
+				continue
+			}
+			op.record(db, action, before, after)
+		}
+	}
+}
+
+func (op *AuditPlugin) record(dB *gorm.DB, action string, before, after auditRow) {
+	stmt := dB.Statement
+	pkName := stmt.Schema.PrioritizedPrimaryField.DBName
+
+	pk := before[pkName]
+	if pk == nil {
+		pk = after[pkName]
+	}
+
+	diff := diffRows(before, after)
+
+	entry := &model.AuditLog{
+		ActorID:    context.UserIDFrom(stmt.Context),
+		RequestID:  context.RequestIDFrom(stmt.Context),
+		Action:     action,
+		Table:      stmt.Table,
+		PrimaryKey: fmt.Sprint(pk),
+		Before:     marshalRow(redactRow(stmt.Schema, before)),
+		After:      marshalRow(redactRow(stmt.Schema, after)),
+		Diff:       marshalRow(redactRow(stmt.Schema, diff)),
+		CreatedAt:  time.Now().UTC().Truncate(time.Millisecond),
+	}
+
+	// write with the statement's connection so that the entry shares the
+	// transaction of the change it describes
+	tx := dB.Session(&gorm.Session{NewDB: true, Context: primaryContext(dB)})
+
+	if err := db.AppendAuditLog(tx, entry); err != nil {
+		_ = dB.AddError(fmt.Errorf("audit: %w", err))
+	}
+}
+
+// newAuditQuery starts a query on the statement's connection and table that
+// sees soft deleted rows too, so restores and purges are captured as well.
+func newAuditQuery(db *gorm.DB) *gorm.DB {
+	return db.Session(&gorm.Session{NewDB: true, Context: primaryContext(db)}).
+		Unscoped().
+		Model(reflect.New(db.Statement.Schema.ModelType).Interface()).
+		Table(db.Statement.Table)
+}
+
+// primaryKeys returns the non-zero primary keys of the statement's model value.
+func primaryKeys(db *gorm.DB) []interface{} {
+	stmt := db.Statement
+	field := stmt.Schema.PrioritizedPrimaryField
+	if field == nil {
+		return nil
+	}
+
+	var pks []interface{}
+	collect := func(rv reflect.Value) {
+		if v, zero := field.ValueOf(stmt.Context, rv); !zero {
+			pks = append(pks, v)
+		}
+	}
+
+	rv := reflect.Indirect(stmt.ReflectValue)
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			collect(reflect.Indirect(rv.Index(i)))
+		}
+	case reflect.Struct:
+		collect(rv)
+	}
+	return pks
+}
+
+// reflectRows converts the created model value(s) into audit rows.
+func reflectRows(db *gorm.DB) []auditRow {
+	stmt := db.Statement
+
+	toRow := func(rv reflect.Value) auditRow {
+		row := make(map[string]interface{}, len(stmt.Schema.DBNames))
+		for _, name := range stmt.Schema.DBNames {
+			field := stmt.Schema.FieldsByDBName[name]
+			v, _ := field.ValueOf(stmt.Context, rv)
+			row[name] = v
+		}
+		return normalizeRow(row)
+	}
+
+	var rows []auditRow
+	rv := reflect.Indirect(stmt.ReflectValue)
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			rows = append(rows, toRow(reflect.Indirect(rv.Index(i))))
+		}
+	case reflect.Struct:
+		rows = append(rows, toRow(rv))
+	}
+	return rows
+}
+
+// normalizeRow makes driver values comparable and serializable.
+func normalizeRow(row map[string]interface{}) auditRow {
+	out := make(auditRow, len(row))
+	for k, v := range row {
+		switch val := v.(type) {
+		case []byte:
+			out[k] = string(val)
+		case time.Time:
+			out[k] = val.UTC().Format(time.RFC3339Nano)
+		case *time.Time:
+			if val != nil {
+				out[k] = val.UTC().Format(time.RFC3339Nano)
+			} else {
+				out[k] = nil
+			}
+		default:
+			out[k] = val
+		}
+	}
+	return out
+}
+
+// redactRow hides the values of fields tagged with `audit:"-"`, the audit log
+// still shows that they changed but never what they contain.
+func redactRow(s *schema.Schema, row auditRow) auditRow {
+	if row == nil {
+		return nil
+	}
+
+	out := make(auditRow, len(row))
+	for k, v := range row {
+		if field := s.LookUpField(k); field != nil && field.Tag.Get("audit") == "-" {
+			if _, ok := v.(map[string]interface{}); ok {
+				v = map[string]interface{}{"from": auditRedacted, "to": auditRedacted}
+			} else {
+				v = auditRedacted
+			}
+		}
+		out[k] = v
+	}
+	return out
+}
+
+// diffRows returns {"column": {"from": x, "to": y}} for the columns that differ.
+func diffRows(before, after auditRow) auditRow {
+	diff := make(auditRow)
+	seen := make(map[string]struct{}, len(before)+len(after))
+	for k := range before {
+		seen[k] = struct{}{}
+	}
+	for k := range after {
+		seen[k] = struct{}{}
+	}
+
+	for k := range seen {
+		from, to := before[k], after[k]
+		if fmt.Sprint(from) == fmt.Sprint(to) {
+			continue
+		}
+		diff[k] = map[string]interface{}{"from": from, "to": to}
+	}
+	return diff
+}
+
+func marshalRow(row auditRow) string {
+	if row == nil {
+		return ""
+	}
+	b, _ := json.Marshal(row)
+	return string(b)
+}
@@ -0,0 +1,175 @@
+package bootstrap
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"go-server-template/internal/db"
+	"go-server-template/internal/db/dbtest"
+	"go-server-template/internal/model"
+	"go-server-template/internal/service"
+	appctx "go-server-template/pkg/context"
+	"go-server-template/pkg/logger"
+	"go-server-template/pkg/storage"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+	gormLogger "gorm.io/gorm/logger"
+)
+
+func openTestDB(t *testing.T) *gorm.DB {
+	logger.Init("zap")
+
+	dB := dbtest.Open(t, new(model.User), new(model.AuditLog), new(model.AuditHead), new(model.File))
+	_ = dB.Use(&ActorPlugin{})
+	_ = dB.Use(&AuditPlugin{})
+	storage.Init(storage.NewMemoryStorage())
+	service.Init(dB)
+	return dB
+}
+
+func TestAuditPlugin(t *testing.T) {
+	dB := openTestDB(t)
+	ctx := context.Background()
+
+	user := &model.User{Username: "alice", Password: "secret"}
+	if err := dB.Create(user).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := dB.Model(user).Update("username", "bob").Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := dB.Model(user).Update("password", "changed").Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := dB.Delete(user).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	logs, total, err := db.ListAuditLogs(ctx, db.AuditFilter{Table: "users", Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 4 {
+		t.Fatalf("expected 4 audit logs, got %d", total)
+	}
+
+	actions := []string{model.AuditActionDelete, model.AuditActionUpdate, model.AuditActionUpdate, model.AuditActionCreate}
+	for i, l := range logs {
+		if l.Action != actions[i] {
+			t.Errorf("log %d: expected action %s, got %s", i, actions[i], l.Action)
+		}
+		if strings.Contains(l.Before+l.After+l.Diff, "secret") || strings.Contains(l.Before+l.After+l.Diff, "changed") {
+			t.Errorf("log %d leaks a redacted field: %+v", i, l)
+		}
+	}
+	if !strings.Contains(logs[2].Diff, `"username"`) {
+		t.Errorf("expected username in diff, got %s", logs[2].Diff)
+	}
+	if !strings.Contains(logs[1].Diff, `"password"`) {
+		t.Errorf("expected redacted password change in diff, got %s", logs[1].Diff)
+	}
+
+	checked, err := service.Get().Audit().VerifyChain(ctx)
+	if err != nil || checked != 4 {
+		t.Fatalf("expected intact chain of 4, got %d, %v", checked, err)
+	}
+
+	// tamper with an entry behind the plugin's back
+	if err = dB.Exec("UPDATE audit_logs SET actor_id = 42 WHERE id = 2").Error; err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = service.Get().Audit().VerifyChain(ctx)
+	var chainErr *service.AuditChainError
+	if !errors.As(err, &chainErr) || chainErr.ID != 2 {
+		t.Fatalf("expected chain broken at entry 2, got %v", err)
+	}
+}
+
+func TestAuditPublicIDs(t *testing.T) {
+	dB := openTestDB(t)
+	admin := &model.User{Username: "admin"}
+	if err := dB.Create(admin).Error; err != nil {
+		t.Fatal(err)
+	}
+	ctx := appctx.WithUserID(context.Background(), uint64(admin.ID))
+
+	user := &model.User{Username: "alice"}
+	if err := dB.WithContext(ctx).Create(user).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := dB.WithContext(ctx).Model(user).Update("username", "bob").Error; err != nil {
+		t.Fatal(err)
+	}
+
+	logs, total, err := db.ListAuditLogs(ctx, db.AuditFilter{Actor: admin.PublicID, Limit: 10})
+	if err != nil || total != 2 {
+		t.Fatalf("expected the 2 entries of the admin, got %d (%v)", total, err)
+	}
+	for _, l := range logs {
+		if l.Actor != admin.PublicID || l.Record != user.PublicID {
+			t.Errorf("expected the public ids, got %+v", l)
+		}
+		b, _ := json.Marshal(l)
+		if strings.Contains(string(b), `"id"`) || strings.Contains(string(b), `"primary_key"`) {
+			t.Errorf("expected no internal id in %s", b)
+		}
+	}
+
+	for _, tt := range []struct {
+		filter db.AuditFilter
+		total  int64
+	}{
+		{db.AuditFilter{Table: "users", Record: user.PublicID}, 2},
+		{db.AuditFilter{Table: "users", Record: admin.PublicID}, 1},
+		{db.AuditFilter{Table: "users", Record: "01ARYZ6S41TSV4RRFFQ69G5FAV"}, 0},
+		{db.AuditFilter{Actor: "01ARYZ6S41TSV4RRFFQ69G5FAV"}, 0},
+	} {
+		tt.filter.Limit = 10
+		if _, total, err = db.ListAuditLogs(ctx, tt.filter); err != nil || total != tt.total {
+			t.Errorf("%+v: expected %d entries, got %d (%v)", tt.filter, tt.total, total, err)
+		}
+	}
+}
+
+// statements is a gorm logger keeping the statements run.
+type statements struct {
+	gormLogger.Interface
+	sql []string
+}
+
+func (s *statements) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	sql, _ := fc()
+	s.sql = append(s.sql, sql)
+}
+
+func TestAuditChainHeadLock(t *testing.T) {
+	dB := openTestDB(t)
+
+	for _, username := range []string{"alice", "bob"} {
+		rec := &statements{Interface: gormLogger.Discard}
+		if err := dB.Session(&gorm.Session{Logger: rec}).Create(&model.User{Username: username}).Error; err != nil {
+			t.Fatal(err)
+		}
+
+		// the head is locked before the last entry is read
+		order := []string{"UPDATE `audit_heads`", "FROM `audit_logs` ORDER BY id desc", "INSERT INTO `audit_logs`"}
+		next := 0
+		for _, sql := range rec.sql {
+			if next < len(order) && strings.Contains(sql, order[next]) {
+				next++
+			}
+		}
+		if next != len(order) {
+			t.Fatalf("expected %q in this order, got %q", order, rec.sql)
+		}
+	}
+
+	var head model.AuditHead
+	if err := dB.First(&head, 1).Error; err != nil || head.Seq != 2 {
+		t.Fatalf("expected the head to count 2 entries, got %+v (%v)", head, err)
+	}
+}
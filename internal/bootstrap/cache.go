@@ -0,0 +1,39 @@
+package bootstrap
+
+import (
+	log "github.com/sirupsen/logrus"
+	"go-server-template/internal/conf"
+	"go-server-template/pkg/cache"
+	"go-server-template/pkg/logger"
+	"time"
+)
+
+func InitCache() {
+	var (
+		backend cache.Backend
+		err     error
+	)
+
+	config := conf.Conf.Cache
+	switch config.Backend {
+	case cache.None, "":
+	case cache.Memory:
+		backend = cache.NewMemoryBackend(config.MaxEntries, config.MaxBytes)
+	case cache.Redis:
+		backend, err = cache.NewRedisBackend(cache.RedisConfig{
+			Addr:     config.Redis.Addr,
+			Password: config.Redis.Password,
+			DB:       config.Redis.DB,
+			PoolSize: config.Redis.PoolSize,
+			Timeout:  time.Duration(config.Redis.Timeout) * time.Millisecond,
+		})
+	default:
+		log.Fatalf("not supported cache backend: %s", config.Backend)
+	}
+	if err != nil {
+		log.Fatalf("failed to init cache: %s", err.Error())
+	}
+
+	cache.Init(backend)
+	logger.GetLogger().Infof("cache init success: %s", config.Backend)
+}
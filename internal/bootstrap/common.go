@@ -1,13 +1,37 @@
 package bootstrap
 
 import (
+	"context"
 	"go-server-template/internal/db"
 	"go-server-template/internal/service"
 )
 
 func Init() {
 	InitLog()
+	InitEncryption()
 	InitDB()
+	InitStorage()
+	InitCache()
 
 	service.Init(db.GetDB())
 }
+
+// InitAsync is Init for the http server, which already answers /health with
+// "starting" while the database is connected in the background. The returned
+// channel receives the outcome once.
+func InitAsync(ctx context.Context) <-chan error {
+	InitLog()
+	InitEncryption()
+	InitStorage()
+	InitCache()
+
+	ready := make(chan error, 1)
+	go func() {
+		err := WaitDB(ctx)
+		if err == nil {
+			service.Init(db.GetDB())
+		}
+		ready <- err
+	}()
+	return ready
+}
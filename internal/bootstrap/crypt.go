@@ -0,0 +1,335 @@
+package bootstrap
+
+import (
+	"encoding/base64"
+	"fmt"
+	"go-server-template/internal/conf"
+	"go-server-template/pkg/crypt"
+	"go-server-template/pkg/logger"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+func InitEncryption() {
+	config, err := encryptionFromEnv(conf.Conf.Encryption)
+	if err != nil {
+		log.Fatalf("failed to init encryption: %s", err.Error())
+	}
+	keyring, err := newKeyring(config)
+	if err != nil {
+		log.Fatalf("failed to init encryption: %s", err.Error())
+	}
+
+	crypt.Init(keyring)
+	if keyring == nil {
+		logger.GetLogger().Info("encryption disabled")
+		return
+	}
+	logger.GetLogger().Infof("encryption init success: primary key %s", keyring.Primary())
+}
+
+// encryptionFromEnv overrides the keys of config by the environment, so they
+// can be kept out of the config file: ENCRYPTION_PRIMARY, ENCRYPTION_BLIND_KEY
+// and ENCRYPTION_KEYS, a comma separated list of id=key. Each is also read
+// from the file named by the variable suffixed with _FILE, a mounted secret
+// for instance.
+func encryptionFromEnv(config conf.Encryption) (conf.Encryption, error) {
+	if v, ok, err := lookupSecret("ENCRYPTION_PRIMARY"); err != nil {
+		return config, err
+	} else if ok {
+		config.Primary = v
+	}
+	if v, ok, err := lookupSecret("ENCRYPTION_BLIND_KEY"); err != nil {
+		return config, err
+	} else if ok {
+		config.BlindKey = v
+	}
+
+	v, ok, err := lookupSecret("ENCRYPTION_KEYS")
+	if err != nil || !ok {
+		return config, err
+	}
+	config.Keys = nil
+	for i, pair := range strings.Split(v, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		id, key, found := strings.Cut(pair, "=")
+		if !found {
+			// not quoted, it may be a key
+			return config, fmt.Errorf("ENCRYPTION_KEYS: entry %d is not id=key", i+1)
+		}
+		config.Keys = append(config.Keys, conf.EncryptionKey{ID: id, Key: key})
+	}
+	return config, nil
+}
+
+// lookupSecret returns the variable name, or else the trimmed content of the
+// file named by name_FILE.
+func lookupSecret(name string) (string, bool, error) {
+	if v, ok := os.LookupEnv(name); ok {
+		return v, true, nil
+	}
+	file, ok := os.LookupEnv(name + "_FILE")
+	if !ok {
+		return "", false, nil
+	}
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return "", false, fmt.Errorf("%s_FILE: %w", name, err)
+	}
+	return strings.TrimSpace(string(b)), true, nil
+}
+
+func newKeyring(config conf.Encryption) (*crypt.Keyring, error) {
+	if config.Primary == "" {
+		return nil, nil
+	}
+	keys := make(map[string][]byte, len(config.Keys))
+	for _, k := range config.Keys {
+		key, err := base64.StdEncoding.DecodeString(k.Key)
+		if err != nil {
+			return nil, fmt.Errorf("key %s is not base64: %w", k.ID, err)
+		}
+		keys[k.ID] = key
+	}
+	var blindKey []byte
+	if config.BlindKey != "" {
+		var err error
+		if blindKey, err = base64.StdEncoding.DecodeString(config.BlindKey); err != nil {
+			return nil, fmt.Errorf("blind key is not base64: %w", err)
+		}
+	}
+	return crypt.NewKeyring(config.Primary, keys, blindKey)
+}
+
+const encryptionName = "crypt:encrypt"
+
+// EncryptionPlugin fills the blind index fields, tagged with crypt.BlindTag,
+// from the plaintext of their field on every create and update of it. It
+// also encrypts the values of the encrypted fields written by a map, which
+// gorm passes through without their serializer.
+type EncryptionPlugin struct {
+	fields sync.Map // *schema.Schema -> *cryptFields
+}
+
+type cryptFields struct {
+	encrypted []*schema.Field
+	blind     []crypt.BlindField
+}
+
+func (op *EncryptionPlugin) Name() string {
+	return "encryptionPlugin"
+}
+
+func (op *EncryptionPlugin) Initialize(db *gorm.DB) (err error) {
+	// 写入前, 按明文计算盲索引, 再加密 map 中的字段
+	_ = db.Callback().Create().Before("gorm:create").Register(encryptionName, op.beforeCreate)
+	_ = db.Callback().Update().Before("gorm:update").Register(encryptionName, op.beforeUpdate)
+	return
+}
+
+var _ gorm.Plugin = &EncryptionPlugin{}
+
+func (op *EncryptionPlugin) cryptFields(db *gorm.DB) *cryptFields {
+	if db.Error != nil || db.Statement.Schema == nil {
+		return nil
+	}
+	s := db.Statement.Schema
+	if v, ok := op.fields.Load(s); ok {
+		return v.(*cryptFields)
+	}
+	blind, err := crypt.BlindFields(s)
+	if err != nil {
+		_ = db.AddError(err)
+		return nil
+	}
+	fields := &cryptFields{encrypted: crypt.EncryptedFields(s), blind: blind}
+	if len(fields.encrypted) == 0 && len(fields.blind) == 0 {
+		fields = nil
+	}
+	op.fields.Store(s, fields)
+	return fields
+}
+
+func (op *EncryptionPlugin) beforeCreate(db *gorm.DB) {
+	fields := op.cryptFields(db)
+	if fields == nil {
+		return
+	}
+
+	stmt := db.Statement
+	if values := destMaps(stmt.Dest); values != nil {
+		for _, m := range values {
+			if err := fields.writeMap(stmt, m); err != nil {
+				_ = db.AddError(err)
+				return
+			}
+		}
+		return
+	}
+
+	set := func(rv reflect.Value) {
+		for _, f := range fields.blind {
+			// the field itself, as ValueOf wraps it in its serializer
+			v := f.Source.ReflectValueOf(stmt.Context, rv).Interface()
+			index, err := blindIndex(f.Source, v)
+			if err != nil {
+				_ = db.AddError(err)
+				return
+			}
+			_ = db.AddError(f.Index.Set(stmt.Context, rv, index))
+		}
+	}
+
+	rv := reflect.Indirect(stmt.ReflectValue)
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			set(reflect.Indirect(rv.Index(i)))
+		}
+	case reflect.Struct:
+		set(rv)
+	}
+}
+
+func (op *EncryptionPlugin) beforeUpdate(db *gorm.DB) {
+	fields := op.cryptFields(db)
+	if fields == nil {
+		return
+	}
+
+	stmt := db.Statement
+	selects, restricted := stmt.SelectAndOmitColumns(false, true)
+	selectIndex := func(f crypt.BlindField) {
+		if restricted && !selects[f.Index.DBName] {
+			stmt.Selects = append(stmt.Selects, f.Index.DBName)
+		}
+	}
+
+	if values := destMaps(stmt.Dest); values != nil {
+		for _, m := range values {
+			if err := fields.writeMap(stmt, m); err != nil {
+				_ = db.AddError(err)
+				return
+			}
+		}
+		for _, f := range fields.blind {
+			if _, ok := values[0][f.Index.DBName]; ok {
+				selectIndex(f)
+			}
+		}
+		return
+	}
+
+	dest := reflect.Indirect(reflect.ValueOf(stmt.Dest))
+	if dest.Kind() != reflect.Struct || dest.Type() != stmt.Schema.ModelType {
+		return
+	}
+	for _, f := range fields.blind {
+		fv := f.Source.ReflectValueOf(stmt.Context, dest)
+		selected, ok := selects[f.Source.DBName]
+		if !(ok && selected) && (ok || restricted || fv.IsZero()) {
+			continue
+		}
+
+		index, err := blindIndex(f.Source, fv.Interface())
+		if err != nil {
+			_ = db.AddError(err)
+			return
+		}
+		stmt.SetColumn(f.Index.DBName, index, true)
+		selectIndex(f)
+	}
+}
+
+// writeMap sets the blind indexes of the fields of m, then encrypts them.
+func (fields *cryptFields) writeMap(stmt *gorm.Statement, m map[string]interface{}) error {
+	lookup := func(f *schema.Field) (string, interface{}, bool) {
+		if v, ok := m[f.DBName]; ok {
+			return f.DBName, v, true
+		}
+		v, ok := m[f.Name]
+		return f.Name, v, ok
+	}
+
+	for _, f := range fields.blind {
+		_, v, ok := lookup(f.Source)
+		if !ok {
+			continue
+		}
+		index, err := blindIndex(f.Source, v)
+		if err != nil {
+			return err
+		}
+		delete(m, f.Index.Name)
+		m[f.Index.DBName] = index
+	}
+
+	for _, f := range fields.encrypted {
+		key, v, ok := lookup(f)
+		if !ok {
+			continue
+		}
+		if s, isString := v.(string); isString && crypt.IsEncrypted(s) {
+			continue
+		}
+		if _, isExpr := v.(clause.Expression); isExpr {
+			continue
+		}
+		sealed, err := crypt.Serializer{}.Value(stmt.Context, f, reflect.Value{}, v)
+		if err != nil {
+			return err
+		}
+		m[key] = sealed
+	}
+	return nil
+}
+
+// destMaps returns the maps of a create or update by map, nil for a struct.
+func destMaps(dest interface{}) []map[string]interface{} {
+	switch dest := dest.(type) {
+	case map[string]interface{}:
+		return []map[string]interface{}{dest}
+	case *map[string]interface{}:
+		return []map[string]interface{}{*dest}
+	case []map[string]interface{}:
+		if len(dest) == 0 {
+			return nil
+		}
+		return dest
+	case *[]map[string]interface{}:
+		return destMaps(*dest)
+	}
+	return nil
+}
+
+// blindIndex returns the blind index of the value v of source, empty for an
+// empty value.
+func blindIndex(source *schema.Field, v interface{}) (string, error) {
+	var value string
+	switch v := v.(type) {
+	case string:
+		value = v
+	case *string:
+		if v != nil {
+			value = *v
+		}
+	case []byte:
+		value = string(v)
+	case nil:
+	default:
+		return "", fmt.Errorf("blind index of %s: unsupported type %T", source.Name, v)
+	}
+	if value == "" {
+		return "", nil
+	}
+	return crypt.BlindIndex(source.DBName, value)
+}
@@ -0,0 +1,216 @@
+package bootstrap
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"go-server-template/internal/conf"
+	"go-server-template/internal/db"
+	"go-server-template/pkg/crypt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+type contact struct {
+	ID         uint
+	Name       string
+	Phone      string `gorm:"serializer:encrypted"`
+	PhoneIndex string `gorm:"index" blind:"Phone"`
+}
+
+func testKeyring(t *testing.T, primary string, ids ...string) {
+	config := conf.Encryption{Primary: primary, BlindKey: base64.StdEncoding.EncodeToString([]byte("blind"))}
+	for _, id := range ids {
+		key := bytes.Repeat([]byte(id[len(id)-1:]), 32)
+		config.Keys = append(config.Keys, conf.EncryptionKey{ID: id, Key: base64.StdEncoding.EncodeToString(key)})
+	}
+	k, err := newKeyring(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	crypt.Init(k)
+	t.Cleanup(func() { crypt.Init(nil) })
+}
+
+func phoneIndex(t *testing.T, phone string) string {
+	index, err := crypt.BlindIndex("phone", phone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return index
+}
+
+func findByPhone(t *testing.T, phone string) []contact {
+	var contacts []contact
+	if err := db.GetDB().Where("phone_index = ?", phoneIndex(t, phone)).Order("id").Find(&contacts).Error; err != nil {
+		t.Fatal(err)
+	}
+	return contacts
+}
+
+func rawPhones(t *testing.T) map[uint]string {
+	var rows []struct {
+		ID    uint
+		Phone string
+	}
+	if err := db.GetDB().Table("contacts").Order("id").Find(&rows).Error; err != nil {
+		t.Fatal(err)
+	}
+	phones := make(map[uint]string, len(rows))
+	for _, r := range rows {
+		phones[r.ID] = r.Phone
+	}
+	return phones
+}
+
+func TestNewKeyring(t *testing.T) {
+	if k, err := newKeyring(conf.Encryption{}); k != nil || err != nil {
+		t.Fatalf("expected the encryption to be disabled, got %v (%v)", k, err)
+	}
+	if _, err := newKeyring(conf.Encryption{Primary: "k1", Keys: []conf.EncryptionKey{{ID: "k1", Key: "not base64"}}}); err == nil {
+		t.Fatal("expected the invalid key to be refused")
+	}
+}
+
+func TestEncryptionFromEnv(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "keys")
+	if err := os.WriteFile(file, []byte("k1=a2V5MQ==, k2=a2V5Mg==\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("ENCRYPTION_PRIMARY", "k2")
+	t.Setenv("ENCRYPTION_KEYS_FILE", file)
+
+	config, err := encryptionFromEnv(conf.Encryption{Primary: "k1", BlindKey: "blind", Keys: []conf.EncryptionKey{{ID: "k1", Key: "old"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []conf.EncryptionKey{{ID: "k1", Key: "a2V5MQ=="}, {ID: "k2", Key: "a2V5Mg=="}}
+	if config.Primary != "k2" || config.BlindKey != "blind" || !reflect.DeepEqual(config.Keys, want) {
+		t.Fatalf("unexpected config %+v", config)
+	}
+
+	t.Setenv("ENCRYPTION_KEYS", "k1")
+	if _, err = encryptionFromEnv(conf.Encryption{}); err == nil {
+		t.Fatal("expected the key without id to be refused")
+	}
+}
+
+func TestEncryptionPlugin(t *testing.T) {
+	dB := openTestDB(t)
+	_ = dB.Use(&EncryptionPlugin{})
+	if err := dB.AutoMigrate(new(contact)); err != nil {
+		t.Fatal(err)
+	}
+	testKeyring(t, "k1", "k1")
+
+	alice := &contact{Name: "alice", Phone: "0601"}
+	if err := dB.Create(alice).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := dB.Create([]*contact{{Name: "bob", Phone: "0602"}, {Name: "carol"}}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if got := findByPhone(t, "0601"); len(got) != 1 || got[0].Name != "alice" || got[0].Phone != "0601" {
+		t.Fatalf("expected alice by her phone, got %+v", got)
+	}
+	if !crypt.IsEncrypted(rawPhones(t)[alice.ID]) {
+		t.Fatal("expected the phone to be stored encrypted")
+	}
+	if err := dB.Model(&contact{}).Create(map[string]interface{}{"Name": "dave", "Phone": "0603"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if got := findByPhone(t, "0603"); len(got) != 1 || got[0].Name != "dave" || !crypt.IsEncrypted(rawPhones(t)[got[0].ID]) {
+		t.Fatalf("expected dave created by map with an encrypted phone, got %+v", got)
+	}
+
+	// by column, by map and by struct with Select
+	if err := dB.Model(alice).Update("phone", "0611").Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(findByPhone(t, "0611")) != 1 || len(findByPhone(t, "0601")) != 0 || !crypt.IsEncrypted(rawPhones(t)[alice.ID]) {
+		t.Fatal("expected the index to follow the updated encrypted phone")
+	}
+	if err := dB.Model(&contact{}).Where("name = ?", "bob").Updates(map[string]interface{}{"Phone": "0612"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if got := findByPhone(t, "0612"); len(got) != 1 || got[0].Name != "bob" || !crypt.IsEncrypted(rawPhones(t)[got[0].ID]) {
+		t.Fatalf("expected bob by his new encrypted phone, got %+v", got)
+	}
+	if err := dB.Model(alice).Select("phone").Updates(&contact{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	var cleared contact
+	dB.First(&cleared, alice.ID)
+	if cleared.Phone != "" || cleared.PhoneIndex != "" {
+		t.Fatalf("expected the phone and its index to be cleared, got %+v", cleared)
+	}
+
+	// the index is left alone when the phone is not written
+	if err := dB.Model(&contact{}).Where("name = ?", "bob").Updates(&contact{Name: "robert"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if got := findByPhone(t, "0612"); len(got) != 1 || got[0].Name != "robert" {
+		t.Fatalf("expected robert by his phone, got %+v", got)
+	}
+}
+
+func TestReencrypt(t *testing.T) {
+	dB := openTestDB(t)
+	_ = dB.Use(&EncryptionPlugin{})
+	if err := dB.AutoMigrate(new(contact)); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if _, err := db.Reencrypt(ctx, 2, false, new(contact)); err != crypt.ErrNotConfigured {
+		t.Fatalf("expected the encryption to be required, got %v", err)
+	}
+
+	testKeyring(t, "k1", "k1")
+	for _, phone := range []string{"0601", "0602", ""} {
+		if err := dB.Create(&contact{Phone: phone}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	// written in plaintext before the column was encrypted
+	dB.Exec("INSERT INTO contacts (id, phone) VALUES (4, '0604')")
+
+	testKeyring(t, "k2", "k1", "k2")
+	stats, err := db.Reencrypt(ctx, 2, true, Tables()...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Tables != 0 {
+		t.Fatalf("expected no encrypted table in the models, got %+v", stats)
+	}
+	stats, err = db.Reencrypt(ctx, 2, true, new(contact))
+	if err != nil || stats.Rows != 4 || stats.Values != 3 || stats.Indexes != 1 {
+		t.Fatalf("unexpected dry run %+v (%v)", stats, err)
+	}
+	if id, _ := crypt.KeyID(rawPhones(t)[1]); id != "k1" {
+		t.Fatal("expected the dry run to write nothing")
+	}
+
+	stats, err = db.Reencrypt(ctx, 2, false, new(contact))
+	if err != nil || stats.Values != 3 || stats.Indexes != 1 || stats.Conflicts != 0 {
+		t.Fatalf("unexpected reencrypt %+v (%v)", stats, err)
+	}
+	for id, phone := range rawPhones(t) {
+		if key, _ := crypt.KeyID(phone); (id == 3) != (key == "") || (id != 3 && key != "k2") {
+			t.Fatalf("expected %d to be encrypted under k2, got %s", id, phone)
+		}
+	}
+	if got := findByPhone(t, "0604"); len(got) != 1 || got[0].Phone != "0604" {
+		t.Fatalf("expected the plaintext phone to be indexed, got %+v", got)
+	}
+
+	// without k1, nothing is left to decrypt with it
+	testKeyring(t, "k2", "k2")
+	if stats, err = db.Reencrypt(ctx, 2, false, new(contact)); err != nil || stats.Values != 0 || stats.Indexes != 0 {
+		t.Fatalf("expected nothing left to re-encrypt, got %+v (%v)", stats, err)
+	}
+	if got := findByPhone(t, "0602"); len(got) != 1 || got[0].Phone != "0602" {
+		t.Fatalf("expected the phone to be read under k2, got %+v", got)
+	}
+}
@@ -1,95 +1,242 @@
 package bootstrap
 
 import (
+	"context"
+	"database/sql"
 	"fmt"
 	log "github.com/sirupsen/logrus"
 	"go-server-template/internal/conf"
 	"go-server-template/internal/db"
+	"go-server-template/internal/db/dialect"
+	"go-server-template/internal/flags"
+	"go-server-template/internal/lock"
 	"go-server-template/internal/model"
+	"go-server-template/internal/search"
+	"go-server-template/internal/setting"
 	"go-server-template/pkg/logger"
-	stdlog "log"
+	"go-server-template/pkg/retry"
 	"strings"
 	"time"
 
-	"gorm.io/driver/mysql"
-	"gorm.io/driver/postgres"
-	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 	gormLogger "gorm.io/gorm/logger"
 )
 
+// InitDB connects to the database, retrying as configured by
+// conf.Database.Retry, and exits when it stays unreachable.
 func InitDB() {
-	var (
-		dB       *gorm.DB
-		err      error
-		logLevel gormLogger.LogLevel
-	)
+	if err := WaitDB(context.Background()); err != nil {
+		log.Fatalf("failed to connect database: %s", err.Error())
+	}
+}
 
+// WaitDB connects to the database with exponential backoff until a ping
+// succeeds, then migrates the tables and marks the database ready.
+func WaitDB(ctx context.Context) error {
 	config := conf.Conf
 
-	if config.Env == conf.Dev {
-		logLevel = gormLogger.Info
-	} else {
-		logLevel = gormLogger.Silent
+	gormLog, err := NewGormLogger(logger.GetLogger(), config.Database.Log, config.Env)
+	if err != nil {
+		return err
 	}
 
-	gormLog := gormLogger.New(
-		stdlog.New(stdlog.Writer(), "\r\n", stdlog.LstdFlags),
-		gormLogger.Config{
-			SlowThreshold:             200 * time.Millisecond, // 慢查询阈值
-			LogLevel:                  logLevel,               // 日志等级
-			IgnoreRecordNotFoundError: false,                  // 忽略RecordNotFound错误
-			Colorful:                  true,                   // 显示彩色
-		},
-	)
-
 	gormConfig := &gorm.Config{
-		Logger: gormLog,
+		Logger:               gormLog,
+		DisableAutomaticPing: true,
 	}
 
 	database := config.Database
-	switch database.Type {
-	case "sqlite3":
-		if !(strings.HasSuffix(database.File, ".db") && len(database.File) > 3) {
-			log.Fatalf("db name error.")
+	backoff := retry.Backoff{
+		Initial: time.Duration(database.Retry.InitialInterval) * time.Millisecond,
+		Max:     time.Duration(database.Retry.MaxInterval) * time.Millisecond,
+		Jitter:  true,
+	}
+
+	var dB *gorm.DB
+	for attempt := 1; ; attempt++ {
+		if dB, err = connect(ctx, database, gormConfig); err == nil {
+			break
+		}
+		if database.Retry.Attempts > 0 && attempt >= database.Retry.Attempts {
+			return fmt.Errorf("giving up after %d attempts: %w", attempt, err)
+		}
+
+		wait := backoff.Wait(attempt)
+		logger.GetLogger().Warnf("database is not ready (attempt %d): %s, retrying in %s", attempt, err.Error(), wait)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
 		}
-		dB, err = gorm.Open(sqlite.Open(fmt.Sprintf("%s?_journal=WAL&_vacuum=incremental",
-			database.File)), gormConfig)
-	case "mysql":
-		dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?charset=utf8mb4&parseTime=True&loc=Local&tls=%s",
-			database.User, database.Password, database.Host, database.Port, database.Name, database.SSLMode)
-		dB, err = gorm.Open(mysql.Open(dsn), gormConfig)
-	case "postgres":
-		dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%d sslmode=%s TimeZone=Asia/Shanghai",
-			database.Host, database.User, database.Password, database.Name, database.Port, database.SSLMode)
-		dB, err = gorm.Open(postgres.Open(dsn), gormConfig)
-	default:
-		log.Fatalf("not supported database type: %s", database.Type)
 	}
-	if err != nil {
-		log.Fatalf("failed to connect database: %s", err.Error())
+
+	if len(database.Replicas) > 0 {
+		resolver, err := newResolver(database, gormConfig)
+		if err != nil {
+			return fmt.Errorf("failed to connect database replicas: %w", err)
+		}
+		_ = dB.Use(resolver)
+		db.OnClose(resolver.Close)
+		go resolver.Watch(context.Background(), time.Duration(database.ReplicaCheckInterval)*time.Second)
 	}
 
 	_ = dB.Use(&TracePlugin{})
+	if (config.Env == conf.Dev || database.Log.Explain) && database.Log.SlowThreshold > 0 {
+		side, err := openSide(database)
+		if err != nil {
+			return fmt.Errorf("failed to open explain connection: %w", err)
+		}
+		db.OnClose(side.Close)
+		_ = dB.Use(&ExplainPlugin{
+			Side:      side,
+			Threshold: time.Duration(database.Log.SlowThreshold) * time.Millisecond,
+		})
+	}
+	_ = dB.Use(&ActorPlugin{})
+	_ = dB.Use(&AuditPlugin{})
+	_ = dB.Use(&SearchPlugin{})
+	_ = dB.Use(&EncryptionPlugin{})
 
 	db.InitDB(dB)
-	registerTables()
+	db.SetCursorSecret(conf.Conf.JWT.Secret)
+	if err = registerTables(); err != nil {
+		return err
+	}
+	if err = lock.Init(config.Lock); err != nil {
+		return err
+	}
+	setting.Init(config.Settings)
+	if err = flags.Init(config.Flags); err != nil {
+		return err
+	}
+	db.SetReady(true)
+	return nil
+}
+
+// connect opens the primary database and pings it.
+func connect(ctx context.Context, database conf.Database, gormConfig *gorm.Config) (*gorm.DB, error) {
+	dialector, err := dialect.Open(database)
+	if err != nil {
+		return nil, err
+	}
+	dB, err := gorm.Open(dialector, gormConfig)
+	if err != nil {
+		return nil, err
+	}
+	if err = configurePool(dB, database.Pool); err != nil {
+		return nil, err
+	}
+
+	sqlDB, err := dB.DB()
+	if err != nil {
+		return nil, err
+	}
+	if err = sqlDB.PingContext(ctx); err != nil {
+		_ = sqlDB.Close()
+		return nil, err
+	}
+	return dB, nil
 }
 
-func registerTables() {
-	err := AutoMigrate(new(model.User))
+// openSide opens a single connection pool to the primary without any plugin,
+// for work that must not run on the connection of the statement it is about.
+func openSide(database conf.Database) (*sql.DB, error) {
+	dialector, err := dialect.Open(database)
 	if err != nil {
-		log.Fatalf("failed migrate database: %s", err.Error())
+		return nil, err
+	}
+	side, err := gorm.Open(dialector, &gorm.Config{Logger: gormLogger.Discard, DisableAutomaticPing: true})
+	if err != nil {
+		return nil, err
+	}
+	sqlDB, err := side.DB()
+	if err != nil {
+		return nil, err
+	}
+	sqlDB.SetMaxOpenConns(1)
+	return sqlDB, nil
+}
+
+// newResolver connects to the replicas of database. A replica that cannot be
+// reached yet starts ejected and is brought back by Resolver.Watch.
+func newResolver(database conf.Database, gormConfig *gorm.Config) (*Resolver, error) {
+	replicas := make([]*Replica, 0, len(database.Replicas))
+	for i, r := range database.Replicas {
+		dialector, err := dialect.Open(database.Replica(r))
+		if err != nil {
+			return nil, err
+		}
+		replicaDB, err := gorm.Open(dialector, &gorm.Config{Logger: gormConfig.Logger, DisableAutomaticPing: true})
+		if err != nil {
+			return nil, err
+		}
+		if err = configurePool(replicaDB, database.Pool); err != nil {
+			return nil, err
+		}
+		sqlDB, err := replicaDB.DB()
+		if err != nil {
+			return nil, err
+		}
+		replicas = append(replicas, NewReplica(fmt.Sprintf("replica-%d", i), sqlDB))
+	}
+
+	resolver, err := NewResolver(database.ReplicaPolicy, replicas...)
+	if err != nil {
+		return nil, err
+	}
+	resolver.Check(context.Background())
+	return resolver, nil
+}
+
+func configurePool(dB *gorm.DB, pool conf.DatabasePool) error {
+	sqlDB, err := dB.DB()
+	if err != nil {
+		return err
+	}
+	sqlDB.SetMaxOpenConns(pool.MaxOpenConns)
+	sqlDB.SetMaxIdleConns(pool.MaxIdleConns)
+	sqlDB.SetConnMaxLifetime(time.Duration(pool.ConnMaxLifetime) * time.Second)
+	sqlDB.SetConnMaxIdleTime(time.Duration(pool.ConnMaxIdleTime) * time.Second)
+	return nil
+}
+
+// Tables returns the models of the tables migrated at startup.
+func Tables() []interface{} {
+	return []interface{}{
+		new(model.User), new(model.AuditLog), new(model.AuditHead), new(model.File),
+		new(model.OutboxEvent), new(model.Job), new(model.Lease), new(model.ScheduledTask),
+		new(model.Setting), new(model.SettingChange), new(model.FeatureFlag),
+	}
+}
+
+func registerTables() error {
+	err := AutoMigrate(Tables()...)
+	if err != nil {
+		return fmt.Errorf("failed migrate database: %w", err)
+	}
+	if err = search.Migrate(db.GetDB(), new(model.User)); err != nil {
+		return err
+	}
+
+	if err = db.BackfillPublicIDs(context.Background(), new(model.User)); err != nil {
+		return fmt.Errorf("failed to backfill public ids: %w", err)
 	}
 	logger.GetLogger().Info("register table success")
+	return nil
 }
 
+// AutoMigrate creates or updates the tables of dist. The tables of mysql are
+// created with InnoDB, whose row locks the jobs and the leases rely on, in
+// the charset of the connection.
 func AutoMigrate(dist ...interface{}) error {
-	var err error
-	if conf.Conf.Database.Type == "mysql" {
-		// TODO ...
-	} else {
-		err = db.GetDB().AutoMigrate(dist...)
+	tx := db.GetDB()
+	if tx.Dialector.Name() == "mysql" {
+		charset := "utf8mb4"
+		if conf.Conf.Database.Charset != "" {
+			// the driver accepts a list of fallbacks, the first one is preferred
+			charset = strings.Split(conf.Conf.Database.Charset, ",")[0]
+		}
+		tx = tx.Set("gorm:table_options", "ENGINE=InnoDB DEFAULT CHARSET="+charset)
 	}
-	return err
+	return tx.AutoMigrate(dist...)
 }
@@ -0,0 +1,176 @@
+package bootstrap
+
+import (
+	stdctx "context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"go-server-template/pkg/context"
+	"go-server-template/pkg/logger"
+	"go-server-template/pkg/trace"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	explainBeforeName = "explain:before"
+	explainAfterName  = "explain:after"
+	explainStart      = "_explain_start"
+
+	explainTimeout = 3 * time.Second
+)
+
+// ExplainPlugin re-runs slow statements as EXPLAIN on a side connection, so
+// neither the statement's transaction nor its pool is used, and attaches the
+// plan to the statement's trace.SQL entry and the log. It never uses
+// EXPLAIN ANALYZE, so writes are planned but never executed twice.
+type ExplainPlugin struct {
+	// Side is the connection pool EXPLAIN runs on.
+	Side *sql.DB
+	// Threshold is the duration above which a statement is explained.
+	Threshold time.Duration
+}
+
+func (op *ExplainPlugin) Name() string {
+	return "explainPlugin"
+}
+
+func (op *ExplainPlugin) Initialize(db *gorm.DB) (err error) {
+	_ = db.Callback().Create().Before("gorm:before_create").Register(explainBeforeName, explainBefore)
+	_ = db.Callback().Query().Before("gorm:query").Register(explainBeforeName, explainBefore)
+	_ = db.Callback().Delete().Before("gorm:before_delete").Register(explainBeforeName, explainBefore)
+	_ = db.Callback().Update().Before("gorm:setup_reflect_value").Register(explainBeforeName, explainBefore)
+	_ = db.Callback().Row().Before("gorm:row").Register(explainBeforeName, explainBefore)
+	_ = db.Callback().Raw().Before("gorm:raw").Register(explainBeforeName, explainBefore)
+
+	// after the trace plugin, which records the trace.SQL entry
+	_ = db.Callback().Create().After(callBackAfterName).Register(explainAfterName, op.after)
+	_ = db.Callback().Query().After(callBackAfterName).Register(explainAfterName, op.after)
+	_ = db.Callback().Delete().After(callBackAfterName).Register(explainAfterName, op.after)
+	_ = db.Callback().Update().After(callBackAfterName).Register(explainAfterName, op.after)
+	_ = db.Callback().Row().After(callBackAfterName).Register(explainAfterName, op.after)
+	_ = db.Callback().Raw().After(callBackAfterName).Register(explainAfterName, op.after)
+	return
+}
+
+var _ gorm.Plugin = &ExplainPlugin{}
+
+func explainBefore(db *gorm.DB) {
+	db.InstanceSet(explainStart, time.Now())
+}
+
+func (op *ExplainPlugin) after(db *gorm.DB) {
+	if db.Error != nil || op.Side == nil || op.Threshold <= 0 {
+		return
+	}
+	v, ok := db.InstanceGet(explainStart)
+	if !ok {
+		return
+	}
+	if elapsed := time.Since(v.(time.Time)); elapsed < op.Threshold {
+		return
+	}
+
+	query := db.Statement.SQL.String()
+	if !explainable(query) {
+		return
+	}
+
+	plan, err := op.explain(db.Dialector.Name(), query, db.Statement.Vars)
+
+	log := logger.GetLogger().WithField("sql", db.Dialector.Explain(query, db.Statement.Vars...))
+	if traceID := context.TraceIDFrom(db.Statement.Context); traceID != "" {
+		log = log.WithField("trace_id", traceID)
+	}
+	if err != nil {
+		log.WithField("error", err.Error()).Warn("failed to explain slow sql")
+		return
+	}
+	if plan == "" {
+		return
+	}
+	log.WithField("plan", plan).Warn("slow sql plan")
+
+	if v, ok := db.InstanceGet(traceSQL); ok {
+		v.(*trace.SQL).Plan = plan
+	}
+}
+
+func (op *ExplainPlugin) explain(dialect, query string, vars []interface{}) (string, error) {
+	// not bound to the statement's context, which may be done already
+	ctx, cancel := stdctx.WithTimeout(stdctx.Background(), explainTimeout)
+	defer cancel()
+
+	rows, err := op.Side.QueryContext(ctx, explainPrefix(dialect)+query, vars...)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return "", err
+	}
+
+	var result []map[string]interface{}
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		pointers := make([]interface{}, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err = rows.Scan(pointers...); err != nil {
+			return "", err
+		}
+
+		row := make(map[string]interface{}, len(columns))
+		for i, column := range columns {
+			if b, ok := values[i].([]byte); ok {
+				values[i] = string(b)
+			}
+			row[column] = values[i]
+		}
+		result = append(result, row)
+	}
+	if err = rows.Err(); err != nil {
+		return "", err
+	}
+
+	// sqlite has nothing to plan for a plain insert
+	if len(result) == 0 {
+		return "", nil
+	}
+	// postgres returns its JSON plan as a single value
+	if len(result) == 1 && len(columns) == 1 {
+		return fmt.Sprint(result[0][columns[0]]), nil
+	}
+	b, err := json.Marshal(result)
+	return string(b), err
+}
+
+func explainPrefix(dialect string) string {
+	switch dialect {
+	case "sqlite":
+		return "EXPLAIN QUERY PLAN "
+	case "postgres":
+		return "EXPLAIN (FORMAT JSON) "
+	default:
+		return "EXPLAIN "
+	}
+}
+
+// explainable reports whether query is a plain DML statement, other
+// statements like DDL or pragmas are never explained.
+func explainable(query string) bool {
+	fields := strings.Fields(query)
+	if len(fields) == 0 {
+		return false
+	}
+	switch strings.ToUpper(fields[0]) {
+	case "SELECT", "INSERT", "UPDATE", "DELETE", "WITH":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,80 @@
+package bootstrap
+
+import (
+	"go-server-template/internal/conf"
+	"go-server-template/internal/model"
+	"go-server-template/pkg/logger"
+	"go-server-template/pkg/trace"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	gormLogger "gorm.io/gorm/logger"
+)
+
+func TestExplainPlugin(t *testing.T) {
+	logger.Init("zap")
+	file := filepath.Join(t.TempDir(), "explain.db")
+
+	dB, err := gorm.Open(sqlite.Open(file), &gorm.Config{Logger: gormLogger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = dB.AutoMigrate(new(model.User)); err != nil {
+		t.Fatal(err)
+	}
+
+	side, err := openSide(conf.Database{Type: "sqlite3", File: file})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer side.Close()
+
+	_ = dB.Use(&TracePlugin{})
+	_ = dB.Use(&ExplainPlugin{Side: side, Threshold: time.Nanosecond})
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	tr := trace.New("")
+	c.Set(trace.Header, tr)
+
+	if err = dB.WithContext(c).Create(&model.User{Username: "alice"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	var users []model.User
+	if err = dB.WithContext(c).Where("username = ?", "alice").Find(&users).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if len(tr.SQLs) != 2 {
+		t.Fatalf("expected 2 traced statements, got %d", len(tr.SQLs))
+	}
+	if plan := tr.SQLs[1].Plan; !strings.Contains(plan, "users") {
+		t.Errorf("unexpected query plan: %s", plan)
+	}
+
+	// explaining the insert must not have executed it again
+	var count int64
+	if err = dB.Model(new(model.User)).Count(&count).Error; err != nil || count != 1 {
+		t.Fatalf("expected 1 user, got %d (%v)", count, err)
+	}
+}
+
+func TestExplainPrefix(t *testing.T) {
+	for dialect, want := range map[string]string{
+		"sqlite":   "EXPLAIN QUERY PLAN ",
+		"postgres": "EXPLAIN (FORMAT JSON) ",
+		"mysql":    "EXPLAIN ",
+	} {
+		if got := explainPrefix(dialect); got != want {
+			t.Errorf("%s: got %q, want %q", dialect, got, want)
+		}
+	}
+	if explainable("CREATE TABLE t (id int)") || explainable("PRAGMA foreign_keys") || !explainable(" select 1") {
+		t.Error("only DML statements should be explained")
+	}
+}
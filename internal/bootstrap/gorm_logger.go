@@ -0,0 +1,145 @@
+package bootstrap
+
+import (
+	stdctx "context"
+	"errors"
+	"fmt"
+	"go-server-template/internal/conf"
+	"go-server-template/pkg/context"
+	"go-server-template/pkg/logger"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	gormLogger "gorm.io/gorm/logger"
+)
+
+// GormLogger writes the GORM log through pkg/logger, so SQL logs share the
+// encoding and the file rotation of the application log. Every line carries
+// the trace_id of the request the statement ran for.
+type GormLogger struct {
+	log                  logger.Logger
+	level                gormLogger.LogLevel
+	slowThreshold        time.Duration
+	ignoreRecordNotFound bool
+}
+
+var _ gormLogger.Interface = (*GormLogger)(nil)
+
+// NewGormLogger returns a GORM logger over log configured by cfg. An empty
+// level logs every statement in dev and only slow ones and errors otherwise,
+// outside of dev the SQL log used to be silent: set "silent" to keep it so.
+func NewGormLogger(log logger.Logger, cfg conf.DatabaseLog, env conf.EnvMode) (*GormLogger, error) {
+	level, err := parseGormLogLevel(cfg.Level, env)
+	if err != nil {
+		return nil, err
+	}
+	return &GormLogger{
+		log:                  log,
+		level:                level,
+		slowThreshold:        time.Duration(cfg.SlowThreshold) * time.Millisecond,
+		ignoreRecordNotFound: cfg.IgnoreRecordNotFound,
+	}, nil
+}
+
+func parseGormLogLevel(level string, env conf.EnvMode) (gormLogger.LogLevel, error) {
+	switch level {
+	case "":
+		if env == conf.Dev {
+			return gormLogger.Info, nil
+		}
+		return gormLogger.Warn, nil
+	case "silent":
+		return gormLogger.Silent, nil
+	case "error":
+		return gormLogger.Error, nil
+	case "warn":
+		return gormLogger.Warn, nil
+	case "info":
+		return gormLogger.Info, nil
+	default:
+		return 0, fmt.Errorf("not supported database log level: %s", level)
+	}
+}
+
+func (l *GormLogger) LogMode(level gormLogger.LogLevel) gormLogger.Interface {
+	clone := *l
+	clone.level = level
+	return &clone
+}
+
+func (l *GormLogger) Info(ctx stdctx.Context, msg string, data ...interface{}) {
+	if l.level >= gormLogger.Info {
+		l.with(ctx).Infof(msg, data...)
+	}
+}
+
+func (l *GormLogger) Warn(ctx stdctx.Context, msg string, data ...interface{}) {
+	if l.level >= gormLogger.Warn {
+		l.with(ctx).Warnf(msg, data...)
+	}
+}
+
+func (l *GormLogger) Error(ctx stdctx.Context, msg string, data ...interface{}) {
+	if l.level >= gormLogger.Error {
+		l.with(ctx).Errorf(msg, data...)
+	}
+}
+
+func (l *GormLogger) Trace(ctx stdctx.Context, begin time.Time, fc func() (sql string, rowsAffected int64), err error) {
+	if l.level <= gormLogger.Silent {
+		return
+	}
+
+	elapsed := time.Since(begin)
+	switch {
+	case err != nil && l.level >= gormLogger.Error && !(l.ignoreRecordNotFound && errors.Is(err, gorm.ErrRecordNotFound)):
+		sql, rows := fc()
+		l.with(ctx).WithFields(l.fields(sql, rows, elapsed)).
+			WithField("error", err.Error()).
+			Error("sql error")
+	case l.slowThreshold > 0 && elapsed > l.slowThreshold && l.level >= gormLogger.Warn:
+		sql, rows := fc()
+		l.with(ctx).WithFields(l.fields(sql, rows, elapsed)).
+			WithField("threshold_ms", l.slowThreshold.Milliseconds()).
+			Warn("slow sql")
+	case l.level >= gormLogger.Info:
+		sql, rows := fc()
+		l.with(ctx).WithFields(l.fields(sql, rows, elapsed)).Info("sql")
+	}
+}
+
+func (l *GormLogger) with(ctx stdctx.Context) logger.Logger {
+	if traceID := context.TraceIDFrom(ctx); traceID != "" {
+		return l.log.WithField("trace_id", traceID)
+	}
+	return l.log
+}
+
+func (l *GormLogger) fields(sql string, rows int64, elapsed time.Duration) logger.Fields {
+	return logger.Fields{
+		"sql":        sql,
+		"rows":       rows,
+		"elapsed_ms": float64(elapsed.Microseconds()) / 1000,
+		"sql_caller": sqlCaller(),
+	}
+}
+
+// sqlCaller returns the call site of the statement, the first frame out of
+// this file and of gorm. utils.FileWithLineNum only skips gorm and would
+// return this file.
+func sqlCaller() string {
+	pcs := [16]uintptr{}
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(2, pcs[:])])
+	for {
+		frame, more := frames.Next()
+		if !strings.HasSuffix(frame.File, "/gorm_logger.go") && !strings.Contains(frame.File, "gorm.io/") {
+			return frame.File + ":" + strconv.Itoa(frame.Line)
+		}
+		if !more {
+			return ""
+		}
+	}
+}
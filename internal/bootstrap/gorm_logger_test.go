@@ -0,0 +1,73 @@
+package bootstrap
+
+import (
+	"bufio"
+	stdctx "context"
+	"encoding/json"
+	"errors"
+	"go-server-template/internal/conf"
+	"go-server-template/pkg/logger"
+	"go-server-template/pkg/trace"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func TestGormLogger(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "sql.log")
+	log := logger.Init("zap", logger.WithFileP(file), logger.WithDisableConsole(), logger.WithEncodingJson())
+
+	l, err := NewGormLogger(log, conf.DatabaseLog{Level: "warn", SlowThreshold: 10, IgnoreRecordNotFound: true}, conf.Dev)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Set(trace.Header, trace.New("trace-1"))
+
+	fc := func() (string, int64) { return "SELECT 1", 1 }
+	now := time.Now()
+	l.Trace(c, now, fc, nil)                                    // fast, below warn
+	l.Trace(c, now.Add(-50*time.Millisecond), fc, nil)          // slow
+	l.Trace(stdctx.Background(), now, fc, errors.New("broken")) // error without request
+	l.Trace(c, now, fc, gorm.ErrRecordNotFound)                 // ignored
+
+	f, err := os.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var lines []map[string]interface{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := make(map[string]interface{})
+		if err = json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, line)
+	}
+
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got %d: %v", len(lines), lines)
+	}
+	if slow := lines[0]; slow["level"] != "warn" || slow["trace_id"] != "trace-1" || slow["sql"] != "SELECT 1" {
+		t.Errorf("unexpected slow query line: %v", slow)
+	}
+	if caller, _ := lines[0]["sql_caller"].(string); !strings.Contains(caller, "/gorm_logger_test.go:") {
+		t.Errorf("expected the test to be the caller, got %q", caller)
+	}
+	if failed := lines[1]; failed["level"] != "error" || failed["error"] != "broken" || failed["trace_id"] != nil {
+		t.Errorf("unexpected error line: %v", failed)
+	}
+
+	if _, err = NewGormLogger(log, conf.DatabaseLog{Level: "verbose"}, conf.Dev); err == nil {
+		t.Error("unknown level should fail")
+	}
+}
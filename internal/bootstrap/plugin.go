@@ -1,7 +1,7 @@
 package bootstrap
 
 import (
-	"github.com/gin-gonic/gin"
+	"go-server-template/pkg/context"
 	"go-server-template/pkg/trace"
 	"time"
 
@@ -13,6 +13,7 @@ const (
 	callBackBeforeName = "core:before"
 	callBackAfterName  = "core:after"
 	startTime          = "_start_time"
+	traceSQL           = "_trace_sql"
 )
 
 type TracePlugin struct{}
@@ -48,8 +49,8 @@ func before(db *gorm.DB) {
 }
 
 func after(db *gorm.DB) {
-	_ctx := db.Statement.Context
-	ctx, ok := _ctx.(*gin.Context)
+	// the gin context may be wrapped, e.g. by service.InTx
+	ctx, ok := context.GinContext(db.Statement.Context)
 	if !ok {
 		return
 	}
@@ -69,13 +70,16 @@ func after(db *gorm.DB) {
 	sqlInfo := new(trace.SQL)
 	sqlInfo.Timestamp = time.Now().Format(time.RFC3339)
 	sqlInfo.SQL = sql
+	sqlInfo.Shape = trace.Shape(db.Statement.SQL.String())
 	sqlInfo.Stack = utils.FileWithLineNum()
 	sqlInfo.Rows = db.Statement.RowsAffected
 	sqlInfo.CostSeconds = time.Since(ts).Milliseconds()
+	sqlInfo.Node = nodeOf(db)
 
 	t := trace.GetTrace(ctx)
 	if t != nil {
 		t.AppendSQL(sqlInfo)
+		db.InstanceSet(traceSQL, sqlInfo)
 	}
 
 	return
@@ -0,0 +1,43 @@
+package bootstrap
+
+import (
+	"context"
+	"database/sql"
+	"go-server-template/internal/conf"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	gormLogger "gorm.io/gorm/logger"
+)
+
+func TestConfigurePool(t *testing.T) {
+	dB, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: gormLogger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := dB.DB()
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	if err = configurePool(dB, conf.DatabasePool{MaxOpenConns: 3, MaxIdleConns: 1, ConnMaxLifetime: 60, ConnMaxIdleTime: 60}); err != nil {
+		t.Fatal(err)
+	}
+	if max := sqlDB.Stats().MaxOpenConnections; max != 3 {
+		t.Fatalf("expected 3 open connections at most, got %d", max)
+	}
+
+	// every connection above the idle limit is closed once released
+	ctx := context.Background()
+	conns := make([]*sql.Conn, 3)
+	for i := range conns {
+		if conns[i], err = sqlDB.Conn(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, conn := range conns {
+		_ = conn.Close()
+	}
+	if stats := sqlDB.Stats(); stats.Idle != 1 || stats.MaxIdleClosed != 2 {
+		t.Fatalf("expected a single idle connection, got %+v", stats)
+	}
+}
@@ -0,0 +1,97 @@
+package bootstrap
+
+import (
+	stdctx "context"
+	"errors"
+	"go-server-template/internal/conf"
+	"go-server-template/internal/db"
+	"go-server-template/internal/model"
+	"go-server-template/internal/service"
+	"go-server-template/pkg/context"
+	"strings"
+	"testing"
+)
+
+func TestPrivacyErase(t *testing.T) {
+	conf.Conf = conf.InitDefaultConfig()
+	dB := openTestDB(t)
+
+	user := &model.User{Username: "alice", Password: "secret"}
+	if err := dB.Create(user).Error; err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.WithUserID(stdctx.Background(), uint64(user.ID))
+	if err := dB.WithContext(ctx).Model(user).Update("username", "alice2").Error; err != nil {
+		t.Fatal(err)
+	}
+
+	export, err := service.Get().Privacy().Export(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := export.Sections["user"]; !ok {
+		t.Fatalf("expected a user section, got %v", export.Sections)
+	}
+	exported, _ := export.Sections["audit_logs"].([]*model.AuditLog)
+	if len(exported) != 2 {
+		t.Fatalf("expected 2 audit logs in the export, got %v", export.Sections["audit_logs"])
+	}
+	if l := exported[1]; l.Actor != user.PublicID || l.Record != user.PublicID {
+		t.Fatalf("expected the export to hold public ids, got %+v", l)
+	}
+
+	if err = service.Get().Privacy().Erase(ctx, user.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	var erased model.User
+	if err = dB.Unscoped().First(&erased, user.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if erased.Username != service.Pseudonym(user) || !erased.DeletedAt.Valid {
+		t.Fatalf("expected an anonymized and deleted user, got %+v", erased)
+	}
+
+	logs, err := db.ListAuditLogsOfUser(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, l := range logs {
+		if strings.Contains(l.Before+l.After+l.Diff, "alice") {
+			t.Errorf("audit log %d still references the user: %+v", l.ID, l)
+		}
+	}
+
+	if _, err = service.Get().Audit().VerifyChain(ctx); err != nil {
+		t.Fatalf("expected the chain to survive the erasure, got %v", err)
+	}
+
+	// neither erased content nor the erased flag can be changed on their own
+	var chainErr *service.AuditChainError
+	erasedLog, erasedAfter := logs[0], logs[0].After
+	if err = dB.Model(erasedLog).Update("after", `{"username":"mallory"}`).Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, err = service.Get().Audit().VerifyChain(ctx); !errors.As(err, &chainErr) || chainErr.ID != erasedLog.ID {
+		t.Fatalf("expected the edited erased entry %d to break the chain, got %v", erasedLog.ID, err)
+	}
+	if err = dB.Model(erasedLog).Update("after", erasedAfter).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	bob := &model.User{Username: "bob", Password: "secret"}
+	if err = dB.Create(bob).Error; err != nil {
+		t.Fatal(err)
+	}
+	bobLogs, err := db.ListAuditLogsOfUser(ctx, bob.ID)
+	if err != nil || len(bobLogs) != 1 {
+		t.Fatalf("expected the creation of bob to be audited, got %v (%v)", bobLogs, err)
+	}
+	err = dB.Model(bobLogs[0]).Updates(map[string]interface{}{"after": `{"username":"mallory"}`, "erased": true}).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = service.Get().Audit().VerifyChain(ctx); !errors.As(err, &chainErr) || chainErr.ID != bobLogs[0].ID {
+		t.Fatalf("expected the entry %d erased without an erasure to break the chain, got %v", bobLogs[0].ID, err)
+	}
+}
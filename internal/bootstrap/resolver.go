@@ -0,0 +1,231 @@
+package bootstrap
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"go-server-template/internal/db"
+	"go-server-template/pkg/logger"
+	"math/rand"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	ReplicaRoundRobin = "round_robin"
+	ReplicaRandom     = "random"
+
+	resolverBeforeName = "resolver:before"
+	resolverAfterName  = "resolver:after"
+	resolverNode       = "_resolver_node"
+	primaryNode        = "primary"
+
+	replicaPingTimeout = 3 * time.Second
+)
+
+// Replica is a read only database node known to the Resolver.
+type Replica struct {
+	Name string
+	DB   *sql.DB
+
+	healthy atomic.Bool
+}
+
+// NewReplica returns a replica that is considered healthy until a query or a
+// health check fails.
+func NewReplica(name string, sqlDB *sql.DB) *Replica {
+	r := &Replica{Name: name, DB: sqlDB}
+	r.healthy.Store(true)
+	return r
+}
+
+// Healthy reports whether the replica currently receives reads.
+func (r *Replica) Healthy() bool {
+	return r.healthy.Load()
+}
+
+func (r *Replica) setHealthy(healthy bool, cause error) {
+	if r.healthy.Swap(healthy) == healthy {
+		return
+	}
+	if healthy {
+		logger.GetLogger().WithField("replica", r.Name).Info("database replica is back")
+	} else {
+		logger.GetLogger().WithField("replica", r.Name).Warnf("database replica ejected: %v", cause)
+	}
+}
+
+// Resolver sends reads to healthy replicas and everything else, including
+// every statement of a transaction, to the primary. Reads fall back to the
+// primary when no replica is healthy or the context was marked with
+// db.UsePrimary.
+type Resolver struct {
+	replicas []*Replica
+	policy   string
+	next     uint64
+
+	once sync.Once
+	done chan struct{}
+}
+
+// NewResolver returns a resolver over replicas using policy, either
+// ReplicaRoundRobin or ReplicaRandom.
+func NewResolver(policy string, replicas ...*Replica) (*Resolver, error) {
+	switch policy {
+	case "":
+		policy = ReplicaRoundRobin
+	case ReplicaRoundRobin, ReplicaRandom:
+	default:
+		return nil, fmt.Errorf("not supported replica policy: %s", policy)
+	}
+	return &Resolver{replicas: replicas, policy: policy, done: make(chan struct{})}, nil
+}
+
+func (r *Resolver) Name() string {
+	return "resolverPlugin"
+}
+
+func (r *Resolver) Initialize(tx *gorm.DB) (err error) {
+	_ = tx.Callback().Query().Before("gorm:query").Register(resolverBeforeName, r.before)
+	_ = tx.Callback().Row().Before("gorm:row").Register(resolverBeforeName, r.before)
+	_ = tx.Callback().Raw().Before("gorm:raw").Register(resolverBeforeName, r.before)
+
+	_ = tx.Callback().Query().After("gorm:query").Register(resolverAfterName, r.after)
+	_ = tx.Callback().Row().After("gorm:row").Register(resolverAfterName, r.after)
+	_ = tx.Callback().Raw().After("gorm:raw").Register(resolverAfterName, r.after)
+	return
+}
+
+var _ gorm.Plugin = &Resolver{}
+
+// Watch pings every replica each interval, ejecting the ones that fail and
+// bringing back the ones that recover, until ctx is done or Close is called.
+func (r *Resolver) Watch(ctx context.Context, interval time.Duration) {
+	if len(r.replicas) == 0 || interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-r.done:
+			return
+		case <-ticker.C:
+			r.Check(ctx)
+		}
+	}
+}
+
+// Check pings every replica once and updates its health.
+func (r *Resolver) Check(ctx context.Context) {
+	for _, replica := range r.replicas {
+		pingCtx, cancel := context.WithTimeout(ctx, replicaPingTimeout)
+		err := replica.DB.PingContext(pingCtx)
+		cancel()
+		replica.setHealthy(err == nil, err)
+	}
+}
+
+// Close stops Watch and closes the connection pools of the replicas.
+func (r *Resolver) Close() (err error) {
+	r.once.Do(func() {
+		close(r.done)
+		for _, replica := range r.replicas {
+			err = errors.Join(err, replica.DB.Close())
+		}
+	})
+	return
+}
+
+func (r *Resolver) before(tx *gorm.DB) {
+	if !r.isRead(tx) {
+		return
+	}
+	replica := r.pick()
+	if replica == nil {
+		return
+	}
+	tx.Statement.ConnPool = replica.DB
+	tx.InstanceSet(resolverNode, replica.Name)
+}
+
+func (r *Resolver) after(tx *gorm.DB) {
+	node, ok := tx.InstanceGet(resolverNode)
+	if !ok || tx.Error == nil || !isConnError(tx.Error) {
+		return
+	}
+	for _, replica := range r.replicas {
+		if replica.Name == node {
+			replica.setHealthy(false, tx.Error)
+		}
+	}
+}
+
+// isRead reports whether the statement may be served by a replica.
+func (r *Resolver) isRead(tx *gorm.DB) bool {
+	stmt := tx.Statement
+	if len(r.replicas) == 0 || db.PrimaryOnly(stmt.Context) {
+		return false
+	}
+	// transactions stay on the connection they were started on
+	if _, ok := stmt.ConnPool.(*sql.DB); !ok {
+		return false
+	}
+	// SELECT ... FOR UPDATE
+	if _, ok := stmt.Clauses["FOR"]; ok {
+		return false
+	}
+	// Exec runs the raw callbacks too
+	if stmt.SQL.Len() > 0 {
+		query := strings.TrimSpace(stmt.SQL.String())
+		return len(query) >= 6 && strings.EqualFold(query[:6], "select")
+	}
+	return true
+}
+
+func (r *Resolver) pick() *Replica {
+	n := len(r.replicas)
+	var start int
+	if r.policy == ReplicaRandom {
+		start = rand.Intn(n)
+	} else {
+		start = int(atomic.AddUint64(&r.next, 1) % uint64(n))
+	}
+	for i := 0; i < n; i++ {
+		if replica := r.replicas[(start+i)%n]; replica.Healthy() {
+			return replica
+		}
+	}
+	return nil
+}
+
+// primaryContext pins the queries a callback runs on behalf of a write to the
+// primary, the replica may not have seen the write yet.
+func primaryContext(tx *gorm.DB) context.Context {
+	return db.UsePrimary(tx.Statement.Context)
+}
+
+// nodeOf returns the name of the node that served the statement.
+func nodeOf(tx *gorm.DB) string {
+	if node, ok := tx.InstanceGet(resolverNode); ok {
+		return node.(string)
+	}
+	return primaryNode
+}
+
+func isConnError(err error) bool {
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, sql.ErrConnDone) {
+		return true
+	}
+	var netErr interface{ Timeout() bool }
+	return errors.As(err, &netErr)
+}
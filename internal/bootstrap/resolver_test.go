@@ -0,0 +1,103 @@
+package bootstrap
+
+import (
+	"context"
+	"go-server-template/internal/db"
+	"go-server-template/internal/model"
+	"go-server-template/internal/service"
+	"go-server-template/pkg/logger"
+	"path/filepath"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	gormLogger "gorm.io/gorm/logger"
+)
+
+func openResolverTestDB(t *testing.T, file string) *gorm.DB {
+	dB, err := gorm.Open(sqlite.Open(file), &gorm.Config{Logger: gormLogger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = dB.AutoMigrate(new(model.User), new(model.AuditLog), new(model.AuditHead)); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		sqlDB, _ := dB.DB()
+		_ = sqlDB.Close()
+	})
+	return dB
+}
+
+func TestResolver(t *testing.T) {
+	logger.Init("zap")
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	primary := openResolverTestDB(t, filepath.Join(dir, "primary.db"))
+	replicaDB := openResolverTestDB(t, filepath.Join(dir, "replica.db"))
+	replicaConn, _ := replicaDB.DB()
+
+	// a row only the replica knows about
+	if err := replicaDB.Create(&model.User{Username: "on-replica"}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	replica := NewReplica("replica-0", replicaConn)
+	resolver, err := NewResolver(ReplicaRoundRobin, replica)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = primary.Use(resolver)
+	_ = primary.Use(&AuditPlugin{})
+	db.InitDB(primary)
+	service.Init(primary)
+
+	user := &model.User{Username: "on-primary"}
+	if err = primary.Create(user).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err = primary.Model(user).Update("username", "renamed").Error; err != nil {
+		t.Fatal(err)
+	}
+
+	usernames := func(ctx context.Context) []string {
+		var names []string
+		if err := db.Conn(ctx).Model(new(model.User)).Pluck("username", &names).Error; err != nil {
+			t.Fatal(err)
+		}
+		return names
+	}
+
+	if names := usernames(ctx); len(names) != 1 || names[0] != "on-replica" {
+		t.Fatalf("read should be served by the replica, got %v", names)
+	}
+	if names := usernames(db.UsePrimary(ctx)); len(names) != 1 || names[0] != "renamed" {
+		t.Fatalf("UsePrimary should read from the primary, got %v", names)
+	}
+
+	err = service.InTx(ctx, func(ctx context.Context) error {
+		if names := usernames(ctx); len(names) != 1 || names[0] != "renamed" {
+			t.Fatalf("transaction should read from the primary, got %v", names)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// audit callbacks read the chain head from the primary
+	if checked, err := service.Get().Audit().VerifyChain(db.UsePrimary(ctx)); err != nil || checked != 2 {
+		t.Fatalf("audit chain: checked %d, err %v", checked, err)
+	}
+
+	// an ejected replica sends reads back to the primary
+	_ = replicaConn.Close()
+	resolver.Check(ctx)
+	if replica.Healthy() {
+		t.Fatal("closed replica should be ejected")
+	}
+	if names := usernames(ctx); len(names) != 1 || names[0] != "renamed" {
+		t.Fatalf("read should fall back to the primary, got %v", names)
+	}
+}
@@ -0,0 +1,101 @@
+package bootstrap
+
+import (
+	"fmt"
+	"go-server-template/internal/search"
+	"go-server-template/pkg/logger"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	searchBeforeName = "search:before"
+	searchAfterName  = "search:after"
+	searchTargets    = "_search_targets"
+)
+
+// SearchPlugin keeps the full-text indexes of the model.Searchable models in
+// step with every create, update and delete, within the same transaction.
+type SearchPlugin struct{}
+
+func (op *SearchPlugin) Name() string {
+	return "searchPlugin"
+}
+
+func (op *SearchPlugin) Initialize(db *gorm.DB) (err error) {
+	// 开始前, 记录要变更的行
+	_ = db.Callback().Update().Before("gorm:update").Register(searchBeforeName, op.targets)
+	_ = db.Callback().Delete().Before("gorm:delete").Register(searchBeforeName, op.targets)
+
+	// 结束后, 重建这些行的索引
+	_ = db.Callback().Create().After("gorm:create").Register(searchAfterName, op.afterCreate)
+	_ = db.Callback().Update().After("gorm:update").Register(searchAfterName, op.afterChange)
+	_ = db.Callback().Delete().After("gorm:delete").Register(searchAfterName, op.afterChange)
+	return
+}
+
+var _ gorm.Plugin = &SearchPlugin{}
+
+func searchable(db *gorm.DB) (search.Table, bool) {
+	if db.Error != nil || db.Statement.Schema == nil {
+		return search.Table{}, false
+	}
+	return search.TableOf(db.Statement.Schema)
+}
+
+// targets loads the keys of the rows an update or delete is about to change,
+// a delete by condition leaves nothing to look them up afterwards.
+func (op *SearchPlugin) targets(db *gorm.DB) {
+	t, ok := searchable(db)
+	if !ok {
+		return
+	}
+
+	stmt := db.Statement
+	pks := primaryKeys(db)
+	c, ok := stmt.Clauses["WHERE"]
+	where, _ := c.Expression.(clause.Where)
+	if !ok || len(where.Exprs) == 0 {
+		db.InstanceSet(searchTargets, pks)
+		return
+	}
+
+	tx := newAuditQuery(db).Clauses(where)
+	if len(pks) > 0 {
+		tx = tx.Where(clause.IN{Column: clause.Column{Name: t.Key}, Values: pks})
+	}
+	var ids []interface{}
+	if err := tx.Pluck(t.Key, &ids).Error; err != nil {
+		logger.GetLogger().Warnf("search: failed to load the rows of %s: %s", stmt.Table, err.Error())
+		return
+	}
+	db.InstanceSet(searchTargets, ids)
+}
+
+func (op *SearchPlugin) afterCreate(db *gorm.DB) {
+	t, ok := searchable(db)
+	if !ok || db.Statement.RowsAffected == 0 {
+		return
+	}
+	op.reindex(db, t, primaryKeys(db))
+}
+
+func (op *SearchPlugin) afterChange(db *gorm.DB) {
+	t, ok := searchable(db)
+	if !ok || db.Statement.RowsAffected == 0 {
+		return
+	}
+	v, _ := db.InstanceGet(searchTargets)
+	ids, _ := v.([]interface{})
+	op.reindex(db, t, ids)
+}
+
+func (op *SearchPlugin) reindex(db *gorm.DB, t search.Table, ids []interface{}) {
+	// on the statement's connection so that the index shares the transaction
+	// of the change
+	tx := db.Session(&gorm.Session{NewDB: true, Context: primaryContext(db)})
+	if err := search.Reindex(tx, t, ids); err != nil {
+		_ = db.AddError(fmt.Errorf("search: failed to reindex %s: %w", t.Name, err))
+	}
+}
@@ -0,0 +1,86 @@
+package bootstrap
+
+import (
+	"context"
+	"go-server-template/internal/db"
+	"go-server-template/internal/model"
+	"go-server-template/internal/search"
+	"testing"
+)
+
+func searchUsernames(t *testing.T, q string) []string {
+	page, err := search.Search[model.User](context.Background(), q, 10, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make([]string, len(page.Items))
+	for i, hit := range page.Items {
+		names[i] = hit.Item.Username
+	}
+	return names
+}
+
+func TestSearchPlugin(t *testing.T) {
+	dB := openTestDB(t)
+	_ = dB.Use(&SearchPlugin{})
+	if err := search.Migrate(dB, new(model.User)); err != nil {
+		t.Fatal(err)
+	}
+
+	alice := &model.User{Username: "alice", Password: "secret"}
+	if err := dB.Create(alice).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := dB.Create([]*model.User{{Username: "alina"}, {Username: "bob"}}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if got := searchUsernames(t, "ali"); len(got) != 2 {
+		t.Fatalf("expected the created users to be indexed, got %v", got)
+	}
+
+	// a rollback leaves the index as it was
+	tx := dB.Begin()
+	if err := tx.Model(alice).Update("username", "carol").Error; err != nil {
+		t.Fatal(err)
+	}
+	tx.Rollback()
+	if got := searchUsernames(t, "alice"); len(got) != 1 {
+		t.Fatalf("expected the rolled back rename to be ignored, got %v", got)
+	}
+
+	if err := dB.Model(alice).Update("username", "carol").Error; err != nil {
+		t.Fatal(err)
+	}
+	if got := searchUsernames(t, "carol"); len(got) != 1 || len(searchUsernames(t, "alice")) != 0 {
+		t.Fatalf("expected the renamed user to be reindexed, got %v", got)
+	}
+
+	// by condition, without the primary keys
+	if err := dB.Model(&model.User{}).Where("username = ?", "bob").Update("username", "robert").Error; err != nil {
+		t.Fatal(err)
+	}
+	if got := searchUsernames(t, "rob"); len(got) != 1 {
+		t.Fatalf("expected the updated user to be reindexed, got %v", got)
+	}
+
+	// soft deleted users are not found until restored, purged ones are gone
+	if err := dB.Where("username = ?", "alina").Delete(&model.User{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if got := searchUsernames(t, "alina"); len(got) != 0 {
+		t.Fatalf("expected the deleted user to be hidden, got %v", got)
+	}
+	if err := dB.Unscoped().Model(&model.User{}).Where("username = ?", "alina").Update("deleted_at", nil).Error; err != nil {
+		t.Fatal(err)
+	}
+	if got := searchUsernames(t, "alina"); len(got) != 1 {
+		t.Fatalf("expected the restored user, got %v", got)
+	}
+	if err := db.Conn(context.Background()).Unscoped().Delete(alice).Error; err != nil {
+		t.Fatal(err)
+	}
+	var indexed int64
+	if err := dB.Table("users_search").Where("rowid = ?", alice.ID).Count(&indexed).Error; err != nil || indexed != 0 {
+		t.Fatalf("expected the purged user to leave the index, got %d (%v)", indexed, err)
+	}
+}
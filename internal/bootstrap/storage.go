@@ -0,0 +1,40 @@
+package bootstrap
+
+import (
+	log "github.com/sirupsen/logrus"
+	"go-server-template/internal/conf"
+	"go-server-template/pkg/logger"
+	"go-server-template/pkg/storage"
+)
+
+func InitStorage() {
+	var (
+		store storage.Storage
+		err   error
+	)
+
+	config := conf.Conf.Storage
+	switch config.Type {
+	case storage.Local:
+		store, err = storage.NewLocalStorage(config.Local.Root)
+	case storage.Memory:
+		store = storage.NewMemoryStorage()
+	case storage.S3:
+		store, err = storage.NewS3Storage(storage.S3Config{
+			Endpoint:  config.S3.Endpoint,
+			Region:    config.S3.Region,
+			Bucket:    config.S3.Bucket,
+			AccessKey: config.S3.AccessKey,
+			SecretKey: config.S3.SecretKey,
+			PathStyle: config.S3.PathStyle,
+		})
+	default:
+		log.Fatalf("not supported storage type: %s", config.Type)
+	}
+	if err != nil {
+		log.Fatalf("failed to init storage: %s", err.Error())
+	}
+
+	storage.Init(store)
+	logger.GetLogger().Infof("storage init success: %s", config.Type)
+}
@@ -0,0 +1,45 @@
+package bootstrap
+
+import (
+	"context"
+	"go-server-template/internal/conf"
+	"go-server-template/internal/db"
+	"go-server-template/pkg/logger"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWaitDB(t *testing.T) {
+	logger.Init("zap")
+	dir := t.TempDir()
+
+	conf.Conf = conf.InitDefaultConfig()
+	conf.Conf.Env = conf.Production
+	conf.Conf.Database.Retry = conf.DatabaseRetry{Attempts: 3, InitialInterval: 1, MaxInterval: 2}
+
+	// the parent directory does not exist, so every ping fails
+	conf.Conf.Database.File = filepath.Join(dir, "missing", "data.db")
+	err := WaitDB(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "3 attempts") {
+		t.Fatalf("expected to give up after 3 attempts, got %v", err)
+	}
+	if db.Ready() {
+		t.Fatal("database should not be ready")
+	}
+
+	conf.Conf.Database.File = filepath.Join(dir, "data.db")
+	if err = WaitDB(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !db.Ready() {
+		t.Fatal("database should be ready")
+	}
+
+	if err = db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if db.Ready() {
+		t.Fatal("closed database should not be ready")
+	}
+}
@@ -18,6 +18,17 @@ type Config struct {
 	Env      EnvMode  `json:"env"`
 	JWT      JWT      `json:"jwt"`
 	Port     int      `json:"port"`
+	Storage  Storage  `json:"storage"`
+
+	QueryBudget QueryBudget `json:"query_budget"`
+	Outbox      Outbox      `json:"outbox"`
+	Jobs        Jobs        `json:"jobs"`
+	Scheduler   Scheduler   `json:"scheduler"`
+	Lock        Lock        `json:"lock"`
+	Settings    Settings    `json:"settings"`
+	Flags       Flags       `json:"flags"`
+	Cache       Cache       `json:"cache"`
+	Encryption  Encryption  `json:"encryption"`
 }
 
 type Database struct {
@@ -30,7 +41,88 @@ type Database struct {
 
 	File    string `json:"file" env:"DB_PATH"`
 	SSLMode string `json:"ssl_mode" env:"DB_SSL_MODE"`
-	DSN     string `json:"dsn" env:"DB_DSN"`
+	DSN     string `json:"dsn" env:"DB_DSN"` // 设置后优先于上面的连接字段
+
+	TimeZone       string            `json:"timezone" env:"DB_TIMEZONE"`               // 会话时区, 如 Asia/Shanghai, 为空使用驱动默认值
+	Charset        string            `json:"charset" env:"DB_CHARSET"`                 // 连接字符集
+	SearchPath     string            `json:"search_path" env:"DB_SEARCH_PATH"`         // postgres schema 搜索路径
+	ConnectTimeout int64             `json:"connect_timeout" env:"DB_CONNECT_TIMEOUT"` // 建立连接超时, 单位秒
+	Params         map[string]string `json:"params"`                                   // 其他驱动参数, 原样附加到 DSN
+
+	Pool  DatabasePool  `json:"pool"`
+	Retry DatabaseRetry `json:"retry"`
+	Log   DatabaseLog   `json:"log"`
+
+	Replicas             []DatabaseReplica `json:"replicas"`
+	ReplicaPolicy        string            `json:"replica_policy" env:"DB_REPLICA_POLICY"` // round_robin or random
+	ReplicaCheckInterval int64             `json:"replica_check_interval"`                 // 只读副本健康检查间隔, 单位秒
+}
+
+// DatabaseRetry controls how long startup waits for the database.
+type DatabaseRetry struct {
+	Attempts        int   `json:"attempts" env:"DB_RETRY_ATTEMPTS"` // 启动时最多尝试连接次数, 0 表示一直重试
+	InitialInterval int64 `json:"initial_interval"`                 // 首次重试间隔, 单位毫秒, 之后每次翻倍
+	MaxInterval     int64 `json:"max_interval"`                     // 最大重试间隔, 单位毫秒
+}
+
+// DatabaseLog configures the SQL log written through pkg/logger.
+type DatabaseLog struct {
+	Level                string `json:"level" env:"DB_LOG_LEVEL"` // silent, error, warn or info, 为空时 dev 为 info, 否则为 warn (不再是 silent, 需要关闭 SQL 日志时显式设为 silent)
+	SlowThreshold        int64  `json:"slow_threshold"`           // 慢查询阈值, 单位毫秒, 0 表示不记录慢查询
+	IgnoreRecordNotFound bool   `json:"ignore_record_not_found"`  // 不记录 RecordNotFound 错误
+	Explain              bool   `json:"explain" env:"DB_EXPLAIN"` // 对慢查询执行 EXPLAIN 并记录执行计划, dev 环境始终开启
+}
+
+// DatabaseReplica is a read only replica of the primary database. Empty
+// fields are inherited from the primary, except DSN: the DSN of the primary
+// would point the replica at the primary.
+type DatabaseReplica struct {
+	Host     string `json:"host"`
+	Port     int    `json:"port"`
+	User     string `json:"user"`
+	Password string `json:"password"`
+	Name     string `json:"name"`
+	File     string `json:"file"`
+	SSLMode  string `json:"ssl_mode"`
+	DSN      string `json:"dsn"`
+}
+
+// Replica returns the connection settings of r, completed from d.
+func (d Database) Replica(r DatabaseReplica) Database {
+	replica := d
+	replica.Replicas = nil
+	if r.Host != "" {
+		replica.Host = r.Host
+	}
+	if r.Port != 0 {
+		replica.Port = r.Port
+	}
+	if r.User != "" {
+		replica.User = r.User
+	}
+	if r.Password != "" {
+		replica.Password = r.Password
+	}
+	if r.Name != "" {
+		replica.Name = r.Name
+	}
+	if r.File != "" {
+		replica.File = r.File
+	}
+	if r.SSLMode != "" {
+		replica.SSLMode = r.SSLMode
+	}
+	replica.DSN = r.DSN
+	return replica
+}
+
+type DatabasePool struct {
+	MaxOpenConns    int   `json:"max_open_conns" env:"DB_MAX_OPEN_CONNS"`         // 最大打开连接数, 0 表示不限制
+	MaxIdleConns    int   `json:"max_idle_conns" env:"DB_MAX_IDLE_CONNS"`         // 最大空闲连接数
+	ConnMaxLifetime int64 `json:"conn_max_lifetime" env:"DB_CONN_MAX_LIFETIME"`   // 连接最长存活时间, 单位秒, 0 表示不限制
+	ConnMaxIdleTime int64 `json:"conn_max_idle_time" env:"DB_CONN_MAX_IDLE_TIME"` // 连接最长空闲时间, 单位秒, 0 表示不限制
+
+	WatchInterval int64 `json:"watch_interval"` // 连接池饱和检查间隔, 单位秒, 0 表示不检查
 }
 
 type LogFile struct {
@@ -53,6 +145,175 @@ type JWT struct {
 	Expire int64  `json:"expire"`
 }
 
+type LocalStorage struct {
+	Root string `json:"root" env:"STORAGE_ROOT"`
+}
+
+type S3Storage struct {
+	Endpoint  string `json:"endpoint" env:"S3_ENDPOINT"`
+	Region    string `json:"region" env:"S3_REGION"`
+	Bucket    string `json:"bucket" env:"S3_BUCKET"`
+	AccessKey string `json:"access_key" env:"S3_ACCESS_KEY"`
+	SecretKey string `json:"secret_key" env:"S3_SECRET_KEY"`
+	PathStyle bool   `json:"path_style" env:"S3_PATH_STYLE"`
+}
+
+type Storage struct {
+	Type  string       `json:"type" env:"STORAGE_TYPE"` // local, memory or s3
+	Local LocalStorage `json:"local"`
+	S3    S3Storage    `json:"s3"`
+
+	MaxSize      int64    `json:"max_size"`      // 单个文件最大字节数
+	AllowedTypes []string `json:"allowed_types"` // 允许上传的 MIME 类型, 按内容识别
+	UserQuota    int64    `json:"user_quota"`    // 每个用户的总容量, 单位字节
+	SignSecret   string   `json:"sign_secret"`   // 下载链接签名密钥
+	URLExpire    int64    `json:"url_expire"`    // 下载链接有效期, 单位秒
+}
+
+// QueryBudget limits the SQL statements of each request, violations are
+// logged and in dev also returned in the X-Query-Budget header.
+type QueryBudget struct {
+	Enable          bool               `json:"enable"`
+	RepeatThreshold int                `json:"repeat_threshold"` // 同一形状的 SQL 超过该次数视为 N+1, 0 表示不检查
+	MaxQueries      int                `json:"max_queries"`      // 每个请求最多执行的 SQL 条数, 0 表示不检查
+	MaxDuration     int64              `json:"max_duration"`     // 每个请求 SQL 总耗时, 单位毫秒, 0 表示不检查
+	Routes          []RouteQueryBudget `json:"routes"`           // 按路由别名覆盖上面的限制
+}
+
+type RouteQueryBudget struct {
+	Route           string `json:"route"` // 路由别名, 如 /user/:id
+	RepeatThreshold int    `json:"repeat_threshold"`
+	MaxQueries      int    `json:"max_queries"`
+	MaxDuration     int64  `json:"max_duration"`
+}
+
+// Outbox configures the relay dispatching the outbox events to their
+// subscribers.
+type Outbox struct {
+	Interval         int64 `json:"interval"`           // 没有待投递事件时的轮询间隔, 单位毫秒
+	BatchSize        int   `json:"batch_size"`         // 每次轮询取出的事件数
+	MaxAttempts      int   `json:"max_attempts"`       // 最多投递次数, 超过后标记为 dead, 0 表示一直重试
+	RetryInterval    int64 `json:"retry_interval"`     // 首次重试间隔, 单位秒, 之后每次翻倍
+	MaxRetryInterval int64 `json:"max_retry_interval"` // 最大重试间隔, 单位秒
+	Timeout          int64 `json:"timeout"`            // 单个事件投递超时, 单位秒, 投递期间事件不会被其他 relay 领取, 0 使用默认的 30 秒
+}
+
+// Jobs configures the worker running the background jobs.
+type Jobs struct {
+	Enable           bool  `json:"enable" env:"JOBS_ENABLE"`               // 是否在 http 服务中运行后台任务
+	Concurrency      int   `json:"concurrency" env:"JOBS_CONCURRENCY"`     // 同时运行的任务数
+	PollInterval     int64 `json:"poll_interval"`                          // 没有待运行任务时的轮询间隔, 单位毫秒
+	Timeout          int64 `json:"timeout"`                                // 单次运行超时, 单位秒, 超时后其他 worker 可重新领取, 0 使用默认的 5 分钟
+	MaxAttempts      int   `json:"max_attempts"`                           // 默认最多运行次数, 超过后标记为 dead, 0 表示一直重试
+	RetryInterval    int64 `json:"retry_interval"`                         // 首次重试间隔, 单位秒, 之后每次翻倍
+	MaxRetryInterval int64 `json:"max_retry_interval"`                     // 最大重试间隔, 单位秒
+	DrainTimeout     int64 `json:"drain_timeout" env:"JOBS_DRAIN_TIMEOUT"` // 停机时等待运行中任务的时间, 单位秒, 之后取消
+}
+
+// Scheduler configures the scheduled tasks, the replicas elect the one
+// running them through a database lease.
+type Scheduler struct {
+	Enable   bool  `json:"enable" env:"SCHEDULER_ENABLE"` // 是否在 http 服务中运行定时任务
+	Interval int64 `json:"interval"`                      // 检查到期任务和续租的间隔, 单位毫秒
+	LeaseTTL int64 `json:"lease_ttl"`                     // leader 租约时长, 单位秒, 超时未续租由其他副本接管
+}
+
+// Lock configures the distributed locks, see internal/lock.
+type Lock struct {
+	Backend string `json:"backend" env:"LOCK_BACKEND"` // table 或 advisory(仅 postgres), 为空时 postgres 使用 advisory, 其他使用 table
+	TTL     int64  `json:"ttl"`                        // 未指定时长时的默认锁时长, 单位秒, 持有期间每 1/3 时长续期一次
+
+	MaxAdvisoryLocks int `json:"max_advisory_locks"` // 同时持有的 advisory 锁上限, 每把锁占用主连接池的一个连接直到释放, 超出时按锁被占用处理, 0 表示不限制
+}
+
+// Settings configures the runtime settings, see internal/setting.
+type Settings struct {
+	CacheTTL int64 `json:"cache_ttl"` // 设置缓存时长, 单位秒, 本副本写入时立即失效, 其他副本最多延迟该时长生效
+}
+
+// Flags configures the feature flags, see internal/flags. The flags stored
+// in the database override the ones of the config with the same key.
+type Flags struct {
+	CacheTTL    int64  `json:"cache_ttl"`   // 数据库中开关的缓存时长, 单位秒, 本副本写入时立即失效
+	Definitions []Flag `json:"definitions"` // 配置文件中定义的开关
+}
+
+// Cache configures the cache backend and the cached models, see pkg/cache.
+type Cache struct {
+	Backend     string     `json:"backend" env:"CACHE_BACKEND"` // memory, redis 或 none
+	MaxEntries  int        `json:"max_entries"`                 // memory: 最多缓存条数, 超过后淘汰最久未使用的, 0 表示不限制
+	MaxBytes    int64      `json:"max_bytes"`                   // memory: 缓存值的总字节数上限, 0 表示不限制
+	Redis       CacheRedis `json:"redis"`
+	UserTTL     int64      `json:"user_ttl"`     // 用户缓存时长, 单位秒, 0 表示不缓存. 本副本写入时立即失效, memory 时其他副本最多延迟该时长生效
+	NegativeTTL int64      `json:"negative_ttl"` // 不存在的记录的缓存时长, 单位秒, 0 表示不缓存
+}
+
+type CacheRedis struct {
+	Addr     string `json:"addr" env:"REDIS_ADDR"` // host:port
+	Password string `json:"password" env:"REDIS_PASSWORD"`
+	DB       int    `json:"db" env:"REDIS_DB"`
+	PoolSize int    `json:"pool_size"` // 保持的空闲连接数
+	Timeout  int64  `json:"timeout"`   // 连接和每条命令的超时, 单位毫秒
+}
+
+// Encryption configures the keys of the encrypted columns, see pkg/crypt.
+// To rotate, add a key, make it the primary one, run `base-cmd db
+// reencrypt` and only then remove the former key.
+//
+// The environment overrides the keys, so they can stay out of the config
+// file: ENCRYPTION_PRIMARY, ENCRYPTION_BLIND_KEY and ENCRYPTION_KEYS as
+// "id=key,id=key", or the files named by the same variables suffixed with
+// _FILE.
+type Encryption struct {
+	Primary  string          `json:"primary" env:"ENCRYPTION_PRIMARY"` // 加密新数据使用的密钥 ID, 为空时不启用加密
+	Keys     []EncryptionKey `json:"keys" env:"ENCRYPTION_KEYS"`
+	BlindKey string          `json:"blind_key" env:"ENCRYPTION_BLIND_KEY"` // 盲索引的 HMAC 密钥, base64 编码, 更换后需运行 db reencrypt 重建盲索引
+}
+
+type EncryptionKey struct {
+	ID  string `json:"id"`  // 密钥 ID, 写入每个密文
+	Key string `json:"key"` // base64 编码的 32 字节 AES-256 密钥
+}
+
+// Flag is a feature flag. A flag without Variants is a boolean flag with
+// the variants "on" and "off".
+type Flag struct {
+	Key         string   `json:"key" example:"new_profile"`
+	Description string   `json:"description" example:"新版个人主页"`
+	Variants    []string `json:"variants" example:"blue,green"`
+	// Enabled false serves OffVariant to everyone, "off" or the first
+	// variant when empty.
+	Enabled    bool   `json:"enabled" example:"true"`
+	OffVariant string `json:"off_variant" example:"off"`
+	// Rules are tried in order, the first matching one serves the subject,
+	// the others get Default.
+	Rules   []FlagRule `json:"rules"`
+	Default FlagServe  `json:"default"`
+}
+
+// FlagRule matches the subjects matching all of its non empty lists, a
+// list matches when it contains the value of the subject. UserIDs holds
+// public ids of users.
+type FlagRule struct {
+	UserIDs   []string `json:"user_ids" example:"01ARYZ6S41TSV4RRFFQ69G5FAV"`
+	Roles     []string `json:"roles" example:"admin"`
+	Tenants   []string `json:"tenants" example:"acme"`
+	FlagServe `mapstructure:",squash"`
+}
+
+// FlagServe serves Variant, or else a variant of Rollout picked by the hash
+// of the user id.
+type FlagServe struct {
+	Variant string       `json:"variant" example:"on"`
+	Rollout []FlagWeight `json:"rollout"`
+}
+
+// FlagWeight serves Variant to Percent percent of the users.
+type FlagWeight struct {
+	Variant string  `json:"variant" example:"on"`
+	Percent float64 `json:"percent" example:"20"`
+}
+
 var Conf *Config
 
 func InitDefaultConfig() *Config {
@@ -63,6 +324,23 @@ func InitDefaultConfig() *Config {
 			Type: "sqlite3",
 			Port: 0,
 			File: dbFile,
+			Pool: DatabasePool{
+				MaxOpenConns:    20,
+				MaxIdleConns:    10,
+				ConnMaxLifetime: int64((time.Minute * 30).Seconds()),
+				ConnMaxIdleTime: int64((time.Minute * 5).Seconds()),
+				WatchInterval:   30,
+			},
+			Retry: DatabaseRetry{
+				Attempts:        10,
+				InitialInterval: 500,
+				MaxInterval:     int64((time.Second * 10).Milliseconds()),
+			},
+			Log: DatabaseLog{
+				SlowThreshold: 200,
+			},
+			ReplicaPolicy:        "round_robin",
+			ReplicaCheckInterval: 10,
 		},
 		Logger: Logger{
 			LogLevel: "debug",
@@ -81,6 +359,76 @@ func InitDefaultConfig() *Config {
 			Secret: "your_secret_key",
 			Expire: int64((time.Hour * 24 * 7).Seconds()), // 7 days
 		},
+		Storage: Storage{
+			Type:    "local",
+			Local:   LocalStorage{Root: filepath.Join("data", "files")},
+			MaxSize: 10 << 20, // 10M
+			AllowedTypes: []string{
+				"image/png", "image/jpeg", "image/gif", "image/webp", "application/pdf", "text/plain; charset=utf-8",
+			},
+			UserQuota:  100 << 20, // 100M
+			SignSecret: "your_sign_secret",
+			URLExpire:  int64((time.Minute * 15).Seconds()),
+		},
+		QueryBudget: QueryBudget{
+			Enable:          true,
+			RepeatThreshold: 5,
+			MaxQueries:      30,
+			MaxDuration:     500,
+		},
+		Outbox: Outbox{
+			Interval:         1000,
+			BatchSize:        100,
+			MaxAttempts:      10,
+			RetryInterval:    5,
+			MaxRetryInterval: int64((time.Hour).Seconds()),
+			Timeout:          30,
+		},
+		Jobs: Jobs{
+			Enable:           true,
+			Concurrency:      4,
+			PollInterval:     1000,
+			Timeout:          int64((time.Minute * 5).Seconds()),
+			MaxAttempts:      5,
+			RetryInterval:    10,
+			MaxRetryInterval: int64((time.Hour).Seconds()),
+			DrainTimeout:     30,
+		},
+		Scheduler: Scheduler{
+			Enable:   true,
+			Interval: 1000,
+			LeaseTTL: 15,
+		},
+		Lock: Lock{
+			TTL:              30,
+			MaxAdvisoryLocks: 4,
+		},
+		Settings: Settings{
+			CacheTTL: 30,
+		},
+		Flags: Flags{
+			CacheTTL: 30,
+			Definitions: []Flag{
+				{
+					Key:         "user_search",
+					Description: "用户全文搜索, 关闭后 /api/users/search 返回 404",
+					Enabled:     true,
+					Default:     FlagServe{Variant: "on"},
+				},
+			},
+		},
+		Cache: Cache{
+			Backend:    "memory",
+			MaxEntries: 10000,
+			MaxBytes:   64 << 20, // 64M
+			Redis: CacheRedis{
+				Addr:     "127.0.0.1:6379",
+				PoolSize: 10,
+				Timeout:  500,
+			},
+			UserTTL:     300,
+			NegativeTTL: 30,
+		},
 		Env: Dev,
 	}
 }
@@ -0,0 +1,347 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go-server-template/internal/model"
+	appctx "go-server-template/pkg/context"
+	"gorm.io/gorm"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AuditFilter narrows down ListAuditLogs, zero values are ignored.
+type AuditFilter struct {
+	// Actor is the public id of the actor.
+	Actor     string
+	RequestID string
+	Action    string
+	Table     string
+	// Record is the public id of the row, looked up in Table, or its primary
+	// key for a table without public ids.
+	Record string
+	From   time.Time
+	To     time.Time
+	Offset int
+	Limit  int
+}
+
+// ListAuditLogs returns the entries matching f, latest first, with their
+// public ids filled.
+func ListAuditLogs(ctx context.Context, f AuditFilter) (logs []*model.AuditLog, total int64, err error) {
+	tx := Conn(ctx).Model(&model.AuditLog{})
+	if f.Actor != "" {
+		tx = tx.Where("actor_id IN (?)", Conn(ctx).Unscoped().Model(&model.User{}).Select("id").Where("public_id = ?", f.Actor))
+	}
+	if f.RequestID != "" {
+		tx = tx.Where("request_id = ?", f.RequestID)
+	}
+	if f.Action != "" {
+		tx = tx.Where("action = ?", f.Action)
+	}
+	if f.Table != "" {
+		tx = tx.Where("table_name = ?", f.Table)
+	}
+	if f.Record != "" {
+		key, err := recordKey(ctx, f.Table, f.Record)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, 0, nil
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		tx = tx.Where("primary_key = ?", key)
+	}
+	if !f.From.IsZero() {
+		tx = tx.Where("created_at >= ?", f.From)
+	}
+	if !f.To.IsZero() {
+		tx = tx.Where("created_at < ?", f.To)
+	}
+
+	if err = tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	if err = tx.Order("id desc").Offset(f.Offset).Limit(f.Limit).Find(&logs).Error; err != nil {
+		return nil, 0, err
+	}
+	if err = resolveAuditIDs(ctx, logs); err != nil {
+		return nil, 0, err
+	}
+
+	return logs, total, nil
+}
+
+// ScanAuditLogs walks the audit chain in insertion order, batchSize rows at a time.
+func ScanAuditLogs(ctx context.Context, batchSize int, fn func(logs []*model.AuditLog) error) error {
+	var lastID uint
+	for {
+		var logs []*model.AuditLog
+		err := Conn(ctx).
+			Where("id > ?", lastID).
+			Order("id asc").
+			Limit(batchSize).
+			Find(&logs).Error
+		if err != nil {
+			return err
+		}
+		if len(logs) == 0 {
+			return nil
+		}
+
+		if err = fn(logs); err != nil {
+			return err
+		}
+		lastID = logs[len(logs)-1].ID
+	}
+}
+
+// AppendAuditLog links entry to the last one of the chain and writes it with
+// tx, which should be the transaction of the change the entry describes.
+//
+// The model.AuditHead row is locked first and stays locked until tx ends, the
+// update takes the lock on every database, sqlite included. Concurrent
+// writers, in this process or another, thus link their entries one after
+// the other and never to the same previous hash.
+func AppendAuditLog(tx *gorm.DB, entry *model.AuditLog) error {
+	if err := lockAuditHead(tx); err != nil {
+		return fmt.Errorf("failed to lock chain head: %w", err)
+	}
+
+	var last model.AuditLog
+	if err := tx.Order("id desc").Limit(1).Find(&last).Error; err != nil {
+		return fmt.Errorf("failed to load chain head: %w", err)
+	}
+
+	entry.PrevHash = last.Hash
+	entry.Digest = entry.ContentDigest()
+	entry.Hash = entry.ComputeHash()
+	if err := tx.Create(entry).Error; err != nil {
+		return fmt.Errorf("failed to write audit log: %w", err)
+	}
+	return nil
+}
+
+func lockAuditHead(tx *gorm.DB) error {
+	res := tx.Model(&model.AuditHead{}).Where("id = ?", 1).UpdateColumn("seq", gorm.Expr("seq + 1"))
+	if res.Error != nil || res.RowsAffected == 1 {
+		return res.Error
+	}
+	// the first entry, a concurrent one fails on the primary key
+	return tx.Create(&model.AuditHead{ID: 1, Seq: 1}).Error
+}
+
+// ListAuditLogsOfUser returns the entries made by the user or about its own
+// row, with their public ids filled.
+func ListAuditLogsOfUser(ctx context.Context, userID uint) (logs []*model.AuditLog, err error) {
+	err = Conn(ctx).
+		Where("actor_id = ?", userID).
+		Or("table_name = ? AND primary_key = ?", userTable(), strconv.FormatUint(uint64(userID), 10)).
+		Order("id asc").
+		Find(&logs).Error
+	if err != nil {
+		return nil, err
+	}
+	return logs, resolveAuditIDs(ctx, logs)
+}
+
+// resolveAuditIDs fills the public ids of the actors and of the rows of logs.
+func resolveAuditIDs(ctx context.Context, logs []*model.AuditLog) error {
+	actorIDs := make([]uint64, 0, len(logs))
+	keys := make(map[string][]string)
+	for _, l := range logs {
+		actorIDs = append(actorIDs, l.ActorID)
+		keys[l.Table] = append(keys[l.Table], l.PrimaryKey)
+	}
+
+	actors, err := users.PublicIDs(ctx, actorIDs)
+	if err != nil {
+		return err
+	}
+	records := make(map[string]map[string]string, len(keys))
+	for table, pks := range keys {
+		if records[table], err = recordPublicIDs(ctx, table, pks); err != nil {
+			return err
+		}
+	}
+
+	for _, l := range logs {
+		l.Actor = actors[l.ActorID]
+		if ids := records[l.Table]; ids != nil {
+			l.Record = ids[l.PrimaryKey]
+		} else {
+			l.Record = l.PrimaryKey
+		}
+	}
+	return nil
+}
+
+// recordPublicIDs maps the primary keys of rows of table to their public ids,
+// purged rows are left out. It returns nil for a table without public ids.
+func recordPublicIDs(ctx context.Context, table string, keys []string) (map[string]string, error) {
+	if !Conn(ctx).Migrator().HasColumn(table, "public_id") {
+		return nil, nil
+	}
+
+	ids := make([]uint64, 0, len(keys))
+	for _, key := range keys {
+		if id, err := strconv.ParseUint(key, 10, 64); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	var rows []struct {
+		ID       uint64
+		PublicID string
+	}
+	if err := Conn(ctx).Table(table).Select("id", "public_id").Where("id IN ?", ids).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	publicIDs := make(map[string]string, len(rows))
+	for _, row := range rows {
+		publicIDs[strconv.FormatUint(row.ID, 10)] = row.PublicID
+	}
+	return publicIDs, nil
+}
+
+// recordKey returns the primary key recorded for the row record of table, a
+// public id when table has them.
+func recordKey(ctx context.Context, table, record string) (string, error) {
+	if table == "" || !Conn(ctx).Migrator().HasColumn(table, "public_id") {
+		return record, nil
+	}
+
+	var ids []uint64
+	if err := Conn(ctx).Table(table).Where("public_id = ?", record).Limit(1).Pluck("id", &ids).Error; err != nil {
+		return "", err
+	}
+	if len(ids) == 0 {
+		return "", gorm.ErrRecordNotFound
+	}
+	return strconv.FormatUint(ids[0], 10), nil
+}
+
+// PseudonymizeAuditLogs replaces the personal data of the user in the content
+// of its audit entries by pseudonym and marks them erased, then records the
+// erasure in the chain, see model.AuditLog. Columns tagged `privacy:"pii"`
+// are rewritten in the entries about the user's own row, values are replaced
+// wherever else they appear. ctx should carry a transaction.
+func PseudonymizeAuditLogs(ctx context.Context, userID uint, values []string, pseudonym string) error {
+	logs, err := ListAuditLogsOfUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	table, columns := userTable(), piiColumns(&model.User{})
+	ownKey := strconv.FormatUint(uint64(userID), 10)
+	erasure := model.AuditErasure{Pseudonym: pseudonym, Entries: make(map[uint]string)}
+
+	for _, l := range logs {
+		before, after, diff := l.Before, l.After, l.Diff
+		if l.Table == table && l.PrimaryKey == ownKey {
+			before = pseudonymizeColumns(before, columns, pseudonym, false)
+			after = pseudonymizeColumns(after, columns, pseudonym, false)
+			diff = pseudonymizeColumns(diff, columns, pseudonym, true)
+		}
+		for _, v := range values {
+			quoted, _ := json.Marshal(v)
+			replacement, _ := json.Marshal(pseudonym)
+			before = strings.ReplaceAll(before, string(quoted), string(replacement))
+			after = strings.ReplaceAll(after, string(quoted), string(replacement))
+			diff = strings.ReplaceAll(diff, string(quoted), string(replacement))
+		}
+		if before == l.Before && after == l.After && diff == l.Diff {
+			continue
+		}
+
+		err = Conn(ctx).Model(&model.AuditLog{}).
+			Where("id = ?", l.ID).
+			Updates(map[string]interface{}{"before": before, "after": after, "diff": diff, "erased": true}).Error
+		if err != nil {
+			return err
+		}
+		erased := model.AuditLog{Before: before, After: after, Diff: diff}
+		erasure.Entries[l.ID] = erased.ContentDigest()
+	}
+	if len(erasure.Entries) == 0 {
+		return nil
+	}
+
+	content, err := json.Marshal(erasure)
+	if err != nil {
+		return err
+	}
+	return AppendAuditLog(Conn(ctx), &model.AuditLog{
+		ActorID:    appctx.UserIDFrom(ctx),
+		RequestID:  appctx.RequestIDFrom(ctx),
+		Action:     model.AuditActionErase,
+		Table:      table,
+		PrimaryKey: ownKey,
+		After:      string(content),
+		CreatedAt:  time.Now().UTC().Truncate(time.Millisecond),
+	})
+}
+
+// pseudonymizeColumns rewrites the given columns of an audit row, or of both
+// sides of an audit diff.
+func pseudonymizeColumns(content string, columns []string, pseudonym string, isDiff bool) string {
+	if content == "" {
+		return content
+	}
+
+	var row map[string]interface{}
+	if err := json.Unmarshal([]byte(content), &row); err != nil {
+		return content
+	}
+
+	changed := false
+	for _, col := range columns {
+		v, ok := row[col]
+		if !ok {
+			continue
+		}
+		if isDiff {
+			if change, ok := v.(map[string]interface{}); ok {
+				for side, val := range change {
+					if val != nil {
+						change[side] = pseudonym
+					}
+				}
+			}
+		} else if v != nil {
+			row[col] = pseudonym
+		}
+		changed = true
+	}
+	if !changed {
+		return content
+	}
+
+	b, _ := json.Marshal(row)
+	return string(b)
+}
+
+func piiColumns(value interface{}) []string {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(value); err != nil {
+		return nil
+	}
+
+	var columns []string
+	for _, field := range stmt.Schema.Fields {
+		if field.DBName != "" && field.Tag.Get("privacy") == "pii" {
+			columns = append(columns, field.DBName)
+		}
+	}
+	return columns
+}
+
+func userTable() string {
+	stmt := &gorm.Statement{DB: db}
+	_ = stmt.Parse(&model.User{})
+	return stmt.Table
+}
@@ -0,0 +1,193 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"go-server-template/pkg/crypt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// ReencryptStats counts the work of Reencrypt.
+type ReencryptStats struct {
+	Tables int `json:"tables"`
+	Rows   int `json:"rows"`
+	// Values is the number of values encrypted again under the primary key,
+	// or encrypted for the first time.
+	Values int `json:"values"`
+	// Indexes is the number of blind indexes recomputed.
+	Indexes int `json:"indexes"`
+	// Conflicts is the number of rows changed while they were re-encrypted,
+	// and left as they were written.
+	Conflicts int `json:"conflicts"`
+}
+
+// Reencrypt walks the tables of values by primary key, batchSize rows at a
+// time, and encrypts again under the primary key the encrypted columns
+// sealed by another key or still in plaintext, then recomputes the stale
+// blind indexes. Each row is written only if its columns are unchanged since
+// it was read, so it is safe to run next to the servers. dryRun only counts.
+func Reencrypt(ctx context.Context, batchSize int, dryRun bool, values ...interface{}) (*ReencryptStats, error) {
+	keyring := crypt.GetKeyring()
+	if keyring == nil {
+		return nil, crypt.ErrNotConfigured
+	}
+
+	stats := &ReencryptStats{}
+	for _, value := range values {
+		stmt := &gorm.Statement{DB: Conn(ctx)}
+		if err := stmt.Parse(value); err != nil {
+			return stats, err
+		}
+		encrypted := crypt.EncryptedFields(stmt.Schema)
+		blind, err := crypt.BlindFields(stmt.Schema)
+		if err != nil {
+			return stats, err
+		}
+		if len(encrypted) == 0 && len(blind) == 0 {
+			continue
+		}
+		if stmt.Schema.PrioritizedPrimaryField == nil {
+			return stats, fmt.Errorf("reencrypt %s: no primary key", stmt.Schema.Table)
+		}
+
+		stats.Tables++
+		t := &reencryptTable{keyring: keyring, schema: stmt.Schema, encrypted: encrypted, blind: blind}
+		if err = t.walk(ctx, batchSize, dryRun, stats); err != nil {
+			return stats, fmt.Errorf("reencrypt %s: %w", stmt.Schema.Table, err)
+		}
+	}
+	return stats, nil
+}
+
+type reencryptTable struct {
+	keyring   *crypt.Keyring
+	schema    *schema.Schema
+	encrypted []*schema.Field
+	blind     []crypt.BlindField
+}
+
+func (t *reencryptTable) walk(ctx context.Context, batchSize int, dryRun bool, stats *ReencryptStats) error {
+	pk := t.schema.PrioritizedPrimaryField.DBName
+	columns := []string{pk}
+	seen := map[string]bool{pk: true}
+	add := func(column string) {
+		if !seen[column] {
+			seen[column] = true
+			columns = append(columns, column)
+		}
+	}
+	for _, f := range t.encrypted {
+		add(f.DBName)
+	}
+	for _, f := range t.blind {
+		add(f.Index.DBName)
+		add(f.Source.DBName)
+	}
+
+	var last interface{}
+	for {
+		// the raw table, so that the serializer and the plugins stay out
+		tx := Conn(ctx).Table(t.schema.Table).Select(columns).Order(pk).Limit(batchSize)
+		if last != nil {
+			tx = tx.Where(pk+" > ?", last)
+		}
+		var rows []map[string]interface{}
+		if err := tx.Find(&rows).Error; err != nil {
+			return err
+		}
+		if len(rows) == 0 {
+			return nil
+		}
+
+		for _, row := range rows {
+			stats.Rows++
+			updates, where, err := t.row(row, stats)
+			if err != nil {
+				return fmt.Errorf("%s %v: %w", pk, row[pk], err)
+			}
+			if len(updates) == 0 || dryRun {
+				continue
+			}
+			where[pk] = row[pk]
+			res := Conn(ctx).Table(t.schema.Table).Where(where).UpdateColumns(updates)
+			if res.Error != nil {
+				return res.Error
+			}
+			if res.RowsAffected == 0 {
+				stats.Conflicts++
+			}
+		}
+		last = rows[len(rows)-1][pk]
+	}
+}
+
+// row returns the columns of row to write, and the columns they were
+// computed of.
+func (t *reencryptTable) row(row map[string]interface{}, stats *ReencryptStats) (updates, where map[string]interface{}, err error) {
+	updates = make(map[string]interface{})
+	where = make(map[string]interface{})
+
+	plaintext := func(f *schema.Field) (string, error) {
+		value := rawString(row[f.DBName])
+		if !crypt.IsEncrypted(value) {
+			return value, nil
+		}
+		b, err := t.keyring.Decrypt(value, crypt.Binding(f))
+		return string(b), err
+	}
+
+	for _, f := range t.encrypted {
+		value := rawString(row[f.DBName])
+		if value == "" {
+			continue
+		}
+		if id, ok := crypt.KeyID(value); ok && id == t.keyring.Primary() {
+			continue
+		}
+		text, err := plaintext(f)
+		if err != nil {
+			return nil, nil, err
+		}
+		if updates[f.DBName], err = t.keyring.Encrypt([]byte(text), crypt.Binding(f)); err != nil {
+			return nil, nil, err
+		}
+		where[f.DBName] = row[f.DBName]
+		stats.Values++
+	}
+
+	for _, f := range t.blind {
+		text, err := plaintext(f.Source)
+		if err != nil {
+			return nil, nil, err
+		}
+		var index string
+		if text != "" {
+			if index, err = t.keyring.BlindIndex(f.Source.DBName, text); err != nil {
+				return nil, nil, err
+			}
+		}
+		if index == rawString(row[f.Index.DBName]) {
+			continue
+		}
+		updates[f.Index.DBName] = index
+		where[f.Source.DBName] = row[f.Source.DBName]
+		stats.Indexes++
+	}
+	return updates, where, nil
+}
+
+// rawString returns a string column as scanned into a map.
+func rawString(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case *interface{}:
+		if v != nil {
+			return rawString(*v)
+		}
+	}
+	return ""
+}
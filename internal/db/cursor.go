@@ -0,0 +1,84 @@
+package db
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"sync"
+)
+
+var (
+	cursorMux  sync.RWMutex
+	cursorAEAD = newCursorAEAD(randomCursorKey())
+)
+
+// SetCursorSecret sets the secret sealing the pagination cursors. The
+// replicas must share it for a cursor to be valid on any of them, until it
+// is set each process seals with a random key.
+func SetCursorSecret(secret string) {
+	key := sha256.Sum256([]byte("cursor\x00" + secret))
+	aead := newCursorAEAD(key[:])
+	cursorMux.Lock()
+	defer cursorMux.Unlock()
+	cursorAEAD = aead
+}
+
+// SealCursor encodes the keyset values of the last row of a page as an
+// opaque cursor. They are encrypted since they may hold internal ids.
+func SealCursor(values interface{}) string {
+	b, _ := json.Marshal(values)
+
+	cursorMux.RLock()
+	aead := cursorAEAD
+	cursorMux.RUnlock()
+
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(b)+aead.Overhead())
+	_, _ = rand.Read(nonce)
+	return base64.RawURLEncoding.EncodeToString(aead.Seal(nonce, nonce, b, nil))
+}
+
+// OpenCursor decodes a cursor from SealCursor into values, ErrInvalidCursor
+// is returned for a cursor that was not sealed with the current secret.
+func OpenCursor(cursor string, values interface{}) error {
+	sealed, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return ErrInvalidCursor
+	}
+
+	cursorMux.RLock()
+	aead := cursorAEAD
+	cursorMux.RUnlock()
+
+	if len(sealed) < aead.NonceSize() {
+		return ErrInvalidCursor
+	}
+	nonce, sealed := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	b, err := aead.Open(nil, nonce, sealed, nil)
+	if err != nil || json.Unmarshal(b, values) != nil {
+		return ErrInvalidCursor
+	}
+	return nil
+}
+
+func newCursorAEAD(key []byte) cipher.AEAD {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		panic(err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		panic(err)
+	}
+	return aead
+}
+
+func randomCursorKey() []byte {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		panic(err)
+	}
+	return key
+}
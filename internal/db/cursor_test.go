@@ -0,0 +1,36 @@
+package db
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestCursor(t *testing.T) {
+	SetCursorSecret("secret")
+	cursor := SealCursor([]interface{}{"2024-01-01T00:00:00Z", 4242})
+
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || strings.Contains(string(raw), "4242") {
+		t.Fatalf("expected an opaque cursor, got %q", raw)
+	}
+	var values []interface{}
+	if err = OpenCursor(cursor, &values); err != nil || len(values) != 2 || values[1] != float64(4242) {
+		t.Fatalf("unexpected values %v (%v)", values, err)
+	}
+
+	forged := base64.RawURLEncoding.EncodeToString([]byte(`["2024-01-01T00:00:00Z",1]`))
+	raw[len(raw)-1] ^= 1
+	tampered := base64.RawURLEncoding.EncodeToString(raw)
+	for name, c := range map[string]string{"forged": forged, "tampered": tampered, "garbage": "garbage!"} {
+		if err = OpenCursor(c, &values); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("%s: expected ErrInvalidCursor, got %v", name, err)
+		}
+	}
+
+	SetCursorSecret("other")
+	if err = OpenCursor(cursor, &values); !errors.Is(err, ErrInvalidCursor) {
+		t.Fatalf("expected a cursor of another secret to be refused, got %v", err)
+	}
+}
@@ -1,15 +1,67 @@
 package db
 
 import (
+	"errors"
+	"sync"
+	"sync/atomic"
+
 	"gorm.io/gorm"
 )
 
 var db *gorm.DB
 
+var (
+	ready atomic.Bool
+
+	closeMux sync.Mutex
+	closers  []func() error
+)
+
 func InitDB(d *gorm.DB) {
 	db = d
 }
 
 func GetDB() *gorm.DB {
 	return db
-}
\ No newline at end of file
+}
+
+// SetReady marks whether the database is connected and migrated.
+func SetReady(r bool) {
+	ready.Store(r)
+}
+
+// Ready reports whether the database is connected and migrated.
+func Ready() bool {
+	return ready.Load()
+}
+
+// OnClose registers fn to be called by Close, e.g. to close replicas.
+func OnClose(fn func() error) {
+	closeMux.Lock()
+	defer closeMux.Unlock()
+	closers = append(closers, fn)
+}
+
+// Close marks the database not ready and closes its connection pool and
+// everything registered with OnClose.
+func Close() error {
+	ready.Store(false)
+
+	closeMux.Lock()
+	fns := closers
+	closers = nil
+	closeMux.Unlock()
+
+	var err error
+	for _, fn := range fns {
+		err = errors.Join(err, fn())
+	}
+	if db != nil {
+		sqlDB, dbErr := db.DB()
+		if dbErr == nil {
+			dbErr = sqlDB.Close()
+		}
+		err = errors.Join(err, dbErr)
+	}
+	return err
+}
@@ -0,0 +1,37 @@
+// Package dbtest opens the databases of the tests.
+package dbtest
+
+import (
+	"go-server-template/internal/db"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	gormLogger "gorm.io/gorm/logger"
+)
+
+// Open opens an in-memory sqlite database with the tables of models, makes
+// it the database of package db and closes it at the end of the test.
+//
+// The database lives as long as its single connection, which every query
+// shares, transactions included.
+func Open(t testing.TB, models ...interface{}) *gorm.DB {
+	t.Helper()
+
+	dB, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: gormLogger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := dB.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	if err = dB.AutoMigrate(models...); err != nil {
+		t.Fatal(err)
+	}
+	db.InitDB(dB)
+	return dB
+}
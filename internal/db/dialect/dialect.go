@@ -0,0 +1,63 @@
+// Package dialect maps conf.Database.Type to the GORM dialector that opens it.
+// Each driver registers a Builder from an init function, so supporting another
+// database only takes a new file in this package.
+package dialect
+
+import (
+	"fmt"
+	"go-server-template/internal/conf"
+	"sort"
+	"sync"
+
+	"gorm.io/gorm"
+)
+
+// Builder returns the dialector for database. It uses database.DSN when set
+// and the structured connection fields otherwise; the extra parameters
+// (timezone, charset, search path, connect timeout and params) apply to both.
+type Builder func(database conf.Database) (gorm.Dialector, error)
+
+var (
+	mux      sync.RWMutex
+	builders = make(map[string]Builder)
+)
+
+// Register makes a builder available under name. It panics if name is
+// already registered, like sql.Register.
+func Register(name string, builder Builder) {
+	mux.Lock()
+	defer mux.Unlock()
+
+	if builder == nil {
+		panic("dialect: Register builder is nil")
+	}
+	if _, dup := builders[name]; dup {
+		panic("dialect: Register called twice for " + name)
+	}
+	builders[name] = builder
+}
+
+// Open returns the dialector of database.Type.
+func Open(database conf.Database) (gorm.Dialector, error) {
+	mux.RLock()
+	builder, ok := builders[database.Type]
+	mux.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("not supported database type: %s", database.Type)
+	}
+	return builder(database)
+}
+
+// Names returns the sorted names of the registered dialects.
+func Names() []string {
+	mux.RLock()
+	defer mux.RUnlock()
+
+	names := make([]string, 0, len(builders))
+	for name := range builders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,151 @@
+package dialect
+
+import (
+	"go-server-template/internal/conf"
+	"strings"
+	"testing"
+)
+
+func TestOpen(t *testing.T) {
+	for _, name := range []string{"mysql", "postgres", "sqlite3"} {
+		if _, err := Open(conf.Database{Type: name, File: "data.db", DSN: dsnFor(name)}); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+	if _, err := Open(conf.Database{Type: "oracle"}); err == nil {
+		t.Error("unknown dialect should fail")
+	}
+}
+
+func dsnFor(name string) string {
+	if name == "mysql" {
+		return "root@tcp(localhost:3306)/app"
+	}
+	return ""
+}
+
+func TestMysqlDSN(t *testing.T) {
+	tests := []struct {
+		name     string
+		database conf.Database
+		want     string
+	}{
+		{
+			name: "structured without tls",
+			database: conf.Database{
+				Host: "db", Port: 3306, User: "root", Password: "pw", Name: "app",
+			},
+			want: "root:pw@tcp(db:3306)/app?loc=Local&parseTime=true&charset=utf8mb4",
+		},
+		{
+			name: "structured with extras",
+			database: conf.Database{
+				Host: "db", Port: 3306, User: "root", Password: "pw", Name: "app",
+				SSLMode: "skip-verify", TimeZone: "Asia/Shanghai", Charset: "utf8", ConnectTimeout: 5,
+				Params: map[string]string{"sql_mode": "'ANSI'"},
+			},
+			want: "root:pw@tcp(db:3306)/app?loc=Asia%2FShanghai&parseTime=true&timeout=5s&tls=skip-verify&charset=utf8&sql_mode=%27ANSI%27",
+		},
+		{
+			name: "raw dsn",
+			database: conf.Database{
+				DSN: "u:p@tcp(h:1)/d?parseTime=true", Host: "ignored", ConnectTimeout: 3,
+			},
+			want: "u:p@tcp(h:1)/d?parseTime=true&timeout=3s",
+		},
+	}
+	for _, tt := range tests {
+		got, err := mysqlDSN(tt.database)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got != tt.want {
+			t.Errorf("%s:\n got %s\nwant %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPostgresDSN(t *testing.T) {
+	tests := []struct {
+		name     string
+		database conf.Database
+		want     string
+	}{
+		{
+			name: "structured without sslmode or timezone",
+			database: conf.Database{
+				Host: "db", Port: 5432, User: "app", Password: "p w'", Name: "app",
+			},
+			want: `dbname=app host=db password='p w\'' port=5432 user=app`,
+		},
+		{
+			name: "structured with extras",
+			database: conf.Database{
+				Host: "db", Port: 5432, User: "app", Name: "app", Password: "pw",
+				SSLMode: "require", TimeZone: "UTC", SearchPath: "tenant,public", ConnectTimeout: 5,
+			},
+			want: "connect_timeout=5 dbname=app host=db password=pw port=5432 search_path=tenant,public sslmode=require timezone=UTC user=app",
+		},
+		{
+			name:     "raw keyword dsn",
+			database: conf.Database{DSN: "host=h dbname=d", TimeZone: "UTC"},
+			want:     "host=h dbname=d timezone=UTC",
+		},
+		{
+			name:     "raw url dsn",
+			database: conf.Database{DSN: "postgres://u:p@h:5432/d?sslmode=disable", SearchPath: "s"},
+			want:     "postgres://u:p@h:5432/d?search_path=s&sslmode=disable",
+		},
+	}
+	for _, tt := range tests {
+		got, err := postgresDSN(tt.database)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got != tt.want {
+			t.Errorf("%s:\n got %s\nwant %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestReplicaDSN(t *testing.T) {
+	primary := conf.Database{DSN: "host=primary dbname=app user=app", Port: 5432, User: "app", Password: "pw", Name: "app"}
+
+	got, err := postgresDSN(primary.Replica(conf.DatabaseReplica{Host: "replica"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "dbname=app host=replica password=pw port=5432 user=app"; got != want {
+		t.Errorf("replica without dsn:\n got %s\nwant %s", got, want)
+	}
+
+	got, err = postgresDSN(primary.Replica(conf.DatabaseReplica{DSN: "host=replica dbname=app"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "host=replica dbname=app"; got != want {
+		t.Errorf("replica with dsn:\n got %s\nwant %s", got, want)
+	}
+}
+
+func TestSqliteDSN(t *testing.T) {
+	got, err := sqliteDSN(conf.Database{File: "data/data.db", ConnectTimeout: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "data/data.db?_busy_timeout=2000&_journal=WAL&_vacuum=incremental"; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+
+	got, err = sqliteDSN(conf.Database{DSN: "file::memory:?cache=shared", TimeZone: "UTC"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "file::memory:?cache=shared&_loc=UTC"; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+
+	if _, err = sqliteDSN(conf.Database{File: "data"}); err == nil || !strings.Contains(err.Error(), "db name") {
+		t.Errorf("invalid file name should fail, got %v", err)
+	}
+}
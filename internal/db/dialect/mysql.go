@@ -0,0 +1,65 @@
+package dialect
+
+import (
+	"fmt"
+	"go-server-template/internal/conf"
+	"time"
+
+	driver "github.com/go-sql-driver/mysql"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+func init() {
+	Register("mysql", func(database conf.Database) (gorm.Dialector, error) {
+		dsn, err := mysqlDSN(database)
+		if err != nil {
+			return nil, err
+		}
+		return mysql.Open(dsn), nil
+	})
+}
+
+func mysqlDSN(database conf.Database) (string, error) {
+	var cfg *driver.Config
+	if database.DSN != "" {
+		var err error
+		if cfg, err = driver.ParseDSN(database.DSN); err != nil {
+			return "", err
+		}
+	} else {
+		cfg = driver.NewConfig()
+		cfg.User = database.User
+		cfg.Passwd = database.Password
+		cfg.Net = "tcp"
+		cfg.Addr = fmt.Sprintf("%s:%d", database.Host, database.Port)
+		cfg.DBName = database.Name
+		cfg.ParseTime = true
+		cfg.Loc = time.Local
+		cfg.Params = map[string]string{"charset": "utf8mb4"}
+	}
+
+	if database.TimeZone != "" {
+		loc, err := time.LoadLocation(database.TimeZone)
+		if err != nil {
+			return "", err
+		}
+		cfg.Loc = loc
+	}
+	if database.SSLMode != "" {
+		cfg.TLSConfig = database.SSLMode
+	}
+	if database.ConnectTimeout > 0 {
+		cfg.Timeout = time.Duration(database.ConnectTimeout) * time.Second
+	}
+	if cfg.Params == nil {
+		cfg.Params = make(map[string]string)
+	}
+	if database.Charset != "" {
+		cfg.Params["charset"] = database.Charset
+	}
+	for k, v := range database.Params {
+		cfg.Params[k] = v
+	}
+	return cfg.FormatDSN(), nil
+}
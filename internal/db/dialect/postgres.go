@@ -0,0 +1,92 @@
+package dialect
+
+import (
+	"fmt"
+	"go-server-template/internal/conf"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+func init() {
+	Register("postgres", func(database conf.Database) (gorm.Dialector, error) {
+		dsn, err := postgresDSN(database)
+		if err != nil {
+			return nil, err
+		}
+		return postgres.Open(dsn), nil
+	})
+}
+
+func postgresDSN(database conf.Database) (string, error) {
+	params := make(map[string]string)
+	if database.DSN == "" {
+		params["host"] = database.Host
+		params["port"] = strconv.Itoa(database.Port)
+		params["user"] = database.User
+		params["password"] = database.Password
+		params["dbname"] = database.Name
+	}
+	if database.SSLMode != "" {
+		params["sslmode"] = database.SSLMode
+	}
+	if database.TimeZone != "" {
+		params["timezone"] = database.TimeZone
+	}
+	if database.Charset != "" {
+		params["client_encoding"] = database.Charset
+	}
+	if database.SearchPath != "" {
+		params["search_path"] = database.SearchPath
+	}
+	if database.ConnectTimeout > 0 {
+		params["connect_timeout"] = strconv.FormatInt(database.ConnectTimeout, 10)
+	}
+	for k, v := range database.Params {
+		params[k] = v
+	}
+
+	dsn := database.DSN
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		u, err := url.Parse(dsn)
+		if err != nil {
+			return "", err
+		}
+		query := u.Query()
+		for k, v := range params {
+			query.Set(k, v)
+		}
+		u.RawQuery = query.Encode()
+		return u.String(), nil
+	}
+
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys)+1)
+	if dsn != "" {
+		pairs = append(pairs, dsn)
+	}
+	// later keywords win in libpq style connection strings
+	for _, k := range keys {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", k, quotePostgres(params[k])))
+	}
+	return strings.Join(pairs, " "), nil
+}
+
+// quotePostgres quotes a keyword/value connection string value if needed.
+func quotePostgres(v string) string {
+	if v != "" && !strings.ContainsAny(v, ` '\`) {
+		return v
+	}
+	v = strings.ReplaceAll(v, `\`, `\\`)
+	v = strings.ReplaceAll(v, `'`, `\'`)
+	return "'" + v + "'"
+}
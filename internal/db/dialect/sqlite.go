@@ -0,0 +1,55 @@
+package dialect
+
+import (
+	"fmt"
+	"go-server-template/internal/conf"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func init() {
+	Register("sqlite3", func(database conf.Database) (gorm.Dialector, error) {
+		dsn, err := sqliteDSN(database)
+		if err != nil {
+			return nil, err
+		}
+		return sqlite.Open(dsn), nil
+	})
+}
+
+func sqliteDSN(database conf.Database) (string, error) {
+	dsn := database.DSN
+	params := url.Values{}
+	if dsn == "" {
+		if !(strings.HasSuffix(database.File, ".db") && len(database.File) > 3) {
+			return "", fmt.Errorf("db name error.")
+		}
+		dsn = database.File
+		params.Set("_journal", "WAL")
+		params.Set("_vacuum", "incremental")
+	}
+
+	if database.TimeZone != "" {
+		params.Set("_loc", database.TimeZone)
+	}
+	if database.ConnectTimeout > 0 {
+		// there is no connection to set up, wait for locks instead
+		params.Set("_busy_timeout", strconv.FormatInt(database.ConnectTimeout*1000, 10))
+	}
+	for k, v := range database.Params {
+		params.Set(k, v)
+	}
+	if len(params) == 0 {
+		return dsn, nil
+	}
+
+	sep := "?"
+	if strings.Contains(dsn, "?") {
+		sep = "&"
+	}
+	return dsn + sep + params.Encode(), nil
+}
@@ -0,0 +1,46 @@
+package db
+
+import (
+	"context"
+	"go-server-template/internal/model"
+	"gorm.io/gorm"
+)
+
+func CreateFile(ctx context.Context, file *model.File) error {
+	return Conn(ctx).Create(file).Error
+}
+
+func GetFileByPublicID(ctx context.Context, publicID string) (file *model.File, err error) {
+	file = &model.File{}
+	if err = Conn(ctx).Where("public_id = ?", publicID).First(file).Error; err != nil {
+		return nil, err
+	}
+
+	return file, nil
+}
+
+func ListFilesOfOwner(ctx context.Context, ownerID uint) (files []*model.File, err error) {
+	err = Conn(ctx).Where("owner_id = ?", ownerID).Order("id asc").Find(&files).Error
+	return files, err
+}
+
+// SumFileSize returns the bytes used by the owner's files.
+func SumFileSize(ctx context.Context, ownerID uint) (total int64, err error) {
+	err = Conn(ctx).Model(&model.File{}).
+		Where("owner_id = ?", ownerID).
+		Select("COALESCE(SUM(size), 0)").
+		Scan(&total).Error
+	return total, err
+}
+
+// DeleteFile removes the file row for good, its content must be deleted from storage.
+func DeleteFile(ctx context.Context, id uint) error {
+	tx := Conn(ctx).Unscoped().Delete(&model.File{}, id)
+	if tx.Error != nil {
+		return tx.Error
+	}
+	if tx.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package db
+
+import (
+	"context"
+	"go-server-template/internal/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ListFeatureFlags returns every flag stored in the database.
+func ListFeatureFlags(ctx context.Context) (flags []*model.FeatureFlag, err error) {
+	err = Conn(ctx).Order("name asc").Find(&flags).Error
+	return flags, err
+}
+
+// SaveFeatureFlag creates the flag f or replaces its definition, as an
+// update so the audit log tells both apart. created reports which.
+func SaveFeatureFlag(ctx context.Context, f *model.FeatureFlag) (created bool, err error) {
+	tx := Conn(ctx).Model(&model.FeatureFlag{Key: f.Key}).Update("definition", f.Definition)
+	if tx.Error != nil {
+		return false, tx.Error
+	}
+	if tx.RowsAffected > 0 {
+		return false, nil
+	}
+
+	tx = Conn(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(f)
+	if tx.Error != nil {
+		return false, tx.Error
+	}
+	if tx.RowsAffected == 0 {
+		// created concurrently, replaced instead
+		return false, Conn(ctx).Model(&model.FeatureFlag{Key: f.Key}).Update("definition", f.Definition).Error
+	}
+	return true, nil
+}
+
+// DeleteFeatureFlag deletes the flag key, gorm.ErrRecordNotFound is
+// returned when it is not stored.
+func DeleteFeatureFlag(ctx context.Context, key string) error {
+	tx := Conn(ctx).Where("name = ?", key).Delete(&model.FeatureFlag{})
+	if tx.Error != nil {
+		return tx.Error
+	}
+	if tx.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
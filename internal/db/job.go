@@ -0,0 +1,286 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"go-server-template/internal/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+// ErrJobState is returned when a job is not in a state the change applies to.
+var ErrJobState = errors.New("job state does not allow this change")
+
+// JobFilter narrows down ListJobs, zero values are ignored.
+type JobFilter struct {
+	Status string
+	Name   string
+	Offset int
+	Limit  int
+}
+
+// CreateJob inserts j with the connection of ctx, so it is only run once the
+// transaction ctx carries commits. A job with the same unique key that is
+// still pending or running is returned instead, with created false.
+func CreateJob(ctx context.Context, j *model.Job) (existing *model.Job, created bool, err error) {
+	if j.UniqueKey == nil {
+		if err = Conn(ctx).Create(j).Error; err != nil {
+			return nil, false, err
+		}
+		return j, true, nil
+	}
+
+	if existing, err = queuedJob(ctx, *j.UniqueKey); existing != nil || err != nil {
+		return existing, false, err
+	}
+	// a concurrent enqueue may insert the same key after the look-up, its
+	// job is returned once the insert of j conflicts with it
+	err = insertJob(ctx, j)
+	if IsUniqueViolation(err) {
+		if existing, err2 := queuedJob(ctx, *j.UniqueKey); existing != nil || err2 != nil {
+			return existing, false, err2
+		}
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return j, true, nil
+}
+
+func queuedJob(ctx context.Context, uniqueKey string) (*model.Job, error) {
+	var jobs []*model.Job
+	if err := Conn(UsePrimary(ctx)).Where("unique_key = ?", uniqueKey).Limit(1).Find(&jobs).Error; err != nil {
+		return nil, err
+	}
+	if len(jobs) == 0 {
+		return nil, nil
+	}
+	return jobs[0], nil
+}
+
+// insertJob inserts j, in a savepoint when ctx carries a transaction, so a
+// failed insert does not abort it.
+func insertJob(ctx context.Context, j *model.Job) error {
+	tx, depth, ok := TxFrom(ctx)
+	if !ok {
+		return Conn(ctx).Create(j).Error
+	}
+	name := SavePointName(depth + 1)
+	if err := tx.SavePoint(name).Error; err != nil {
+		return err
+	}
+	if err := tx.Create(j).Error; err != nil {
+		if rbErr := tx.RollbackTo(name).Error; rbErr != nil {
+			return rbErr
+		}
+		return err
+	}
+	return nil
+}
+
+// claimable limits tx to due pending jobs and to running jobs whose worker
+// let the lock expire.
+func claimable(tx *gorm.DB, now time.Time) *gorm.DB {
+	return tx.Where("((status = ? AND run_at <= ?) OR (status = ? AND locked_until < ?))",
+		model.JobPending, now, model.JobRunning, now)
+}
+
+// ClaimJobs locks up to limit due jobs for worker until lease and counts an
+// attempt of each. Postgres and mysql skip the rows locked by concurrent
+// claims, sqlite, which serializes writers anyway, claims each job with a
+// conditional update.
+func ClaimJobs(ctx context.Context, worker string, now, lease time.Time, limit int) ([]*model.Job, error) {
+	if limit <= 0 {
+		return nil, nil
+	}
+	conn := Conn(ctx)
+	switch conn.Dialector.Name() {
+	case "postgres", "mysql":
+		return claimJobsSkipLocked(conn, worker, now, lease, limit)
+	default:
+		return claimJobsEach(conn, worker, now, lease, limit)
+	}
+}
+
+// lockClaimable selects up to limit claimable jobs and locks them, skipping
+// the ones locked by concurrent claims.
+func lockClaimable(tx *gorm.DB, now time.Time, limit int) *gorm.DB {
+	return claimable(tx, now).
+		Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+		Order("run_at asc, id asc").
+		Limit(limit)
+}
+
+func claimJobsSkipLocked(conn *gorm.DB, worker string, now, lease time.Time, limit int) (jobs []*model.Job, err error) {
+	err = conn.Transaction(func(tx *gorm.DB) error {
+		err := lockClaimable(tx, now, limit).Find(&jobs).Error
+		if err != nil || len(jobs) == 0 {
+			return err
+		}
+
+		ids := make([]uint, 0, len(jobs))
+		for _, j := range jobs {
+			ids = append(ids, j.ID)
+		}
+		return tx.Model(&model.Job{}).Where("id IN ?", ids).Updates(map[string]interface{}{
+			"status":       model.JobRunning,
+			"attempts":     gorm.Expr("attempts + 1"),
+			"locked_by":    worker,
+			"locked_until": lease,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, j := range jobs {
+		claimed(j, worker, lease)
+	}
+	return jobs, nil
+}
+
+func claimJobsEach(conn *gorm.DB, worker string, now, lease time.Time, limit int) ([]*model.Job, error) {
+	var candidates []*model.Job
+	err := claimable(conn, now).
+		Order("run_at asc, id asc").
+		Limit(limit).
+		Find(&candidates).Error
+	if err != nil {
+		return nil, err
+	}
+
+	jobs := make([]*model.Job, 0, len(candidates))
+	for _, j := range candidates {
+		ok, err := claimRow(claimable(conn.Model(&model.Job{}), now), j.ID, j.Attempts, map[string]interface{}{
+			"status":       model.JobRunning,
+			"locked_by":    worker,
+			"locked_until": lease,
+		})
+		if err != nil {
+			return jobs, err
+		}
+		if ok {
+			claimed(j, worker, lease)
+			jobs = append(jobs, j)
+		}
+	}
+	return jobs, nil
+}
+
+func claimed(j *model.Job, worker string, lease time.Time) {
+	j.Status = model.JobRunning
+	j.Attempts++
+	j.LockedBy = worker
+	j.LockedUntil = &lease
+}
+
+// ownedJob limits tx to j as long as it is still running for the claim of
+// worker, a job claimed again after its lock expired is left alone.
+func ownedJob(ctx context.Context, j *model.Job, worker string) *gorm.DB {
+	tx := Conn(ctx).Model(&model.Job{}).Where("status = ? AND locked_by = ?", model.JobRunning, worker)
+	return claimedRow(tx, j.ID, j.Attempts)
+}
+
+// CompleteJob records the success of the claim of worker on j.
+func CompleteJob(ctx context.Context, j *model.Job, worker string, at time.Time) error {
+	return ownedJob(ctx, j, worker).Updates(map[string]interface{}{
+		"status":       model.JobSucceeded,
+		"unique_key":   nil,
+		"locked_until": nil,
+		"last_error":   "",
+		"finished_at":  at,
+	}).Error
+}
+
+// FailJob records the failure of the claim of worker on j, which runs again
+// at next, or never again when dead.
+func FailJob(ctx context.Context, j *model.Job, worker, reason string, next time.Time, dead bool) error {
+	values := map[string]interface{}{
+		"status":       model.JobPending,
+		"locked_until": nil,
+		"last_error":   reason,
+		"run_at":       next,
+	}
+	if dead {
+		values["status"] = model.JobDead
+		values["unique_key"] = nil
+		values["finished_at"] = time.Now()
+	}
+	return ownedJob(ctx, j, worker).Updates(values).Error
+}
+
+func ListJobs(ctx context.Context, f JobFilter) (jobs []*model.Job, total int64, err error) {
+	tx := Conn(ctx).Model(&model.Job{})
+	if f.Status != "" {
+		tx = tx.Where("status = ?", f.Status)
+	}
+	if f.Name != "" {
+		tx = tx.Where("name = ?", f.Name)
+	}
+
+	if err = tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	if err = tx.Order("id desc").Offset(f.Offset).Limit(f.Limit).Find(&jobs).Error; err != nil {
+		return nil, 0, err
+	}
+
+	return jobs, total, nil
+}
+
+func GetJob(ctx context.Context, jobID string) (*model.Job, error) {
+	var j model.Job
+	if err := Conn(ctx).Where("job_id = ?", jobID).First(&j).Error; err != nil {
+		return nil, err
+	}
+	return &j, nil
+}
+
+// RetryJob queues the dead or canceled job jobID again with a fresh count of
+// attempts. Its unique key is not restored.
+func RetryJob(ctx context.Context, jobID string) error {
+	return changeJob(ctx, jobID, []string{model.JobDead, model.JobCanceled}, map[string]interface{}{
+		"status":      model.JobPending,
+		"attempts":    0,
+		"last_error":  "",
+		"run_at":      time.Now(),
+		"finished_at": nil,
+	})
+}
+
+// CancelJob cancels the pending job jobID, a running job cannot be canceled.
+func CancelJob(ctx context.Context, jobID string) error {
+	return changeJob(ctx, jobID, []string{model.JobPending}, map[string]interface{}{
+		"status":      model.JobCanceled,
+		"unique_key":  nil,
+		"finished_at": time.Now(),
+	})
+}
+
+// changeJob applies values to the job jobID when it is in one of statuses,
+// ErrJobState is returned when it exists in another one.
+func changeJob(ctx context.Context, jobID string, statuses []string, values map[string]interface{}) error {
+	tx := Conn(ctx).Model(&model.Job{}).
+		Where("job_id = ? AND status IN ?", jobID, statuses).
+		Updates(values)
+	if tx.Error != nil {
+		return tx.Error
+	}
+	if tx.RowsAffected == 0 {
+		if _, err := GetJob(ctx, jobID); err != nil {
+			return err
+		}
+		return ErrJobState
+	}
+	return nil
+}
+
+// DeleteFinishedJobs deletes the jobs succeeded or canceled before t, dead
+// jobs are kept until they are retried.
+func DeleteFinishedJobs(ctx context.Context, t time.Time) (int64, error) {
+	tx := Conn(ctx).
+		Where("status IN ? AND finished_at < ?", []string{model.JobSucceeded, model.JobCanceled}, t).
+		Delete(&model.Job{})
+	return tx.RowsAffected, tx.Error
+}
@@ -0,0 +1,39 @@
+package db
+
+import (
+	"go-server-template/internal/model"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	gormLogger "gorm.io/gorm/logger"
+)
+
+func TestLockClaimableSQL(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	want := []string{
+		`WHERE ((status = 'pending' AND run_at <= '2024-01-01 00:00:00') OR (status = 'running' AND locked_until < '2024-01-01 00:00:00'))`,
+		`ORDER BY run_at asc, id asc LIMIT 5 FOR UPDATE SKIP LOCKED`,
+	}
+	for _, dialector := range []gorm.Dialector{
+		postgres.New(postgres.Config{DSN: "host=localhost dbname=test"}),
+		mysql.New(mysql.Config{DSN: "root@tcp(localhost:3306)/test", SkipInitializeWithVersion: true}),
+	} {
+		dB, err := gorm.Open(dialector, &gorm.Config{DryRun: true, DisableAutomaticPing: true, Logger: gormLogger.Discard})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := dB.ToSQL(func(tx *gorm.DB) *gorm.DB {
+			var jobs []*model.Job
+			return lockClaimable(tx, now, 5).Find(&jobs)
+		})
+		for _, want := range want {
+			if !strings.Contains(got, want) {
+				t.Errorf("%s: expected %s in %s", dialector.Name(), want, got)
+			}
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package db
+
+import (
+	"context"
+	"go-server-template/internal/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+// AcquireLease makes holder hold the lease name for ttl when it is free,
+// expired or already held by holder, and returns its fencing token. The
+// token grows each time the lease changes hands, ok is false when another
+// holder has it.
+//
+// The lease is written outside the transaction of ctx, so other replicas
+// see it at once. Expiry is judged by the local clock, the clocks of the
+// replicas must be in sync well within ttl.
+func AcquireLease(ctx context.Context, name, holder string, ttl time.Duration) (token uint64, ok bool, err error) {
+	ctx = WithoutTx(UsePrimary(ctx))
+	now := time.Now()
+	expires := now.Add(ttl)
+
+	// renewal
+	tx := Conn(ctx).Model(&model.Lease{}).
+		Where("name = ? AND holder = ? AND expires_at >= ?", name, holder, now).
+		Update("expires_at", expires)
+	if tx.Error != nil {
+		return 0, false, tx.Error
+	}
+
+	if tx.RowsAffected == 0 {
+		// take over of a released or expired lease
+		tx = Conn(ctx).Model(&model.Lease{}).
+			Where("name = ? AND expires_at < ?", name, now).
+			Updates(map[string]interface{}{"holder": holder, "expires_at": expires, "token": gorm.Expr("token + 1")})
+		if tx.Error != nil {
+			return 0, false, tx.Error
+		}
+	}
+
+	if tx.RowsAffected == 0 {
+		// first acquisition
+		tx = Conn(ctx).Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&model.Lease{Name: name, Holder: holder, Token: 1, ExpiresAt: expires})
+		if tx.Error != nil {
+			return 0, false, tx.Error
+		}
+		if tx.RowsAffected == 0 {
+			return 0, false, nil
+		}
+		return 1, true, nil
+	}
+
+	var lease model.Lease
+	if err = Conn(ctx).Where("name = ? AND holder = ?", name, holder).First(&lease).Error; err != nil {
+		return 0, false, err
+	}
+	return lease.Token, true, nil
+}
+
+// RenewLease extends the lease name held by holder with token by ttl, it
+// reports false when the lease expired or changed hands meanwhile.
+func RenewLease(ctx context.Context, name, holder string, token uint64, ttl time.Duration) (bool, error) {
+	now := time.Now()
+	tx := Conn(WithoutTx(UsePrimary(ctx))).Model(&model.Lease{}).
+		Where("name = ? AND holder = ? AND token = ? AND expires_at >= ?", name, holder, token, now).
+		Update("expires_at", now.Add(ttl))
+	return tx.RowsAffected > 0, tx.Error
+}
+
+// ReleaseLease gives up the lease name if holder holds it. The row is kept
+// so the next token still grows.
+func ReleaseLease(ctx context.Context, name, holder string) error {
+	return Conn(WithoutTx(ctx)).Model(&model.Lease{}).
+		Where("name = ? AND holder = ?", name, holder).
+		Update("expires_at", time.Now().Add(-time.Millisecond)).Error
+}
+
+// NextLeaseToken records holder as the holder of the lease name until
+// expires and returns its next fencing token, for holders excluding each
+// other by other means such as postgres advisory locks.
+func NextLeaseToken(ctx context.Context, name, holder string, expires time.Time) (uint64, error) {
+	ctx = WithoutTx(UsePrimary(ctx))
+	err := Conn(ctx).Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "name"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"holder":     holder,
+			"expires_at": expires,
+			"token":      gorm.Expr("leases.token + 1"),
+		}),
+	}).Create(&model.Lease{Name: name, Holder: holder, Token: 1, ExpiresAt: expires}).Error
+	if err != nil {
+		return 0, err
+	}
+
+	var lease model.Lease
+	if err = Conn(ctx).Where("name = ? AND holder = ?", name, holder).First(&lease).Error; err != nil {
+		return 0, err
+	}
+	return lease.Token, nil
+}
+
+// GetLease returns the lease name, expired or not.
+func GetLease(ctx context.Context, name string) (*model.Lease, error) {
+	var lease model.Lease
+	if err := Conn(ctx).Where("name = ?", name).First(&lease).Error; err != nil {
+		return nil, err
+	}
+	return &lease, nil
+}
+
+// ListLeases returns the leases whose name starts with prefix that are held
+// at now.
+func ListLeases(ctx context.Context, prefix string, now time.Time) (leases []*model.Lease, err error) {
+	err = Conn(ctx).
+		Where("name LIKE ? ESCAPE '!' AND expires_at >= ?", escapeLike(prefix)+"%", now).
+		Order("name asc").
+		Find(&leases).Error
+	return leases, err
+}
@@ -0,0 +1,30 @@
+package db
+
+import (
+	"context"
+	"go-server-template/internal/model"
+	"testing"
+	"time"
+)
+
+func TestListLeases(t *testing.T) {
+	openTestDB(t)
+	if err := GetDB().AutoMigrate(new(model.Lease)); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	now := time.Now()
+	for _, name := range []string{"lock:job_1", "lock:jobs", "lock:job_2"} {
+		if err := GetDB().Create(&model.Lease{Name: name, Holder: "a", ExpiresAt: now.Add(time.Minute)}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	leases, err := ListLeases(ctx, "lock:job_", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(leases) != 2 || leases[0].Name != "lock:job_1" || leases[1].Name != "lock:job_2" {
+		t.Fatalf("expected the underscore to match itself only, got %+v", leases)
+	}
+}
@@ -0,0 +1,132 @@
+package db
+
+import (
+	"context"
+	"go-server-template/internal/model"
+	"gorm.io/gorm"
+	"time"
+)
+
+// OutboxFilter narrows down ListOutboxEvents, zero values are ignored.
+type OutboxFilter struct {
+	Status string
+	Name   string
+	Offset int
+	Limit  int
+}
+
+// CreateOutboxEvents inserts events with the connection of ctx, so they are
+// committed or rolled back with the transaction it carries.
+func CreateOutboxEvents(ctx context.Context, events []*model.OutboxEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+	return Conn(ctx).Create(&events).Error
+}
+
+// DueOutboxEvents returns up to limit pending events due at now, oldest first.
+func DueOutboxEvents(ctx context.Context, now time.Time, limit int) (events []*model.OutboxEvent, err error) {
+	err = Conn(UsePrimary(ctx)).
+		Where("status = ? AND next_attempt_at <= ?", model.OutboxPending, now).
+		Order("id asc").
+		Limit(limit).
+		Find(&events).Error
+	return events, err
+}
+
+// ClaimOutboxEvent counts a delivery attempt of e and hides it from other
+// relays until lease. It reports false when another relay claimed it first.
+func ClaimOutboxEvent(ctx context.Context, e *model.OutboxEvent, lease time.Time) (bool, error) {
+	ok, err := claimRow(pendingOutbox(ctx), e.ID, e.Attempts, map[string]interface{}{"next_attempt_at": lease})
+	if !ok || err != nil {
+		return false, err
+	}
+	e.Attempts++
+	e.NextAttemptAt = lease
+	return true, nil
+}
+
+// MarkOutboxDelivered records the successful delivery of the claim of e. An
+// event claimed again after its lease expired is left alone.
+func MarkOutboxDelivered(ctx context.Context, e *model.OutboxEvent, at time.Time) error {
+	return claimedRow(pendingOutbox(ctx), e.ID, e.Attempts).
+		Updates(map[string]interface{}{"status": model.OutboxDelivered, "delivered_at": at, "last_error": ""}).Error
+}
+
+// MarkOutboxFailed records the failed delivery of the claim of e, which is
+// tried again at next, or never again when dead.
+func MarkOutboxFailed(ctx context.Context, e *model.OutboxEvent, reason string, next time.Time, dead bool) error {
+	values := map[string]interface{}{"last_error": reason, "next_attempt_at": next}
+	if dead {
+		values["status"] = model.OutboxDead
+	}
+	return claimedRow(pendingOutbox(ctx), e.ID, e.Attempts).Updates(values).Error
+}
+
+func pendingOutbox(ctx context.Context) *gorm.DB {
+	return Conn(ctx).Model(&model.OutboxEvent{}).Where("status = ?", model.OutboxPending)
+}
+
+func ListOutboxEvents(ctx context.Context, f OutboxFilter) (events []*model.OutboxEvent, total int64, err error) {
+	tx := Conn(ctx).Model(&model.OutboxEvent{})
+	if f.Status != "" {
+		tx = tx.Where("status = ?", f.Status)
+	}
+	if f.Name != "" {
+		tx = tx.Where("name = ?", f.Name)
+	}
+
+	if err = tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	if err = tx.Order("id desc").Offset(f.Offset).Limit(f.Limit).Find(&events).Error; err != nil {
+		return nil, 0, err
+	}
+
+	return events, total, nil
+}
+
+func GetOutboxEvent(ctx context.Context, eventID string) (*model.OutboxEvent, error) {
+	var e model.OutboxEvent
+	if err := Conn(ctx).Where("event_id = ?", eventID).First(&e).Error; err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// ReplayOutboxEvent makes the event eventID pending again with a fresh count
+// of attempts, an event still pending is left as is.
+func ReplayOutboxEvent(ctx context.Context, eventID string) error {
+	tx := Conn(ctx).Model(&model.OutboxEvent{}).
+		Where("event_id = ? AND status <> ?", eventID, model.OutboxPending).
+		Updates(map[string]interface{}{
+			"status":          model.OutboxPending,
+			"attempts":        0,
+			"last_error":      "",
+			"next_attempt_at": time.Now(),
+			"delivered_at":    nil,
+		})
+	if tx.Error != nil {
+		return tx.Error
+	}
+	if tx.RowsAffected == 0 {
+		var count int64
+		if err := Conn(ctx).Model(&model.OutboxEvent{}).Where("event_id = ?", eventID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			return gorm.ErrRecordNotFound
+		}
+	}
+	return nil
+}
+
+// DeleteDeliveredOutboxEvents deletes the events delivered before t, dead
+// events are kept until they are replayed.
+func DeleteDeliveredOutboxEvents(ctx context.Context, t time.Time) (int64, error) {
+	tx := Conn(ctx).
+		Where("status = ? AND delivered_at < ?", model.OutboxDelivered, t).
+		Delete(&model.OutboxEvent{})
+	return tx.RowsAffected, tx.Error
+}
@@ -0,0 +1,93 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"go-server-template/pkg/logger"
+)
+
+// ErrNotInitialized is returned when the global database is not set up yet.
+var ErrNotInitialized = errors.New("database is not initialized")
+
+// PoolStats is the JSON view of sql.DBStats.
+type PoolStats struct {
+	MaxOpenConnections int   `json:"max_open_connections"`
+	OpenConnections    int   `json:"open_connections"`
+	InUse              int   `json:"in_use"`
+	Idle               int   `json:"idle"`
+	WaitCount          int64 `json:"wait_count"`
+	WaitDuration       int64 `json:"wait_duration_ms"`
+	MaxIdleClosed      int64 `json:"max_idle_closed"`
+	MaxIdleTimeClosed  int64 `json:"max_idle_time_closed"`
+	MaxLifetimeClosed  int64 `json:"max_lifetime_closed"`
+	Saturated          bool  `json:"saturated"`
+}
+
+func newPoolStats(s sql.DBStats) *PoolStats {
+	return &PoolStats{
+		MaxOpenConnections: s.MaxOpenConnections,
+		OpenConnections:    s.OpenConnections,
+		InUse:              s.InUse,
+		Idle:               s.Idle,
+		WaitCount:          s.WaitCount,
+		WaitDuration:       s.WaitDuration.Milliseconds(),
+		MaxIdleClosed:      s.MaxIdleClosed,
+		MaxIdleTimeClosed:  s.MaxIdleTimeClosed,
+		MaxLifetimeClosed:  s.MaxLifetimeClosed,
+		Saturated:          s.MaxOpenConnections > 0 && s.InUse >= s.MaxOpenConnections,
+	}
+}
+
+// Stats returns the connection pool statistics of the global database.
+func Stats() (*PoolStats, error) {
+	if db == nil {
+		return nil, ErrNotInitialized
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	return newPoolStats(sqlDB.Stats()), nil
+}
+
+// WatchPool logs a warning every interval in which the pool was saturated,
+// i.e. all connections were in use or callers had to wait for one. It
+// returns when ctx is done.
+func WatchPool(ctx context.Context, interval time.Duration) {
+	if db == nil || interval <= 0 {
+		return
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	last := sqlDB.Stats()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		cur := sqlDB.Stats()
+		waits := cur.WaitCount - last.WaitCount
+		waited := cur.WaitDuration - last.WaitDuration
+		if waits > 0 || (cur.MaxOpenConnections > 0 && cur.InUse >= cur.MaxOpenConnections) {
+			logger.GetLogger().WithFields(logger.Fields{
+				"max_open": cur.MaxOpenConnections,
+				"in_use":   cur.InUse,
+				"idle":     cur.Idle,
+				"waits":    waits,
+				"waited":   waited.String(),
+			}).Warn("database connection pool saturated")
+		}
+		last = cur
+	}
+}
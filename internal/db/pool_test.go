@@ -0,0 +1,88 @@
+package db
+
+import (
+	"context"
+	"go-server-template/pkg/logger"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPoolStats(t *testing.T) {
+	openTestDB(t)
+	sqlDB, _ := GetDB().DB()
+	ctx := context.Background()
+
+	stats, err := Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.MaxOpenConnections != 1 || stats.InUse != 0 || stats.Saturated {
+		t.Fatalf("unexpected idle pool %+v", stats)
+	}
+
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats, _ = Stats()
+	if stats.InUse != 1 || !stats.Saturated {
+		t.Fatalf("expected the pool to be saturated, got %+v", stats)
+	}
+
+	// a caller waiting for the held connection
+	waited := make(chan struct{})
+	go func() {
+		defer close(waited)
+		if err := sqlDB.PingContext(ctx); err != nil {
+			t.Error(err)
+		}
+	}()
+	time.Sleep(20 * time.Millisecond)
+	_ = conn.Close()
+	<-waited
+
+	stats, _ = Stats()
+	if stats.WaitCount != 1 || stats.WaitDuration <= 0 || stats.Saturated {
+		t.Fatalf("expected the wait to be counted, got %+v", stats)
+	}
+}
+
+func TestWatchPool(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "pool.log")
+	logger.Init("zap", logger.WithFileP(file), logger.WithDisableConsole(), logger.WithEncodingJson())
+	openTestDB(t)
+	sqlDB, _ := GetDB().DB()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		WatchPool(ctx, 10*time.Millisecond)
+	}()
+
+	time.Sleep(30 * time.Millisecond)
+	quiet, _ := os.ReadFile(file)
+	if strings.Contains(string(quiet), "saturated") {
+		t.Fatalf("expected no warning while the pool is free, got %s", quiet)
+	}
+
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(30 * time.Millisecond)
+	_ = conn.Close()
+	cancel()
+	<-done
+
+	content, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(content), "database connection pool saturated") || !strings.Contains(string(content), `"in_use":1`) {
+		t.Fatalf("expected a saturation warning, got %s", content)
+	}
+}
@@ -0,0 +1,26 @@
+package db
+
+import "gorm.io/gorm"
+
+// The outbox events and the jobs are queued rows that a consumer claims
+// before it works on them, until a deadline after which another consumer may
+// claim them again. A claim counts an attempt of the row, so the attempts a
+// consumer saw when it claimed a row tell its claim from the later ones.
+
+// claimRow applies values to the row id of tx and counts an attempt of it,
+// as long as the row still has attempts. It reports whether the claim won:
+// of concurrent claims of a row exactly one does.
+func claimRow(tx *gorm.DB, id uint, attempts int, values map[string]interface{}) (bool, error) {
+	values["attempts"] = attempts + 1
+	res := tx.Where("id = ? AND attempts = ?", id, attempts).Updates(values)
+	if res.Error != nil {
+		return false, res.Error
+	}
+	return res.RowsAffected == 1, nil
+}
+
+// claimedRow limits tx to the row id while the claim counted as attempts
+// holds it, a row claimed again since is left alone.
+func claimedRow(tx *gorm.DB, id uint, attempts int) *gorm.DB {
+	return tx.Where("id = ? AND attempts = ?", id, attempts)
+}
@@ -0,0 +1,439 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go-server-template/internal/model"
+	"reflect"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+var (
+	ErrInvalidFilter = errors.New("invalid filter")
+	ErrInvalidSort   = errors.New("invalid sort")
+	ErrInvalidCursor = errors.New("invalid cursor")
+	// ErrConflict is returned by Update when an entity embedding
+	// model.Versioned was changed by someone else since it was read.
+	ErrConflict = errors.New("version conflict")
+)
+
+type FilterOp string
+
+const (
+	OpEq    FilterOp = "eq"
+	OpIn    FilterOp = "in"
+	OpLike  FilterOp = "like"
+	OpRange FilterOp = "range"
+)
+
+// Filter is one condition of a Query, Field must be whitelisted by WithFilterFields.
+type Filter struct {
+	Field string
+	Op    FilterOp
+	// Value is compared by OpEq, OpLike matches it anywhere in the column.
+	Value interface{}
+	// Values are matched by OpIn.
+	Values []interface{}
+	// From (inclusive) and To (exclusive) bound OpRange, either may be nil.
+	From interface{}
+	To   interface{}
+}
+
+// Sort orders a Query, Field must be whitelisted by WithSortFields.
+type Sort struct {
+	Field string
+	Desc  bool
+}
+
+// Query is a declarative list request. The primary key is always appended to
+// Sort so that pages are stable.
+type Query struct {
+	Filters []Filter
+	Sort    []Sort
+	Limit   int
+
+	// Offset is used by offset pagination.
+	Offset int
+
+	// Keyset switches to keyset pagination, Cursor is the NextCursor of the
+	// previous page and empty for the first one.
+	Keyset bool
+	Cursor string
+}
+
+// Page is a Query result, Total is only counted by offset pagination.
+type Page[T any] struct {
+	Items      []*T   `json:"items"`
+	Total      int64  `json:"total"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+type RepositoryOption func(*repositoryOption)
+
+type repositoryOption struct {
+	filterFields map[string]struct{}
+	sortFields   map[string]struct{}
+	maxLimit     int
+}
+
+// WithFilterFields whitelists the columns a Query may filter on.
+func WithFilterFields(columns ...string) RepositoryOption {
+	return func(opt *repositoryOption) {
+		for _, c := range columns {
+			opt.filterFields[c] = struct{}{}
+		}
+	}
+}
+
+// WithSortFields whitelists the columns a Query may sort on.
+func WithSortFields(columns ...string) RepositoryOption {
+	return func(opt *repositoryOption) {
+		for _, c := range columns {
+			opt.sortFields[c] = struct{}{}
+		}
+	}
+}
+
+// WithMaxLimit caps Query.Limit, 100 by default.
+func WithMaxLimit(limit int) RepositoryOption {
+	return func(opt *repositoryOption) {
+		opt.maxLimit = limit
+	}
+}
+
+// Repository implements the common data access of model T. Every call runs
+// on Conn(ctx), joining the transaction of ctx if any, and carries ctx so
+// that plugins like TracePlugin see the request.
+type Repository[T any] struct {
+	opt *repositoryOption
+}
+
+func NewRepository[T any](options ...RepositoryOption) *Repository[T] {
+	opt := &repositoryOption{
+		filterFields: make(map[string]struct{}),
+		sortFields:   make(map[string]struct{}),
+		maxLimit:     100,
+	}
+	for _, f := range options {
+		f(opt)
+	}
+	return &Repository[T]{opt: opt}
+}
+
+// DB returns a session on model T for queries the repository does not cover.
+func (r *Repository[T]) DB(ctx context.Context) *gorm.DB {
+	return Conn(ctx).Model(new(T))
+}
+
+func (r *Repository[T]) Get(ctx context.Context, id interface{}) (*T, error) {
+	entity := new(T)
+	if err := r.DB(ctx).First(entity, id).Error; err != nil {
+		return nil, err
+	}
+	return entity, nil
+}
+
+// First returns the first entity matching the filters.
+func (r *Repository[T]) First(ctx context.Context, filters ...Filter) (*T, error) {
+	tx, err := r.filter(r.DB(ctx), filters)
+	if err != nil {
+		return nil, err
+	}
+
+	entity := new(T)
+	if err = tx.First(entity).Error; err != nil {
+		return nil, err
+	}
+	return entity, nil
+}
+
+func (r *Repository[T]) List(ctx context.Context, q Query) (*Page[T], error) {
+	s, err := r.schema()
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := r.filter(r.DB(ctx), q.Filters)
+	if err != nil {
+		return nil, err
+	}
+
+	sorts, err := r.sorts(s, q.Sort)
+	if err != nil {
+		return nil, err
+	}
+
+	limit := q.Limit
+	if limit <= 0 || limit > r.opt.maxLimit {
+		limit = r.opt.maxLimit
+	}
+
+	page := &Page[T]{Items: make([]*T, 0)}
+
+	if !q.Keyset {
+		if err = tx.Session(&gorm.Session{}).Count(&page.Total).Error; err != nil {
+			return nil, err
+		}
+		tx = tx.Offset(q.Offset)
+	} else if q.Cursor != "" {
+		after, err := decodeCursor(s, sorts, q.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		tx = tx.Where(keysetCondition(sorts, after))
+	}
+
+	for _, srt := range sorts {
+		tx = tx.Order(clause.OrderByColumn{Column: clause.Column{Name: srt.Field}, Desc: srt.Desc})
+	}
+
+	// fetch one more row to know whether there is a next page
+	if err = tx.Limit(limit + 1).Find(&page.Items).Error; err != nil {
+		return nil, err
+	}
+
+	if len(page.Items) > limit {
+		page.Items = page.Items[:limit]
+		if q.Keyset {
+			page.NextCursor = encodeCursor(ctx, s, sorts, page.Items[limit-1])
+		}
+	}
+	return page, nil
+}
+
+func (r *Repository[T]) Count(ctx context.Context, filters ...Filter) (count int64, err error) {
+	tx, err := r.filter(r.DB(ctx), filters)
+	if err != nil {
+		return 0, err
+	}
+	err = tx.Count(&count).Error
+	return count, err
+}
+
+func (r *Repository[T]) Create(ctx context.Context, entity *T) error {
+	return Conn(ctx).Create(entity).Error
+}
+
+// CreateAll creates entities with a single statement.
+func (r *Repository[T]) CreateAll(ctx context.Context, entities []*T) error {
+	if len(entities) == 0 {
+		return nil
+	}
+	return Conn(ctx).Create(entities).Error
+}
+
+// Update writes values, a map or a struct, to the entity identified by its
+// primary key.
+//
+// An entity embedding model.Versioned is only updated while its row still
+// has the entity's version, which is then bumped; ErrConflict is returned
+// otherwise. Its values must be a map or a pointer to a model.Versioner.
+func (r *Repository[T]) Update(ctx context.Context, entity *T, values interface{}) error {
+	tx := Conn(ctx).Model(entity)
+
+	versioned, ok := interface{}(entity).(model.Versioner)
+	var next uint64
+	if ok {
+		current := versioned.GetVersion()
+		next = current + 1
+		switch v := values.(type) {
+		case map[string]interface{}:
+			withVersion := make(map[string]interface{}, len(v)+1)
+			for k, value := range v {
+				withVersion[k] = value
+			}
+			withVersion["version"] = next
+			values = withVersion
+		case model.Versioner:
+			v.SetVersion(next)
+		default:
+			return fmt.Errorf("update of versioned %T with %T values", entity, values)
+		}
+		tx = tx.Where("version = ?", current)
+	}
+
+	tx = tx.Updates(values)
+	if tx.Error != nil {
+		return tx.Error
+	}
+	if tx.RowsAffected == 0 {
+		if ok {
+			return r.conflict(ctx, entity)
+		}
+		return gorm.ErrRecordNotFound
+	}
+	if ok {
+		versioned.SetVersion(next)
+	}
+	return nil
+}
+
+// conflict tells a stale version from a missing row after an update of the
+// versioned entity affected nothing.
+func (r *Repository[T]) conflict(ctx context.Context, entity *T) error {
+	s, err := r.schema()
+	if err != nil {
+		return err
+	}
+	pk, zero := s.PrioritizedPrimaryField.ValueOf(ctx, reflect.ValueOf(entity).Elem())
+	if zero {
+		return gorm.ErrRecordNotFound
+	}
+
+	var count int64
+	err = r.DB(ctx).Where(clause.Eq{Column: clause.Column{Name: s.PrioritizedPrimaryField.DBName}, Value: pk}).
+		Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return ErrConflict
+}
+
+// Delete deletes the entity identified by its primary key, softly if T has a
+// gorm.DeletedAt field.
+func (r *Repository[T]) Delete(ctx context.Context, entity *T) error {
+	tx := Conn(ctx).Delete(entity)
+	if tx.Error != nil {
+		return tx.Error
+	}
+	if tx.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (r *Repository[T]) schema() (*schema.Schema, error) {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(new(T)); err != nil {
+		return nil, err
+	}
+	return stmt.Schema, nil
+}
+
+func (r *Repository[T]) filter(tx *gorm.DB, filters []Filter) (*gorm.DB, error) {
+	for _, f := range filters {
+		if _, ok := r.opt.filterFields[f.Field]; !ok {
+			return nil, fmt.Errorf("%w: field %q", ErrInvalidFilter, f.Field)
+		}
+
+		column := clause.Column{Name: f.Field}
+		switch f.Op {
+		case OpEq:
+			tx = tx.Where(clause.Eq{Column: column, Value: f.Value})
+		case OpIn:
+			if len(f.Values) == 0 {
+				return nil, fmt.Errorf("%w: %q in needs values", ErrInvalidFilter, f.Field)
+			}
+			tx = tx.Where(clause.IN{Column: column, Values: f.Values})
+		case OpLike:
+			pattern := "%" + escapeLike(fmt.Sprint(f.Value)) + "%"
+			tx = tx.Where(clause.Expr{SQL: "? LIKE ? ESCAPE '!'", Vars: []interface{}{column, pattern}})
+		case OpRange:
+			if f.From == nil && f.To == nil {
+				return nil, fmt.Errorf("%w: %q range needs a bound", ErrInvalidFilter, f.Field)
+			}
+			if f.From != nil {
+				tx = tx.Where(clause.Gte{Column: column, Value: f.From})
+			}
+			if f.To != nil {
+				tx = tx.Where(clause.Lt{Column: column, Value: f.To})
+			}
+		default:
+			return nil, fmt.Errorf("%w: unknown operator %q", ErrInvalidFilter, f.Op)
+		}
+	}
+	return tx, nil
+}
+
+// sorts validates the requested order and appends the primary key as tie-breaker.
+func (r *Repository[T]) sorts(s *schema.Schema, requested []Sort) ([]Sort, error) {
+	pk := s.PrioritizedPrimaryField
+	if pk == nil {
+		return nil, fmt.Errorf("%w: %s has no primary key", ErrInvalidSort, s.Name)
+	}
+
+	sorts := make([]Sort, 0, len(requested)+1)
+	for _, srt := range requested {
+		if _, ok := r.opt.sortFields[srt.Field]; !ok || s.LookUpField(srt.Field) == nil {
+			return nil, fmt.Errorf("%w: field %q", ErrInvalidSort, srt.Field)
+		}
+		if srt.Field == pk.DBName {
+			continue
+		}
+		sorts = append(sorts, srt)
+	}
+
+	desc := false
+	for _, srt := range requested {
+		if srt.Field == pk.DBName {
+			desc = srt.Desc
+		}
+	}
+	return append(sorts, Sort{Field: pk.DBName, Desc: desc}), nil
+}
+
+// keysetCondition selects the rows strictly after values in sorts order:
+// (a > va) OR (a = va AND b > vb) OR ...
+func keysetCondition(sorts []Sort, values []interface{}) clause.Expression {
+	var or []clause.Expression
+	for i, srt := range sorts {
+		and := make([]clause.Expression, 0, i+1)
+		for j := 0; j < i; j++ {
+			and = append(and, clause.Eq{Column: clause.Column{Name: sorts[j].Field}, Value: values[j]})
+		}
+
+		column := clause.Column{Name: srt.Field}
+		if srt.Desc {
+			and = append(and, clause.Lt{Column: column, Value: values[i]})
+		} else {
+			and = append(and, clause.Gt{Column: column, Value: values[i]})
+		}
+		or = append(or, clause.And(and...))
+	}
+	return clause.Or(or...)
+}
+
+func encodeCursor(ctx context.Context, s *schema.Schema, sorts []Sort, last interface{}) string {
+	rv := reflect.Indirect(reflect.ValueOf(last))
+
+	values := make([]interface{}, len(sorts))
+	for i, srt := range sorts {
+		values[i], _ = s.LookUpField(srt.Field).ValueOf(ctx, rv)
+	}
+
+	return SealCursor(values)
+}
+
+// decodeCursor restores the cursor values with the types of their fields, so
+// that times and numbers are compared as such by the database.
+func decodeCursor(s *schema.Schema, sorts []Sort, cursor string) ([]interface{}, error) {
+	var raw []json.RawMessage
+	if err := OpenCursor(cursor, &raw); err != nil || len(raw) != len(sorts) {
+		return nil, ErrInvalidCursor
+	}
+
+	values := make([]interface{}, len(sorts))
+	for i, srt := range sorts {
+		v := reflect.New(s.LookUpField(srt.Field).FieldType)
+		if err := json.Unmarshal(raw[i], v.Interface()); err != nil {
+			return nil, ErrInvalidCursor
+		}
+		values[i] = v.Elem().Interface()
+	}
+	return values, nil
+}
+
+// escapeLike escapes the wildcards of a LIKE pattern with '!', to be used
+// with ESCAPE '!', a backslash would need escaping itself on mysql.
+func escapeLike(s string) string {
+	return strings.NewReplacer("!", "!!", "%", "!%", "_", "!_").Replace(s)
+}
@@ -0,0 +1,158 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go-server-template/internal/model"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	gormLogger "gorm.io/gorm/logger"
+)
+
+func openTestDB(t *testing.T) {
+	dB, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: gormLogger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := dB.DB()
+	sqlDB.SetMaxOpenConns(1)
+
+	if err = dB.AutoMigrate(new(model.User)); err != nil {
+		t.Fatal(err)
+	}
+	InitDB(dB)
+}
+
+func seedUsers(t *testing.T, n int) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < n; i++ {
+		user := &model.User{Username: fmt.Sprintf("user_%02d", i)}
+		// several users share a timestamp to exercise the tie-breaker
+		user.CreatedAt = start.Add(time.Duration(i/3) * time.Hour)
+		if err := Users().Create(context.Background(), user); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestRepositoryFilters(t *testing.T) {
+	openTestDB(t)
+	seedUsers(t, 10)
+	ctx := context.Background()
+
+	tests := []struct {
+		name    string
+		filters []Filter
+		want    int64
+		err     error
+	}{
+		{"eq", []Filter{{Field: "username", Op: OpEq, Value: "user_01"}}, 1, nil},
+		{"in", []Filter{{Field: "username", Op: OpIn, Values: []interface{}{"user_01", "user_02", "nobody"}}}, 2, nil},
+		{"like", []Filter{{Field: "username", Op: OpLike, Value: "er_0"}}, 10, nil},
+		{"like escapes wildcards", []Filter{{Field: "username", Op: OpLike, Value: "r%0"}}, 0, nil},
+		{"range", []Filter{{Field: "created_at", Op: OpRange,
+			From: time.Date(2024, 1, 1, 1, 0, 0, 0, time.UTC),
+			To:   time.Date(2024, 1, 1, 3, 0, 0, 0, time.UTC)}}, 6, nil},
+		{"not whitelisted", []Filter{{Field: "password", Op: OpEq, Value: ""}}, 0, ErrInvalidFilter},
+		{"unknown operator", []Filter{{Field: "username", Op: "gt", Value: ""}}, 0, ErrInvalidFilter},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Users().Count(ctx, tt.filters...)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("expected error %v, got %v", tt.err, err)
+			}
+			if got != tt.want {
+				t.Fatalf("expected %d users, got %d", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestRepositoryPagination(t *testing.T) {
+	openTestDB(t)
+	seedUsers(t, 10)
+	ctx := context.Background()
+
+	page, err := Users().List(ctx, Query{Sort: []Sort{{Field: "username", Desc: true}}, Offset: 8, Limit: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Total != 10 || len(page.Items) != 2 || page.Items[0].Username != "user_01" {
+		t.Fatalf("unexpected offset page: total %d, %d items", page.Total, len(page.Items))
+	}
+
+	if _, err = Users().List(ctx, Query{Sort: []Sort{{Field: "password"}}}); !errors.Is(err, ErrInvalidSort) {
+		t.Fatalf("expected ErrInvalidSort, got %v", err)
+	}
+
+	// walk the whole table by keyset pages, newest first
+	var seen []string
+	q := Query{Sort: []Sort{{Field: "created_at", Desc: true}}, Limit: 4, Keyset: true}
+	for {
+		page, err = Users().List(ctx, q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, u := range page.Items {
+			seen = append(seen, u.Username)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		q.Cursor = page.NextCursor
+	}
+
+	want := []string{"user_09", "user_06", "user_07", "user_08", "user_03", "user_04", "user_05", "user_00", "user_01", "user_02"}
+	if fmt.Sprint(seen) != fmt.Sprint(want) {
+		t.Fatalf("unexpected keyset walk\n got %v\nwant %v", seen, want)
+	}
+
+	q.Cursor = "garbage"
+	if _, err = Users().List(ctx, q); !errors.Is(err, ErrInvalidCursor) {
+		t.Fatalf("expected ErrInvalidCursor, got %v", err)
+	}
+}
+
+func TestRepositoryOptimisticLocking(t *testing.T) {
+	openTestDB(t)
+	ctx := context.Background()
+
+	user := &model.User{Username: "alice"}
+	if err := Users().Create(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+	if user.Version != 1 {
+		t.Fatalf("new user should have version 1, got %d", user.Version)
+	}
+
+	// two writers read the same version
+	first, _ := Users().GetByPublicID(ctx, user.PublicID)
+	second, _ := Users().GetByPublicID(ctx, user.PublicID)
+
+	if err := Users().Update(ctx, first, map[string]interface{}{"username": "bob"}); err != nil {
+		t.Fatal(err)
+	}
+	if first.Version != 2 {
+		t.Errorf("update should bump the version to 2, got %d", first.Version)
+	}
+
+	err := Users().Update(ctx, second, map[string]interface{}{"username": "carol"})
+	if !errors.Is(err, ErrConflict) {
+		t.Fatalf("stale update should conflict, got %v", err)
+	}
+
+	stored, _ := Users().GetByPublicID(ctx, user.PublicID)
+	if stored.Username != "bob" || stored.Version != 2 {
+		t.Errorf("stale update must not be applied, got %s v%d", stored.Username, stored.Version)
+	}
+
+	if err = Users().Update(ctx, &model.User{Base: model.Base{ID: 404}}, map[string]interface{}{"username": "x"}); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("missing row should not be a conflict, got %v", err)
+	}
+}
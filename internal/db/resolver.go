@@ -0,0 +1,17 @@
+package db
+
+import "context"
+
+type primaryKey struct{}
+
+// UsePrimary returns a context whose reads are served by the primary instead
+// of a replica, for read-after-write consistency.
+func UsePrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryKey{}, true)
+}
+
+// PrimaryOnly reports whether ctx was marked with UsePrimary.
+func PrimaryOnly(ctx context.Context) bool {
+	v, _ := ctx.Value(primaryKey{}).(bool)
+	return v
+}
@@ -0,0 +1,75 @@
+package db
+
+import (
+	"context"
+	"go-server-template/internal/model"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+// ListScheduledTasks returns the state of the tasks names.
+func ListScheduledTasks(ctx context.Context, names []string) (tasks []*model.ScheduledTask, err error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	err = Conn(ctx).Where("name IN ?", names).Find(&tasks).Error
+	return tasks, err
+}
+
+// SaveScheduledTask creates the state of a task or reschedules it for spec.
+func SaveScheduledTask(ctx context.Context, name, spec string, next time.Time) error {
+	tx := Conn(ctx).Model(&model.ScheduledTask{}).
+		Where("name = ?", name).
+		Updates(map[string]interface{}{"spec": spec, "next_run_at": next})
+	if tx.Error != nil || tx.RowsAffected > 0 {
+		return tx.Error
+	}
+	return Conn(ctx).Create(&model.ScheduledTask{Name: name, Spec: spec, NextRunAt: next}).Error
+}
+
+// CreateScheduledTask creates the state of a task unless it exists.
+func CreateScheduledTask(ctx context.Context, name, spec string, next time.Time) error {
+	return Conn(ctx).Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&model.ScheduledTask{Name: name, Spec: spec, NextRunAt: next}).Error
+}
+
+// ClaimScheduledTask claims the tick of t due at t.NextRunAt and schedules
+// the following one at next, it reports false when another replica claimed
+// the tick first. A run starts at start unless skipped.
+func ClaimScheduledTask(ctx context.Context, t *model.ScheduledTask, next time.Time, start *time.Time) (bool, error) {
+	values := map[string]interface{}{"runs": t.Runs + 1, "next_run_at": next}
+	if start != nil {
+		values["running_since"] = *start
+	}
+	tx := Conn(ctx).Model(&model.ScheduledTask{}).
+		Where("name = ? AND runs = ?", t.Name, t.Runs).
+		Updates(values)
+	if tx.Error != nil {
+		return false, tx.Error
+	}
+	if tx.RowsAffected == 0 {
+		return false, nil
+	}
+	t.Runs++
+	t.NextRunAt = next
+	t.RunningSince = start
+	return true, nil
+}
+
+// FinishScheduledTask records the outcome of a run of the task name started
+// at start.
+func FinishScheduledTask(ctx context.Context, name string, start time.Time, runErr error) error {
+	status, reason := model.TaskSucceeded, ""
+	if runErr != nil {
+		status, reason = model.TaskFailed, runErr.Error()
+	}
+	return Conn(ctx).Model(&model.ScheduledTask{}).
+		Where("name = ?", name).
+		Updates(map[string]interface{}{
+			"running_since": nil,
+			"last_run_at":   start,
+			"last_status":   status,
+			"last_error":    reason,
+			"last_duration": time.Since(start).Milliseconds(),
+		}).Error
+}
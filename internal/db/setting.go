@@ -0,0 +1,143 @@
+package db
+
+import (
+	"context"
+	"go-server-template/internal/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// SettingChangeFilter narrows down ListSettingChanges, zero values are
+// ignored.
+type SettingChangeFilter struct {
+	Key    string
+	Offset int
+	Limit  int
+}
+
+// ListSettings returns every stored setting.
+func ListSettings(ctx context.Context) (settings []*model.Setting, err error) {
+	err = Conn(ctx).Order("name asc").Find(&settings).Error
+	return settings, err
+}
+
+func GetSetting(ctx context.Context, key string) (*model.Setting, error) {
+	var s model.Setting
+	if err := Conn(ctx).Where("name = ?", key).First(&s).Error; err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// FindSetting returns the setting key, nil when it is not stored.
+func FindSetting(ctx context.Context, key string) (*model.Setting, error) {
+	var settings []*model.Setting
+	if err := Conn(ctx).Where("name = ?", key).Limit(1).Find(&settings).Error; err != nil {
+		return nil, err
+	}
+	if len(settings) == 0 {
+		return nil, nil
+	}
+	return settings[0], nil
+}
+
+// SaveSetting writes value to the setting key while it still has version,
+// 0 matching any version, and returns the previous row, nil when there was
+// none. ErrConflict is returned when the setting changed meanwhile.
+func SaveSetting(ctx context.Context, key, value string, version uint64) (old, saved *model.Setting, err error) {
+	if old, err = FindSetting(UsePrimary(ctx), key); err != nil {
+		return nil, nil, err
+	}
+
+	if old == nil {
+		if version > 1 {
+			return nil, nil, ErrConflict
+		}
+		saved = &model.Setting{Key: key, Value: value, Versioned: model.Versioned{Version: 1}}
+		tx := Conn(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(saved)
+		if tx.Error != nil {
+			return nil, nil, tx.Error
+		}
+		if tx.RowsAffected == 0 {
+			return nil, nil, ErrConflict
+		}
+		return nil, saved, nil
+	}
+
+	if version != 0 && version != old.Version {
+		return nil, nil, ErrConflict
+	}
+	saved = &model.Setting{Key: key}
+	saved.Version = old.Version
+	tx := Conn(ctx).Model(saved).
+		Where("version = ?", old.Version).
+		Updates(map[string]interface{}{"value": value, "version": old.Version + 1})
+	if tx.Error != nil {
+		return nil, nil, tx.Error
+	}
+	if tx.RowsAffected == 0 {
+		return nil, nil, ErrConflict
+	}
+	saved, err = GetSetting(UsePrimary(ctx), key)
+	return old, saved, err
+}
+
+// DeleteSetting deletes the setting key while it still has version, 0
+// matching any version, and returns the deleted row. gorm.ErrRecordNotFound
+// is returned when it was not stored.
+func DeleteSetting(ctx context.Context, key string, version uint64) (*model.Setting, error) {
+	old, err := FindSetting(UsePrimary(ctx), key)
+	if err != nil {
+		return nil, err
+	}
+	if old == nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+	if version != 0 && version != old.Version {
+		return nil, ErrConflict
+	}
+
+	tx := Conn(ctx).Where("name = ? AND version = ?", key, old.Version).Delete(&model.Setting{})
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+	if tx.RowsAffected == 0 {
+		return nil, ErrConflict
+	}
+	return old, nil
+}
+
+func CreateSettingChange(ctx context.Context, change *model.SettingChange) error {
+	return Conn(ctx).Create(change).Error
+}
+
+// ListSettingChanges returns the change history, latest first, with the
+// public ids of the actors filled.
+func ListSettingChanges(ctx context.Context, f SettingChangeFilter) (changes []*model.SettingChange, total int64, err error) {
+	tx := Conn(ctx).Model(&model.SettingChange{})
+	if f.Key != "" {
+		tx = tx.Where("name = ?", f.Key)
+	}
+
+	if err = tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	if err = tx.Order("id desc").Offset(f.Offset).Limit(f.Limit).Find(&changes).Error; err != nil {
+		return nil, 0, err
+	}
+
+	actorIDs := make([]uint64, 0, len(changes))
+	for _, change := range changes {
+		actorIDs = append(actorIDs, change.ActorID)
+	}
+	actors, err := users.PublicIDs(ctx, actorIDs)
+	if err != nil {
+		return nil, 0, err
+	}
+	for _, change := range changes {
+		change.Actor = actors[change.ActorID]
+	}
+
+	return changes, total, nil
+}
@@ -0,0 +1,126 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/mattn/go-sqlite3"
+	"gorm.io/gorm"
+)
+
+type txKey struct{}
+
+type txState struct {
+	tx    *gorm.DB
+	depth int
+	// afterCommit is shared by the transaction and its savepoints.
+	afterCommit *[]func()
+}
+
+// Conn returns the transaction carried by ctx, see WithTx, or else the
+// connection pool. Every query of this package starts from it.
+func Conn(ctx context.Context) *gorm.DB {
+	if state, ok := ctx.Value(txKey{}).(*txState); ok && state != nil {
+		return state.tx.WithContext(ctx)
+	}
+	return db.WithContext(ctx)
+}
+
+// WithoutTx returns a context whose queries run on the connection pool even
+// when ctx carries a transaction, for writes that must be seen by other
+// connections before it commits.
+func WithoutTx(ctx context.Context) context.Context {
+	return context.WithValue(ctx, txKey{}, (*txState)(nil))
+}
+
+// WithTx returns a context whose queries run in tx.
+func WithTx(ctx context.Context, tx *gorm.DB) context.Context {
+	state := &txState{tx: tx, afterCommit: new([]func())}
+	if parent, ok := ctx.Value(txKey{}).(*txState); ok && parent != nil {
+		state.depth = parent.depth + 1
+		state.afterCommit = parent.afterCommit
+	}
+	return context.WithValue(ctx, txKey{}, state)
+}
+
+// AfterCommit runs fn once the transaction carried by ctx commits, or right
+// away when ctx carries none. fn is dropped when the transaction rolls back,
+// but not when only the savepoint it was added in does, which suits cache
+// invalidations.
+func AfterCommit(ctx context.Context, fn func()) {
+	state, ok := ctx.Value(txKey{}).(*txState)
+	if !ok || state == nil {
+		fn()
+		return
+	}
+	*state.afterCommit = append(*state.afterCommit, fn)
+}
+
+// Committed runs the functions given to AfterCommit, it is called once the
+// transaction carried by ctx committed.
+func Committed(ctx context.Context) {
+	state, ok := ctx.Value(txKey{}).(*txState)
+	if !ok || state == nil {
+		return
+	}
+	hooks := *state.afterCommit
+	*state.afterCommit = nil
+	for _, fn := range hooks {
+		fn()
+	}
+}
+
+// TxFrom returns the transaction carried by ctx and its nesting depth.
+func TxFrom(ctx context.Context) (tx *gorm.DB, depth int, ok bool) {
+	state, ok := ctx.Value(txKey{}).(*txState)
+	if !ok || state == nil {
+		return nil, 0, false
+	}
+	return state.tx, state.depth, true
+}
+
+// SavePointName returns the name of the savepoint at depth.
+func SavePointName(depth int) string {
+	return fmt.Sprintf("sp_%d", depth)
+}
+
+// IsRetryable reports whether err is a serialization failure or a deadlock
+// that may succeed when the whole transaction is run again.
+func IsRetryable(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		// serialization_failure, deadlock_detected
+		return pgErr.Code == "40001" || pgErr.Code == "40P01"
+	}
+
+	var myErr *mysql.MySQLError
+	if errors.As(err, &myErr) {
+		// ER_LOCK_DEADLOCK, ER_LOCK_WAIT_TIMEOUT
+		return myErr.Number == 1213 || myErr.Number == 1205
+	}
+	return false
+}
+
+// IsUniqueViolation reports whether err is the violation of a unique index.
+func IsUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		// unique_violation
+		return pgErr.Code == "23505"
+	}
+
+	var myErr *mysql.MySQLError
+	if errors.As(err, &myErr) {
+		// ER_DUP_ENTRY
+		return myErr.Number == 1062
+	}
+
+	var liteErr sqlite3.Error
+	if errors.As(err, &liteErr) {
+		return liteErr.ExtendedCode == sqlite3.ErrConstraintUnique || liteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey
+	}
+	return false
+}
@@ -3,13 +3,211 @@ package db
 import (
 	"context"
 	"go-server-template/internal/model"
+	"go-server-template/pkg/ulid"
+	"gorm.io/gorm"
+	"time"
 )
 
-func GetUserByID(ctx context.Context, id uint) (user *model.User, err error) {
-	user = &model.User{ID: id}
-	if err = db.WithContext(ctx).First(&user).Error; err != nil {
+var users = NewUserRepository()
+
+// Users returns the user repository.
+func Users() *UserRepository {
+	return users
+}
+
+type UserRepository struct {
+	*Repository[model.User]
+}
+
+func NewUserRepository() *UserRepository {
+	return &UserRepository{
+		Repository: NewRepository[model.User](
+			WithFilterFields("public_id", "username", "created_at", "updated_at"),
+			WithSortFields("username", "created_at", "updated_at"),
+		),
+	}
+}
+
+func (r *UserRepository) GetByPublicID(ctx context.Context, publicID string) (*model.User, error) {
+	return r.First(ctx, Filter{Field: "public_id", Op: OpEq, Value: publicID})
+}
+
+// IDByPublicID returns the id of the user, soft deleted or not.
+func (r *UserRepository) IDByPublicID(ctx context.Context, publicID string) (uint, error) {
+	var ids []uint
+	err := r.DB(ctx).Unscoped().Where("public_id = ?", publicID).Limit(1).Pluck("id", &ids).Error
+	if err != nil {
+		return 0, err
+	}
+	if len(ids) == 0 {
+		return 0, gorm.ErrRecordNotFound
+	}
+	return ids[0], nil
+}
+
+// PublicIDs maps the user ids to their public ids, soft deleted users
+// included. The ids without a user, such as 0 for the system, are left out.
+func (r *UserRepository) PublicIDs(ctx context.Context, ids []uint64) (map[uint64]string, error) {
+	publicIDs := make(map[uint64]string, len(ids))
+	known := make([]uint64, 0, len(ids))
+	for _, id := range ids {
+		if id != 0 {
+			known = append(known, id)
+		}
+	}
+	if len(known) == 0 {
+		return publicIDs, nil
+	}
+	var rows []struct {
+		ID       uint64
+		PublicID string
+	}
+	if err := r.DB(ctx).Unscoped().Select("id", "public_id").Where("id IN ?", known).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		publicIDs[row.ID] = row.PublicID
+	}
+	return publicIDs, nil
+}
+
+// UsernameTaken reports whether a user, soft deleted or not, has username.
+func (r *UserRepository) UsernameTaken(ctx context.Context, username string) (bool, error) {
+	var count int64
+	err := r.DB(ctx).Unscoped().Where("username = ?", username).Count(&count).Error
+	return count > 0, err
+}
+
+// TakenUsernames returns which of usernames a user, soft deleted or not,
+// already has.
+func (r *UserRepository) TakenUsernames(ctx context.Context, usernames []string) (map[string]bool, error) {
+	taken := make(map[string]bool)
+	if len(usernames) == 0 {
+		return taken, nil
+	}
+	var found []string
+	err := r.DB(ctx).Unscoped().Where("username IN ?", usernames).Pluck("username", &found).Error
+	if err != nil {
 		return nil, err
 	}
+	for _, username := range found {
+		taken[username] = true
+	}
+	return taken, nil
+}
+
+// UserFilter selects the users walked by Each.
+type UserFilter struct {
+	// UsernamePrefix keeps the users whose username starts with it.
+	UsernamePrefix string
+	CreatedFrom    time.Time
+	CreatedTo      time.Time
+	// Deleted includes the soft deleted users.
+	Deleted bool
+}
+
+// Each calls fn with the users matching f by batches of size, in id order,
+// until fn returns an error. Each batch is a separate query so that a walk
+// over the whole table never holds a cursor open.
+func (r *UserRepository) Each(ctx context.Context, f UserFilter, size int, fn func(users []*model.User) error) error {
+	tx := r.DB(ctx)
+	if f.Deleted {
+		tx = tx.Unscoped()
+	}
+	if f.UsernamePrefix != "" {
+		tx = tx.Where("username LIKE ? ESCAPE '!'", escapeLike(f.UsernamePrefix)+"%")
+	}
+	if !f.CreatedFrom.IsZero() {
+		tx = tx.Where("created_at >= ?", f.CreatedFrom)
+	}
+	if !f.CreatedTo.IsZero() {
+		tx = tx.Where("created_at < ?", f.CreatedTo)
+	}
+
+	var last uint
+	for {
+		var batch []*model.User
+		if err := tx.Session(&gorm.Session{}).Where("id > ?", last).Order("id").Limit(size).Find(&batch).Error; err != nil {
+			return err
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := fn(batch); err != nil {
+			return err
+		}
+		if len(batch) < size {
+			return nil
+		}
+		last = batch[len(batch)-1].ID
+	}
+}
+
+// DeleteByPublicID soft deletes the user, it can be brought back by Restore.
+func (r *UserRepository) DeleteByPublicID(ctx context.Context, publicID string) error {
+	user, err := r.GetByPublicID(ctx, publicID)
+	if err != nil {
+		return err
+	}
+	return r.Delete(ctx, user)
+}
+
+// Restore reverts a soft delete.
+func (r *UserRepository) Restore(ctx context.Context, publicID string) error {
+	tx := r.DB(ctx).Unscoped().
+		Where("public_id = ? AND deleted_at IS NOT NULL", publicID).
+		Update("deleted_at", nil)
+	if tx.Error != nil {
+		return tx.Error
+	}
+	if tx.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// Purge permanently removes the user, deleted or not.
+func (r *UserRepository) Purge(ctx context.Context, publicID string) error {
+	tx := r.DB(ctx).Unscoped().Where("public_id = ?", publicID).Delete(&model.User{})
+	if tx.Error != nil {
+		return tx.Error
+	}
+	if tx.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// Anonymize replaces the user's personal data with pseudonym and soft deletes it.
+func (r *UserRepository) Anonymize(ctx context.Context, user *model.User, pseudonym string) error {
+	err := r.Update(ctx, user, map[string]interface{}{"username": pseudonym, "password": ""})
+	if err != nil {
+		return err
+	}
+	return r.Delete(ctx, user)
+}
+
+func (r *UserRepository) UpdateAvatar(ctx context.Context, user *model.User, avatar string) error {
+	return r.Update(ctx, user, map[string]interface{}{"avatar": avatar})
+}
 
-	return user, nil
+// BackfillPublicIDs assigns a public id to rows created before the column existed.
+func BackfillPublicIDs(ctx context.Context, value interface{}) error {
+	var ids []uint
+	err := Conn(ctx).Unscoped().Model(value).
+		Where("public_id IS NULL OR public_id = ''").
+		Pluck("id", &ids).Error
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		err = Conn(ctx).Unscoped().Model(value).
+			Where("id = ?", id).
+			UpdateColumn("public_id", ulid.New()).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
@@ -0,0 +1,112 @@
+// Package event publishes domain events through the transactional outbox and
+// dispatches them to the in-process subscribers.
+//
+// Publish writes events to the outbox table with the connection of its
+// context, so an event is committed with the change it describes or not at
+// all. Relay then delivers every committed event at least once: a handler may
+// see the same event again, after a failure or a crash of the relay, and must
+// therefore be idempotent, e.g. by remembering the Message.ID it handled.
+package event
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"go-server-template/internal/db"
+	"go-server-template/internal/model"
+	pkgctx "go-server-template/pkg/context"
+	"go-server-template/pkg/ulid"
+	"sync"
+	"time"
+)
+
+// Event is a domain event, its JSON encoding is the outbox payload.
+type Event interface {
+	EventName() string
+}
+
+// Message is one delivery of an outbox event to a handler.
+type Message struct {
+	ID        string
+	Name      string
+	Payload   []byte
+	TraceID   string
+	Attempt   int
+	CreatedAt time.Time
+}
+
+// Decode unmarshals the payload into v.
+func (m *Message) Decode(v interface{}) error {
+	return json.Unmarshal(m.Payload, v)
+}
+
+// Handler handles a message, an error or a panic fails the delivery, which
+// is retried.
+type Handler func(ctx context.Context, msg *Message) error
+
+type subscriber struct {
+	name    string
+	handler Handler
+}
+
+var (
+	subscribersMux sync.RWMutex
+	subscribers    = make(map[string][]subscriber)
+)
+
+// Subscribe registers handler for the events named name, name identifies the
+// subscriber in the logs and errors. It is meant to be called from init.
+func Subscribe(event, name string, handler Handler) {
+	subscribersMux.Lock()
+	defer subscribersMux.Unlock()
+
+	for _, s := range subscribers[event] {
+		if s.name == name {
+			panic(fmt.Sprintf("event: subscriber %s of %s registered twice", name, event))
+		}
+	}
+	subscribers[event] = append(subscribers[event], subscriber{name: name, handler: handler})
+}
+
+// On subscribes fn to the events of type T, decoded from the payload.
+func On[T Event](name string, fn func(ctx context.Context, e T) error) {
+	var zero T
+	Subscribe(zero.EventName(), name, func(ctx context.Context, msg *Message) error {
+		var e T
+		if err := msg.Decode(&e); err != nil {
+			return err
+		}
+		return fn(ctx, e)
+	})
+}
+
+func subscribersOf(event string) []subscriber {
+	subscribersMux.RLock()
+	defer subscribersMux.RUnlock()
+	return subscribers[event]
+}
+
+// Publish writes events to the outbox. Call it with the context of the
+// transaction making the change, see service.InTx, the events are then only
+// delivered once it commits.
+func Publish(ctx context.Context, events ...Event) error {
+	now := time.Now()
+	traceID := pkgctx.TraceIDFrom(ctx)
+
+	rows := make([]*model.OutboxEvent, 0, len(events))
+	for _, e := range events {
+		payload, err := json.Marshal(e)
+		if err != nil {
+			return fmt.Errorf("failed to encode event %s: %w", e.EventName(), err)
+		}
+		rows = append(rows, &model.OutboxEvent{
+			EventID:       ulid.New(),
+			Name:          e.EventName(),
+			Payload:       string(payload),
+			TraceID:       traceID,
+			Status:        model.OutboxPending,
+			NextAttemptAt: now,
+		})
+	}
+	return db.CreateOutboxEvents(ctx, rows)
+}
@@ -0,0 +1,161 @@
+package event
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go-server-template/internal/conf"
+	"go-server-template/internal/db"
+	"go-server-template/internal/model"
+	"go-server-template/pkg/logger"
+	"go-server-template/pkg/retry"
+	"time"
+)
+
+// Relay polls the outbox for due events and dispatches them to their
+// subscribers. Several relays, in one process or many, may run against the
+// same database: an event is claimed before it is dispatched.
+type Relay struct {
+	// Interval is the wait between two polls when the outbox is drained.
+	Interval time.Duration
+	// BatchSize is the number of events fetched per poll.
+	BatchSize int
+	// Retry spaces the deliveries of a failing event and bounds their number.
+	Retry retry.Policy
+	// Timeout bounds the dispatch of an event. The event stays claimed as
+	// long, and is dispatched again after it if the relay died meanwhile. 0
+	// means DefaultTimeout.
+	Timeout time.Duration
+}
+
+// DefaultTimeout bounds the dispatch of an event when the relay sets none.
+const DefaultTimeout = 30 * time.Second
+
+// NewRelay returns a relay configured by outbox.
+func NewRelay(outbox conf.Outbox) *Relay {
+	return &Relay{
+		Interval:  time.Duration(outbox.Interval) * time.Millisecond,
+		BatchSize: outbox.BatchSize,
+		Retry: retry.Policy{
+			Backoff: retry.Backoff{
+				Initial: time.Duration(outbox.RetryInterval) * time.Second,
+				Max:     time.Duration(outbox.MaxRetryInterval) * time.Second,
+			},
+			MaxAttempts: outbox.MaxAttempts,
+		},
+		Timeout: time.Duration(outbox.Timeout) * time.Second,
+	}
+}
+
+// Run dispatches the outbox until ctx is done. The event being dispatched
+// when ctx is done is finished first.
+func (r *Relay) Run(ctx context.Context) {
+	for {
+		n, err := r.RunOnce(ctx)
+		if err != nil {
+			logger.GetLogger().Errorf("Failed to relay outbox events: %s", err.Error())
+		}
+
+		wait := r.Interval
+		if err == nil && n >= r.BatchSize {
+			// more events are probably due
+			wait = 0
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// RunOnce dispatches one batch of due events and returns how many were due.
+func (r *Relay) RunOnce(ctx context.Context) (int, error) {
+	events, err := db.DueOutboxEvents(ctx, time.Now(), r.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, e := range events {
+		if ctx.Err() != nil {
+			break
+		}
+		if err = r.relay(e); err != nil {
+			return len(events), err
+		}
+	}
+	return len(events), nil
+}
+
+// relay claims and dispatches e. The outbox is updated without the caller's
+// context, so a shutdown never leaves a dispatched event unrecorded.
+func (r *Relay) relay(e *model.OutboxEvent) error {
+	ctx := context.Background()
+
+	claimed, err := db.ClaimOutboxEvent(ctx, e, time.Now().Add(r.timeout()))
+	if err != nil || !claimed {
+		return err
+	}
+
+	err = r.dispatch(e)
+	if err == nil {
+		return db.MarkOutboxDelivered(ctx, e, time.Now())
+	}
+
+	next, dead := r.Retry.Next(time.Now(), e.Attempts)
+	log := logger.GetLogger().WithFields(logger.Fields{
+		"event_id": e.EventID,
+		"event":    e.Name,
+		"attempt":  e.Attempts,
+		"error":    err.Error(),
+	})
+	if e.TraceID != "" {
+		log = log.WithField("trace_id", e.TraceID)
+	}
+	if dead {
+		log.Error("outbox event is dead")
+	} else {
+		log.Warn("failed to deliver outbox event")
+	}
+	return db.MarkOutboxFailed(ctx, e, err.Error(), next, dead)
+}
+
+func (r *Relay) timeout() time.Duration {
+	if r.Timeout <= 0 {
+		return DefaultTimeout
+	}
+	return r.Timeout
+}
+
+// dispatch hands e to every subscriber. A failure of any of them fails the
+// delivery, which is then retried for all of them.
+func (r *Relay) dispatch(e *model.OutboxEvent) error {
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout())
+	defer cancel()
+
+	msg := &Message{
+		ID:        e.EventID,
+		Name:      e.Name,
+		Payload:   []byte(e.Payload),
+		TraceID:   e.TraceID,
+		Attempt:   e.Attempts,
+		CreatedAt: e.CreatedAt,
+	}
+
+	var errs []error
+	for _, s := range subscribersOf(e.Name) {
+		if err := call(ctx, s, msg); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", s.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func call(ctx context.Context, s subscriber, msg *Message) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return s.handler(ctx, msg)
+}
@@ -0,0 +1,157 @@
+package event
+
+import (
+	"context"
+	"errors"
+	"go-server-template/internal/db"
+	"go-server-template/internal/db/dbtest"
+	"go-server-template/internal/model"
+	"go-server-template/pkg/logger"
+	"go-server-template/pkg/retry"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type pinged struct {
+	N int `json:"n"`
+}
+
+func (pinged) EventName() string {
+	return "test.pinged"
+}
+
+func openOutbox(t *testing.T) {
+	logger.Init("zap")
+	dbtest.Open(t, new(model.OutboxEvent))
+}
+
+func outboxEvent(t *testing.T) *model.OutboxEvent {
+	events, _, err := db.ListOutboxEvents(context.Background(), db.OutboxFilter{Limit: 10})
+	if err != nil || len(events) != 1 {
+		t.Fatalf("expected one outbox event, got %d (%v)", len(events), err)
+	}
+	return events[0]
+}
+
+func TestRelay(t *testing.T) {
+	openOutbox(t)
+	ctx := context.Background()
+
+	var received []int
+	fail := true
+	On("test", func(ctx context.Context, e pinged) error {
+		if fail {
+			return errors.New("unavailable")
+		}
+		received = append(received, e.N)
+		return nil
+	})
+	t.Cleanup(func() {
+		subscribersMux.Lock()
+		delete(subscribers, pinged{}.EventName())
+		subscribersMux.Unlock()
+	})
+
+	// events of a rolled back transaction are never written
+	tx := db.GetDB().Begin()
+	if err := Publish(db.WithTx(ctx, tx), pinged{N: 0}); err != nil {
+		t.Fatal(err)
+	}
+	tx.Rollback()
+
+	if err := Publish(ctx, pinged{N: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	relay := &Relay{BatchSize: 10, Retry: retry.Policy{MaxAttempts: 2}, Timeout: time.Second}
+	for attempt := 1; attempt <= 2; attempt++ {
+		if n, err := relay.RunOnce(ctx); err != nil || n != 1 {
+			t.Fatalf("attempt %d: expected 1 due event, got %d (%v)", attempt, n, err)
+		}
+	}
+	e := outboxEvent(t)
+	if e.Status != model.OutboxDead || e.Attempts != 2 || e.LastError != "test: unavailable" {
+		t.Fatalf("expected a dead event after 2 attempts, got %+v", e)
+	}
+	if n, _ := relay.RunOnce(ctx); n != 0 {
+		t.Fatalf("a dead event must not be due, got %d", n)
+	}
+
+	fail = false
+	if err := db.ReplayOutboxEvent(ctx, e.EventID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := relay.RunOnce(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if e = outboxEvent(t); e.Status != model.OutboxDelivered || e.DeliveredAt == nil || len(received) != 1 || received[0] != 1 {
+		t.Fatalf("expected the replayed event to be delivered once, got %+v, %v", e, received)
+	}
+
+	if err := db.ReplayOutboxEvent(ctx, "01ARYZ6S41TSV4RRFFQ69G5FAV"); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Fatalf("expected not found, got %v", err)
+	}
+}
+
+func TestRelayDefaultTimeout(t *testing.T) {
+	openOutbox(t)
+	ctx := context.Background()
+
+	var due int
+	var deadline time.Time
+	On("test", func(ctx context.Context, e pinged) error {
+		events, _ := db.DueOutboxEvents(ctx, time.Now(), 10)
+		due = len(events)
+		deadline, _ = ctx.Deadline()
+		return nil
+	})
+	t.Cleanup(func() {
+		subscribersMux.Lock()
+		delete(subscribers, pinged{}.EventName())
+		subscribersMux.Unlock()
+	})
+
+	if err := Publish(ctx, pinged{N: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := (&Relay{BatchSize: 10}).RunOnce(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if due != 0 {
+		t.Fatal("an event being dispatched must stay claimed without a timeout set")
+	}
+	if time.Until(deadline) < DefaultTimeout-time.Second {
+		t.Fatalf("expected the dispatch to be bounded by the default timeout, got %s", deadline)
+	}
+}
+
+func TestClaimOutboxEvent(t *testing.T) {
+	openOutbox(t)
+	ctx := context.Background()
+
+	if err := Publish(ctx, pinged{N: 1}); err != nil {
+		t.Fatal(err)
+	}
+	first, second := outboxEvent(t), outboxEvent(t)
+
+	lease := time.Now().Add(time.Minute)
+	if ok, err := db.ClaimOutboxEvent(ctx, first, lease); !ok || err != nil {
+		t.Fatalf("expected the first claim to succeed, got %v", err)
+	}
+	if ok, err := db.ClaimOutboxEvent(ctx, second, lease); ok || err != nil {
+		t.Fatalf("expected the second claim to fail, got %v", err)
+	}
+	if events, _ := db.DueOutboxEvents(ctx, time.Now(), 10); len(events) != 0 {
+		t.Fatal("a claimed event must not be due before its lease ends")
+	}
+
+	// the late outcome of a claim whose lease expired is ignored
+	if err := db.MarkOutboxDelivered(ctx, second, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if e := outboxEvent(t); e.Status != model.OutboxPending {
+		t.Fatalf("expected the event to stay pending, got %+v", e)
+	}
+}
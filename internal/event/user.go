@@ -0,0 +1,20 @@
+package event
+
+// UserCreated is published when a user is created. Payloads only carry ids,
+// so no personal data is kept in the outbox.
+type UserCreated struct {
+	UserID string `json:"user_id"`
+}
+
+func (UserCreated) EventName() string {
+	return "user.created"
+}
+
+// PasswordChanged is published when the password of a user is changed.
+type PasswordChanged struct {
+	UserID string `json:"user_id"`
+}
+
+func (PasswordChanged) EventName() string {
+	return "user.password_changed"
+}
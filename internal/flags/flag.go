@@ -0,0 +1,237 @@
+// Package flags evaluates the feature flags for the subject of a request.
+//
+// A flag is defined in the config or stored in the database, the stored one
+// winning. It serves one of its variants to each subject: the first rule
+// targeting the subject by public user id, role or tenant decides, the others get
+// the default. A rule or the default may roll out several variants by
+// percentage, a user is always put in the same bucket of a flag by hashing
+// its id, so the rollout is sticky and grows without reshuffling.
+package flags
+
+import (
+	"errors"
+	"fmt"
+	"go-server-template/internal/conf"
+	"go-server-template/pkg/ulid"
+	"hash/fnv"
+	"regexp"
+	"strconv"
+)
+
+type (
+	Flag   = conf.Flag
+	Rule   = conf.FlagRule
+	Serve  = conf.FlagServe
+	Weight = conf.FlagWeight
+)
+
+const (
+	On  = "on"
+	Off = "off"
+)
+
+// The reasons of an Evaluation.
+const (
+	ReasonUnknown  = "unknown"
+	ReasonDisabled = "disabled"
+	ReasonRule     = "rule"
+	ReasonDefault  = "default"
+)
+
+var ErrInvalid = errors.New("invalid flag")
+
+var keyPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_.-]{0,127}$`)
+
+// buckets is the granularity of the rollouts, a hundredth of a percent.
+const buckets = 10000
+
+// Subject is who a flag is evaluated for. UserID places the user in the
+// buckets of the rollouts, PublicID is matched by the user ids of the
+// rules.
+type Subject struct {
+	UserID   uint64
+	PublicID string
+	Roles    []string
+	Tenant   string
+}
+
+// Evaluation is the variant a flag serves to a subject.
+type Evaluation struct {
+	Key     string `json:"key" example:"new_profile"`
+	Variant string `json:"variant" example:"on"`
+	// Enabled is true when the served variant is not the off variant.
+	Enabled bool   `json:"enabled" example:"true"`
+	Reason  string `json:"reason" example:"rule"`
+}
+
+// variants returns the variants of f.
+func variants(f *Flag) []string {
+	if len(f.Variants) == 0 {
+		return []string{On, Off}
+	}
+	return f.Variants
+}
+
+// offVariant returns the variant served while f is disabled.
+func offVariant(f *Flag) string {
+	if f.OffVariant != "" {
+		return f.OffVariant
+	}
+	if len(f.Variants) == 0 {
+		return Off
+	}
+	return f.Variants[0]
+}
+
+// Validate checks that f only serves its own variants, that its rollouts
+// add up to 100 percent and that its rules target public user ids, which
+// are canonicalized.
+func Validate(f *Flag) error {
+	if !keyPattern.MatchString(f.Key) {
+		return fmt.Errorf("%w: key %q must be lowercase letters, digits, '_', '.' or '-'", ErrInvalid, f.Key)
+	}
+
+	known := make(map[string]bool)
+	for _, v := range variants(f) {
+		if v == "" || known[v] {
+			return fmt.Errorf("%w: %s: empty or duplicate variant %q", ErrInvalid, f.Key, v)
+		}
+		known[v] = true
+	}
+	if !known[offVariant(f)] {
+		return fmt.Errorf("%w: %s: unknown off variant %q", ErrInvalid, f.Key, f.OffVariant)
+	}
+
+	check := func(s *Serve, what string) error {
+		if len(s.Rollout) == 0 {
+			if !known[s.Variant] {
+				return fmt.Errorf("%w: %s: %s serves unknown variant %q", ErrInvalid, f.Key, what, s.Variant)
+			}
+			return nil
+		}
+		if s.Variant != "" {
+			return fmt.Errorf("%w: %s: %s has both a variant and a rollout", ErrInvalid, f.Key, what)
+		}
+		total := 0
+		for _, w := range s.Rollout {
+			if !known[w.Variant] {
+				return fmt.Errorf("%w: %s: %s rolls out unknown variant %q", ErrInvalid, f.Key, what, w.Variant)
+			}
+			if w.Percent < 0 {
+				return fmt.Errorf("%w: %s: %s has a negative percentage", ErrInvalid, f.Key, what)
+			}
+			total += percentBuckets(w.Percent)
+		}
+		if total != buckets {
+			return fmt.Errorf("%w: %s: %s rollout adds up to %.2f%%, not 100%%", ErrInvalid, f.Key, what, float64(total)/100)
+		}
+		return nil
+	}
+
+	for i := range f.Rules {
+		r := &f.Rules[i]
+		if len(r.UserIDs) == 0 && len(r.Roles) == 0 && len(r.Tenants) == 0 {
+			return fmt.Errorf("%w: %s: rule %d targets no one", ErrInvalid, f.Key, i+1)
+		}
+		for j, id := range r.UserIDs {
+			publicID, err := ulid.Parse(id)
+			if err != nil {
+				return fmt.Errorf("%w: %s: rule %d targets %q, not a public user id", ErrInvalid, f.Key, i+1, id)
+			}
+			r.UserIDs[j] = publicID
+		}
+		if err := check(&r.FlagServe, "rule "+strconv.Itoa(i+1)); err != nil {
+			return err
+		}
+	}
+	return check(&f.Default, "the default")
+}
+
+func percentBuckets(percent float64) int {
+	return int(percent*buckets/100 + 0.5)
+}
+
+// Evaluate returns the variant f serves to s.
+func Evaluate(f *Flag, s Subject) *Evaluation {
+	e := &Evaluation{Key: f.Key}
+	switch rule := match(f, s); {
+	case !f.Enabled:
+		e.Variant, e.Reason = offVariant(f), ReasonDisabled
+	case rule != nil:
+		e.Variant, e.Reason = serve(f, &rule.FlagServe, s), ReasonRule
+	default:
+		e.Variant, e.Reason = serve(f, &f.Default, s), ReasonDefault
+	}
+	e.Enabled = e.Variant != offVariant(f)
+	return e
+}
+
+// targetsUsers reports whether a rule of f targets user ids.
+func targetsUsers(f *Flag) bool {
+	for i := range f.Rules {
+		if len(f.Rules[i].UserIDs) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// match returns the first rule of f matching s.
+func match(f *Flag, s Subject) *Rule {
+	for i := range f.Rules {
+		r := &f.Rules[i]
+		if len(r.UserIDs) > 0 && !contains(r.UserIDs, s.PublicID) {
+			continue
+		}
+		if len(r.Tenants) > 0 && !contains(r.Tenants, s.Tenant) {
+			continue
+		}
+		if len(r.Roles) > 0 && !containsAny(r.Roles, s.Roles) {
+			continue
+		}
+		return r
+	}
+	return nil
+}
+
+func serve(f *Flag, s *Serve, subject Subject) string {
+	if len(s.Rollout) == 0 {
+		return s.Variant
+	}
+	b := bucket(f.Key, subject.UserID)
+	upper := 0
+	for _, w := range s.Rollout {
+		upper += percentBuckets(w.Percent)
+		if b < upper {
+			return w.Variant
+		}
+	}
+	return s.Rollout[len(s.Rollout)-1].Variant
+}
+
+// bucket places userID in one of the buckets of the flag key, the same
+// one on every evaluation. Salting with the key keeps the rollouts of the
+// different flags independent.
+func bucket(key string, userID uint64) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key + ":" + strconv.FormatUint(userID, 10)))
+	return int(h.Sum32() % buckets)
+}
+
+func contains[T comparable](list []T, v T) bool {
+	for _, item := range list {
+		if item == v {
+			return true
+		}
+	}
+	return false
+}
+
+func containsAny[T comparable](list, values []T) bool {
+	for _, v := range values {
+		if contains(list, v) {
+			return true
+		}
+	}
+	return false
+}
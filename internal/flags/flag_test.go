@@ -0,0 +1,188 @@
+package flags
+
+import (
+	"context"
+	"errors"
+	"go-server-template/internal/conf"
+	"go-server-template/internal/db"
+	"go-server-template/internal/db/dbtest"
+	"go-server-template/internal/model"
+	"go-server-template/pkg/logger"
+	"math"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+func openFlags(t *testing.T, config ...Flag) {
+	logger.Init("zap")
+	dbtest.Open(t, new(model.FeatureFlag))
+
+	if err := Init(conf.Flags{CacheTTL: 60, Definitions: config}); err != nil {
+		t.Fatal(err)
+	}
+	Invalidate()
+}
+
+func TestValidate(t *testing.T) {
+	for name, f := range map[string]Flag{
+		"bad key":          {Key: "New Profile", Default: Serve{Variant: Off}},
+		"unknown variant":  {Key: "x", Default: Serve{Variant: "blue"}},
+		"duplicate":        {Key: "x", Variants: []string{"a", "a"}, Default: Serve{Variant: "a"}},
+		"rollout below":    {Key: "x", Default: Serve{Rollout: []Weight{{Variant: On, Percent: 20}, {Variant: Off, Percent: 70}}}},
+		"variant+rollout":  {Key: "x", Default: Serve{Variant: On, Rollout: []Weight{{Variant: On, Percent: 100}}}},
+		"empty rule":       {Key: "x", Rules: []Rule{{FlagServe: Serve{Variant: On}}}, Default: Serve{Variant: Off}},
+		"unknown off":      {Key: "x", Variants: []string{"a", "b"}, OffVariant: "c", Default: Serve{Variant: "a"}},
+		"no default serve": {Key: "x"},
+		"internal user id": {Key: "x", Rules: []Rule{{UserIDs: []string{"7"}, FlagServe: Serve{Variant: On}}}, Default: Serve{Variant: Off}},
+	} {
+		if err := Validate(&f); !errors.Is(err, ErrInvalid) {
+			t.Errorf("%s: expected ErrInvalid, got %v", name, err)
+		}
+	}
+
+	f := Flag{Key: "checkout", Variants: []string{"old", "new"}, Default: Serve{
+		Rollout: []Weight{{Variant: "old", Percent: 66.66}, {Variant: "new", Percent: 33.34}},
+	}}
+	if err := Validate(&f); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	f := &Flag{
+		Key:     "new_profile",
+		Enabled: true,
+		Rules: []Rule{
+			{UserIDs: []string{"01arz3ndektsv4rrffq69g5fav"}, FlagServe: Serve{Variant: Off}},
+			{Roles: []string{"admin", "staff"}, Tenants: []string{"acme"}, FlagServe: Serve{Variant: On}},
+		},
+		Default: Serve{Rollout: []Weight{{Variant: On, Percent: 20}, {Variant: Off, Percent: 80}}},
+	}
+	if err := Validate(f); err != nil {
+		t.Fatal(err)
+	}
+
+	if f.Rules[0].UserIDs[0] != "01ARZ3NDEKTSV4RRFFQ69G5FAV" {
+		t.Fatalf("expected the canonical public id, got %s", f.Rules[0].UserIDs[0])
+	}
+
+	if e := Evaluate(f, Subject{UserID: 7, PublicID: "01ARZ3NDEKTSV4RRFFQ69G5FAV", Roles: []string{"admin"}, Tenant: "acme"}); e.Enabled || e.Reason != ReasonRule {
+		t.Fatalf("expected the user rule to win, got %+v", e)
+	}
+	if e := Evaluate(f, Subject{UserID: 8, Roles: []string{"user", "staff"}, Tenant: "acme"}); !e.Enabled || e.Reason != ReasonRule {
+		t.Fatalf("expected the role and tenant rule, got %+v", e)
+	}
+	if e := Evaluate(f, Subject{UserID: 8, Roles: []string{"staff"}, Tenant: "other"}); e.Reason != ReasonDefault {
+		t.Fatalf("a rule needs all of its lists to match, got %+v", e)
+	}
+
+	// the rollout is sticky and close to its percentage
+	enabled := 0
+	const users = 10000
+	for id := uint64(1); id <= users; id++ {
+		e := Evaluate(f, Subject{UserID: id + 100})
+		if e != nil && e.Enabled {
+			enabled++
+		}
+		if again := Evaluate(f, Subject{UserID: id + 100}); again.Variant != e.Variant {
+			t.Fatalf("user %d moved from %s to %s", id, e.Variant, again.Variant)
+		}
+	}
+	if ratio := float64(enabled) / users; math.Abs(ratio-0.2) > 0.02 {
+		t.Fatalf("expected about 20%% of the users, got %.3f", ratio)
+	}
+
+	// a larger rollout keeps the users already in it
+	wider := *f
+	wider.Default = Serve{Rollout: []Weight{{Variant: On, Percent: 50}, {Variant: Off, Percent: 50}}}
+	for id := uint64(1); id <= 1000; id++ {
+		if Evaluate(f, Subject{UserID: id}).Enabled && !Evaluate(&wider, Subject{UserID: id}).Enabled {
+			t.Fatalf("user %d left the rollout when it grew", id)
+		}
+	}
+
+	f.Enabled = false
+	if e := Evaluate(f, Subject{UserID: 8, Roles: []string{"admin"}, Tenant: "acme"}); e.Enabled || e.Variant != Off || e.Reason != ReasonDisabled {
+		t.Fatalf("expected the disabled flag to serve off, got %+v", e)
+	}
+}
+
+func TestSources(t *testing.T) {
+	openFlags(t,
+		Flag{Key: "new_profile", Enabled: true, Default: Serve{Variant: On}},
+		Flag{Key: "theme", Enabled: true, Variants: []string{"light", "dark"}, Default: Serve{Variant: "light"},
+			Rules: []Rule{{Tenants: []string{"acme"}, FlagServe: Serve{Variant: "dark"}}}},
+	)
+	ctx := WithSubject(context.Background(), Subject{UserID: 1, Tenant: "acme"})
+
+	if !Enabled(ctx, "new_profile") || Variant(ctx, "theme") != "dark" {
+		t.Fatal("expected the flags of the config")
+	}
+	if Enabled(ctx, "missing") || Get(ctx, "missing").Reason != ReasonUnknown {
+		t.Fatal("an unknown flag must be disabled")
+	}
+
+	// the stored flag overrides the config once the cache is invalidated
+	if err := Save(ctx, &Flag{Key: "new_profile", Enabled: false, Default: Serve{Variant: On}}); err != nil {
+		t.Fatal(err)
+	}
+	if !Enabled(ctx, "new_profile") {
+		t.Fatal("expected the cached flags")
+	}
+	Invalidate()
+	if Enabled(ctx, "new_profile") {
+		t.Fatal("expected the stored flag to override the config")
+	}
+	if err := Save(ctx, &Flag{Key: "new_profile", Enabled: true, Default: Serve{Variant: "blue"}}); !errors.Is(err, ErrInvalid) {
+		t.Fatalf("expected ErrInvalid, got %v", err)
+	}
+
+	list, err := List(ctx)
+	if err != nil || len(list) != 2 || list[0].Source != SourceDatabase || list[1].Source != SourceConfig {
+		t.Fatalf("unexpected list %v (%v)", list, err)
+	}
+	if all := All(ctx); len(all) != 2 || all["new_profile"].Enabled || all["theme"].Variant != "dark" {
+		t.Fatalf("unexpected evaluations %v", all)
+	}
+
+	if err = Delete(ctx, "new_profile"); err != nil {
+		t.Fatal(err)
+	}
+	Invalidate()
+	if !Enabled(ctx, "new_profile") {
+		t.Fatal("expected the flag of the config back")
+	}
+	if err = Delete(ctx, "new_profile"); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Fatalf("expected not found, got %v", err)
+	}
+}
+
+func TestTargetPublicID(t *testing.T) {
+	openFlags(t)
+	if err := db.GetDB().AutoMigrate(new(model.User)); err != nil {
+		t.Fatal(err)
+	}
+	user := &model.User{Username: "alice"}
+	if err := db.Users().Create(context.Background(), user); err != nil {
+		t.Fatal(err)
+	}
+	ctx := WithSubject(context.Background(), Subject{UserID: uint64(user.ID)})
+
+	err := Save(ctx, &Flag{Key: "beta", Enabled: true, Default: Serve{Variant: Off},
+		Rules: []Rule{{UserIDs: []string{user.PublicID}, FlagServe: Serve{Variant: On}}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	Invalidate()
+	if e := Get(ctx, "beta"); !e.Enabled || e.Reason != ReasonRule {
+		t.Fatalf("expected the rule to target the user by public id, got %+v", e)
+	}
+	if all := All(ctx); !all["beta"].Enabled {
+		t.Fatalf("unexpected evaluations %v", all)
+	}
+	other := WithSubject(context.Background(), Subject{UserID: uint64(user.ID) + 1})
+	if Enabled(other, "beta") {
+		t.Fatal("expected another user to get the default")
+	}
+}
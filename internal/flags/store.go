@@ -0,0 +1,256 @@
+package flags
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"go-server-template/internal/conf"
+	"go-server-template/internal/db"
+	"go-server-template/internal/model"
+	"go-server-template/pkg/cache"
+	pkgctx "go-server-template/pkg/context"
+	"go-server-template/pkg/logger"
+	"sort"
+	"sync"
+	"time"
+)
+
+// The sources of a Definition.
+const (
+	SourceConfig   = "config"
+	SourceDatabase = "database"
+)
+
+// Definition is a flag along with where it is defined.
+type Definition struct {
+	*Flag
+	Source string `json:"source" example:"database"`
+	// Error tells why a stored flag is ignored.
+	Error string `json:"error,omitempty"`
+}
+
+const defaultCacheTTL = 30 * time.Second
+
+var store = &flagStore{stored: cache.NewSnapshot(defaultCacheTTL, loadStored)}
+
+// flagStore keeps the flags of the config and a cache of the stored ones.
+type flagStore struct {
+	mux    sync.RWMutex
+	config map[string]*Flag
+	stored *cache.Snapshot[map[string]*Flag]
+}
+
+// Init validates the flags of the config and configures the cache as flags
+// says.
+func Init(flags conf.Flags) error {
+	config := make(map[string]*Flag, len(flags.Definitions))
+	for i := range flags.Definitions {
+		f := flags.Definitions[i]
+		if err := Validate(&f); err != nil {
+			return err
+		}
+		if _, ok := config[f.Key]; ok {
+			return fmt.Errorf("%w: %s defined twice in the config", ErrInvalid, f.Key)
+		}
+		config[f.Key] = &f
+	}
+
+	store.mux.Lock()
+	store.config = config
+	store.mux.Unlock()
+	store.stored.SetTTL(time.Duration(flags.CacheTTL) * time.Second)
+	return nil
+}
+
+// Invalidate drops the cached flags of the database, the next evaluation
+// loads them again. It is called after every write, once its transaction
+// committed.
+func Invalidate() {
+	store.stored.Invalidate()
+}
+
+// definitions returns the flags by key, the stored ones overriding the
+// ones of the config. The flags of the config alone are returned when the
+// database cannot be read.
+func (s *flagStore) definitions(ctx context.Context) map[string]*Definition {
+	stored, err := s.stored.Get(ctx)
+	if err != nil {
+		logger.GetLogger().Errorf("Failed to load feature flags, using the config only: %s", err.Error())
+	}
+
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	defs := make(map[string]*Definition, len(s.config)+len(stored))
+	for key, f := range s.config {
+		defs[key] = &Definition{Flag: f, Source: SourceConfig}
+	}
+	for key, f := range stored {
+		defs[key] = &Definition{Flag: f, Source: SourceDatabase}
+	}
+	return defs
+}
+
+func loadStored(ctx context.Context) (map[string]*Flag, error) {
+	// read outside the transaction of ctx, which may hold uncommitted writes
+	rows, err := db.ListFeatureFlags(db.WithoutTx(ctx))
+	if err != nil {
+		return nil, err
+	}
+	stored := make(map[string]*Flag, len(rows))
+	for _, row := range rows {
+		f, err := decode(row)
+		if err != nil {
+			logger.GetLogger().Warnf("Ignoring stored feature flag %s: %s", row.Key, err.Error())
+			continue
+		}
+		stored[row.Key] = f
+	}
+	return stored, nil
+}
+
+func decode(row *model.FeatureFlag) (*Flag, error) {
+	var f Flag
+	if err := json.Unmarshal([]byte(row.Definition), &f); err != nil {
+		return nil, err
+	}
+	f.Key = row.Key
+	if err := Validate(&f); err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+// List returns every flag sorted by key, the stored ones read from the
+// database rather than the cache.
+func List(ctx context.Context) ([]*Definition, error) {
+	rows, err := db.ListFeatureFlags(db.UsePrimary(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	store.mux.RLock()
+	defs := make(map[string]*Definition, len(store.config)+len(rows))
+	for key, f := range store.config {
+		defs[key] = &Definition{Flag: f, Source: SourceConfig}
+	}
+	store.mux.RUnlock()
+	for _, row := range rows {
+		f, err := decode(row)
+		if err != nil {
+			// listed anyway, so it can be fixed
+			defs[row.Key] = &Definition{Flag: &Flag{Key: row.Key}, Source: SourceDatabase, Error: err.Error()}
+			continue
+		}
+		defs[row.Key] = &Definition{Flag: f, Source: SourceDatabase}
+	}
+
+	list := make([]*Definition, 0, len(defs))
+	for _, d := range defs {
+		list = append(list, d)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Key < list[j].Key })
+	return list, nil
+}
+
+// Save validates f and stores it, overriding the flag of the config with
+// the same key. Invalidate must be called once the transaction of ctx
+// committed.
+func Save(ctx context.Context, f *Flag) error {
+	if err := Validate(f); err != nil {
+		return err
+	}
+	definition, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+	_, err = db.SaveFeatureFlag(ctx, &model.FeatureFlag{Key: f.Key, Definition: string(definition)})
+	return err
+}
+
+// Delete deletes the stored flag key, the flag of the config with the same
+// key applies again. gorm.ErrRecordNotFound is returned when it is not
+// stored. Invalidate must be called once the transaction of ctx committed.
+func Delete(ctx context.Context, key string) error {
+	return db.DeleteFeatureFlag(ctx, key)
+}
+
+type subjectKey struct{}
+
+// WithSubject returns a context evaluating the flags for s, for work that
+// runs outside a request such as jobs.
+func WithSubject(ctx context.Context, s Subject) context.Context {
+	return context.WithValue(ctx, subjectKey{}, s)
+}
+
+// SubjectFrom returns the subject set by WithSubject, or else the
+// authorized user of the request behind ctx. Its PublicID is looked up when
+// a flag targets user ids.
+func SubjectFrom(ctx context.Context) Subject {
+	if s, ok := ctx.Value(subjectKey{}).(Subject); ok {
+		return s
+	}
+	return Subject{
+		UserID: pkgctx.UserIDFrom(ctx),
+		Roles:  pkgctx.RolesFrom(ctx),
+		Tenant: pkgctx.TenantFrom(ctx),
+	}
+}
+
+// Get evaluates the flag key for the subject of ctx. An unknown flag
+// serves no variant and is disabled.
+func Get(ctx context.Context, key string) *Evaluation {
+	d, ok := store.definitions(ctx)[key]
+	if !ok {
+		return &Evaluation{Key: key, Reason: ReasonUnknown}
+	}
+	return Evaluate(d.Flag, withPublicID(ctx, SubjectFrom(ctx), d))
+}
+
+// Enabled reports whether the flag key serves the subject of ctx another
+// variant than its off variant, "on" for a boolean flag.
+func Enabled(ctx context.Context, key string) bool {
+	return Get(ctx, key).Enabled
+}
+
+// Variant returns the variant the flag key serves to the subject of ctx.
+func Variant(ctx context.Context, key string) string {
+	return Get(ctx, key).Variant
+}
+
+// All evaluates every flag for the subject of ctx.
+func All(ctx context.Context) map[string]*Evaluation {
+	defs := store.definitions(ctx)
+	list := make([]*Definition, 0, len(defs))
+	for _, d := range defs {
+		list = append(list, d)
+	}
+	subject := withPublicID(ctx, SubjectFrom(ctx), list...)
+	evaluations := make(map[string]*Evaluation, len(defs))
+	for key, d := range defs {
+		evaluations[key] = Evaluate(d.Flag, subject)
+	}
+	return evaluations
+}
+
+// withPublicID fills the PublicID of s from its UserID when one of defs
+// targets user ids, so the subjects of requests only cost a lookup for the
+// flags that need it. The rules by user id match no one when the lookup
+// fails.
+func withPublicID(ctx context.Context, s Subject, defs ...*Definition) Subject {
+	if s.PublicID != "" || s.UserID == 0 {
+		return s
+	}
+	for _, d := range defs {
+		if !targetsUsers(d.Flag) {
+			continue
+		}
+		ids, err := db.Users().PublicIDs(ctx, []uint64{s.UserID})
+		if err != nil {
+			logger.GetLogger().Errorf("Failed to look up the public id of user %d for the feature flags: %s", s.UserID, err.Error())
+			return s
+		}
+		s.PublicID = ids[s.UserID]
+		return s
+	}
+	return s
+}
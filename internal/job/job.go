@@ -0,0 +1,154 @@
+// Package job runs background work outside the request path, on the tables
+// of the application database.
+//
+// Handlers are registered by name from init, and jobs are enqueued with the
+// context of the caller, so a job enqueued in a transaction only runs once it
+// commits. A Worker claims due jobs and runs them with a bounded concurrency.
+// A job may run more than once, after a failure or when its worker died, its
+// handler must therefore be idempotent.
+package job
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go-server-template/internal/db"
+	"go-server-template/internal/model"
+	"go-server-template/pkg/ulid"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrDuplicate is returned by Enqueue, along with the existing job, when a
+// job with the same unique key is still pending or running.
+var ErrDuplicate = errors.New("job with the same unique key already queued")
+
+// Job is the typed payload of a job, JobName selects its handler.
+type Job interface {
+	JobName() string
+}
+
+// Handler runs a job, an error or a panic fails the attempt, which is retried
+// with backoff until the job is dead.
+type Handler func(ctx context.Context, j *model.Job) error
+
+var (
+	handlersMux sync.RWMutex
+	handlers    = make(map[string]Handler)
+)
+
+// Register registers handler for the jobs named name. It is meant to be
+// called from init.
+func Register(name string, handler Handler) {
+	handlersMux.Lock()
+	defer handlersMux.Unlock()
+
+	if _, ok := handlers[name]; ok {
+		panic(fmt.Sprintf("job: handler of %s registered twice", name))
+	}
+	handlers[name] = handler
+}
+
+// Handle registers fn for the jobs of type T, decoded from the payload.
+func Handle[T Job](fn func(ctx context.Context, j T) error) {
+	var zero T
+	Register(zero.JobName(), func(ctx context.Context, j *model.Job) error {
+		var payload T
+		if err := json.Unmarshal([]byte(j.Payload), &payload); err != nil {
+			return err
+		}
+		return fn(ctx, payload)
+	})
+}
+
+func handlerOf(name string) (Handler, bool) {
+	handlersMux.RLock()
+	defer handlersMux.RUnlock()
+	h, ok := handlers[name]
+	return h, ok
+}
+
+// Names returns the sorted names of the registered handlers.
+func Names() []string {
+	handlersMux.RLock()
+	defer handlersMux.RUnlock()
+	names := make([]string, 0, len(handlers))
+	for name := range handlers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+type options struct {
+	uniqueKey   string
+	runAt       time.Time
+	maxAttempts int
+}
+
+type Option func(*options)
+
+// WithUniqueKey skips the job while another one with key is pending or
+// running.
+func WithUniqueKey(key string) Option {
+	return func(o *options) {
+		o.uniqueKey = key
+	}
+}
+
+// WithRunAt delays the job until t.
+func WithRunAt(t time.Time) Option {
+	return func(o *options) {
+		o.runAt = t
+	}
+}
+
+// WithDelay delays the job by d.
+func WithDelay(d time.Duration) Option {
+	return func(o *options) {
+		o.runAt = time.Now().Add(d)
+	}
+}
+
+// WithMaxAttempts overrides the number of attempts of the worker.
+func WithMaxAttempts(n int) Option {
+	return func(o *options) {
+		o.maxAttempts = n
+	}
+}
+
+// Enqueue queues j with the connection of ctx, see service.InTx.
+func Enqueue(ctx context.Context, j Job, opts ...Option) (*model.Job, error) {
+	o := &options{runAt: time.Now()}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	payload, err := json.Marshal(j)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode job %s: %w", j.JobName(), err)
+	}
+
+	row := &model.Job{
+		JobID:       ulid.New(),
+		Name:        j.JobName(),
+		Payload:     string(payload),
+		Status:      model.JobPending,
+		MaxAttempts: o.maxAttempts,
+		RunAt:       o.runAt,
+	}
+	if o.uniqueKey != "" {
+		row.UniqueKey = &o.uniqueKey
+	}
+
+	existing, created, err := db.CreateJob(ctx, row)
+	if err != nil {
+		return nil, err
+	}
+	if !created {
+		return existing, ErrDuplicate
+	}
+	return row, nil
+}
@@ -0,0 +1,205 @@
+package job
+
+import (
+	"context"
+	"fmt"
+	"go-server-template/internal/conf"
+	"go-server-template/internal/db"
+	"go-server-template/internal/model"
+	"go-server-template/pkg/logger"
+	"go-server-template/pkg/retry"
+	"go-server-template/pkg/ulid"
+	"os"
+	"sync"
+	"time"
+)
+
+// Worker claims due jobs and runs them on up to Concurrency goroutines.
+type Worker struct {
+	// ID identifies the worker in the locks it holds.
+	ID string
+	// Concurrency is the number of jobs run at once.
+	Concurrency int
+	// PollInterval is the wait between two claims when no job is due.
+	PollInterval time.Duration
+	// Timeout bounds a run of a job. The job stays locked as long, other
+	// workers claim it again after it when this worker died meanwhile. 0
+	// means DefaultTimeout.
+	Timeout time.Duration
+	// Retry spaces the runs of a failing job and bounds their number, unless
+	// the job sets its own maximum.
+	Retry retry.Policy
+	// DrainTimeout is how long Run waits for the running jobs once its
+	// context is done, they are canceled after it.
+	DrainTimeout time.Duration
+}
+
+// DefaultTimeout bounds a run of a job when the worker sets none.
+const DefaultTimeout = 5 * time.Minute
+
+// NewWorker returns a worker configured by jobs.
+func NewWorker(jobs conf.Jobs) *Worker {
+	host, _ := os.Hostname()
+	return &Worker{
+		ID:           fmt.Sprintf("%s-%d-%s", host, os.Getpid(), ulid.New()[20:]),
+		Concurrency:  jobs.Concurrency,
+		PollInterval: time.Duration(jobs.PollInterval) * time.Millisecond,
+		Timeout:      time.Duration(jobs.Timeout) * time.Second,
+		Retry: retry.Policy{
+			Backoff: retry.Backoff{
+				Initial: time.Duration(jobs.RetryInterval) * time.Second,
+				Max:     time.Duration(jobs.MaxRetryInterval) * time.Second,
+			},
+			MaxAttempts: jobs.MaxAttempts,
+		},
+		DrainTimeout: time.Duration(jobs.DrainTimeout) * time.Second,
+	}
+}
+
+// Run claims and runs jobs until ctx is done, then drains the running jobs.
+func (w *Worker) Run(ctx context.Context) {
+	concurrency := w.concurrency()
+
+	// the jobs are only canceled by stop, not by ctx, so they can finish
+	// while the worker drains
+	runCtx, stop := context.WithCancel(context.Background())
+	defer stop()
+
+	slots := make(chan struct{}, concurrency)
+	finished := make(chan struct{}, 1)
+	var running sync.WaitGroup
+
+	for ctx.Err() == nil {
+		free := concurrency - len(slots)
+		jobs, err := db.ClaimJobs(ctx, w.ID, time.Now(), time.Now().Add(w.timeout()), free)
+		if err != nil && ctx.Err() == nil {
+			logger.GetLogger().Errorf("Failed to claim jobs: %s", err.Error())
+		}
+
+		for _, j := range jobs {
+			slots <- struct{}{}
+			running.Add(1)
+			go func(j *model.Job) {
+				defer func() {
+					<-slots
+					running.Done()
+					select {
+					case finished <- struct{}{}:
+					default:
+					}
+				}()
+				w.run(runCtx, j)
+			}(j)
+		}
+
+		if err == nil && free > 0 && len(jobs) == free {
+			// more jobs are probably due, claim again once a slot is free
+			select {
+			case <-ctx.Done():
+			case <-finished:
+			}
+			continue
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(w.PollInterval):
+		}
+	}
+
+	drained := make(chan struct{})
+	go func() {
+		running.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+	case <-time.After(w.DrainTimeout):
+		logger.GetLogger().Warnf("Canceling the jobs still running after %s", w.DrainTimeout)
+		stop()
+		<-drained
+	}
+}
+
+// RunOnce claims up to Concurrency due jobs, runs them and returns how many
+// ran.
+func (w *Worker) RunOnce(ctx context.Context) (int, error) {
+	jobs, err := db.ClaimJobs(ctx, w.ID, time.Now(), time.Now().Add(w.timeout()), w.concurrency())
+	if err != nil {
+		return 0, err
+	}
+	var running sync.WaitGroup
+	for _, j := range jobs {
+		running.Add(1)
+		go func(j *model.Job) {
+			defer running.Done()
+			w.run(ctx, j)
+		}(j)
+	}
+	running.Wait()
+	return len(jobs), nil
+}
+
+func (w *Worker) concurrency() int {
+	if w.Concurrency <= 0 {
+		return 1
+	}
+	return w.Concurrency
+}
+
+func (w *Worker) timeout() time.Duration {
+	if w.Timeout <= 0 {
+		return DefaultTimeout
+	}
+	return w.Timeout
+}
+
+// run runs j and records the outcome. The outcome is recorded without ctx,
+// so a canceled run is recorded as a failure too.
+func (w *Worker) run(ctx context.Context, j *model.Job) {
+	err := w.call(ctx, j)
+	if err == nil {
+		if err = db.CompleteJob(context.Background(), j, w.ID, time.Now()); err != nil {
+			logger.GetLogger().Errorf("Failed to complete job %s: %s", j.JobID, err.Error())
+		}
+		return
+	}
+
+	policy := w.Retry
+	if j.MaxAttempts > 0 {
+		policy.MaxAttempts = j.MaxAttempts
+	}
+	next, dead := policy.Next(time.Now(), j.Attempts)
+
+	log := logger.GetLogger().WithFields(logger.Fields{
+		"job_id":  j.JobID,
+		"job":     j.Name,
+		"attempt": j.Attempts,
+		"error":   err.Error(),
+	})
+	if dead {
+		log.Error("job is dead")
+	} else {
+		log.Warn("job failed")
+	}
+
+	if err = db.FailJob(context.Background(), j, w.ID, err.Error(), next, dead); err != nil {
+		logger.GetLogger().Errorf("Failed to record the failure of job %s: %s", j.JobID, err.Error())
+	}
+}
+
+func (w *Worker) call(ctx context.Context, j *model.Job) (err error) {
+	handler, ok := handlerOf(j.Name)
+	if !ok {
+		return fmt.Errorf("no handler registered for job %s", j.Name)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, w.timeout())
+	defer cancel()
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return handler(ctx, j)
+}
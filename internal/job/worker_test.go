@@ -0,0 +1,231 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"go-server-template/internal/db"
+	"go-server-template/internal/db/dbtest"
+	"go-server-template/internal/model"
+	"go-server-template/pkg/logger"
+	"go-server-template/pkg/retry"
+	"go-server-template/pkg/ulid"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type cleanup struct {
+	Dir string `json:"dir"`
+}
+
+func (cleanup) JobName() string {
+	return "test.cleanup"
+}
+
+func openJobs(t *testing.T) *gorm.DB {
+	logger.Init("zap")
+	return dbtest.Open(t, new(model.Job))
+}
+
+func handle(t *testing.T, fn func(ctx context.Context, j cleanup) error) {
+	Handle(fn)
+	t.Cleanup(func() {
+		handlersMux.Lock()
+		delete(handlers, cleanup{}.JobName())
+		handlersMux.Unlock()
+	})
+}
+
+func getJob(t *testing.T, jobID string) *model.Job {
+	j, err := db.GetJob(context.Background(), jobID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return j
+}
+
+func TestWorker(t *testing.T) {
+	openJobs(t)
+	ctx := context.Background()
+
+	var fail atomic.Bool
+	fail.Store(true)
+	var runs atomic.Int32
+	handle(t, func(ctx context.Context, j cleanup) error {
+		runs.Add(1)
+		if j.Dir != "tmp" {
+			t.Errorf("unexpected payload %+v", j)
+		}
+		if fail.Load() {
+			return errors.New("disk busy")
+		}
+		return nil
+	})
+
+	queued, err := Enqueue(ctx, cleanup{Dir: "tmp"}, WithUniqueKey("cleanup:tmp"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dup, err := Enqueue(ctx, cleanup{Dir: "tmp"}, WithUniqueKey("cleanup:tmp")); !errors.Is(err, ErrDuplicate) || dup.JobID != queued.JobID {
+		t.Fatalf("expected the queued job back as a duplicate, got %v", err)
+	}
+
+	w := &Worker{ID: "w1", Concurrency: 2, Timeout: time.Minute, Retry: retry.Policy{MaxAttempts: 2}}
+	for attempt := 1; attempt <= 2; attempt++ {
+		if n, err := w.RunOnce(ctx); err != nil || n != 1 {
+			t.Fatalf("attempt %d: expected 1 job, got %d (%v)", attempt, n, err)
+		}
+	}
+	j := getJob(t, queued.JobID)
+	if j.Status != model.JobDead || j.Attempts != 2 || j.LastError != "disk busy" || j.UniqueKey != nil {
+		t.Fatalf("expected a dead job after 2 attempts, got %+v", j)
+	}
+
+	// the unique key is released once the job is dead
+	if _, err = Enqueue(ctx, cleanup{Dir: "tmp"}, WithUniqueKey("cleanup:tmp"), WithDelay(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := w.RunOnce(ctx); n != 0 {
+		t.Fatalf("a delayed job must not run, got %d", n)
+	}
+
+	if err = db.CancelJob(ctx, queued.JobID); !errors.Is(err, db.ErrJobState) {
+		t.Fatalf("a dead job cannot be canceled, got %v", err)
+	}
+	fail.Store(false)
+	if err = db.RetryJob(ctx, queued.JobID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = w.RunOnce(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if j = getJob(t, queued.JobID); j.Status != model.JobSucceeded || j.FinishedAt == nil || runs.Load() != 3 {
+		t.Fatalf("expected the retried job to succeed, got %+v after %d runs", j, runs.Load())
+	}
+	if err = db.RetryJob(ctx, "01ARYZ6S41TSV4RRFFQ69G5FAV"); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Fatalf("expected not found, got %v", err)
+	}
+}
+
+func TestEnqueueRace(t *testing.T) {
+	dB := openJobs(t)
+	ctx := context.Background()
+
+	// another enqueue inserts the key race between the look-up and the insert
+	var race string
+	var other *model.Job
+	err := dB.Callback().Query().After("gorm:query").Register("test:race", func(tx *gorm.DB) {
+		if race == "" || tx.Statement.Table != "jobs" {
+			return
+		}
+		key := race
+		race = ""
+		other = &model.Job{JobID: ulid.New(), Name: cleanup{}.JobName(), Payload: "{}", UniqueKey: &key, Status: model.JobPending, RunAt: time.Now()}
+		if err := tx.Session(&gorm.Session{NewDB: true}).Create(other).Error; err != nil {
+			t.Error(err)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	race = "cleanup:race"
+	dup, err := Enqueue(ctx, cleanup{Dir: "tmp"}, WithUniqueKey("cleanup:race"))
+	if !errors.Is(err, ErrDuplicate) || dup.JobID != other.JobID {
+		t.Fatalf("expected the concurrent job back as a duplicate, got %+v (%v)", dup, err)
+	}
+
+	// the insert that lost the race does not abort the transaction
+	race = "cleanup:tx"
+	err = dB.Transaction(func(tx *gorm.DB) error {
+		ctx := db.WithTx(ctx, tx)
+		dup, err := Enqueue(ctx, cleanup{Dir: "tmp"}, WithUniqueKey("cleanup:tx"))
+		if !errors.Is(err, ErrDuplicate) || dup.JobID != other.JobID {
+			t.Fatalf("expected the concurrent job back as a duplicate, got %+v (%v)", dup, err)
+		}
+		_, err = Enqueue(ctx, cleanup{Dir: "other"})
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if jobs, total, _ := db.ListJobs(ctx, db.JobFilter{Limit: 10}); total != 3 {
+		t.Fatalf("expected both concurrent jobs and the one after them, got %d", len(jobs))
+	}
+}
+
+func TestClaimJobs(t *testing.T) {
+	openJobs(t)
+	ctx := context.Background()
+
+	queued, err := Enqueue(ctx, cleanup{Dir: "tmp"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	jobs, err := db.ClaimJobs(ctx, "w1", now, now.Add(time.Minute), 10)
+	if err != nil || len(jobs) != 1 || jobs[0].Attempts != 1 {
+		t.Fatalf("expected to claim the job, got %v (%v)", jobs, err)
+	}
+	if jobs, _ = db.ClaimJobs(ctx, "w2", now, now.Add(time.Minute), 10); len(jobs) != 0 {
+		t.Fatal("a locked job must not be claimed again")
+	}
+	if err = db.CancelJob(ctx, queued.JobID); !errors.Is(err, db.ErrJobState) {
+		t.Fatalf("a running job cannot be canceled, got %v", err)
+	}
+
+	// the first worker died, its lock expires
+	later := now.Add(2 * time.Minute)
+	jobs, err = db.ClaimJobs(ctx, "w2", later, later.Add(time.Minute), 10)
+	if err != nil || len(jobs) != 1 || jobs[0].Attempts != 2 {
+		t.Fatalf("expected the abandoned job to be claimed again, got %v (%v)", jobs, err)
+	}
+
+	// the late outcome of the first worker is ignored
+	stale := *jobs[0]
+	stale.Attempts = 1
+	if err = db.CompleteJob(ctx, &stale, "w1", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if j := getJob(t, queued.JobID); j.Status != model.JobRunning || j.LockedBy != "w2" {
+		t.Fatalf("expected the job to stay with w2, got %+v", j)
+	}
+}
+
+func TestWorkerDrain(t *testing.T) {
+	openJobs(t)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	started := make(chan struct{})
+	handle(t, func(ctx context.Context, j cleanup) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	queued, err := Enqueue(ctx, cleanup{Dir: "tmp"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := &Worker{ID: "w1", Concurrency: 1, PollInterval: 10 * time.Millisecond, Timeout: time.Minute, DrainTimeout: 50 * time.Millisecond, Retry: retry.Policy{Backoff: retry.Backoff{Initial: time.Second}}}
+	stopped := make(chan struct{})
+	go func() {
+		w.Run(ctx)
+		close(stopped)
+	}()
+
+	<-started
+	cancel()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the worker did not stop after the drain timeout")
+	}
+
+	if j := getJob(t, queued.JobID); j.Status != model.JobPending || j.LastError != context.Canceled.Error() {
+		t.Fatalf("expected the canceled job to be pending again, got %+v", j)
+	}
+}
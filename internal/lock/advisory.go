@@ -0,0 +1,124 @@
+package lock
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"go-server-template/internal/db"
+	"hash/fnv"
+	"sync"
+	"time"
+)
+
+// AdvisoryLocker holds the locks as postgres session advisory locks, each
+// on a connection of its own taken from DB. The lock is freed by the
+// server as soon as the connection drops, so a crashed replica does not
+// keep it until its TTL runs out.
+//
+// A held lock thus keeps a connection of DB, the main pool, out of the
+// pool until its release. MaxLocks bounds the locks held at once so they
+// never take the whole pool, the locks above it are refused with ErrLocked.
+//
+// The leases table still records the holder and hands out the fencing
+// tokens, its expiry only tells how long the holder was last seen.
+type AdvisoryLocker struct {
+	DB *sql.DB
+	// MaxLocks is the number of locks held at once, 0 means no limit.
+	MaxLocks int
+
+	slotsOnce sync.Once
+	slots     chan struct{}
+}
+
+var _ Locker = (*AdvisoryLocker)(nil)
+
+// advisoryKey maps name onto the 64 bits key space of the advisory locks.
+func advisoryKey(name string) int64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(name))
+	return int64(h.Sum64())
+}
+
+// takeSlot reserves a connection for a lock, free must be called once the
+// connection went back to the pool.
+func (a *AdvisoryLocker) takeSlot() (free func(), ok bool) {
+	if a.MaxLocks <= 0 {
+		return func() {}, true
+	}
+	a.slotsOnce.Do(func() {
+		a.slots = make(chan struct{}, a.MaxLocks)
+	})
+	select {
+	case a.slots <- struct{}{}:
+		var once sync.Once
+		return func() { once.Do(func() { <-a.slots }) }, true
+	default:
+		return nil, false
+	}
+}
+
+func (a *AdvisoryLocker) TryAcquire(ctx context.Context, name string, ttl time.Duration) (*Lock, error) {
+	key := namePrefix + name
+	free, ok := a.takeSlot()
+	if !ok {
+		return nil, fmt.Errorf("%w: %d advisory locks held already", ErrLocked, a.MaxLocks)
+	}
+	conn, err := a.DB.Conn(ctx)
+	if err != nil {
+		free()
+		return nil, err
+	}
+
+	if err = conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", advisoryKey(key)).Scan(&ok); err != nil || !ok {
+		_ = conn.Close()
+		free()
+		if err == nil {
+			err = ErrLocked
+		}
+		return nil, err
+	}
+
+	unlock := func(ctx context.Context) error {
+		_, err := conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", advisoryKey(key))
+		if err != nil {
+			// the session still holds the lock, it is discarded rather than
+			// going back to the pool so that the lock goes with it
+			_ = conn.Raw(func(interface{}) error { return driver.ErrBadConn })
+		}
+		if closeErr := conn.Close(); err == nil {
+			err = closeErr
+		}
+		free()
+		return err
+	}
+
+	holder := newHolder()
+	token, err := db.NextLeaseToken(ctx, key, holder, time.Now().Add(ttl))
+	if err != nil {
+		_ = unlock(context.Background())
+		return nil, err
+	}
+
+	renew := func(ctx context.Context) (bool, error) {
+		if conn.PingContext(ctx) != nil {
+			// the server freed the lock along with the connection
+			return false, nil
+		}
+		return db.RenewLease(ctx, key, holder, token, ttl)
+	}
+	release := func(ctx context.Context) error {
+		err := unlock(ctx)
+		if releaseErr := db.ReleaseLease(ctx, key, holder); err == nil {
+			err = releaseErr
+		}
+		return err
+	}
+	return newLock(name, holder, token, ttl, renew, release), nil
+}
+
+func (a *AdvisoryLocker) Acquire(ctx context.Context, name string, ttl time.Duration) (*Lock, error) {
+	return acquire(ctx, func() (*Lock, error) {
+		return a.TryAcquire(ctx, name, ttl)
+	})
+}
@@ -0,0 +1,200 @@
+package lock
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeAdvisory is a database/sql connector answering the advisory lock
+// functions of postgres: a lock belongs to the connection that took it and
+// is freed when the connection closes.
+type fakeAdvisory struct {
+	mux    sync.Mutex
+	owners map[int64]*fakeAdvisoryConn
+	// failUnlock makes pg_advisory_unlock fail as on a network error
+	failUnlock bool
+}
+
+type fakeAdvisoryConn struct {
+	d *fakeAdvisory
+}
+
+func (d *fakeAdvisory) Open(string) (driver.Conn, error) {
+	return &fakeAdvisoryConn{d: d}, nil
+}
+
+func (c *fakeAdvisoryConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("not supported")
+}
+
+func (c *fakeAdvisoryConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("not supported")
+}
+
+func (c *fakeAdvisoryConn) Close() error {
+	c.d.mux.Lock()
+	defer c.d.mux.Unlock()
+	for key, owner := range c.d.owners {
+		if owner == c {
+			delete(c.d.owners, key)
+		}
+	}
+	return nil
+}
+
+func (c *fakeAdvisoryConn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	key := args[0].Value.(int64)
+	c.d.mux.Lock()
+	defer c.d.mux.Unlock()
+	switch {
+	case strings.Contains(query, "pg_try_advisory_lock"):
+		owner, held := c.d.owners[key]
+		if !held {
+			c.d.owners[key] = c
+		}
+		return &boolRows{value: !held || owner == c}, nil
+	case strings.Contains(query, "pg_advisory_unlock"):
+		if c.d.failUnlock {
+			return nil, errors.New("connection reset")
+		}
+		owned := c.d.owners[key] == c
+		if owned {
+			delete(c.d.owners, key)
+		}
+		return &boolRows{value: owned}, nil
+	}
+	return nil, errors.New("unexpected query " + query)
+}
+
+func (c *fakeAdvisoryConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if _, err := c.QueryContext(ctx, query, args); err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(1), nil
+}
+
+type boolRows struct {
+	value bool
+	done  bool
+}
+
+func (r *boolRows) Columns() []string { return []string{"result"} }
+func (r *boolRows) Close() error      { return nil }
+
+func (r *boolRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	dest[0] = r.value
+	return nil
+}
+
+func (d *fakeAdvisory) Connect(context.Context) (driver.Conn, error) {
+	return d.Open("")
+}
+
+func (d *fakeAdvisory) Driver() driver.Driver {
+	return d
+}
+
+func openAdvisory(t *testing.T) (*sql.DB, *fakeAdvisory) {
+	openLocks(t)
+	fake := &fakeAdvisory{owners: make(map[int64]*fakeAdvisoryConn)}
+	sqlDB := sql.OpenDB(fake)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+	return sqlDB, fake
+}
+
+func TestAdvisoryLocker(t *testing.T) {
+	sqlDB, fake := openAdvisory(t)
+	ctx := context.Background()
+	locker := &AdvisoryLocker{DB: sqlDB, MaxLocks: 2}
+
+	a, err := locker.TryAcquire(ctx, "report", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Token != 1 {
+		t.Fatalf("expected the first token to be 1, got %d", a.Token)
+	}
+	if _, err = locker.TryAcquire(ctx, "report", time.Minute); !errors.Is(err, ErrLocked) {
+		t.Fatalf("expected ErrLocked, got %v", err)
+	}
+
+	// every held lock keeps a connection, up to MaxLocks of them
+	other, err := locker.TryAcquire(ctx, "export", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = locker.TryAcquire(ctx, "import", time.Minute); !errors.Is(err, ErrLocked) {
+		t.Fatalf("expected the locks above MaxLocks to be refused, got %v", err)
+	}
+	if err = other.Release(ctx); err != nil {
+		t.Fatal(err)
+	}
+	third, err := locker.TryAcquire(ctx, "import", time.Minute)
+	if err != nil {
+		t.Fatalf("expected the released connection to be reused, got %v", err)
+	}
+	_ = third.Release(ctx)
+
+	if err = a.Release(ctx); err != nil {
+		t.Fatal(err)
+	}
+	b, err := locker.TryAcquire(ctx, "report", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Token != 2 {
+		t.Fatalf("expected the token to grow, got %d", b.Token)
+	}
+	if err = a.Check(ctx); !errors.Is(err, ErrNotHeld) {
+		t.Fatalf("expected the stale holder to be fenced off, got %v", err)
+	}
+	_ = b.Release(ctx)
+
+	fake.mux.Lock()
+	defer fake.mux.Unlock()
+	if len(fake.owners) != 0 {
+		t.Fatalf("expected every advisory lock to be freed, got %v", fake.owners)
+	}
+}
+
+func TestAdvisoryLockerFailedUnlock(t *testing.T) {
+	sqlDB, fake := openAdvisory(t)
+	ctx := context.Background()
+	locker := &AdvisoryLocker{DB: sqlDB, MaxLocks: 2}
+
+	l, err := locker.TryAcquire(ctx, "report", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake.mux.Lock()
+	fake.failUnlock = true
+	fake.mux.Unlock()
+	if err = l.Release(ctx); err == nil {
+		t.Fatal("expected the failed unlock to be reported")
+	}
+
+	// the session holding the lock is closed instead of going back to the pool
+	fake.mux.Lock()
+	held := len(fake.owners)
+	fake.failUnlock = false
+	fake.mux.Unlock()
+	if held != 0 {
+		t.Fatalf("expected the lock to go with its connection, %d still held", held)
+	}
+	if other, err := locker.TryAcquire(ctx, "report", time.Minute); err != nil {
+		t.Fatalf("expected the lock to be free, got %v", err)
+	} else {
+		_ = other.Release(ctx)
+	}
+}
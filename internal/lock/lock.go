@@ -0,0 +1,322 @@
+// Package lock excludes work across the replicas with locks kept in the
+// database, e.g. a batch endpoint that must not run twice at once.
+//
+// A Lock is held for a TTL and renewed by a heartbeat while it is held, so
+// the lock of a dead replica frees itself. Every acquisition gets a fencing
+// token greater than the previous ones of the same name: a holder that was
+// paused past its TTL can be told apart from the current one by passing the
+// token along with its writes, see Lock.Check.
+package lock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go-server-template/internal/conf"
+	"go-server-template/internal/db"
+	pkgctx "go-server-template/pkg/context"
+	"go-server-template/pkg/logger"
+	"go-server-template/pkg/ulid"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	ErrLocked  = errors.New("lock is held by another holder")
+	ErrNotHeld = errors.New("lock is no longer held")
+)
+
+// DefaultTTL is used when a lock is acquired without a TTL and none is
+// configured.
+const DefaultTTL = 30 * time.Second
+
+// namePrefix keeps the locks apart from the other leases, e.g. the one of
+// the scheduler.
+const namePrefix = "lock:"
+
+// Locker acquires named locks.
+type Locker interface {
+	// TryAcquire acquires the lock name for ttl, or returns ErrLocked at
+	// once when it is held.
+	TryAcquire(ctx context.Context, name string, ttl time.Duration) (*Lock, error)
+	// Acquire waits for the lock name until ctx is done, the error then
+	// wraps both ErrLocked and the error of ctx.
+	Acquire(ctx context.Context, name string, ttl time.Duration) (*Lock, error)
+}
+
+// Lock is a held lock. It is renewed every third of its TTL until Release.
+type Lock struct {
+	Name  string
+	Token uint64
+
+	holder  string
+	ttl     time.Duration
+	renew   func(ctx context.Context) (bool, error)
+	release func(ctx context.Context) error
+
+	lost     chan struct{}
+	lostOnce sync.Once
+	stop     chan struct{}
+	stopped  chan struct{}
+	released sync.Once
+}
+
+func newLock(name, holder string, token uint64, ttl time.Duration,
+	renew func(ctx context.Context) (bool, error), release func(ctx context.Context) error) *Lock {
+	l := &Lock{
+		Name:    name,
+		Token:   token,
+		holder:  holder,
+		ttl:     ttl,
+		renew:   renew,
+		release: release,
+		lost:    make(chan struct{}),
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	go l.heartbeat()
+	return l
+}
+
+// heartbeat renews the lock until it is released. A failed renewal is
+// retried until the TTL of the last successful one ran out.
+func (l *Lock) heartbeat() {
+	defer close(l.stopped)
+
+	ticker := time.NewTicker(l.ttl / 3)
+	defer ticker.Stop()
+
+	until := time.Now().Add(l.ttl)
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), l.ttl/3)
+		start := time.Now()
+		ok, err := l.renew(ctx)
+		cancel()
+		switch {
+		case err == nil && ok:
+			until = start.Add(l.ttl)
+			continue
+		case err == nil:
+			logger.GetLogger().Warnf("Lost lock %s, it was freed or taken over", l.Name)
+		case time.Now().Before(until):
+			logger.GetLogger().Warnf("Failed to renew lock %s: %s", l.Name, err.Error())
+			continue
+		default:
+			logger.GetLogger().Errorf("Lost lock %s after failing to renew it: %s", l.Name, err.Error())
+		}
+		l.markLost()
+		return
+	}
+}
+
+func (l *Lock) markLost() {
+	l.lostOnce.Do(func() { close(l.lost) })
+}
+
+// Lost is closed when the lock could not be renewed and may be held by
+// another holder. Work done under the lock should stop then.
+func (l *Lock) Lost() <-chan struct{} {
+	return l.lost
+}
+
+// Check returns ErrNotHeld when the lock was lost or another holder got a
+// newer token since.
+func (l *Lock) Check(ctx context.Context) error {
+	select {
+	case <-l.lost:
+		return ErrNotHeld
+	default:
+	}
+	lease, err := db.GetLease(db.UsePrimary(ctx), namePrefix+l.Name)
+	if err != nil {
+		return err
+	}
+	if lease.Token != l.Token || lease.Holder != l.holder {
+		return ErrNotHeld
+	}
+	return nil
+}
+
+// Release stops the heartbeat and frees the lock. It may be called more
+// than once, the later calls do nothing.
+func (l *Lock) Release(ctx context.Context) error {
+	var err error
+	l.released.Do(func() {
+		close(l.stop)
+		<-l.stopped
+		err = l.release(ctx)
+		l.markLost()
+	})
+	return err
+}
+
+// acquire retries try with a growing delay until it stops returning
+// ErrLocked or ctx is done.
+func acquire(ctx context.Context, try func() (*Lock, error)) (*Lock, error) {
+	delay := 20 * time.Millisecond
+	for {
+		l, err := try()
+		if !errors.Is(err, ErrLocked) {
+			return l, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("%w: %w", ErrLocked, ctx.Err())
+		case <-time.After(delay):
+		}
+		if delay *= 2; delay > time.Second {
+			delay = time.Second
+		}
+	}
+}
+
+var hostname, _ = os.Hostname()
+
+// newHolder identifies an acquisition.
+func newHolder() string {
+	return fmt.Sprintf("%s-%d-%s", hostname, os.Getpid(), ulid.New())
+}
+
+var (
+	defaultMux    sync.RWMutex
+	defaultLocker Locker
+	defaultTTL    = DefaultTTL
+)
+
+// Init sets the locker returned by Default as configured by lock. The
+// database must be open.
+func Init(lock conf.Lock) error {
+	if lock.TTL > 0 {
+		defaultTTL = time.Duration(lock.TTL) * time.Second
+	}
+
+	backend := lock.Backend
+	if backend == "" {
+		backend = "table"
+		if db.GetDB().Dialector.Name() == "postgres" {
+			backend = "advisory"
+		}
+	}
+
+	var locker Locker
+	switch backend {
+	case "table":
+		locker = &TableLocker{}
+	case "advisory":
+		sqlDB, err := db.GetDB().DB()
+		if err != nil {
+			return err
+		}
+		locker = &AdvisoryLocker{DB: sqlDB, MaxLocks: lock.MaxAdvisoryLocks}
+	default:
+		return fmt.Errorf("unknown lock backend %q", lock.Backend)
+	}
+
+	defaultMux.Lock()
+	defer defaultMux.Unlock()
+	defaultLocker = locker
+	return nil
+}
+
+// Default returns the locker set by Init, a TableLocker before.
+func Default() Locker {
+	defaultMux.RLock()
+	defer defaultMux.RUnlock()
+	if defaultLocker == nil {
+		return &TableLocker{}
+	}
+	return defaultLocker
+}
+
+func ttlOrDefault(ttl time.Duration) time.Duration {
+	if ttl <= 0 {
+		return defaultTTL
+	}
+	return ttl
+}
+
+// TryAcquire acquires the lock name with the default locker, ttl <= 0
+// means the configured TTL.
+func TryAcquire(ctx context.Context, name string, ttl time.Duration) (*Lock, error) {
+	return Default().TryAcquire(ctx, name, ttlOrDefault(ttl))
+}
+
+// Acquire waits for the lock name with the default locker until ctx is
+// done, ttl <= 0 means the configured TTL.
+func Acquire(ctx context.Context, name string, ttl time.Duration) (*Lock, error) {
+	return Default().Acquire(ctx, name, ttlOrDefault(ttl))
+}
+
+// Do runs fn under the lock name, waiting for it until ctx is done. The
+// context given to fn is canceled when the lock is lost.
+func Do(ctx context.Context, name string, ttl time.Duration, fn func(ctx context.Context) error) error {
+	l, err := Acquire(ctx, name, ttl)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := l.Release(db.WithoutTx(context.Background())); err != nil {
+			logger.GetLogger().Errorf("Failed to release lock %s: %s", name, err.Error())
+		}
+	}()
+
+	runCtx, cancel := context.WithCancel(NewContext(ctx, l))
+	defer cancel()
+	go func() {
+		select {
+		case <-l.Lost():
+			cancel()
+		case <-runCtx.Done():
+		}
+	}()
+
+	if err = fn(runCtx); err != nil {
+		return err
+	}
+	select {
+	case <-l.Lost():
+		return ErrNotHeld
+	default:
+		return nil
+	}
+}
+
+type lockKey struct{}
+
+// ginKey is where the route middleware keeps the lock of the request.
+const ginKey = "_lock_"
+
+// NewContext returns a context carrying l.
+func NewContext(ctx context.Context, l *Lock) context.Context {
+	return context.WithValue(ctx, lockKey{}, l)
+}
+
+// SetContext makes l the lock of the request c, see FromContext.
+func SetContext(c *gin.Context, l *Lock) {
+	c.Set(ginKey, l)
+}
+
+// FromContext returns the lock carried by ctx, either by NewContext or by
+// the route middleware.
+func FromContext(ctx context.Context) (*Lock, bool) {
+	if l, ok := ctx.Value(lockKey{}).(*Lock); ok {
+		return l, true
+	}
+	if c, ok := pkgctx.GinContext(ctx); ok {
+		if v, ok := c.Get(ginKey); ok {
+			l, ok := v.(*Lock)
+			return l, ok
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,162 @@
+package lock
+
+import (
+	"context"
+	"errors"
+	"go-server-template/internal/db"
+	"go-server-template/internal/db/dbtest"
+	"go-server-template/internal/model"
+	"go-server-template/pkg/logger"
+	"testing"
+	"time"
+)
+
+func openLocks(t *testing.T) {
+	logger.Init("zap")
+	dbtest.Open(t, new(model.Lease))
+}
+
+func TestTableLocker(t *testing.T) {
+	openLocks(t)
+	ctx := context.Background()
+	locker := &TableLocker{}
+
+	a, err := locker.TryAcquire(ctx, "report", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Token != 1 {
+		t.Fatalf("expected the first token to be 1, got %d", a.Token)
+	}
+	if _, err = locker.TryAcquire(ctx, "report", time.Minute); !errors.Is(err, ErrLocked) {
+		t.Fatalf("expected ErrLocked, got %v", err)
+	}
+	other, err := locker.TryAcquire(ctx, "export", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = other.Release(ctx)
+
+	if err = a.Release(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err = a.Release(ctx); err != nil {
+		t.Fatalf("a second release must do nothing, got %v", err)
+	}
+	select {
+	case <-a.Lost():
+	default:
+		t.Fatal("a released lock must be lost")
+	}
+
+	b, err := locker.TryAcquire(ctx, "report", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Release(ctx)
+	if b.Token != 2 {
+		t.Fatalf("expected the token to grow, got %d", b.Token)
+	}
+	if err = b.Check(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err = a.Check(ctx); !errors.Is(err, ErrNotHeld) {
+		t.Fatalf("expected the stale holder to be fenced off, got %v", err)
+	}
+}
+
+func TestLockExpires(t *testing.T) {
+	openLocks(t)
+	ctx := context.Background()
+	locker := &TableLocker{}
+
+	a, err := locker.TryAcquire(ctx, "report", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the holder died without releasing, its lease ran out
+	close(a.stop)
+	<-a.stopped
+	if err = db.GetDB().Model(&model.Lease{}).Where("name = ?", "lock:report").
+		Update("expires_at", time.Now().Add(-time.Second)).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := locker.TryAcquire(ctx, "report", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Release(ctx)
+	if b.Token != 2 {
+		t.Fatalf("expected the takeover to get a new token, got %d", b.Token)
+	}
+	if ok, _ := a.renew(ctx); ok {
+		t.Fatal("the previous holder must not renew the lock")
+	}
+}
+
+func TestAcquireTimeout(t *testing.T) {
+	openLocks(t)
+	locker := &TableLocker{}
+
+	a, err := locker.TryAcquire(context.Background(), "report", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err = locker.Acquire(ctx, "report", time.Minute); !errors.Is(err, ErrLocked) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected ErrLocked after the timeout, got %v", err)
+	}
+
+	// the waiter gets the lock once it is released
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		_ = a.Release(context.Background())
+	}()
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	b, err := locker.Acquire(ctx, "report", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = b.Release(ctx)
+}
+
+func TestHeartbeat(t *testing.T) {
+	openLocks(t)
+	ctx := context.Background()
+	ttl := 150 * time.Millisecond
+
+	err := Do(ctx, "report", ttl, func(ctx context.Context) error {
+		if l, ok := FromContext(ctx); !ok || l.Name != "report" {
+			t.Error("expected the lock in the context")
+		}
+		// outlives the ttl thanks to the renewals
+		time.Sleep(3 * ttl)
+		if _, err := TryAcquire(ctx, "report", ttl); !errors.Is(err, ErrLocked) {
+			t.Errorf("expected the renewed lock to be held, got %v", err)
+		}
+		return ctx.Err()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a renewal failing past the ttl loses the lock
+	l, err := TryAcquire(ctx, "report", ttl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Release(ctx)
+	if err = db.GetDB().Model(&model.Lease{}).Where("name = ?", "lock:report").
+		Update("token", l.Token+1).Error; err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-l.Lost():
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the lock to be lost")
+	}
+}
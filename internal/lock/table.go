@@ -0,0 +1,39 @@
+package lock
+
+import (
+	"context"
+	"go-server-template/internal/db"
+	"time"
+)
+
+// TableLocker keeps the locks in the leases table, it works on every
+// database. The token grows each time the lease changes hands.
+type TableLocker struct{}
+
+var _ Locker = (*TableLocker)(nil)
+
+func (t *TableLocker) TryAcquire(ctx context.Context, name string, ttl time.Duration) (*Lock, error) {
+	key := namePrefix + name
+	holder := newHolder()
+	token, ok, err := db.AcquireLease(ctx, key, holder, ttl)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrLocked
+	}
+
+	renew := func(ctx context.Context) (bool, error) {
+		return db.RenewLease(ctx, key, holder, token, ttl)
+	}
+	release := func(ctx context.Context) error {
+		return db.ReleaseLease(ctx, key, holder)
+	}
+	return newLock(name, holder, token, ttl, renew, release), nil
+}
+
+func (t *TableLocker) Acquire(ctx context.Context, name string, ttl time.Duration) (*Lock, error) {
+	return acquire(ctx, func() (*Lock, error) {
+		return t.TryAcquire(ctx, name, ttl)
+	})
+}
@@ -39,6 +39,8 @@ func Auth() gin.HandlerFunc {
 		}
 
 		context.SetUserID(c, ctx.UserID)
+		context.SetRoles(c, ctx.Roles)
+		context.SetTenant(c, ctx.Tenant)
 
 		c.Next()
 	}
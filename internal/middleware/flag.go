@@ -0,0 +1,23 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"go-server-template/internal/flags"
+	"go-server-template/internal/server/errcode"
+	"go-server-template/internal/server/response"
+)
+
+// Flag only lets through the requests whose subject has the feature flag
+// key enabled, the others get ErrFeatureDisabled as if the route did not
+// exist. It goes after Auth for the flags targeting users.
+func Flag(key string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !flags.Enabled(c, key) {
+			response.Error(c, errcode.ErrFeatureDisabled)
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
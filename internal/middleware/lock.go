@@ -0,0 +1,74 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"go-server-template/internal/db"
+	"go-server-template/internal/lock"
+	"go-server-template/internal/server/errcode"
+	"go-server-template/internal/server/response"
+	"go-server-template/pkg/logger"
+	"go-server-template/pkg/ulid"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Lock runs the route under the lock name so it never runs twice at once
+// across the replicas. The ":param" parts of name are replaced by the path
+// parameters, e.g. "report.:id" locks each report on its own.
+//
+// The parameters named in publicIDs hold public ids, they are parsed and
+// replaced by their canonical form so that every spelling of an id takes the
+// same lock, and a malformed one fails with ErrParams.
+//
+// The request waits up to wait for the lock, then fails with ErrLocked. The
+// handler finds the lock with lock.FromContext.
+func Lock(name string, wait time.Duration, publicIDs ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		params := append(gin.Params(nil), c.Params...)
+		for i, p := range params {
+			for _, publicID := range publicIDs {
+				if p.Key != publicID {
+					continue
+				}
+				id, err := ulid.Parse(p.Value)
+				if err != nil {
+					response.Error(c, errcode.ErrParams.WithDetail("invalid %s: %q", p.Key, p.Value))
+					c.Abort()
+					return
+				}
+				params[i].Value = id
+			}
+		}
+
+		// the longest first, so that :id does not replace the start of :idx
+		sort.SliceStable(params, func(i, j int) bool { return len(params[i].Key) > len(params[j].Key) })
+		key := name
+		for _, p := range params {
+			key = strings.ReplaceAll(key, ":"+p.Key, p.Value)
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), wait)
+		l, err := lock.Acquire(ctx, key, 0)
+		cancel()
+		if err != nil {
+			if errors.Is(err, lock.ErrLocked) {
+				response.Error(c, errcode.ErrLocked)
+			} else {
+				response.Error(c, errcode.ErrInternal.WithError(err))
+			}
+			c.Abort()
+			return
+		}
+		defer func() {
+			if err := l.Release(db.WithoutTx(context.Background())); err != nil {
+				logger.GetLogger().Errorf("Failed to release lock %s: %s", key, err.Error())
+			}
+		}()
+
+		lock.SetContext(c, l)
+		c.Next()
+	}
+}
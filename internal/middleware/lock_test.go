@@ -0,0 +1,96 @@
+package middleware
+
+import (
+	"go-server-template/internal/db"
+	"go-server-template/internal/db/dbtest"
+	"go-server-template/internal/lock"
+	"go-server-template/internal/model"
+	"go-server-template/pkg/logger"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestLock(t *testing.T) {
+	logger.Init("zap")
+	gin.SetMode(gin.TestMode)
+	dbtest.Open(t, new(model.Lease))
+
+	entered, release := make(chan struct{}), make(chan struct{})
+	r := gin.New()
+	r.GET("/report/:id/:idx", Lock("report.:id.:idx", 50*time.Millisecond), func(c *gin.Context) {
+		l, ok := lock.FromContext(c)
+		if !ok {
+			c.Status(http.StatusInternalServerError)
+			return
+		}
+		if c.Query("wait") != "" {
+			entered <- struct{}{}
+			<-release
+		}
+		c.String(http.StatusOK, l.Name)
+	})
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+
+	if w := get("/report/1/12"); w.Code != http.StatusOK || w.Body.String() != "report.1.12" {
+		t.Fatalf("expected each parameter replaced by its own value, got %d %s", w.Code, w.Body)
+	}
+
+	held := make(chan *httptest.ResponseRecorder)
+	go func() {
+		held <- get("/report/2/3?wait=1")
+	}()
+	<-entered
+	if w := get("/report/2/3"); w.Code != http.StatusConflict {
+		t.Fatalf("expected the held lock to be refused, got %d %s", w.Code, w.Body)
+	}
+	if w := get("/report/2/4"); w.Code != http.StatusOK {
+		t.Fatalf("expected another lock to be free, got %d %s", w.Code, w.Body)
+	}
+	close(release)
+	if w := <-held; w.Code != http.StatusOK {
+		t.Fatalf("unexpected %d %s", w.Code, w.Body)
+	}
+
+	if w := get("/report/2/3"); w.Code != http.StatusOK {
+		t.Fatalf("expected the lock to be released with the request, got %d %s", w.Code, w.Body)
+	}
+}
+
+func TestLockPublicID(t *testing.T) {
+	logger.Init("zap")
+	gin.SetMode(gin.TestMode)
+	dbtest.Open(t, new(model.Lease))
+
+	r := gin.New()
+	r.GET("/user/:id", Lock("user.:id", 50*time.Millisecond, "id"), func(c *gin.Context) {
+		l, _ := lock.FromContext(c)
+		c.String(http.StatusOK, l.Name)
+	})
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+
+	for _, id := range []string{"01arz3ndektsv4rrffq69g5fav", "01ARZ3NDEKTSV4RRFFQ69G5FAV"} {
+		if w := get("/user/" + id); w.Code != http.StatusOK || w.Body.String() != "user.01ARZ3NDEKTSV4RRFFQ69G5FAV" {
+			t.Fatalf("%s: expected the canonical id in the lock, got %d %s", id, w.Code, w.Body)
+		}
+	}
+	if w := get("/user/42"); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected a malformed id to be refused, got %d %s", w.Code, w.Body)
+	}
+
+	var leases int64
+	if err := db.GetDB().Model(new(model.Lease)).Where("name LIKE ?", "%42%").Count(&leases).Error; err != nil || leases != 0 {
+		t.Fatalf("expected no lease for a malformed id, got %d (%v)", leases, err)
+	}
+}
@@ -0,0 +1,24 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"go-server-template/internal/server/errcode"
+	"go-server-template/internal/server/response"
+	"go-server-template/pkg/context"
+)
+
+// Role only lets through the requests whose token has one of roles, the
+// others get ErrForbidden. It goes after Auth.
+func Role(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		for _, role := range roles {
+			if context.HasRole(c, role) {
+				c.Next()
+				return
+			}
+		}
+
+		response.Error(c, errcode.ErrForbidden)
+		c.Abort()
+	}
+}
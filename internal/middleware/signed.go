@@ -0,0 +1,24 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"go-server-template/internal/conf"
+	"go-server-template/internal/server/errcode"
+	"go-server-template/internal/server/response"
+	"go-server-template/pkg/app"
+	"time"
+)
+
+// SignedURL only lets through requests carrying a valid signature from app.SignURL.
+func SignedURL() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		err := app.VerifyURL(c.Request.URL.Path, c.Request.URL.Query(), conf.Conf.Storage.SignSecret, time.Now())
+		if err != nil {
+			response.Error(c, errcode.ErrInvalidSignature.WithError(err))
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
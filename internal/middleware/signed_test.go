@@ -0,0 +1,49 @@
+package middleware
+
+import (
+	"go-server-template/internal/conf"
+	"go-server-template/pkg/app"
+	"go-server-template/pkg/logger"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestSignedURL(t *testing.T) {
+	logger.Init("zap")
+	gin.SetMode(gin.TestMode)
+	old := conf.Conf
+	conf.Conf = conf.InitDefaultConfig()
+	conf.Conf.Storage.SignSecret = "secret"
+	t.Cleanup(func() { conf.Conf = old })
+
+	r := gin.New()
+	r.GET("/files/:id/download", SignedURL(), func(c *gin.Context) {
+		c.String(http.StatusOK, c.Param("id"))
+	})
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+
+	path := "/files/a/download"
+	valid := app.SignURL(path, time.Now().Add(time.Minute), "secret").Encode()
+	if w := get(path + "?" + valid); w.Code != http.StatusOK || w.Body.String() != "a" {
+		t.Fatalf("expected the signed request to pass, got %d %s", w.Code, w.Body)
+	}
+
+	for name, p := range map[string]string{
+		"unsigned":     path,
+		"other path":   "/files/b/download?" + valid,
+		"other secret": path + "?" + app.SignURL(path, time.Now().Add(time.Minute), "other").Encode(),
+		"expired":      path + "?" + app.SignURL(path, time.Now().Add(-time.Minute), "secret").Encode(),
+	} {
+		if w := get(p); w.Code != http.StatusForbidden {
+			t.Fatalf("%s: expected 403, got %d %s", name, w.Code, w.Body)
+		}
+	}
+}
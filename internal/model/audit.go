@@ -0,0 +1,93 @@
+package model
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	AuditActionCreate = "create"
+	AuditActionUpdate = "update"
+	AuditActionDelete = "delete"
+	// AuditActionErase is the entry recording a data erasure, see AuditErasure.
+	AuditActionErase = "erase"
+)
+
+// Auditable marks a model whose writes are recorded in the audit log.
+type Auditable interface {
+	Audited() bool
+}
+
+// AuditLog is one entry of the hash-chained audit trail. Hash covers the
+// entry metadata, the Digest of its content and PrevHash, so editing or
+// removing any row breaks the chain.
+//
+// The content (Before, After and Diff) may be pseudonymized by a data
+// erasure, Erased is then set and the content is no longer checked against
+// Digest. The erasure appends an AuditActionErase entry to the chain instead,
+// whose hash covers the pseudonym and the new digest of every entry it erased,
+// so setting Erased or editing erased content without it breaks the chain.
+//
+// The internal ids are not serialized, Actor and Record hold the public ids
+// of the actor and of the row instead. They are filled when the entries are
+// listed, Record is the primary key itself for a table without public ids.
+type AuditLog struct {
+	ID         uint      `json:"-" gorm:"primaryKey"`
+	ActorID    uint64    `json:"-" gorm:"index"`
+	Actor      string    `json:"actor_id" gorm:"-" example:"01ARYZ6S41TSV4RRFFQ69G5FAV"`
+	RequestID  string    `json:"request_id" gorm:"size:64" example:"76d27e8c-a80e-48c8-ad20-e5562e0f67e4"`
+	Action     string    `json:"action" gorm:"size:16;index" example:"update"`
+	Table      string    `json:"table" gorm:"column:table_name;size:64;index" example:"users"`
+	PrimaryKey string    `json:"-" gorm:"size:64;index"`
+	Record     string    `json:"record_id" gorm:"-" example:"01ARYZ6S41TSV4RRFFQ69G5FAV"`
+	Before     string    `json:"before" gorm:"type:text"`
+	After      string    `json:"after" gorm:"type:text"`
+	Diff       string    `json:"diff" gorm:"type:text"`
+	Digest     string    `json:"digest" gorm:"size:64"`
+	Erased     bool      `json:"erased"`
+	PrevHash   string    `json:"prev_hash" gorm:"size:64"`
+	Hash       string    `json:"hash" gorm:"size:64;uniqueIndex"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// AuditHead is the single row locked by the writers of the audit log, in the
+// transaction of their entry, before they link it to the last one. Seq
+// counts the entries.
+type AuditHead struct {
+	ID  uint `gorm:"primaryKey"`
+	Seq uint64
+}
+
+// AuditErasure is the content, in After, of an AuditActionErase entry.
+type AuditErasure struct {
+	Pseudonym string `json:"pseudonym"`
+	// Entries maps the ID of each erased entry to its ContentDigest after
+	// the erasure.
+	Entries map[uint]string `json:"entries"`
+}
+
+// ContentDigest returns the digest of the entry content.
+func (a *AuditLog) ContentDigest() string {
+	sum := sha256.Sum256([]byte(strings.Join([]string{a.Before, a.After, a.Diff}, "\x1f")))
+	return hex.EncodeToString(sum[:])
+}
+
+// ComputeHash returns the chain hash of the entry.
+func (a *AuditLog) ComputeHash() string {
+	fields := []string{
+		a.PrevHash,
+		strconv.FormatUint(a.ActorID, 10),
+		a.RequestID,
+		a.Action,
+		a.Table,
+		a.PrimaryKey,
+		a.Digest,
+		strconv.FormatInt(a.CreatedAt.UnixMilli(), 10),
+	}
+
+	sum := sha256.Sum256([]byte(strings.Join(fields, "\x1f")))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,31 @@
+package model
+
+import (
+	"go-server-template/pkg/ulid"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Base is embedded by models that need timestamps, soft delete and actor
+// stamping. CreatedBy and UpdatedBy are filled by bootstrap.ActorPlugin.
+//
+// ID stays the internal primary key used for joins, only PublicID (a ULID)
+// is exposed to clients. CreatedBy and UpdatedBy hold internal user ids too,
+// so they are not serialized either.
+type Base struct {
+	ID        uint           `json:"-" gorm:"primaryKey"`
+	PublicID  string         `json:"id" gorm:"size:26;uniqueIndex" example:"01ARYZ6S41TSV4RRFFQ69G5FAV"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `json:"-" gorm:"index" swaggerignore:"true"`
+	CreatedBy uint64         `json:"-"`
+	UpdatedBy uint64         `json:"-"`
+}
+
+func (b *Base) BeforeCreate(tx *gorm.DB) error {
+	if b.PublicID == "" {
+		b.PublicID = ulid.New()
+	}
+	return nil
+}
@@ -0,0 +1,17 @@
+package model
+
+const (
+	FileKindAttachment = "attachment"
+	FileKindAvatar     = "avatar"
+)
+
+// File is the metadata of an uploaded blob, the content lives in storage under Key.
+type File struct {
+	Base
+	OwnerID     uint   `json:"-" gorm:"index"`
+	Kind        string `json:"kind" gorm:"size:16" example:"avatar"`
+	Key         string `json:"-" gorm:"size:255;uniqueIndex"`
+	Name        string `json:"name" gorm:"size:255" example:"me.png"`
+	ContentType string `json:"content_type" gorm:"size:128" example:"image/png"`
+	Size        int64  `json:"size" example:"1024"`
+}
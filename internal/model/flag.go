@@ -0,0 +1,17 @@
+package model
+
+import "time"
+
+// FeatureFlag is a feature flag stored in the database, see internal/flags.
+// Definition is the JSON of a conf.Flag, the key is stored in the name
+// column, key being reserved by mysql.
+type FeatureFlag struct {
+	Key        string    `json:"key" gorm:"column:name;primaryKey;size:128" example:"new_profile"`
+	Definition string    `json:"definition" gorm:"type:text"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+	CreatedBy  uint64    `json:"-"`
+	UpdatedBy  uint64    `json:"-"`
+}
+
+func (f *FeatureFlag) Audited() bool { return true }
@@ -0,0 +1,36 @@
+package model
+
+import "time"
+
+const (
+	JobPending   = "pending"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobDead      = "dead"
+	JobCanceled  = "canceled"
+)
+
+// Job is a unit of background work run by a job.Worker with the handler
+// registered under Name.
+//
+// A pending job is due at RunAt. A running job is hidden from the other
+// workers until LockedUntil, after which it is considered abandoned and
+// claimed again. UniqueKey is only kept while the job is pending or running,
+// so at most one such job exists per key.
+type Job struct {
+	ID          uint       `json:"-" gorm:"primaryKey"`
+	JobID       string     `json:"id" gorm:"size:26;uniqueIndex" example:"01ARYZ6S41TSV4RRFFQ69G5FAV"`
+	Name        string     `json:"name" gorm:"size:64;index" example:"file.cleanup"`
+	Payload     string     `json:"payload" gorm:"type:text" example:"{}"`
+	UniqueKey   *string    `json:"unique_key" gorm:"size:191;uniqueIndex"`
+	Status      string     `json:"status" gorm:"size:16;index:idx_jobs_due,priority:1" example:"pending"`
+	Attempts    int        `json:"attempts" example:"0"`
+	MaxAttempts int        `json:"max_attempts" example:"0"` // 0 uses the worker's default
+	RunAt       time.Time  `json:"run_at" gorm:"index:idx_jobs_due,priority:2"`
+	LockedBy    string     `json:"locked_by" gorm:"size:128"`
+	LockedUntil *time.Time `json:"locked_until"`
+	LastError   string     `json:"last_error" gorm:"type:text"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	FinishedAt  *time.Time `json:"finished_at"`
+}
@@ -0,0 +1,33 @@
+package model
+
+import "time"
+
+const (
+	OutboxPending   = "pending"
+	OutboxDelivered = "delivered"
+	OutboxDead      = "dead"
+)
+
+// OutboxEvent is a domain event written in the transaction of the change it
+// describes, and dispatched to the subscribers by event.Relay once committed.
+//
+// A pending event is due at NextAttemptAt, the relay pushes it forward while
+// it dispatches the event and after a failure. An event still failing after
+// the configured attempts is dead until it is replayed.
+type OutboxEvent struct {
+	ID            uint       `json:"-" gorm:"primaryKey"`
+	EventID       string     `json:"id" gorm:"size:26;uniqueIndex" example:"01ARYZ6S41TSV4RRFFQ69G5FAV"`
+	Name          string     `json:"name" gorm:"size:64;index" example:"user.created"`
+	Payload       string     `json:"payload" gorm:"type:text" example:"{\"user_id\":\"01ARYZ6S41TSV4RRFFQ69G5FAV\"}"`
+	TraceID       string     `json:"trace_id" gorm:"size:64" example:"76d27e8c-a80e-48c8-ad20-e5562e0f67e4"`
+	Status        string     `json:"status" gorm:"size:16;index:idx_outbox_due,priority:1" example:"pending"`
+	Attempts      int        `json:"attempts" example:"0"`
+	LastError     string     `json:"last_error" gorm:"type:text"`
+	NextAttemptAt time.Time  `json:"next_attempt_at" gorm:"index:idx_outbox_due,priority:2"`
+	CreatedAt     time.Time  `json:"created_at"`
+	DeliveredAt   *time.Time `json:"delivered_at"`
+}
+
+func (OutboxEvent) TableName() string {
+	return "outbox"
+}
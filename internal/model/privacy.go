@@ -0,0 +1,37 @@
+package model
+
+import (
+	"reflect"
+)
+
+// PIIValues returns the non-empty string values of the fields tagged with
+// `privacy:"pii"`, embedded structs included.
+func PIIValues(v interface{}) []string {
+	var values []string
+
+	var walk func(rv reflect.Value)
+	walk = func(rv reflect.Value) {
+		rv = reflect.Indirect(rv)
+		if rv.Kind() != reflect.Struct {
+			return
+		}
+
+		rt := rv.Type()
+		for i := 0; i < rt.NumField(); i++ {
+			field := rt.Field(i)
+			if field.Anonymous {
+				walk(rv.Field(i))
+				continue
+			}
+			if field.Tag.Get("privacy") != "pii" || field.Type.Kind() != reflect.String {
+				continue
+			}
+			if s := rv.Field(i).String(); s != "" {
+				values = append(values, s)
+			}
+		}
+	}
+	walk(reflect.ValueOf(v))
+
+	return values
+}
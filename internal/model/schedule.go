@@ -0,0 +1,37 @@
+package model
+
+import "time"
+
+const (
+	TaskSucceeded = "succeeded"
+	TaskFailed    = "failed"
+)
+
+// Lease is held by one holder until ExpiresAt, e.g. the scheduler leader or
+// a lock. The holder renews it before it expires, another holder may take
+// it over afterwards. Token is the fencing token, it grows each time the
+// lease changes hands.
+type Lease struct {
+	Name      string    `json:"name" gorm:"primaryKey;size:64"`
+	Holder    string    `json:"holder" gorm:"size:128"`
+	Token     uint64    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// ScheduledTask is the state of a task of the scheduler, shared by the
+// replicas so a tick runs once whichever replica leads.
+//
+// Runs counts the claimed ticks, a tick is claimed by a conditional update
+// on it. RunningSince is set while a run is in progress.
+type ScheduledTask struct {
+	Name         string     `json:"name" gorm:"primaryKey;size:64" example:"outbox.cleanup"`
+	Spec         string     `json:"spec" gorm:"size:128" example:"@daily"`
+	Runs         int64      `json:"runs" example:"1"`
+	NextRunAt    time.Time  `json:"next_run_at"`
+	RunningSince *time.Time `json:"running_since"`
+	LastRunAt    *time.Time `json:"last_run_at"`
+	LastStatus   string     `json:"last_status" gorm:"size:16" example:"succeeded"`
+	LastError    string     `json:"last_error" gorm:"type:text"`
+	LastDuration int64      `json:"last_duration_ms" example:"12"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
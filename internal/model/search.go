@@ -0,0 +1,9 @@
+package model
+
+// Searchable marks a model whose text columns are indexed for full-text
+// search, see internal/search.
+type Searchable interface {
+	// SearchColumns returns the indexed columns, in the order of their
+	// weight.
+	SearchColumns() []string
+}
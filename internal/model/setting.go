@@ -0,0 +1,31 @@
+package model
+
+import "time"
+
+// Setting is the stored value of a runtime setting, see internal/setting.
+// A setting without a row has its default value. The key is stored in the
+// name column, key being reserved by mysql.
+type Setting struct {
+	Key   string `json:"key" gorm:"column:name;primaryKey;size:128" example:"site.banner"`
+	Value string `json:"value" gorm:"type:text" example:"\"maintenance tonight\""` // JSON
+	Versioned
+	UpdatedBy uint64    `json:"-"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// SettingChange is one entry of the change history of the settings. The
+// values are JSON, OldValue is nil for the first write of a setting and
+// NewValue for a reset to the default. Actor is the public id of ActorID,
+// filled when the changes are listed.
+type SettingChange struct {
+	ID        uint      `json:"-" gorm:"primaryKey"`
+	Key       string    `json:"key" gorm:"column:name;size:128;index" example:"site.banner"`
+	Action    string    `json:"action" gorm:"size:16" example:"update"`
+	OldValue  *string   `json:"old_value" gorm:"type:text" example:"\"\""`
+	NewValue  *string   `json:"new_value" gorm:"type:text" example:"\"maintenance tonight\""`
+	Version   uint64    `json:"version" example:"2"`
+	ActorID   uint64    `json:"-" gorm:"index"`
+	Actor     string    `json:"actor_id" gorm:"-" example:"01ARYZ6S41TSV4RRFFQ69G5FAV"`
+	RequestID string    `json:"request_id" gorm:"size:64" example:"76d27e8c-a80e-48c8-ad20-e5562e0f67e4"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -1,7 +1,16 @@
 package model
 
+// RoleAdmin is the role of the tokens allowed on the admin api.
+const RoleAdmin = "admin"
+
 type User struct {
-	ID       uint   `json:"id" gorm:"primaryKey" example:"1"`
-	Username string `json:"username" gorm:"unique" binding:"required" example:"JohnDoe"`
-	Password string `json:"password" example:"xxxxxxx"`
+	Base
+	Versioned
+	Username string `json:"username" gorm:"size:64;unique" binding:"required" privacy:"pii" example:"JohnDoe"`
+	Password string `json:"-" audit:"-"`
+	Avatar   string `json:"avatar" gorm:"size:26" example:"01ARYZ6S41TSV4RRFFQ69G5FAV"` // public id of the avatar File
 }
+
+func (u *User) Audited() bool { return true }
+
+func (u *User) SearchColumns() []string { return []string{"username"} }
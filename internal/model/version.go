@@ -0,0 +1,22 @@
+package model
+
+// Versioned is embedded by models that opt in to optimistic locking. Updates
+// through db.Repository only apply while the row still has the version the
+// caller read, and bump it by one.
+type Versioned struct {
+	Version uint64 `json:"version" gorm:"not null;default:1" example:"1"`
+}
+
+// Versioner is implemented by models embedding Versioned.
+type Versioner interface {
+	GetVersion() uint64
+	SetVersion(version uint64)
+}
+
+func (v *Versioned) GetVersion() uint64 {
+	return v.Version
+}
+
+func (v *Versioned) SetVersion(version uint64) {
+	v.Version = version
+}
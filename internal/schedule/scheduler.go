@@ -0,0 +1,338 @@
+package schedule
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go-server-template/internal/conf"
+	"go-server-template/internal/db"
+	"go-server-template/internal/model"
+	"go-server-template/pkg/logger"
+	"go-server-template/pkg/ulid"
+	"math/rand"
+	"os"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// LeaseName is the name of the lease held by the leading scheduler.
+const LeaseName = "scheduler"
+
+var ErrTaskNotFound = errors.New("task not found")
+
+// Scheduler starts the due tasks while it holds the scheduler lease.
+type Scheduler struct {
+	// ID identifies the scheduler as the lease holder.
+	ID string
+	// Interval is the wait between two ticks, which also renew the lease.
+	Interval time.Duration
+	// LeaseTTL is how long the lease is held without renewal, another
+	// replica takes the lead after it when the leader died.
+	LeaseTTL time.Duration
+
+	mux     sync.Mutex
+	leader  bool
+	synced  bool
+	running map[string]bool
+	runs    sync.WaitGroup
+}
+
+// NewScheduler returns a scheduler configured by scheduler.
+func NewScheduler(scheduler conf.Scheduler) *Scheduler {
+	host, _ := os.Hostname()
+	return &Scheduler{
+		ID:       fmt.Sprintf("%s-%d-%s", host, os.Getpid(), ulid.New()[20:]),
+		Interval: time.Duration(scheduler.Interval) * time.Millisecond,
+		LeaseTTL: time.Duration(scheduler.LeaseTTL) * time.Second,
+	}
+}
+
+// Run ticks until ctx is done, then cancels the runs in progress, waits for
+// them and gives up the lead.
+func (s *Scheduler) Run(ctx context.Context) {
+	// the runs outlive ctx until the loop is left
+	runCtx, stop := context.WithCancel(context.Background())
+	defer stop()
+
+	for ctx.Err() == nil {
+		if err := s.Tick(runCtx, time.Now()); err != nil {
+			logger.GetLogger().Errorf("Failed to run scheduler tick: %s", err.Error())
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(s.Interval):
+		}
+	}
+
+	stop()
+	s.Wait()
+	if s.isLeader() {
+		if err := db.ReleaseLease(context.Background(), LeaseName, s.ID); err != nil {
+			logger.GetLogger().Errorf("Failed to release scheduler lease: %s", err.Error())
+		}
+	}
+}
+
+// Wait waits for the runs in progress.
+func (s *Scheduler) Wait() {
+	s.runs.Wait()
+}
+
+// Tick renews the lead and, while leading, starts the tasks due at now. The
+// runs use ctx.
+func (s *Scheduler) Tick(ctx context.Context, now time.Time) error {
+	_, leader, err := db.AcquireLease(ctx, LeaseName, s.ID, s.LeaseTTL)
+	if err != nil {
+		s.setLeader(false)
+		return err
+	}
+	if !s.setLeader(leader) {
+		return nil
+	}
+
+	registered := Tasks()
+	names := make([]string, 0, len(registered))
+	for _, t := range registered {
+		names = append(names, t.Name)
+	}
+	rows, err := db.ListScheduledTasks(ctx, names)
+	if err != nil {
+		return err
+	}
+	states := make(map[string]*model.ScheduledTask, len(rows))
+	for _, row := range rows {
+		states[row.Name] = row
+	}
+
+	if !s.synced {
+		// a new leader schedules the new tasks and the changed expressions
+		for _, t := range registered {
+			if state, ok := states[t.Name]; ok && state.Spec == t.Spec {
+				continue
+			}
+			if err = db.SaveScheduledTask(ctx, t.Name, t.Spec, s.next(t, now)); err != nil {
+				return err
+			}
+			delete(states, t.Name)
+		}
+		s.synced = true
+	}
+
+	for _, t := range registered {
+		state, ok := states[t.Name]
+		if !ok || state.NextRunAt.After(now) {
+			continue
+		}
+		if err = s.tick(ctx, t, state, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tick claims the due tick of t and runs it unless the previous run is in
+// progress or the policy skips it.
+func (s *Scheduler) tick(ctx context.Context, t *Task, state *model.ScheduledTask, now time.Time) error {
+	log := logger.GetLogger().WithFields(logger.Fields{"task": t.Name, "due_at": state.NextRunAt})
+	next := s.next(t, now)
+
+	inProgress := s.isRunning(t.Name) ||
+		state.RunningSince != nil && (t.Timeout <= 0 || now.Before(state.RunningSince.Add(t.Timeout)))
+	missed := now.Sub(state.NextRunAt) > s.LeaseTTL+2*s.Interval
+
+	var reason string
+	switch {
+	case inProgress:
+		reason = "the previous run is in progress"
+	case missed && t.Missed == MissedSkip:
+		reason = "the tick was missed"
+	}
+	if reason != "" {
+		if _, err := db.ClaimScheduledTask(ctx, state, next, nil); err != nil {
+			return err
+		}
+		log.WithField("reason", reason).Warn("skipping scheduled task")
+		return nil
+	}
+
+	start := now
+	claimed, err := db.ClaimScheduledTask(ctx, state, next, &start)
+	if err != nil || !claimed {
+		return err
+	}
+	if missed {
+		log.Warn("running missed scheduled task once")
+	}
+	s.start(ctx, t, start)
+	return nil
+}
+
+func (s *Scheduler) start(ctx context.Context, t *Task, start time.Time) {
+	s.setRunning(t.Name, true)
+	s.runs.Add(1)
+	go func() {
+		defer s.runs.Done()
+		defer s.setRunning(t.Name, false)
+
+		err := t.run(ctx)
+		log := logger.GetLogger().WithFields(logger.Fields{
+			"task":       t.Name,
+			"elapsed_ms": time.Since(start).Milliseconds(),
+			"leader":     s.ID,
+		})
+		if err != nil {
+			log.WithField("error", err.Error()).Error("scheduled task failed")
+		} else {
+			log.Info("scheduled task succeeded")
+		}
+		// recorded even when ctx was canceled by a shutdown
+		if err = db.FinishScheduledTask(context.Background(), t.Name, start, err); err != nil {
+			logger.GetLogger().Errorf("Failed to record the run of task %s: %s", t.Name, err.Error())
+		}
+	}()
+}
+
+// next returns the tick of t following now, delayed by its jitter.
+func (s *Scheduler) next(t *Task, now time.Time) time.Time {
+	next := t.Schedule.Next(now)
+	if t.Jitter > 0 {
+		next = next.Add(time.Duration(rand.Int63n(int64(t.Jitter))))
+	}
+	return next
+}
+
+// setLeader records whether the scheduler leads and returns it.
+func (s *Scheduler) setLeader(leader bool) bool {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if leader != s.leader {
+		if leader {
+			logger.GetLogger().Infof("Scheduler %s is the leader", s.ID)
+		} else {
+			logger.GetLogger().Infof("Scheduler %s is no longer the leader", s.ID)
+		}
+		s.synced = false
+	}
+	s.leader = leader
+	return leader
+}
+
+func (s *Scheduler) isLeader() bool {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.leader
+}
+
+func (s *Scheduler) setRunning(name string, running bool) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if s.running == nil {
+		s.running = make(map[string]bool)
+	}
+	if running {
+		s.running[name] = true
+	} else {
+		delete(s.running, name)
+	}
+}
+
+func (s *Scheduler) isRunning(name string) bool {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.running[name]
+}
+
+// RunNow runs the task name right away in the calling process, whether or
+// not a scheduler leads, and records the run.
+func RunNow(ctx context.Context, name string) error {
+	t, ok := Lookup(name)
+	if !ok {
+		return ErrTaskNotFound
+	}
+
+	start := time.Now()
+	if err := db.CreateScheduledTask(ctx, t.Name, t.Spec, t.Schedule.Next(start)); err != nil {
+		return err
+	}
+	err := t.run(ctx)
+	if recordErr := db.FinishScheduledTask(context.Background(), t.Name, start, err); recordErr != nil {
+		logger.GetLogger().Errorf("Failed to record the run of task %s: %s", t.Name, recordErr.Error())
+	}
+	return err
+}
+
+// TaskStatus is a registered task along with its state.
+type TaskStatus struct {
+	Name    string       `json:"name" example:"outbox.cleanup"`
+	Spec    string       `json:"spec" example:"@daily"`
+	Timeout int64        `json:"timeout_seconds" example:"3600"`
+	Jitter  int64        `json:"jitter_seconds" example:"60"`
+	Missed  MissedPolicy `json:"missed" example:"run_once"`
+
+	Runs         int64      `json:"runs" example:"1"`
+	NextRunAt    *time.Time `json:"next_run_at"`
+	RunningSince *time.Time `json:"running_since"`
+	LastRunAt    *time.Time `json:"last_run_at"`
+	LastStatus   string     `json:"last_status" example:"succeeded"`
+	LastError    string     `json:"last_error"`
+	LastDuration int64      `json:"last_duration_ms" example:"12"`
+}
+
+// Status is the state of the scheduler shared by the replicas.
+type Status struct {
+	Leader      string        `json:"leader" example:"host-1234-ABCDEF"`
+	LeaderUntil *time.Time    `json:"leader_until"`
+	Tasks       []*TaskStatus `json:"tasks"`
+}
+
+// GetStatus returns the leader and the state of every registered task.
+func GetStatus(ctx context.Context) (*Status, error) {
+	status := &Status{}
+	lease, err := db.GetLease(ctx, LeaseName)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	if lease != nil && lease.ExpiresAt.After(time.Now()) {
+		status.Leader = lease.Holder
+		status.LeaderUntil = &lease.ExpiresAt
+	}
+
+	registered := Tasks()
+	names := make([]string, 0, len(registered))
+	for _, t := range registered {
+		names = append(names, t.Name)
+	}
+	rows, err := db.ListScheduledTasks(ctx, names)
+	if err != nil {
+		return nil, err
+	}
+	states := make(map[string]*model.ScheduledTask, len(rows))
+	for _, row := range rows {
+		states[row.Name] = row
+	}
+
+	for _, t := range registered {
+		ts := &TaskStatus{
+			Name:    t.Name,
+			Spec:    t.Spec,
+			Timeout: int64(t.Timeout.Seconds()),
+			Jitter:  int64(t.Jitter.Seconds()),
+			Missed:  t.Missed,
+		}
+		if state, ok := states[t.Name]; ok {
+			next := state.NextRunAt
+			ts.Runs = state.Runs
+			ts.NextRunAt = &next
+			ts.RunningSince = state.RunningSince
+			ts.LastRunAt = state.LastRunAt
+			ts.LastStatus = state.LastStatus
+			ts.LastError = state.LastError
+			ts.LastDuration = state.LastDuration
+		}
+		status.Tasks = append(status.Tasks, ts)
+	}
+	return status, nil
+}
@@ -0,0 +1,167 @@
+package schedule
+
+import (
+	"context"
+	"errors"
+	"go-server-template/internal/db"
+	"go-server-template/internal/db/dbtest"
+	"go-server-template/internal/model"
+	"go-server-template/pkg/logger"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func openSchedule(t *testing.T) {
+	logger.Init("zap")
+	dbtest.Open(t, new(model.Lease), new(model.ScheduledTask))
+}
+
+func register(t *testing.T, name, spec string, handler Handler, opts ...Option) {
+	Register(name, spec, handler, opts...)
+	t.Cleanup(func() {
+		tasksMux.Lock()
+		delete(tasks, name)
+		tasksMux.Unlock()
+	})
+}
+
+func state(t *testing.T, name string) *model.ScheduledTask {
+	rows, err := db.ListScheduledTasks(context.Background(), []string{name})
+	if err != nil || len(rows) != 1 {
+		t.Fatalf("expected the state of %s, got %v (%v)", name, rows, err)
+	}
+	return rows[0]
+}
+
+func TestScheduler(t *testing.T) {
+	openSchedule(t)
+	ctx := context.Background()
+
+	var runs atomic.Int32
+	register(t, "test.count", "*/5 * * * *", func(ctx context.Context) error {
+		runs.Add(1)
+		return nil
+	})
+
+	a := &Scheduler{ID: "a", Interval: time.Second, LeaseTTL: time.Minute}
+	b := &Scheduler{ID: "b", Interval: time.Second, LeaseTTL: time.Minute}
+
+	now := time.Date(2024, time.March, 1, 10, 2, 0, 0, time.Local)
+	if err := a.Tick(ctx, now); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Tick(ctx, now); err != nil {
+		t.Fatal(err)
+	}
+	if !a.isLeader() || b.isLeader() {
+		t.Fatal("expected a to lead alone")
+	}
+	if next := state(t, "test.count").NextRunAt; !next.Equal(now.Add(3 * time.Minute)) {
+		t.Fatalf("expected the first tick at 10:05, got %s", next)
+	}
+
+	// the tick is due, only the leader runs it
+	due := now.Add(3 * time.Minute)
+	for _, s := range []*Scheduler{a, b} {
+		if err := s.Tick(ctx, due); err != nil {
+			t.Fatal(err)
+		}
+	}
+	a.Wait()
+	if runs.Load() != 1 {
+		t.Fatalf("expected 1 run, got %d", runs.Load())
+	}
+	st := state(t, "test.count")
+	if st.LastStatus != model.TaskSucceeded || st.RunningSince != nil || !st.NextRunAt.Equal(due.Add(5*time.Minute)) {
+		t.Fatalf("unexpected state after the run: %+v", st)
+	}
+
+	// a dies, b takes over once the lease expired and runs the missed ticks once
+	later := due.Add(time.Hour)
+	if err := db.ReleaseLease(ctx, LeaseName, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Tick(ctx, later); err != nil {
+		t.Fatal(err)
+	}
+	b.Wait()
+	if !b.isLeader() || runs.Load() != 2 {
+		t.Fatalf("expected b to lead and run the missed ticks once, got %d runs", runs.Load())
+	}
+
+	status, err := GetStatus(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Leader != "b" || len(status.Tasks) != 1 || status.Tasks[0].Runs != 2 || status.Tasks[0].LastRunAt == nil {
+		t.Fatalf("unexpected status: %+v %+v", status, status.Tasks)
+	}
+}
+
+func TestSchedulerSkips(t *testing.T) {
+	openSchedule(t)
+	ctx := context.Background()
+
+	release := make(chan struct{})
+	var slowRuns, missedRuns atomic.Int32
+	register(t, "test.slow", "* * * * *", func(ctx context.Context) error {
+		slowRuns.Add(1)
+		<-release
+		return errors.New("gave up")
+	})
+	register(t, "test.missed", "0 * * * *", func(ctx context.Context) error {
+		missedRuns.Add(1)
+		return nil
+	}, WithMissed(MissedSkip))
+
+	s := &Scheduler{ID: "a", Interval: time.Second, LeaseTTL: time.Minute}
+	now := time.Date(2024, time.March, 1, 10, 0, 30, 0, time.Local)
+	if err := s.Tick(ctx, now); err != nil {
+		t.Fatal(err)
+	}
+
+	// the slow task is still running at its next tick
+	if err := s.Tick(ctx, now.Add(30*time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Tick(ctx, now.Add(90*time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	close(release)
+	s.Wait()
+	if slowRuns.Load() != 1 {
+		t.Fatalf("expected the overlapping tick to be skipped, got %d runs", slowRuns.Load())
+	}
+	if st := state(t, "test.slow"); st.LastStatus != model.TaskFailed || st.LastError != "gave up" {
+		t.Fatalf("expected a failed run, got %+v", st)
+	}
+
+	// three hours later the hourly tick was missed
+	if err := s.Tick(ctx, now.Add(3*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	s.Wait()
+	if missedRuns.Load() != 0 {
+		t.Fatalf("expected the missed tick to be skipped, got %d runs", missedRuns.Load())
+	}
+	if next := state(t, "test.missed").NextRunAt; !next.Equal(time.Date(2024, time.March, 1, 14, 0, 0, 0, time.Local)) {
+		t.Fatalf("expected the next tick at 14:00, got %s", next)
+	}
+}
+
+func TestRunNow(t *testing.T) {
+	openSchedule(t)
+
+	register(t, "test.timeout", "@daily", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}, WithTimeout(10*time.Millisecond))
+
+	if err := RunNow(context.Background(), "test.timeout"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the run to time out, got %v", err)
+	}
+	if err := RunNow(context.Background(), "test.unknown"); !errors.Is(err, ErrTaskNotFound) {
+		t.Fatalf("expected ErrTaskNotFound, got %v", err)
+	}
+}
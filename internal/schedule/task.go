@@ -0,0 +1,145 @@
+// Package schedule runs the tasks registered by the modules on their cron
+// expressions, see pkg/cron.
+//
+// Every replica runs a Scheduler, the one holding the database lease leads
+// and is the only one starting runs. The state of each task is kept in the
+// scheduled_tasks table and every tick is claimed there, so a tick runs once
+// even while the leadership moves between replicas.
+package schedule
+
+import (
+	"context"
+	"fmt"
+	"go-server-template/pkg/cron"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MissedPolicy decides what happens to the ticks missed while no replica
+// led, e.g. during a deployment.
+type MissedPolicy string
+
+const (
+	// MissedRunOnce runs the task once for all the missed ticks.
+	MissedRunOnce MissedPolicy = "run_once"
+	// MissedSkip skips the missed ticks and waits for the next one.
+	MissedSkip MissedPolicy = "skip"
+)
+
+const defaultTimeout = time.Hour
+
+// Handler runs a task, ctx is done when the task times out.
+type Handler func(ctx context.Context) error
+
+// Task is a registered task.
+type Task struct {
+	Name     string
+	Spec     string
+	Schedule cron.Schedule
+	Handler  Handler
+	// Timeout bounds a run. A tick due while the previous run is still in
+	// progress is skipped, a run older than Timeout is considered dead.
+	Timeout time.Duration
+	// Jitter delays each tick by a random duration up to it, so tasks on
+	// the same expression do not all start at once.
+	Jitter time.Duration
+	Missed MissedPolicy
+}
+
+type Option func(*Task)
+
+// WithTimeout bounds a run of the task, an hour by default.
+func WithTimeout(d time.Duration) Option {
+	return func(t *Task) {
+		t.Timeout = d
+	}
+}
+
+// WithJitter delays each tick by up to d.
+func WithJitter(d time.Duration) Option {
+	return func(t *Task) {
+		t.Jitter = d
+	}
+}
+
+// WithMissed sets the policy for the missed ticks, MissedRunOnce by default.
+func WithMissed(policy MissedPolicy) Option {
+	return func(t *Task) {
+		t.Missed = policy
+	}
+}
+
+var (
+	tasksMux sync.RWMutex
+	tasks    = make(map[string]*Task)
+)
+
+// Register registers handler to run on spec. It is meant to be called from
+// init and panics on a spec that is malformed or never activates, or on a
+// name registered twice.
+func Register(name, spec string, handler Handler, opts ...Option) {
+	schedule, err := cron.Parse(spec)
+	if err != nil {
+		panic(fmt.Sprintf("schedule: task %s: %s", name, err.Error()))
+	}
+	if schedule.Next(time.Now()).IsZero() {
+		panic(fmt.Sprintf("schedule: task %s never runs on %q", name, spec))
+	}
+
+	t := &Task{
+		Name:     name,
+		Spec:     spec,
+		Schedule: schedule,
+		Handler:  handler,
+		Timeout:  defaultTimeout,
+		Missed:   MissedRunOnce,
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+
+	tasksMux.Lock()
+	defer tasksMux.Unlock()
+	if _, ok := tasks[name]; ok {
+		panic(fmt.Sprintf("schedule: task %s registered twice", name))
+	}
+	tasks[name] = t
+}
+
+// Tasks returns the registered tasks sorted by name.
+func Tasks() []*Task {
+	tasksMux.RLock()
+	defer tasksMux.RUnlock()
+
+	list := make([]*Task, 0, len(tasks))
+	for _, t := range tasks {
+		list = append(list, t)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// Lookup returns the task name.
+func Lookup(name string) (*Task, bool) {
+	tasksMux.RLock()
+	defer tasksMux.RUnlock()
+	t, ok := tasks[name]
+	return t, ok
+}
+
+// run runs the handler of t with its timeout, turning a panic into an error.
+func (t *Task) run(ctx context.Context) (err error) {
+	if t.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, t.Timeout)
+		defer cancel()
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return t.Handler(ctx)
+}
@@ -0,0 +1,65 @@
+package search
+
+import (
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+func init() {
+	Register("mysql", &mysqlIndex{})
+}
+
+var _ Index = (*mysqlIndex)(nil)
+
+// mysqlIndex relies on a FULLTEXT index over the columns, which InnoDB keeps
+// up to date itself. Words shorter than innodb_ft_min_token_size, 3 by
+// default, are not indexed.
+type mysqlIndex struct{}
+
+func (ix *mysqlIndex) name(t Table) string {
+	return "idx_" + t.Name + "_search"
+}
+
+func (ix *mysqlIndex) Migrate(tx *gorm.DB, t Table) error {
+	var count int64
+	err := tx.Raw("SELECT COUNT(*) FROM information_schema.statistics WHERE table_schema = DATABASE() AND table_name = ? AND index_name = ?",
+		t.Name, ix.name(t)).Scan(&count).Error
+	if err != nil || count > 0 {
+		return err
+	}
+	return tx.Exec(fmt.Sprintf("ALTER TABLE %s ADD FULLTEXT INDEX %s (%s)",
+		tx.Statement.Quote(t.Name), tx.Statement.Quote(ix.name(t)), strings.Join(quoteAll(tx, t.Columns), ", "))).Error
+}
+
+func (ix *mysqlIndex) Reindex(tx *gorm.DB, t Table, ids []interface{}) error {
+	return nil
+}
+
+func (ix *mysqlIndex) Match(tx *gorm.DB, t Table, terms []string) *gorm.DB {
+	table := tx.Statement.Quote(t.Name)
+	columns := make([]string, len(t.Columns))
+	for i, column := range t.Columns {
+		columns[i] = table + "." + tx.Statement.Quote(column)
+	}
+	words := make([]string, len(terms))
+	for i, term := range terms {
+		words[i] = "+" + term + "*"
+	}
+	against := fmt.Sprintf("MATCH (%s) AGAINST (? IN BOOLEAN MODE)", strings.Join(columns, ", "))
+	query := strings.Join(words, " ")
+
+	selects := []string{
+		fmt.Sprintf("%s.%s AS search_id", table, tx.Statement.Quote(t.Key)),
+		against + " AS search_rank",
+	}
+	for i, column := range columns {
+		selects = append(selects, fmt.Sprintf("%s AS search_highlight_%d", column, i))
+	}
+	return tx.Table(t.Name).Select(strings.Join(selects, ", "), query).Where(against, query)
+}
+
+func (ix *mysqlIndex) Highlights() bool {
+	return false
+}
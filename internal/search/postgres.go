@@ -0,0 +1,86 @@
+package search
+
+import (
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+func init() {
+	Register("postgres", &postgresIndex{})
+}
+
+var _ Index = (*postgresIndex)(nil)
+
+// postgresIndex keeps the columns in a tsvector column of the table with a
+// GIN index, the earlier columns weighted higher. The 'simple' configuration
+// indexes the words as they are, whatever their language.
+type postgresIndex struct{}
+
+// postgresWeights are the weights of the columns in order, the later ones
+// all weighted D.
+var postgresWeights = []string{"A", "B", "C", "D"}
+
+const postgresVector = "search_vector"
+
+func (ix *postgresIndex) document(tx *gorm.DB, t Table) string {
+	parts := make([]string, len(t.Columns))
+	for i, column := range t.Columns {
+		weight := postgresWeights[len(postgresWeights)-1]
+		if i < len(postgresWeights) {
+			weight = postgresWeights[i]
+		}
+		parts[i] = fmt.Sprintf("setweight(to_tsvector('simple', coalesce(%s, '')), '%s')", tx.Statement.Quote(column), weight)
+	}
+	return strings.Join(parts, " || ")
+}
+
+func (ix *postgresIndex) Migrate(tx *gorm.DB, t Table) error {
+	table := tx.Statement.Quote(t.Name)
+	err := tx.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN IF NOT EXISTS %s tsvector", table, postgresVector)).Error
+	if err != nil {
+		return err
+	}
+	err = tx.Exec(fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s ON %s USING GIN (%s)",
+		tx.Statement.Quote("idx_"+t.Name+"_search"), table, postgresVector)).Error
+	if err != nil {
+		return err
+	}
+	return tx.Exec(fmt.Sprintf("UPDATE %s SET %s = %s WHERE %s IS NULL",
+		table, postgresVector, ix.document(tx, t), postgresVector)).Error
+}
+
+func (ix *postgresIndex) Reindex(tx *gorm.DB, t Table, ids []interface{}) error {
+	return tx.Exec(fmt.Sprintf("UPDATE %s SET %s = %s WHERE %s IN ?",
+		tx.Statement.Quote(t.Name), postgresVector, ix.document(tx, t), tx.Statement.Quote(t.Key)), ids).Error
+}
+
+func (ix *postgresIndex) Match(tx *gorm.DB, t Table, terms []string) *gorm.DB {
+	table := tx.Statement.Quote(t.Name)
+	prefixes := make([]string, len(terms))
+	for i, term := range terms {
+		prefixes[i] = term + ":*"
+	}
+	query := strings.Join(prefixes, " & ")
+	options := fmt.Sprintf("StartSel=%s, StopSel=%s, HighlightAll=true", markStart, markEnd)
+
+	selects := []string{
+		fmt.Sprintf("%s.%s AS search_id", table, tx.Statement.Quote(t.Key)),
+		fmt.Sprintf("ts_rank(%s.%s, to_tsquery('simple', ?)) AS search_rank", table, postgresVector),
+	}
+	args := []interface{}{query}
+	for i, column := range t.Columns {
+		selects = append(selects, fmt.Sprintf("ts_headline('simple', coalesce(%s.%s, ''), to_tsquery('simple', ?), ?) AS search_highlight_%d",
+			table, tx.Statement.Quote(column), i))
+		args = append(args, query, options)
+	}
+
+	return tx.Table(t.Name).
+		Select(strings.Join(selects, ", "), args...).
+		Where(fmt.Sprintf("%s.%s @@ to_tsquery('simple', ?)", table, postgresVector), query)
+}
+
+func (ix *postgresIndex) Highlights() bool {
+	return true
+}
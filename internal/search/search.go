@@ -0,0 +1,378 @@
+// Package search runs full-text searches over the model.Searchable models
+// with the index their database supports: an FTS virtual table on sqlite, a
+// tsvector column with a GIN index on postgres and a FULLTEXT index on
+// mysql. bootstrap.SearchPlugin keeps the indexes up to date on every write.
+//
+// A query matches the rows containing words starting with each of its
+// words, the best ranked first. Pages are cut by the rank and the key of
+// their last row, so a row is never listed twice.
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go-server-template/internal/db"
+	"go-server-template/internal/model"
+	"html"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+var ErrUnsupported = errors.New("full-text search not supported")
+
+// The native highlighting wraps the matches in these private use
+// characters, so the text can be escaped before they become <mark> tags.
+const (
+	markStart = "\uE000"
+	markEnd   = "\uE001"
+)
+
+// maxTerms bounds the words of a query.
+const maxTerms = 8
+
+// Table is a searchable table.
+type Table struct {
+	Name string
+	// Key is the primary key column.
+	Key     string
+	Columns []string
+	// SoftDelete is the deleted_at column of the table, if any.
+	SoftDelete string
+}
+
+// TableOf returns the table of the model of s, false when it is not
+// model.Searchable.
+func TableOf(s *schema.Schema) (Table, bool) {
+	searchable, ok := reflect.New(s.ModelType).Interface().(model.Searchable)
+	if !ok || s.PrioritizedPrimaryField == nil {
+		return Table{}, false
+	}
+	t := Table{Name: s.Table, Key: s.PrioritizedPrimaryField.DBName, Columns: searchable.SearchColumns()}
+	for _, f := range s.Fields {
+		if f.FieldType == reflect.TypeOf(gorm.DeletedAt{}) {
+			t.SoftDelete = f.DBName
+		}
+	}
+	return t, true
+}
+
+// Index is the full-text index of a dialect.
+type Index interface {
+	// Migrate creates the index of t and indexes the rows it misses.
+	Migrate(tx *gorm.DB, t Table) error
+
+	// Reindex indexes the rows ids of t as they are now, the rows no longer
+	// there are removed from the index.
+	Reindex(tx *gorm.DB, t Table, ids []interface{}) error
+
+	// Match returns a query selecting the rows of t matching all of terms:
+	// their key as search_id, their rank as search_rank, the higher the
+	// better, and each column as search_highlight_<i>.
+	Match(tx *gorm.DB, t Table, terms []string) *gorm.DB
+
+	// Highlights reports whether Match wraps the matches of the columns in
+	// markStart and markEnd, or else Search marks them itself.
+	Highlights() bool
+}
+
+var (
+	mux     sync.RWMutex
+	indexes = make(map[string]Index)
+)
+
+// Register makes index the one of the dialect name, see gorm.Dialector.
+// It panics if name is already registered.
+func Register(name string, index Index) {
+	mux.Lock()
+	defer mux.Unlock()
+
+	if _, dup := indexes[name]; dup {
+		panic("search: Register called twice for " + name)
+	}
+	indexes[name] = index
+}
+
+// For returns the index of the dialect name.
+func For(name string) (Index, error) {
+	mux.RLock()
+	defer mux.RUnlock()
+
+	index, ok := indexes[name]
+	if !ok {
+		return nil, fmt.Errorf("%w on %s", ErrUnsupported, name)
+	}
+	return index, nil
+}
+
+// Migrate creates the indexes of values and indexes their existing rows.
+func Migrate(tx *gorm.DB, values ...model.Searchable) error {
+	index, err := For(tx.Dialector.Name())
+	if err != nil {
+		return err
+	}
+	for _, value := range values {
+		stmt := &gorm.Statement{DB: tx}
+		if err = stmt.Parse(value); err != nil {
+			return err
+		}
+		t, _ := TableOf(stmt.Schema)
+		if err = index.Migrate(tx.Session(&gorm.Session{NewDB: true}), t); err != nil {
+			return fmt.Errorf("failed to migrate the search index of %s: %w", t.Name, err)
+		}
+	}
+	return nil
+}
+
+// Reindex indexes the rows ids of t as they are now, in the transaction of
+// tx if any.
+func Reindex(tx *gorm.DB, t Table, ids []interface{}) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	index, err := For(tx.Dialector.Name())
+	if err != nil {
+		return err
+	}
+	return index.Reindex(tx.Session(&gorm.Session{NewDB: true}), t, ids)
+}
+
+// Terms returns the words of q, lowercased, which are the only characters
+// of a query reaching the database.
+func Terms(q string) []string {
+	var terms []string
+	seen := make(map[string]bool)
+	for _, word := range strings.FieldsFunc(strings.ToLower(q), isSeparator) {
+		if seen[word] || len(terms) == maxTerms {
+			continue
+		}
+		seen[word] = true
+		terms = append(terms, word)
+	}
+	return terms
+}
+
+func isSeparator(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+}
+
+// Hit is a row matching a search.
+type Hit[T any] struct {
+	Item *T      `json:"item"`
+	Rank float64 `json:"rank" example:"0.6"`
+	// Highlight holds the indexed columns HTML escaped, the matches
+	// between <mark> and </mark>.
+	Highlight map[string]string `json:"highlight"`
+}
+
+// Search returns up to limit rows of T matching q, the best ranked first.
+// Cursor is the NextCursor of the previous page and empty for the first one.
+// T must be model.Searchable, its key an integer.
+func Search[T any](ctx context.Context, q string, limit int, cursor string) (*db.Page[Hit[T]], error) {
+	conn := db.Conn(ctx)
+	stmt := &gorm.Statement{DB: conn}
+	if err := stmt.Parse(new(T)); err != nil {
+		return nil, err
+	}
+	t, ok := TableOf(stmt.Schema)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s is not searchable", ErrUnsupported, stmt.Schema.Name)
+	}
+	index, err := For(conn.Dialector.Name())
+	if err != nil {
+		return nil, err
+	}
+
+	page := &db.Page[Hit[T]]{Items: make([]*Hit[T], 0)}
+	terms := Terms(q)
+	if len(terms) == 0 {
+		return page, nil
+	}
+
+	matches := index.Match(conn.Session(&gorm.Session{NewDB: true}), t, terms)
+	if t.SoftDelete != "" {
+		matches = matches.Where(clause.Eq{Column: clause.Column{Table: t.Name, Name: t.SoftDelete}, Value: nil})
+	}
+	tx := conn.Table("(?) AS hits", matches)
+	if cursor != "" {
+		rank, id, err := decodeCursor(cursor)
+		if err != nil {
+			return nil, err
+		}
+		tx = tx.Where("search_rank < ? OR (search_rank = ? AND search_id > ?)", rank, rank, id)
+	}
+
+	// fetch one more row to know whether there is a next page
+	var rows []map[string]interface{}
+	if err = tx.Order("search_rank DESC").Order("search_id ASC").Limit(limit + 1).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	more := len(rows) > limit
+	if more {
+		rows = rows[:limit]
+	}
+	if len(rows) == 0 {
+		return page, nil
+	}
+
+	ids := make([]interface{}, len(rows))
+	for i, row := range rows {
+		ids[i] = deref(row["search_id"])
+	}
+	var items []*T
+	err = conn.Model(new(T)).Where(clause.IN{Column: clause.Column{Name: t.Key}, Values: ids}).Find(&items).Error
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[string]*T, len(items))
+	for _, item := range items {
+		id, _ := stmt.Schema.PrioritizedPrimaryField.ValueOf(ctx, reflect.ValueOf(item).Elem())
+		byID[fmt.Sprint(id)] = item
+	}
+
+	for _, row := range rows {
+		id, _ := toUint(row["search_id"])
+		item, ok := byID[strconv.FormatUint(id, 10)]
+		if !ok {
+			// deleted since matched
+			continue
+		}
+		rank, _ := toFloat(row["search_rank"])
+		hit := &Hit[T]{Item: item, Rank: rank, Highlight: make(map[string]string, len(t.Columns))}
+		for i, column := range t.Columns {
+			text := toString(row["search_highlight_"+strconv.Itoa(i)])
+			if index.Highlights() {
+				hit.Highlight[column] = markNative(text)
+			} else {
+				hit.Highlight[column] = markTerms(text, terms)
+			}
+		}
+		page.Items = append(page.Items, hit)
+	}
+	if more {
+		page.NextCursor = encodeCursor(rows[len(rows)-1])
+	}
+	return page, nil
+}
+
+func encodeCursor(row map[string]interface{}) string {
+	rank, _ := toFloat(row["search_rank"])
+	id, _ := toUint(row["search_id"])
+	return db.SealCursor([]interface{}{rank, id})
+}
+
+func decodeCursor(cursor string) (rank float64, id uint64, err error) {
+	var values []json.RawMessage
+	if err = db.OpenCursor(cursor, &values); err != nil || len(values) != 2 {
+		return 0, 0, db.ErrInvalidCursor
+	}
+	if json.Unmarshal(values[0], &rank) != nil || json.Unmarshal(values[1], &id) != nil {
+		return 0, 0, db.ErrInvalidCursor
+	}
+	return rank, id, nil
+}
+
+// markNative escapes text highlighted by the database and turns its markers
+// into <mark> tags.
+func markNative(text string) string {
+	return strings.NewReplacer(markStart, "<mark>", markEnd, "</mark>").Replace(html.EscapeString(text))
+}
+
+// markTerms escapes text and wraps its words starting with one of terms in
+// <mark> tags.
+func markTerms(text string, terms []string) string {
+	var b strings.Builder
+	runes := []rune(text)
+	for start := 0; start < len(runes); {
+		end := start + 1
+		word := !isSeparator(runes[start])
+		for end < len(runes) && !isSeparator(runes[end]) == word {
+			end++
+		}
+		part := string(runes[start:end])
+		if word && matchesAny(strings.ToLower(part), terms) {
+			b.WriteString("<mark>" + html.EscapeString(part) + "</mark>")
+		} else {
+			b.WriteString(html.EscapeString(part))
+		}
+		start = end
+	}
+	return b.String()
+}
+
+func matchesAny(word string, terms []string) bool {
+	for _, term := range terms {
+		if strings.HasPrefix(word, term) {
+			return true
+		}
+	}
+	return false
+}
+
+// The drivers scan the selected values with different types, the
+// expressions without a declared type as *interface{}.
+
+func deref(v interface{}) interface{} {
+	if p, ok := v.(*interface{}); ok && p != nil {
+		return *p
+	}
+	return v
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch v := deref(v).(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case []byte:
+		f, err := strconv.ParseFloat(string(v), 64)
+		return f, err == nil
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func toUint(v interface{}) (uint64, bool) {
+	switch v := deref(v).(type) {
+	case int64:
+		return uint64(v), true
+	case int32:
+		return uint64(v), true
+	case uint64:
+		return v, true
+	case uint32:
+		return uint64(v), true
+	case []byte:
+		n, err := strconv.ParseUint(string(v), 10, 64)
+		return n, err == nil
+	case string:
+		n, err := strconv.ParseUint(v, 10, 64)
+		return n, err == nil
+	}
+	return 0, false
+}
+
+func toString(v interface{}) string {
+	switch v := deref(v).(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	}
+	return fmt.Sprint(v)
+}
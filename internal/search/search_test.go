@@ -0,0 +1,321 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"go-server-template/internal/db"
+	"go-server-template/internal/db/dbtest"
+	"go-server-template/internal/model"
+	"go-server-template/pkg/logger"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	gormLogger "gorm.io/gorm/logger"
+)
+
+var users = Table{Name: "users", Key: "id", Columns: []string{"username"}, SoftDelete: "deleted_at"}
+
+func openSearchDB(t *testing.T) *gorm.DB {
+	logger.Init("zap")
+
+	dB := dbtest.Open(t, new(model.User))
+	return dB
+}
+
+func createUsers(t *testing.T, dB *gorm.DB, usernames ...string) []*model.User {
+	created := make([]*model.User, len(usernames))
+	for i, username := range usernames {
+		created[i] = &model.User{Username: username}
+		if err := dB.Create(created[i]).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	return created
+}
+
+func usernames(page *db.Page[Hit[model.User]]) []string {
+	names := make([]string, len(page.Items))
+	for i, hit := range page.Items {
+		names[i] = hit.Item.Username
+	}
+	return names
+}
+
+func TestTerms(t *testing.T) {
+	got := Terms(`Ann-Marie "OR" ann* née; 42 `)
+	want := []string{"ann", "marie", "or", "née", "42"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	if got = Terms(strings.Repeat("a b c d e f g h i j ", 2)); len(got) != maxTerms {
+		t.Fatalf("expected %d terms, got %v", maxTerms, got)
+	}
+	if got = Terms(` "*:()' `); len(got) != 0 {
+		t.Fatalf("expected no terms, got %v", got)
+	}
+}
+
+func TestMark(t *testing.T) {
+	if got := markTerms("<Ann> annabel & Joann", []string{"ann"}); got != "&lt;<mark>Ann</mark>&gt; <mark>annabel</mark> &amp; Joann" {
+		t.Fatalf("unexpected %s", got)
+	}
+	if got := markNative("<b>" + markStart + "ann" + markEnd + "</b>"); got != "&lt;b&gt;<mark>ann</mark>&lt;/b&gt;" {
+		t.Fatalf("unexpected %s", got)
+	}
+}
+
+func TestTableOf(t *testing.T) {
+	dB := openSearchDB(t)
+	stmt := &gorm.Statement{DB: dB}
+	if err := stmt.Parse(new(model.User)); err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := TableOf(stmt.Schema); !ok || !reflect.DeepEqual(got, users) {
+		t.Fatalf("unexpected %+v", got)
+	}
+	if err := stmt.Parse(new(model.AuditLog)); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := TableOf(stmt.Schema); ok {
+		t.Fatal("expected the audit logs not to be searchable")
+	}
+}
+
+func TestSearchSQLite(t *testing.T) {
+	dB := openSearchDB(t)
+	ctx := context.Background()
+
+	// the rows before the index are indexed by Migrate
+	created := createUsers(t, dB, "ann", "ann marie lee", "joann", "annabel")
+	if err := Migrate(dB, new(model.User)); err != nil {
+		t.Fatal(err)
+	}
+	// and migrating again changes nothing
+	if err := Migrate(dB, new(model.User)); err != nil {
+		t.Fatal(err)
+	}
+	more := createUsers(t, dB, "Anna <script>", "bob")
+	if err := Reindex(dB, users, []interface{}{more[0].ID, more[1].ID}); err != nil {
+		t.Fatal(err)
+	}
+
+	page, err := Search[model.User](ctx, "ANN", 10, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := usernames(page)
+	if len(got) != 4 || page.NextCursor != "" {
+		t.Fatalf("expected the 4 users with a word starting with ann, got %v", got)
+	}
+	for i := 1; i < len(page.Items); i++ {
+		if page.Items[i].Rank > page.Items[i-1].Rank {
+			t.Fatalf("expected the best ranked first, got %v", got)
+		}
+	}
+	if page.Items[0].Rank <= page.Items[len(page.Items)-1].Rank {
+		t.Fatalf("expected the matches to be ranked, got %v", page.Items)
+	}
+	if got[0] != "ann" {
+		t.Fatalf("expected the shortest match first, got %v", got)
+	}
+	for _, hit := range page.Items {
+		if hit.Item.Username == "Anna <script>" && hit.Highlight["username"] != "<mark>Anna</mark> &lt;script&gt;" {
+			t.Fatalf("unexpected highlight %s", hit.Highlight["username"])
+		}
+	}
+
+	// every term must match
+	if page, _ = Search[model.User](ctx, "ann lee", 10, ""); len(page.Items) != 1 || page.Items[0].Item.ID != created[1].ID {
+		t.Fatalf("expected ann marie lee, got %v", usernames(page))
+	}
+
+	// pages neither repeat nor skip a row
+	seen := make(map[uint]bool)
+	cursor := ""
+	for pages := 0; ; pages++ {
+		page, err = Search[model.User](ctx, "ann", 3, cursor)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, hit := range page.Items {
+			if seen[hit.Item.ID] {
+				t.Fatalf("%s listed twice", hit.Item.Username)
+			}
+			seen[hit.Item.ID] = true
+		}
+		if cursor = page.NextCursor; cursor == "" {
+			if pages != 1 {
+				t.Fatalf("expected 2 pages, got %d", pages+1)
+			}
+			break
+		}
+	}
+	if len(seen) != 4 {
+		t.Fatalf("expected 4 users over the pages, got %d", len(seen))
+	}
+
+	// renamed and deleted rows once reindexed
+	if err = dB.Model(created[0]).Update("username", "zed").Error; err != nil {
+		t.Fatal(err)
+	}
+	if err = dB.Delete(created[3]).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err = Reindex(dB, users, []interface{}{created[0].ID, created[3].ID}); err != nil {
+		t.Fatal(err)
+	}
+	if page, _ = Search[model.User](ctx, "ann", 10, ""); len(page.Items) != 2 {
+		t.Fatalf("expected the renamed and deleted users to be gone, got %v", usernames(page))
+	}
+	if page, _ = Search[model.User](ctx, "ze", 10, ""); len(page.Items) != 1 {
+		t.Fatalf("expected the renamed user, got %v", usernames(page))
+	}
+
+	if _, err = Search[model.User](ctx, "ann", 10, "garbage"); !errors.Is(err, db.ErrInvalidCursor) {
+		t.Fatalf("expected an invalid cursor, got %v", err)
+	}
+	if _, err = Search[model.AuditLog](ctx, "ann", 10, ""); !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("expected the audit logs not to be searchable, got %v", err)
+	}
+}
+
+// dryRun opens a connection of dialector generating the SQL without running
+// it.
+func dryRun(t *testing.T, dialector gorm.Dialector) *gorm.DB {
+	dB, err := gorm.Open(dialector, &gorm.Config{DryRun: true, DisableAutomaticPing: true, Logger: gormLogger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dB
+}
+
+func toSQL(dB *gorm.DB, fn func(tx *gorm.DB) *gorm.DB) string {
+	return dB.ToSQL(func(tx *gorm.DB) *gorm.DB {
+		return fn(tx.Session(&gorm.Session{NewDB: true}))
+	})
+}
+
+func TestPostgresSQL(t *testing.T) {
+	dB := dryRun(t, postgres.New(postgres.Config{DSN: "host=localhost dbname=test"}))
+	index, err := For("postgres")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t2 := Table{Name: "users", Key: "id", Columns: []string{"username", "bio"}}
+
+	got := toSQL(dB, func(tx *gorm.DB) *gorm.DB {
+		var rows []map[string]interface{}
+		return index.Match(tx, t2, []string{"ann", "lee"}).Find(&rows)
+	})
+	for _, want := range []string{
+		`ts_rank("users".search_vector, to_tsquery('simple', 'ann:* & lee:*')) AS search_rank`,
+		`ts_headline('simple', coalesce("users"."bio", ''), to_tsquery('simple', 'ann:* & lee:*'), 'StartSel=` + markStart,
+		`AS search_highlight_1`,
+		`WHERE "users".search_vector @@ to_tsquery('simple', 'ann:* & lee:*')`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("expected %s in %s", want, got)
+		}
+	}
+
+	var statements []string
+	dB.Logger = recorder{Interface: gormLogger.Discard, statements: &statements}
+	if err = index.Migrate(dB.Session(&gorm.Session{NewDB: true}), t2); err != nil {
+		t.Fatal(err)
+	}
+	if err = index.Reindex(dB.Session(&gorm.Session{NewDB: true}), t2, []interface{}{1, 2}); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		`ALTER TABLE "users" ADD COLUMN IF NOT EXISTS search_vector tsvector`,
+		`CREATE INDEX IF NOT EXISTS "idx_users_search" ON "users" USING GIN (search_vector)`,
+		`UPDATE "users" SET search_vector = setweight(to_tsvector('simple', coalesce("username", '')), 'A') || setweight(to_tsvector('simple', coalesce("bio", '')), 'B') WHERE search_vector IS NULL`,
+		`UPDATE "users" SET search_vector = setweight(to_tsvector('simple', coalesce("username", '')), 'A') || setweight(to_tsvector('simple', coalesce("bio", '')), 'B') WHERE "id" IN (1,2)`,
+	}
+	if !reflect.DeepEqual(statements, want) {
+		t.Fatalf("expected\n%s\ngot\n%s", strings.Join(want, "\n"), strings.Join(statements, "\n"))
+	}
+}
+
+func TestMySQLSQL(t *testing.T) {
+	dB := dryRun(t, mysql.New(mysql.Config{DSN: "root@tcp(localhost:3306)/test", SkipInitializeWithVersion: true}))
+	index, err := For("mysql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if index.Highlights() {
+		t.Fatal("expected mysql to leave the highlighting to Search")
+	}
+
+	got := toSQL(dB, func(tx *gorm.DB) *gorm.DB {
+		var rows []map[string]interface{}
+		return index.Match(tx, users, []string{"ann", "lee"}).Find(&rows)
+	})
+	for _, want := range []string{
+		"MATCH (`users`.`username`) AGAINST ('+ann* +lee*' IN BOOLEAN MODE) AS search_rank",
+		"`users`.`username` AS search_highlight_0",
+		"WHERE MATCH (`users`.`username`) AGAINST ('+ann* +lee*' IN BOOLEAN MODE)",
+	} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("expected %s in %s", want, got)
+		}
+	}
+}
+
+func TestSQLiteFTS4SQL(t *testing.T) {
+	dB := openSearchDB(t)
+	index := &sqliteIndex{module: "fts4"}
+
+	got := dB.ToSQL(func(tx *gorm.DB) *gorm.DB {
+		var rows []map[string]interface{}
+		return index.Match(tx.Session(&gorm.Session{NewDB: true}), users, []string{"ann", "lee"}).Find(&rows)
+	})
+	for _, want := range []string{
+		"(length(offsets(`users_search`)) - length(replace(offsets(`users_search`), ' ', '')) + 1) / 4.0 / (1 + length(`users_search`.`username`)) AS search_rank",
+		"WHERE `users_search` MATCH " + `"\"ann*\" \"lee*\""`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("expected %s in %s", want, got)
+		}
+	}
+}
+
+func TestSQLiteFTS5SQL(t *testing.T) {
+	dB := openSearchDB(t)
+	index := &sqliteIndex{module: "fts5"}
+
+	got := dB.ToSQL(func(tx *gorm.DB) *gorm.DB {
+		var rows []map[string]interface{}
+		return index.Match(tx.Session(&gorm.Session{NewDB: true}), users, []string{"ann", "lee"}).Find(&rows)
+	})
+	for _, want := range []string{
+		"-bm25(`users_search`) AS search_rank",
+		"highlight(`users_search`, 0, \"" + markStart + "\", \"" + markEnd + "\") AS search_highlight_0",
+		"JOIN `users` ON `users`.`id` = `users_search`.rowid",
+		"WHERE `users_search` MATCH " + `"\"ann\"* \"lee\"*"`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("expected %s in %s", want, got)
+		}
+	}
+}
+
+// recorder is a gorm logger keeping the statements run.
+type recorder struct {
+	gormLogger.Interface
+	statements *[]string
+}
+
+func (r recorder) LogMode(gormLogger.LogLevel) gormLogger.Interface {
+	return r
+}
+
+func (r recorder) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	sql, _ := fc()
+	*r.statements = append(*r.statements, sql)
+}
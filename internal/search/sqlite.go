@@ -0,0 +1,125 @@
+package search
+
+import (
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+func init() {
+	Register("sqlite", &sqliteIndex{module: sqliteModule})
+}
+
+var _ Index = (*sqliteIndex)(nil)
+
+// sqliteIndex keeps the columns in an FTS virtual table named after the
+// table, the rowid of an entry being the key of its row.
+type sqliteIndex struct {
+	module string
+}
+
+func (ix *sqliteIndex) name(t Table) string {
+	return t.Name + "_search"
+}
+
+func (ix *sqliteIndex) Migrate(tx *gorm.DB, t Table) error {
+	name := ix.name(t)
+	var existing string
+	err := tx.Raw("SELECT sql FROM sqlite_master WHERE type = 'table' AND name = ?", name).Scan(&existing).Error
+	if err != nil {
+		return err
+	}
+	// built with the other module
+	if existing != "" && !strings.Contains(strings.ToLower(existing), "using "+ix.module) {
+		if err = tx.Exec(fmt.Sprintf("DROP TABLE %s", tx.Statement.Quote(name))).Error; err != nil {
+			return err
+		}
+		existing = ""
+	}
+
+	if existing == "" {
+		columns := quoteAll(tx, t.Columns)
+		tokenize := `tokenize = 'unicode61 remove_diacritics 2'`
+		if ix.module != "fts5" {
+			tokenize = `tokenize=unicode61 "remove_diacritics=2"`
+		}
+		err = tx.Exec(fmt.Sprintf("CREATE VIRTUAL TABLE %s USING %s(%s, %s)",
+			tx.Statement.Quote(name), ix.module, strings.Join(columns, ", "), tokenize)).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Exec(fmt.Sprintf("INSERT INTO %s(rowid, %s) SELECT %s, %s FROM %s WHERE %s NOT IN (SELECT rowid FROM %s)",
+		tx.Statement.Quote(name), strings.Join(quoteAll(tx, t.Columns), ", "),
+		tx.Statement.Quote(t.Key), strings.Join(quoteAll(tx, t.Columns), ", "), tx.Statement.Quote(t.Name),
+		tx.Statement.Quote(t.Key), tx.Statement.Quote(name))).Error
+}
+
+func (ix *sqliteIndex) Reindex(tx *gorm.DB, t Table, ids []interface{}) error {
+	name := tx.Statement.Quote(ix.name(t))
+	if err := tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE rowid IN ?", name), ids).Error; err != nil {
+		return err
+	}
+	columns := strings.Join(quoteAll(tx, t.Columns), ", ")
+	return tx.Exec(fmt.Sprintf("INSERT INTO %s(rowid, %s) SELECT %s, %s FROM %s WHERE %s IN ?",
+		name, columns, tx.Statement.Quote(t.Key), columns, tx.Statement.Quote(t.Name), tx.Statement.Quote(t.Key)), ids).Error
+}
+
+func (ix *sqliteIndex) Match(tx *gorm.DB, t Table, terms []string) *gorm.DB {
+	name := tx.Statement.Quote(ix.name(t))
+	table := tx.Statement.Quote(t.Name)
+
+	selects := []string{fmt.Sprintf("%s.%s AS search_id", table, tx.Statement.Quote(t.Key))}
+	var (
+		args  []interface{}
+		match []string
+	)
+	if ix.module == "fts5" {
+		// bm25 is lower for the better matches
+		selects = append(selects, fmt.Sprintf("-bm25(%s) AS search_rank", name))
+		for i := range t.Columns {
+			selects = append(selects, fmt.Sprintf("highlight(%s, %d, ?, ?) AS search_highlight_%d", name, i, i))
+			args = append(args, markStart, markEnd)
+		}
+		for _, term := range terms {
+			match = append(match, `"`+term+`"*`)
+		}
+	} else {
+		// offsets lists 4 integers per match: the matches per character of
+		// the indexed text, so the shorter the text the better the match
+		lengths := make([]string, len(t.Columns))
+		for i, col := range t.Columns {
+			lengths[i] = fmt.Sprintf("length(%s.%s)", name, tx.Statement.Quote(col))
+		}
+		selects = append(selects, fmt.Sprintf(
+			"(length(offsets(%s)) - length(replace(offsets(%s), ' ', '')) + 1) / 4.0 / (1 + %s) AS search_rank",
+			name, name, strings.Join(lengths, " + ")))
+		for i := range t.Columns {
+			// the whole column as long as it has up to 64 tokens
+			selects = append(selects, fmt.Sprintf("snippet(%s, ?, ?, '...', %d, 64) AS search_highlight_%d", name, i, i))
+			args = append(args, markStart, markEnd)
+		}
+		for _, term := range terms {
+			match = append(match, `"`+term+`*"`)
+		}
+	}
+
+	return tx.Table(ix.name(t)).
+		Select(strings.Join(selects, ", "), args...).
+		Joins(fmt.Sprintf("JOIN %s ON %s.%s = %s.rowid", table, table, tx.Statement.Quote(t.Key), name)).
+		Where(fmt.Sprintf("%s MATCH ?", name), strings.Join(match, " "))
+}
+
+func (ix *sqliteIndex) Highlights() bool {
+	return true
+}
+
+func quoteAll(tx *gorm.DB, names []string) []string {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = tx.Statement.Quote(name)
+	}
+	return quoted
+}
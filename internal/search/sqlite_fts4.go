@@ -0,0 +1,10 @@
+//go:build !sqlite_fts5
+
+package search
+
+// sqliteModule is the FTS module of the sqlite indexes. FTS5, which ranks
+// the matches with bm25, needs the sqlite_fts5 build tag of
+// github.com/mattn/go-sqlite3 that the Makefile sets. Builds without it fall
+// back to FTS4, which has no ranking function: the matches are ranked by
+// their number per character of the indexed text.
+const sqliteModule = "fts4"
@@ -0,0 +1,6 @@
+//go:build sqlite_fts5
+
+package search
+
+// sqliteModule is the FTS module of the sqlite indexes.
+const sqliteModule = "fts5"
@@ -6,6 +6,7 @@ import (
 	swaggerfiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
 	"go-server-template/internal/conf"
+	"go-server-template/internal/db"
 	"net/http"
 	"time"
 )
@@ -119,16 +120,30 @@ func NewMux(options ...Option) (mux *gin.Engine, err error) {
 	// health check
 	mux.GET("/health", func(c *gin.Context) {
 		resp := &struct {
-			Timestamp   time.Time `json:"timestamp"`
-			Environment string    `json:"environment"`
-			Host        string    `json:"host"`
-			Status      string    `json:"status"`
+			Timestamp   time.Time     `json:"timestamp"`
+			Environment string        `json:"environment"`
+			Host        string        `json:"host"`
+			Status      string        `json:"status"`
+			Database    *db.PoolStats `json:"database,omitempty"`
 		}{
 			Timestamp:   time.Now(),
 			Environment: string(conf.Conf.Env),
 			Host:        "",
 			Status:      "ok",
 		}
+		if !db.Ready() {
+			resp.Status = "starting"
+			c.JSON(http.StatusServiceUnavailable, resp)
+			return
+		}
+		if stats, err := db.Stats(); err == nil {
+			resp.Database = stats
+			if stats.Saturated {
+				resp.Status = "degraded"
+			}
+		} else {
+			resp.Status = "unavailable"
+		}
 		c.JSON(http.StatusOK, resp)
 	})
 	return
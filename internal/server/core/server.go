@@ -6,46 +6,49 @@ import (
 	"github.com/gin-gonic/gin"
 	_ "go-server-template/docs"
 	"go-server-template/internal/conf"
+	"go-server-template/internal/db"
+	"go-server-template/internal/event"
+	"go-server-template/internal/job"
+	"go-server-template/internal/schedule"
 	"go-server-template/internal/server/router"
 	"go-server-template/pkg/logger"
 	"go-server-template/pkg/middleware"
+	"go-server-template/pkg/trace"
 	"golang.org/x/sync/errgroup"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
 	"regexp"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 )
 
-func RunServer() {
+// RunServer serves /health right away and the api once dbReady yields nil,
+// until it yields an error or the process is signalled.
+func RunServer(dbReady <-chan error) {
 	logOut := logger.GetLogger().Writer()
-	mux, err := NewMux(
+	starting, err := NewMux(
 		WithDisablePProf(),
+		WithDisableSwagger(),
 		WithDisablePrometheus(),
 	)
-
 	if err != nil {
 		panic(err)
 	}
+	starting.NoRoute(func(c *gin.Context) {
+		c.String(http.StatusServiceUnavailable, "The server is starting.")
+	})
 
-	mws := middleware.New().
-		Add("recovery", gin.RecoveryWithWriter(logOut)).
-		Add("logger", middleware.LoggerWithConfig(middleware.LoggerConfig{
-			// Filter do not add a logger for URLs that contain prefixes such as /debug/, /metrics/, /swagger/, /health
-			Filter: func(ctx *gin.Context) bool {
-				re, _ := regexp.Compile("^/debug/|^/metrics/|^/swagger/|^/health")
-				return re.MatchString(ctx.Request.URL.Path)
-			},
-		})).All()
-
-	router.Load(mux, mws...)
+	handler := new(swapHandler)
+	handler.Store(starting)
 
 	var g errgroup.Group
 	httpServer := &http.Server{
 		Addr:    fmt.Sprintf("%s:%d", "localhost", conf.Conf.Port),
-		Handler: mux,
+		Handler: handler,
 	}
 
 	g.Go(func() error {
@@ -56,6 +59,11 @@ func RunServer() {
 		serverApiWait <- g.Wait()
 	}()
 
+	// background workers using the database, stopped before it is closed
+	watchCtx, stopWatch := context.WithCancel(context.Background())
+	defer stopWatch()
+	var workers sync.WaitGroup
+
 	// Wait for interrupt signal to gracefully shutdown the server with
 	// a timeout of 1 second.
 	quit := make(chan os.Signal, 1)
@@ -64,13 +72,70 @@ func RunServer() {
 	// kill -9 is syscall. SIGKILL but can"t be catch, so don't need add it
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 
-	select {
-	case err := <-serverApiWait:
-		if err != nil {
-			logger.GetLogger().Warnf("Shutting down due to ServerApi error: %s", err.Error())
+wait:
+	for {
+		select {
+		case err := <-dbReady:
+			if err != nil {
+				logger.GetLogger().Errorf("Shutting down due to database error: %s", err.Error())
+				break wait
+			}
+			dbReady = nil
+
+			mux, err := NewMux(
+				WithDisablePProf(),
+				WithDisablePrometheus(),
+			)
+			if err != nil {
+				panic(err)
+			}
+
+			m := middleware.New().
+				Add("recovery", gin.RecoveryWithWriter(logOut)).
+				Add("logger", middleware.LoggerWithConfig(middleware.LoggerConfig{
+					// Filter do not add a logger for URLs that contain prefixes such as /debug/, /metrics/, /swagger/, /health
+					Filter: func(ctx *gin.Context) bool {
+						re, _ := regexp.Compile("^/debug/|^/metrics/|^/swagger/|^/health")
+						return re.MatchString(ctx.Request.URL.Path)
+					},
+				}))
+			if conf.Conf.QueryBudget.Enable {
+				m.Add("query_budget", middleware.QueryBudget(queryBudgetConfig(conf.Conf)))
+			}
+			mws := m.All()
+
+			router.Load(mux, mws...)
+			handler.Store(mux)
+
+			go db.WatchPool(watchCtx, time.Duration(conf.Conf.Database.Pool.WatchInterval)*time.Second)
+			workers.Add(1)
+			go func() {
+				defer workers.Done()
+				event.NewRelay(conf.Conf.Outbox).Run(watchCtx)
+			}()
+			if conf.Conf.Jobs.Enable {
+				workers.Add(1)
+				go func() {
+					defer workers.Done()
+					job.NewWorker(conf.Conf.Jobs).Run(watchCtx)
+				}()
+			}
+			if conf.Conf.Scheduler.Enable {
+				workers.Add(1)
+				go func() {
+					defer workers.Done()
+					schedule.NewScheduler(conf.Conf.Scheduler).Run(watchCtx)
+				}()
+			}
+			logger.GetLogger().Infof("Server is ready")
+		case err := <-serverApiWait:
+			if err != nil {
+				logger.GetLogger().Warnf("Shutting down due to ServerApi error: %s", err.Error())
+			}
+			break wait
+		case <-quit:
+			break wait
 		}
-	case <-quit:
-		break
 	}
 
 	logger.GetLogger().Infof("Shutting down server...")
@@ -82,7 +147,53 @@ func RunServer() {
 	if err == nil {
 		log.Println("Server gracefully stopped")
 	} else {
-		log.Fatalf("Failed to shutdown http server: %v", err)
+		// the requests still running are cut short, the workers are drained
+		// and the database closed all the same
+		logger.GetLogger().Errorf("Failed to shutdown http server: %s", err.Error())
+	}
+
+	// close the database only after in-flight requests are done
+	stopWatch()
+	workers.Wait()
+	if err = db.Close(); err != nil {
+		logger.GetLogger().Errorf("Failed to close database: %s", err.Error())
+	} else {
+		log.Println("Database closed")
 	}
 	return
 }
+
+func queryBudgetConfig(config *conf.Config) middleware.QueryBudgetConfig {
+	budget := func(repeat, queries int, duration int64) trace.Budget {
+		return trace.Budget{
+			RepeatThreshold: repeat,
+			MaxQueries:      queries,
+			MaxDuration:     time.Duration(duration) * time.Millisecond,
+		}
+	}
+
+	qb := config.QueryBudget
+	routes := make(map[string]trace.Budget, len(qb.Routes))
+	for _, r := range qb.Routes {
+		routes[r.Route] = budget(r.RepeatThreshold, r.MaxQueries, r.MaxDuration)
+	}
+	return middleware.QueryBudgetConfig{
+		Default:      budget(qb.RepeatThreshold, qb.MaxQueries, qb.MaxDuration),
+		Routes:       routes,
+		ExposeHeader: config.Env == conf.Dev,
+	}
+}
+
+// swapHandler serves the handler stored last, so the api can replace the
+// startup handler without restarting the listener.
+type swapHandler struct {
+	h atomic.Pointer[gin.Engine]
+}
+
+func (s *swapHandler) Store(e *gin.Engine) {
+	s.h.Store(e)
+}
+
+func (s *swapHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.h.Load().ServeHTTP(w, r)
+}
@@ -13,4 +13,10 @@ var (
 	ErrParams               = NewSvrError(10001, "params error", http.StatusBadRequest)
 	ErrInternal             = NewSvrError(10002, "internal error", http.StatusInternalServerError)
 	ErrInvalidAuthorization = NewSvrError(10003, "empty or invalid authorization", http.StatusUnauthorized)
+	ErrInvalidSignature     = NewSvrError(10004, "invalid or expired signature", http.StatusForbidden)
+	ErrConflict             = NewSvrError(10005, "resource was modified by another request", http.StatusConflict)
+	ErrPreconditionRequired = NewSvrError(10006, "If-Match header is required", http.StatusPreconditionRequired)
+	ErrLocked               = NewSvrError(10007, "resource is locked by another request", http.StatusConflict)
+	ErrFeatureDisabled      = NewSvrError(10008, "feature is not available", http.StatusNotFound)
+	ErrForbidden            = NewSvrError(10009, "permission denied", http.StatusForbidden)
 )
@@ -51,7 +51,7 @@ func (e *svrError) Detail() []string {
 
 func (e *svrError) WithDetail(format string, a ...interface{}) SvrError {
 	c := *e
-	c.detail = append(c.detail, fmt.Sprintf(format, a))
+	c.detail = append(c.detail, fmt.Sprintf(format, a...))
 	return &c
 }
 
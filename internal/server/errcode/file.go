@@ -0,0 +1,13 @@
+package errcode
+
+import (
+	"net/http"
+)
+
+var (
+	ErrFileNotFound      = NewSvrError(200201, "file not found", http.StatusNotFound)
+	ErrFileTooLarge      = NewSvrError(200202, "file too large", http.StatusRequestEntityTooLarge)
+	ErrFileType          = NewSvrError(200203, "file type not allowed", http.StatusUnsupportedMediaType)
+	ErrFileQuotaExceeded = NewSvrError(200204, "file quota exceeded", http.StatusForbidden)
+	ErrFileForbidden     = NewSvrError(200205, "file access forbidden", http.StatusForbidden)
+)
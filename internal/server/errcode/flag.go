@@ -0,0 +1,10 @@
+package errcode
+
+import (
+	"net/http"
+)
+
+var (
+	ErrFlagNotFound = NewSvrError(200601, "flag not found", http.StatusNotFound)
+	ErrFlagInvalid  = NewSvrError(200602, "invalid flag", http.StatusBadRequest)
+)
@@ -0,0 +1,10 @@
+package errcode
+
+import (
+	"net/http"
+)
+
+var (
+	ErrJobNotFound = NewSvrError(200401, "job not found", http.StatusNotFound)
+	ErrJobState    = NewSvrError(200402, "job state does not allow this change", http.StatusConflict)
+)
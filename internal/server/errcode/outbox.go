@@ -0,0 +1,9 @@
+package errcode
+
+import (
+	"net/http"
+)
+
+var (
+	ErrEventNotFound = NewSvrError(200301, "event not found", http.StatusNotFound)
+)
@@ -0,0 +1,10 @@
+package errcode
+
+import (
+	"net/http"
+)
+
+var (
+	ErrSettingNotFound = NewSvrError(200501, "setting not found", http.StatusNotFound)
+	ErrSettingInvalid  = NewSvrError(200502, "invalid setting value", http.StatusBadRequest)
+)
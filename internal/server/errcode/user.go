@@ -5,5 +5,7 @@ import (
 )
 
 var (
-	ErrUserNotFound = NewSvrError(200101, "user not found", http.StatusNotFound)
+	ErrUserNotFound     = NewSvrError(200101, "user not found", http.StatusNotFound)
+	ErrUsernameTaken    = NewSvrError(200102, "username already taken", http.StatusConflict)
+	ErrPasswordMismatch = NewSvrError(200103, "current password does not match", http.StatusForbidden)
 )
@@ -0,0 +1,117 @@
+package audit
+
+import (
+	"github.com/gin-gonic/gin"
+	"go-server-template/internal/db"
+	"go-server-template/internal/model"
+	"go-server-template/internal/server/errcode"
+	"go-server-template/internal/server/response"
+	"go-server-template/internal/service"
+	"go-server-template/pkg/ulid"
+	"time"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+var _ Handler = (*handler)(nil)
+
+type Handler interface {
+	ListAuditLogs(c *gin.Context)
+
+	i()
+}
+
+type handler struct {
+	auditService service.AuditService
+}
+
+func New(s service.Service) Handler {
+	return &handler{
+		auditService: s.Audit(),
+	}
+}
+
+type listRequest struct {
+	ActorID   string    `form:"actor_id"`
+	RequestID string    `form:"request_id"`
+	Action    string    `form:"action" binding:"omitempty,oneof=create update delete erase"`
+	Table     string    `form:"table"`
+	RecordID  string    `form:"record_id"`
+	From      time.Time `form:"from" time_format:"2006-01-02T15:04:05Z07:00"`
+	To        time.Time `form:"to" time_format:"2006-01-02T15:04:05Z07:00"`
+	Page      int       `form:"page" binding:"omitempty,min=1"`
+	PageSize  int       `form:"page_size" binding:"omitempty,min=1"`
+}
+
+type listResponse struct {
+	List  []*model.AuditLog `json:"list"`
+	Total int64             `json:"total"`
+}
+
+// ListAuditLogs 查询审计日志
+// @Summary 查询审计日志
+// @Description 按操作人、表、主键、动作和时间范围过滤审计日志
+// @Tags API.admin
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Param actor_id query string false "操作人ID"
+// @Param request_id query string false "请求ID"
+// @Param action query string false "动作" Enums(create, update, delete, erase)
+// @Param table query string false "表名"
+// @Param record_id query string false "记录ID, 有公开ID的表需同时指定 table"
+// @Param from query string false "开始时间 RFC3339"
+// @Param to query string false "结束时间 RFC3339"
+// @Param page query int false "页码"
+// @Param page_size query int false "每页数量"
+// @Success 200 {object} listResponse
+// @Failure 400
+// @Router /api/admin/audit [get]
+func (h *handler) ListAuditLogs(c *gin.Context) {
+	var req listRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		response.Error(c, errcode.ErrParams.WithError(err))
+		return
+	}
+
+	if req.ActorID != "" {
+		actorID, err := ulid.Parse(req.ActorID)
+		if err != nil {
+			response.Error(c, errcode.ErrParams.WithDetail("invalid actor_id: %q", req.ActorID))
+			return
+		}
+		req.ActorID = actorID
+	}
+
+	if req.Page == 0 {
+		req.Page = 1
+	}
+	if req.PageSize == 0 {
+		req.PageSize = defaultPageSize
+	}
+	if req.PageSize > maxPageSize {
+		req.PageSize = maxPageSize
+	}
+
+	logs, total, err := h.auditService.ListAuditLogs(c, db.AuditFilter{
+		Actor:     req.ActorID,
+		RequestID: req.RequestID,
+		Action:    req.Action,
+		Table:     req.Table,
+		Record:    req.RecordID,
+		From:      req.From,
+		To:        req.To,
+		Offset:    (req.Page - 1) * req.PageSize,
+		Limit:     req.PageSize,
+	})
+	if err != nil {
+		response.Error(c, errcode.ErrInternal.WithError(err))
+		return
+	}
+
+	response.Success(c, &listResponse{List: logs, Total: total})
+}
+
+func (h *handler) i() {}
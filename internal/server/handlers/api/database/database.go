@@ -0,0 +1,45 @@
+package database
+
+import (
+	"github.com/gin-gonic/gin"
+	"go-server-template/internal/server/errcode"
+	"go-server-template/internal/server/response"
+	"go-server-template/internal/service"
+)
+
+var _ Handler = (*handler)(nil)
+
+type Handler interface {
+	Stats(c *gin.Context)
+
+	i()
+}
+
+type handler struct {
+	databaseService service.DatabaseService
+}
+
+func New(s service.Service) Handler {
+	return &handler{
+		databaseService: s.Database(),
+	}
+}
+
+// Stats 数据库连接池状态
+// @Summary 数据库连接池状态
+// @Description 返回连接池的使用中、空闲、等待次数和等待时长等统计
+// @Tags API.admin
+// @Produce json
+// @Success 200 {object} db.PoolStats
+// @Failure 500
+// @Router /api/admin/db/stats [get]
+func (h *handler) Stats(c *gin.Context) {
+	stats, err := h.databaseService.Stats(c)
+	if err != nil {
+		response.Error(c, errcode.ErrInternal.WithError(err))
+		return
+	}
+	response.Success(c, stats)
+}
+
+func (h *handler) i() {}
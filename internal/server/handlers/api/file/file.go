@@ -0,0 +1,243 @@
+package file
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"go-server-template/internal/conf"
+	"go-server-template/internal/model"
+	"go-server-template/internal/server/errcode"
+	"go-server-template/internal/server/handlers/bind"
+	"go-server-template/internal/server/response"
+	"go-server-template/internal/service"
+	"go-server-template/pkg/context"
+	"go-server-template/pkg/storage"
+	"gorm.io/gorm"
+	"mime/multipart"
+	"net/http"
+	"time"
+)
+
+// multipartOverhead leaves room for the multipart envelope around the file.
+const multipartOverhead = 1 << 20
+
+var _ Handler = (*handler)(nil)
+
+type Handler interface {
+	Upload(c *gin.Context)
+
+	UploadAvatar(c *gin.Context)
+
+	GetURL(c *gin.Context)
+
+	Download(c *gin.Context)
+
+	Delete(c *gin.Context)
+
+	i()
+}
+
+type handler struct {
+	fileService service.FileService
+}
+
+func New(s service.Service) Handler {
+	return &handler{
+		fileService: s.File(),
+	}
+}
+
+type urlResponse struct {
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Upload 上传文件
+// @Summary 上传文件
+// @Description 上传文件, 类型按内容识别, 受大小和用户容量限制
+// @Tags API.file
+// @Accept multipart/form-data
+// @Produce json
+// @Param file formData file true "文件"
+// @Success 200 {object} model.File
+// @Failure 400
+// @Failure 413
+// @Failure 415
+// @Router /api/files [post]
+func (h *handler) Upload(c *gin.Context) {
+	h.upload(c, func(name string, f multipartFile) (*model.File, error) {
+		return h.fileService.Upload(c, uint(context.GetUserID(c)), model.FileKindAttachment, name, f, f.size)
+	})
+}
+
+// UploadAvatar 上传头像
+// @Summary 上传头像
+// @Description 上传图片并设为当前用户的头像
+// @Tags API.me
+// @Accept multipart/form-data
+// @Produce json
+// @Param file formData file true "头像图片"
+// @Success 200 {object} model.File
+// @Failure 400
+// @Failure 413
+// @Failure 415
+// @Router /api/me/avatar [post]
+func (h *handler) UploadAvatar(c *gin.Context) {
+	h.upload(c, func(name string, f multipartFile) (*model.File, error) {
+		return h.fileService.SetAvatar(c, uint(context.GetUserID(c)), name, f, f.size)
+	})
+}
+
+// GetURL 获取下载链接
+// @Summary 获取下载链接
+// @Description 获取有时效的签名下载链接, 仅限文件所有者, 头像对所有登录用户可见
+// @Tags API.file
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Param id path string true "文件ID"
+// @Success 200 {object} urlResponse
+// @Failure 403
+// @Failure 404
+// @Router /api/files/{id}/url [get]
+func (h *handler) GetURL(c *gin.Context) {
+	file, svrErr := h.getFile(c)
+	if svrErr != nil {
+		response.Error(c, svrErr)
+		return
+	}
+
+	if file.Kind != model.FileKindAvatar && file.OwnerID != uint(context.GetUserID(c)) {
+		response.Error(c, errcode.ErrFileForbidden)
+		return
+	}
+
+	url, expires := h.fileService.SignURL(file)
+	response.Success(c, &urlResponse{URL: url, ExpiresAt: expires})
+}
+
+// Download 下载文件
+// @Summary 下载文件
+// @Description 通过签名链接下载文件
+// @Tags API.file
+// @Produce octet-stream
+// @Param id path string true "文件ID"
+// @Param expires query int true "过期时间"
+// @Param signature query string true "签名"
+// @Success 200
+// @Failure 403
+// @Failure 404
+// @Router /api/files/{id}/download [get]
+func (h *handler) Download(c *gin.Context) {
+	file, svrErr := h.getFile(c)
+	if svrErr != nil {
+		response.Error(c, svrErr)
+		return
+	}
+
+	r, err := h.fileService.Open(c, file)
+	if err != nil {
+		response.Error(c, fileError(err))
+		return
+	}
+	defer r.Close()
+
+	c.DataFromReader(http.StatusOK, file.Size, file.ContentType, r, map[string]string{
+		"Content-Disposition":    fmt.Sprintf("inline; filename=%q", file.Name),
+		"X-Content-Type-Options": "nosniff",
+	})
+}
+
+// Delete 删除文件
+// @Summary 删除文件
+// @Description 删除自己上传的文件
+// @Tags API.file
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Param id path string true "文件ID"
+// @Success 200
+// @Failure 403
+// @Failure 404
+// @Router /api/files/{id} [delete]
+func (h *handler) Delete(c *gin.Context) {
+	file, svrErr := h.getFile(c)
+	if svrErr != nil {
+		response.Error(c, svrErr)
+		return
+	}
+
+	if file.OwnerID != uint(context.GetUserID(c)) {
+		response.Error(c, errcode.ErrFileForbidden)
+		return
+	}
+
+	if err := h.fileService.DeleteFile(c, file); err != nil {
+		response.Error(c, fileError(err))
+		return
+	}
+
+	response.Success(c, nil)
+}
+
+func (h *handler) i() {}
+
+type multipartFile struct {
+	multipart.File
+	size int64
+}
+
+func (h *handler) upload(c *gin.Context, store func(name string, f multipartFile) (*model.File, error)) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, conf.Conf.Storage.MaxSize+multipartOverhead)
+
+	header, err := c.FormFile("file")
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			response.Error(c, errcode.ErrFileTooLarge)
+			return
+		}
+		response.Error(c, errcode.ErrParams.WithError(err))
+		return
+	}
+
+	f, err := header.Open()
+	if err != nil {
+		response.Error(c, errcode.ErrInternal.WithError(err))
+		return
+	}
+	defer f.Close()
+
+	file, err := store(header.Filename, multipartFile{f, header.Size})
+	if err != nil {
+		response.Error(c, fileError(err))
+		return
+	}
+
+	response.Success(c, file)
+}
+
+func (h *handler) getFile(c *gin.Context) (*model.File, errcode.SvrError) {
+	id, svrErr := bind.PublicID(c, "id")
+	if svrErr != nil {
+		return nil, svrErr
+	}
+
+	file, err := h.fileService.GetFile(c, id)
+	if err != nil {
+		return nil, fileError(err)
+	}
+	return file, nil
+}
+
+func fileError(err error) errcode.SvrError {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound), errors.Is(err, storage.ErrNotFound):
+		return errcode.ErrFileNotFound.WithError(err)
+	case errors.Is(err, service.ErrFileTooLarge):
+		return errcode.ErrFileTooLarge.WithError(err)
+	case errors.Is(err, service.ErrFileType):
+		return errcode.ErrFileType.WithError(err)
+	case errors.Is(err, service.ErrFileQuotaExceeded):
+		return errcode.ErrFileQuotaExceeded.WithError(err)
+	}
+	return errcode.ErrInternal.WithError(err)
+}
@@ -0,0 +1,121 @@
+package flag
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"go-server-template/internal/flags"
+	"go-server-template/internal/server/errcode"
+	"go-server-template/internal/server/response"
+	"go-server-template/internal/service"
+	"gorm.io/gorm"
+)
+
+var _ Handler = (*handler)(nil)
+
+type Handler interface {
+	ListFlags(c *gin.Context)
+
+	SaveFlag(c *gin.Context)
+
+	DeleteFlag(c *gin.Context)
+
+	MyFlags(c *gin.Context)
+
+	i()
+}
+
+type handler struct {
+	flagService service.FlagService
+}
+
+func New(s service.Service) Handler {
+	return &handler{
+		flagService: s.Flag(),
+	}
+}
+
+// ListFlags 查询功能开关
+// @Summary 查询功能开关
+// @Description 查询配置文件和数据库中的所有功能开关, 数据库中的开关覆盖配置文件中的同名开关
+// @Tags API.admin
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Success 200 {array} flags.Definition
+// @Router /api/admin/flags [get]
+func (h *handler) ListFlags(c *gin.Context) {
+	list, err := h.flagService.List(c)
+	if err != nil {
+		response.Error(c, errcode.ErrInternal.WithError(err))
+		return
+	}
+
+	response.Success(c, list)
+}
+
+// SaveFlag 保存功能开关
+// @Summary 保存功能开关
+// @Description 在数据库中创建或替换功能开关, 覆盖配置文件中的同名开关. 没有 variants 的开关为布尔开关, 取值为 on 和 off; 规则按顺序匹配, 灰度按用户ID哈希分桶, 比例之和须为 100
+// @Tags API.admin
+// @Accept json
+// @Produce json
+// @Param key path string true "开关名"
+// @Param body body conf.Flag true "开关定义"
+// @Success 200 {object} conf.Flag
+// @Failure 400
+// @Router /api/admin/flags/{key} [put]
+func (h *handler) SaveFlag(c *gin.Context) {
+	var f flags.Flag
+	if err := c.ShouldBindJSON(&f); err != nil {
+		response.Error(c, errcode.ErrParams.WithError(err))
+		return
+	}
+	f.Key = c.Param("key")
+
+	if err := h.flagService.Save(c, &f); err != nil {
+		if errors.Is(err, flags.ErrInvalid) {
+			response.Error(c, errcode.ErrFlagInvalid.WithError(err))
+			return
+		}
+		response.Error(c, errcode.ErrInternal.WithError(err))
+		return
+	}
+
+	response.Success(c, &f)
+}
+
+// DeleteFlag 删除功能开关
+// @Summary 删除功能开关
+// @Description 删除数据库中的功能开关, 配置文件中的同名开关重新生效
+// @Tags API.admin
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Param key path string true "开关名"
+// @Success 200
+// @Failure 404
+// @Router /api/admin/flags/{key} [delete]
+func (h *handler) DeleteFlag(c *gin.Context) {
+	if err := h.flagService.Delete(c, c.Param("key")); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			response.Error(c, errcode.ErrFlagNotFound.WithError(err))
+			return
+		}
+		response.Error(c, errcode.ErrInternal.WithError(err))
+		return
+	}
+
+	response.Success(c, nil)
+}
+
+// MyFlags 获取当前用户的功能开关
+// @Summary 获取当前用户的功能开关
+// @Description 按当前用户的ID, 角色和租户计算所有功能开关, 供前端使用
+// @Tags API.me
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Success 200 {object} map[string]flags.Evaluation
+// @Router /api/me/flags [get]
+func (h *handler) MyFlags(c *gin.Context) {
+	response.Success(c, h.flagService.Evaluate(c))
+}
+
+func (h *handler) i() {}
@@ -0,0 +1,164 @@
+package job
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"go-server-template/internal/db"
+	"go-server-template/internal/model"
+	"go-server-template/internal/server/errcode"
+	"go-server-template/internal/server/handlers/bind"
+	"go-server-template/internal/server/response"
+	"go-server-template/internal/service"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+var _ Handler = (*handler)(nil)
+
+type Handler interface {
+	ListJobs(c *gin.Context)
+
+	RetryJob(c *gin.Context)
+
+	CancelJob(c *gin.Context)
+
+	i()
+}
+
+type handler struct {
+	jobService service.JobService
+}
+
+func New(s service.Service) Handler {
+	return &handler{
+		jobService: s.Job(),
+	}
+}
+
+type listRequest struct {
+	Status   string `form:"status" binding:"omitempty,oneof=pending running succeeded dead canceled"`
+	Name     string `form:"name"`
+	Page     int    `form:"page" binding:"omitempty,min=1"`
+	PageSize int    `form:"page_size" binding:"omitempty,min=1"`
+}
+
+type listResponse struct {
+	List  []*model.Job `json:"list"`
+	Total int64        `json:"total"`
+}
+
+// ListJobs 查询后台任务
+// @Summary 查询后台任务
+// @Description 按状态和任务名查询后台任务, 最新的在前
+// @Tags API.admin
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Param status query string false "状态" Enums(pending, running, succeeded, dead, canceled)
+// @Param name query string false "任务名"
+// @Param page query int false "页码"
+// @Param page_size query int false "每页数量"
+// @Success 200 {object} listResponse
+// @Failure 400
+// @Router /api/admin/jobs [get]
+func (h *handler) ListJobs(c *gin.Context) {
+	var req listRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		response.Error(c, errcode.ErrParams.WithError(err))
+		return
+	}
+
+	if req.Page == 0 {
+		req.Page = 1
+	}
+	if req.PageSize == 0 {
+		req.PageSize = defaultPageSize
+	}
+	if req.PageSize > maxPageSize {
+		req.PageSize = maxPageSize
+	}
+
+	jobs, total, err := h.jobService.ListJobs(c, db.JobFilter{
+		Status: req.Status,
+		Name:   req.Name,
+		Offset: (req.Page - 1) * req.PageSize,
+		Limit:  req.PageSize,
+	})
+	if err != nil {
+		response.Error(c, errcode.ErrInternal.WithError(err))
+		return
+	}
+
+	response.Success(c, &listResponse{List: jobs, Total: total})
+}
+
+// RetryJob 重试后台任务
+// @Summary 重试后台任务
+// @Description 将 dead 或已取消的任务重新置为 pending 并清零运行次数
+// @Tags API.admin
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Param id path string true "任务ID"
+// @Success 200 {object} model.Job
+// @Failure 400
+// @Failure 404
+// @Failure 409
+// @Router /api/admin/jobs/{id}/retry [post]
+func (h *handler) RetryJob(c *gin.Context) {
+	jobID, bindErr := bind.PublicID(c, "id")
+	if bindErr != nil {
+		response.Error(c, bindErr)
+		return
+	}
+
+	j, err := h.jobService.RetryJob(c, jobID)
+	if err != nil {
+		response.Error(c, jobError(err))
+		return
+	}
+
+	response.Success(c, j)
+}
+
+// CancelJob 取消后台任务
+// @Summary 取消后台任务
+// @Description 取消尚未运行的任务, 运行中的任务无法取消
+// @Tags API.admin
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Param id path string true "任务ID"
+// @Success 200 {object} model.Job
+// @Failure 400
+// @Failure 404
+// @Failure 409
+// @Router /api/admin/jobs/{id}/cancel [post]
+func (h *handler) CancelJob(c *gin.Context) {
+	jobID, bindErr := bind.PublicID(c, "id")
+	if bindErr != nil {
+		response.Error(c, bindErr)
+		return
+	}
+
+	j, err := h.jobService.CancelJob(c, jobID)
+	if err != nil {
+		response.Error(c, jobError(err))
+		return
+	}
+
+	response.Success(c, j)
+}
+
+func (h *handler) i() {}
+
+func jobError(err error) errcode.SvrError {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return errcode.ErrJobNotFound.WithError(err)
+	}
+	if errors.Is(err, db.ErrJobState) {
+		return errcode.ErrJobState.WithError(err)
+	}
+	return errcode.ErrInternal.WithError(err)
+}
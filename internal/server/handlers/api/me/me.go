@@ -0,0 +1,162 @@
+package me
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"go-server-template/internal/server/errcode"
+	"go-server-template/internal/server/response"
+	"go-server-template/internal/service"
+	"go-server-template/pkg/context"
+	"gorm.io/gorm"
+	"net/http"
+	"sort"
+)
+
+var _ Handler = (*handler)(nil)
+
+type Handler interface {
+	Export(c *gin.Context)
+
+	Erase(c *gin.Context)
+
+	ChangePassword(c *gin.Context)
+
+	i()
+}
+
+type handler struct {
+	privacyService service.PrivacyService
+	userService    service.UserService
+}
+
+func New(s service.Service) Handler {
+	return &handler{
+		privacyService: s.Privacy(),
+		userService:    s.User(),
+	}
+}
+
+type exportRequest struct {
+	Format string `form:"format" binding:"omitempty,oneof=json zip"`
+}
+
+// Export 导出个人数据
+// @Summary 导出个人数据
+// @Description 导出当前用户的全部数据, 默认 json, format=zip 时每个模块一个文件
+// @Tags API.me
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Produce application/zip
+// @Param format query string false "导出格式" Enums(json, zip)
+// @Success 200 {object} service.DataExport
+// @Failure 401
+// @Router /api/me/export [get]
+func (h *handler) Export(c *gin.Context) {
+	var req exportRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		response.Error(c, errcode.ErrParams.WithError(err))
+		return
+	}
+
+	export, err := h.privacyService.Export(c, uint(context.GetUserID(c)))
+	if err != nil {
+		response.Error(c, userError(err))
+		return
+	}
+
+	if req.Format != "zip" {
+		response.Success(c, export)
+		return
+	}
+
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="export-%s.zip"`, export.UserID))
+	c.Status(http.StatusOK)
+
+	names := make([]string, 0, len(export.Sections))
+	for name := range export.Sections {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	zw := zip.NewWriter(c.Writer)
+	for _, name := range names {
+		w, err := zw.Create(name + ".json")
+		if err != nil {
+			_ = c.Error(err)
+			return
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err = enc.Encode(export.Sections[name]); err != nil {
+			_ = c.Error(err)
+			return
+		}
+	}
+	_ = zw.Close()
+}
+
+// Erase 注销账号
+// @Summary 注销账号
+// @Description 匿名化当前用户的个人数据并删除账号, 审计记录保留并以化名引用
+// @Tags API.me
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Success 200
+// @Failure 401
+// @Router /api/me [delete]
+func (h *handler) Erase(c *gin.Context) {
+	if err := h.privacyService.Erase(c, uint(context.GetUserID(c))); err != nil {
+		response.Error(c, userError(err))
+		return
+	}
+
+	response.Success(c, nil)
+}
+
+type passwordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	Password        string `json:"password" binding:"required,min=8,max=72"`
+}
+
+// ChangePassword 修改密码
+// @Summary 修改密码
+// @Description 校验当前密码后修改当前用户的密码
+// @Tags API.me
+// @Accept json
+// @Produce json
+// @Param body body passwordRequest true "当前密码和新密码"
+// @Success 200
+// @Failure 400
+// @Failure 401
+// @Failure 403
+// @Router /api/me/password [put]
+func (h *handler) ChangePassword(c *gin.Context) {
+	var req passwordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, errcode.ErrParams.WithError(err))
+		return
+	}
+
+	if err := h.userService.ChangePassword(c, uint(context.GetUserID(c)), req.CurrentPassword, req.Password); err != nil {
+		response.Error(c, userError(err))
+		return
+	}
+
+	response.Success(c, nil)
+}
+
+func (h *handler) i() {}
+
+func userError(err error) errcode.SvrError {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return errcode.ErrUserNotFound.WithError(err)
+	}
+	if errors.Is(err, service.ErrPasswordMismatch) {
+		return errcode.ErrPasswordMismatch.WithError(err)
+	}
+	return errcode.ErrInternal.WithError(err)
+}
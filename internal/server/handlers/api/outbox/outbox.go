@@ -0,0 +1,127 @@
+package outbox
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"go-server-template/internal/db"
+	"go-server-template/internal/model"
+	"go-server-template/internal/server/errcode"
+	"go-server-template/internal/server/handlers/bind"
+	"go-server-template/internal/server/response"
+	"go-server-template/internal/service"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+var _ Handler = (*handler)(nil)
+
+type Handler interface {
+	ListEvents(c *gin.Context)
+
+	ReplayEvent(c *gin.Context)
+
+	i()
+}
+
+type handler struct {
+	outboxService service.OutboxService
+}
+
+func New(s service.Service) Handler {
+	return &handler{
+		outboxService: s.Outbox(),
+	}
+}
+
+type listRequest struct {
+	Status   string `form:"status" binding:"omitempty,oneof=pending delivered dead"`
+	Name     string `form:"name"`
+	Page     int    `form:"page" binding:"omitempty,min=1"`
+	PageSize int    `form:"page_size" binding:"omitempty,min=1"`
+}
+
+type listResponse struct {
+	List  []*model.OutboxEvent `json:"list"`
+	Total int64                `json:"total"`
+}
+
+// ListEvents 查询事件
+// @Summary 查询事件
+// @Description 按状态和事件名查询 outbox 中的领域事件, 最新的在前
+// @Tags API.admin
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Param status query string false "状态" Enums(pending, delivered, dead)
+// @Param name query string false "事件名"
+// @Param page query int false "页码"
+// @Param page_size query int false "每页数量"
+// @Success 200 {object} listResponse
+// @Failure 400
+// @Router /api/admin/outbox [get]
+func (h *handler) ListEvents(c *gin.Context) {
+	var req listRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		response.Error(c, errcode.ErrParams.WithError(err))
+		return
+	}
+
+	if req.Page == 0 {
+		req.Page = 1
+	}
+	if req.PageSize == 0 {
+		req.PageSize = defaultPageSize
+	}
+	if req.PageSize > maxPageSize {
+		req.PageSize = maxPageSize
+	}
+
+	events, total, err := h.outboxService.ListEvents(c, db.OutboxFilter{
+		Status: req.Status,
+		Name:   req.Name,
+		Offset: (req.Page - 1) * req.PageSize,
+		Limit:  req.PageSize,
+	})
+	if err != nil {
+		response.Error(c, errcode.ErrInternal.WithError(err))
+		return
+	}
+
+	response.Success(c, &listResponse{List: events, Total: total})
+}
+
+// ReplayEvent 重新投递事件
+// @Summary 重新投递事件
+// @Description 将事件重新置为 pending 并清零投递次数, 通常用于 dead 事件
+// @Tags API.admin
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Param id path string true "事件ID"
+// @Success 200 {object} model.OutboxEvent
+// @Failure 400
+// @Failure 404
+// @Router /api/admin/outbox/{id}/replay [post]
+func (h *handler) ReplayEvent(c *gin.Context) {
+	eventID, bindErr := bind.PublicID(c, "id")
+	if bindErr != nil {
+		response.Error(c, bindErr)
+		return
+	}
+
+	e, err := h.outboxService.ReplayEvent(c, eventID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			response.Error(c, errcode.ErrEventNotFound.WithError(err))
+			return
+		}
+		response.Error(c, errcode.ErrInternal.WithError(err))
+		return
+	}
+
+	response.Success(c, e)
+}
+
+func (h *handler) i() {}
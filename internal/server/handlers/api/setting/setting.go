@@ -0,0 +1,248 @@
+package setting
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"go-server-template/internal/db"
+	"go-server-template/internal/model"
+	"go-server-template/internal/server/errcode"
+	"go-server-template/internal/server/handlers/bind"
+	"go-server-template/internal/server/response"
+	"go-server-template/internal/service"
+	"go-server-template/internal/setting"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+var _ Handler = (*handler)(nil)
+
+type Handler interface {
+	ListSettings(c *gin.Context)
+
+	GetSetting(c *gin.Context)
+
+	SetSetting(c *gin.Context)
+
+	ResetSetting(c *gin.Context)
+
+	ListHistory(c *gin.Context)
+
+	PublicSettings(c *gin.Context)
+
+	i()
+}
+
+type handler struct {
+	settingService service.SettingService
+}
+
+func New(s service.Service) Handler {
+	return &handler{
+		settingService: s.Setting(),
+	}
+}
+
+// ListSettings 查询设置
+// @Summary 查询设置
+// @Description 查询所有运行时设置及其类型, 默认值和当前值
+// @Tags API.admin
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Success 200 {array} setting.Entry
+// @Router /api/admin/settings [get]
+func (h *handler) ListSettings(c *gin.Context) {
+	entries, err := h.settingService.List(c)
+	if err != nil {
+		response.Error(c, errcode.ErrInternal.WithError(err))
+		return
+	}
+
+	response.Success(c, entries)
+}
+
+// GetSetting 获取设置
+// @Summary 获取设置
+// @Description 获取一个运行时设置, 已保存的设置返回 ETag
+// @Tags API.admin
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Param key path string true "设置项"
+// @Success 200 {object} setting.Entry
+// @Header 200 {string} ETag "设置版本"
+// @Failure 404
+// @Router /api/admin/settings/{key} [get]
+func (h *handler) GetSetting(c *gin.Context) {
+	entry, err := h.settingService.Get(c, c.Param("key"))
+	if err != nil {
+		response.Error(c, settingError(err))
+		return
+	}
+
+	if entry.Stored {
+		response.ETag(c, entry.Version)
+	}
+	response.Success(c, entry)
+}
+
+type setRequest struct {
+	Value json.RawMessage `json:"value" binding:"required" swaggertype:"object"`
+}
+
+// SetSetting 修改设置
+// @Summary 修改设置
+// @Description 修改运行时设置, 值需符合设置的类型. 需在 If-Match 中带上获取设置时返回的 ETag, 尚未保存的设置使用 "*", 设置已被其他请求修改时返回 409
+// @Tags API.admin
+// @Accept json
+// @Produce json
+// @Param key path string true "设置项"
+// @Param If-Match header string true "设置的 ETag"
+// @Param body body setRequest true "新的值"
+// @Success 200 {object} setting.Entry
+// @Header 200 {string} ETag "设置新版本"
+// @Failure 400
+// @Failure 404
+// @Failure 409
+// @Failure 428
+// @Router /api/admin/settings/{key} [put]
+func (h *handler) SetSetting(c *gin.Context) {
+	version, bindErr := bind.IfMatch(c)
+	if bindErr != nil {
+		response.Error(c, bindErr)
+		return
+	}
+
+	var req setRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, errcode.ErrParams.WithError(err))
+		return
+	}
+
+	entry, err := h.settingService.Set(c, c.Param("key"), req.Value, version)
+	if err != nil {
+		response.Error(c, settingError(err))
+		return
+	}
+
+	response.ETag(c, entry.Version)
+	response.Success(c, entry)
+}
+
+// ResetSetting 重置设置
+// @Summary 重置设置
+// @Description 删除已保存的值, 恢复为默认值. 需在 If-Match 中带上获取设置时返回的 ETag 或 "*"
+// @Tags API.admin
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Param key path string true "设置项"
+// @Param If-Match header string true "设置的 ETag"
+// @Success 200 {object} setting.Entry
+// @Failure 400
+// @Failure 404
+// @Failure 409
+// @Failure 428
+// @Router /api/admin/settings/{key} [delete]
+func (h *handler) ResetSetting(c *gin.Context) {
+	version, bindErr := bind.IfMatch(c)
+	if bindErr != nil {
+		response.Error(c, bindErr)
+		return
+	}
+
+	entry, err := h.settingService.Reset(c, c.Param("key"), version)
+	if err != nil {
+		response.Error(c, settingError(err))
+		return
+	}
+
+	response.Success(c, entry)
+}
+
+type historyRequest struct {
+	Page     int `form:"page" binding:"omitempty,min=1"`
+	PageSize int `form:"page_size" binding:"omitempty,min=1"`
+}
+
+type historyResponse struct {
+	List  []*model.SettingChange `json:"list"`
+	Total int64                  `json:"total"`
+}
+
+// ListHistory 查询设置变更记录
+// @Summary 查询设置变更记录
+// @Description 查询一个设置的变更记录, 最新的在前
+// @Tags API.admin
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Param key path string true "设置项"
+// @Param page query int false "页码"
+// @Param page_size query int false "每页数量"
+// @Success 200 {object} historyResponse
+// @Failure 400
+// @Failure 404
+// @Router /api/admin/settings/{key}/history [get]
+func (h *handler) ListHistory(c *gin.Context) {
+	key := c.Param("key")
+	if _, ok := setting.Lookup(key); !ok {
+		response.Error(c, errcode.ErrSettingNotFound)
+		return
+	}
+
+	var req historyRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		response.Error(c, errcode.ErrParams.WithError(err))
+		return
+	}
+
+	if req.Page == 0 {
+		req.Page = 1
+	}
+	if req.PageSize == 0 {
+		req.PageSize = defaultPageSize
+	}
+	if req.PageSize > maxPageSize {
+		req.PageSize = maxPageSize
+	}
+
+	changes, total, err := h.settingService.History(c, db.SettingChangeFilter{
+		Key:    key,
+		Offset: (req.Page - 1) * req.PageSize,
+		Limit:  req.PageSize,
+	})
+	if err != nil {
+		response.Error(c, errcode.ErrInternal.WithError(err))
+		return
+	}
+
+	response.Success(c, &historyResponse{List: changes, Total: total})
+}
+
+// PublicSettings 获取公开设置
+// @Summary 获取公开设置
+// @Description 获取公开设置的当前值, 无需登录, 如是否开放注册和站点横幅
+// @Tags API.setting
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Router /api/settings [get]
+func (h *handler) PublicSettings(c *gin.Context) {
+	response.Success(c, h.settingService.PublicValues(c))
+}
+
+func (h *handler) i() {}
+
+func settingError(err error) errcode.SvrError {
+	if errors.Is(err, setting.ErrUnknown) {
+		return errcode.ErrSettingNotFound.WithError(err)
+	}
+	if errors.Is(err, setting.ErrInvalid) {
+		return errcode.ErrSettingInvalid.WithError(err)
+	}
+	if errors.Is(err, db.ErrConflict) {
+		return errcode.ErrConflict.WithError(err)
+	}
+	return errcode.ErrInternal.WithError(err)
+}
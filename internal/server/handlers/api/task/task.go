@@ -0,0 +1,45 @@
+package task
+
+import (
+	"github.com/gin-gonic/gin"
+	"go-server-template/internal/server/errcode"
+	"go-server-template/internal/server/response"
+	"go-server-template/internal/service"
+)
+
+var _ Handler = (*handler)(nil)
+
+type Handler interface {
+	Status(c *gin.Context)
+
+	i()
+}
+
+type handler struct {
+	taskService service.TaskService
+}
+
+func New(s service.Service) Handler {
+	return &handler{
+		taskService: s.Task(),
+	}
+}
+
+// Status 定时任务状态
+// @Summary 定时任务状态
+// @Description 返回当前 leader 以及每个定时任务的表达式、上次运行结果和下次运行时间
+// @Tags API.admin
+// @Produce json
+// @Success 200 {object} schedule.Status
+// @Failure 500
+// @Router /api/admin/tasks [get]
+func (h *handler) Status(c *gin.Context) {
+	status, err := h.taskService.Status(c)
+	if err != nil {
+		response.Error(c, errcode.ErrInternal.WithError(err))
+		return
+	}
+	response.Success(c, status)
+}
+
+func (h *handler) i() {}
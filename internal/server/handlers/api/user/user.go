@@ -1,11 +1,24 @@
 package user
 
 import (
+	"errors"
+	"fmt"
 	"github.com/gin-gonic/gin"
+	"go-server-template/internal/db"
+	"go-server-template/internal/model"
 	"go-server-template/internal/server/errcode"
+	"go-server-template/internal/server/handlers/bind"
 	"go-server-template/internal/server/response"
 	"go-server-template/internal/service"
-	"strconv"
+	"go-server-template/pkg/context"
+	"gorm.io/gorm"
+	"net/http"
+	"time"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
 )
 
 var _ Handler = (*handler)(nil)
@@ -13,6 +26,22 @@ var _ Handler = (*handler)(nil)
 type Handler interface {
 	GetUser(c *gin.Context)
 
+	CreateUser(c *gin.Context)
+
+	UpdateUser(c *gin.Context)
+
+	DeleteUser(c *gin.Context)
+
+	RestoreUser(c *gin.Context)
+
+	PurgeUser(c *gin.Context)
+
+	SearchUsers(c *gin.Context)
+
+	ImportUsers(c *gin.Context)
+
+	ExportUsers(c *gin.Context)
+
 	i()
 }
 
@@ -32,24 +61,410 @@ func New(s service.Service) Handler {
 // @Tags API.user
 // @Accept application/x-www-form-urlencoded
 // @Produce json
-// @Param id path int true "用户ID"
+// @Param id path string true "用户ID"
 // @Success 200 {object} model.User
+// @Header 200 {string} ETag "用户版本"
 // @Failure 400
 // @Router /api/user/{id} [get]
 func (h *handler) GetUser(c *gin.Context) {
-	userID, err := strconv.ParseUint(c.Param("id"), 10, 64)
-	if err != nil {
-		response.Error(c, errcode.ErrParams.WithDetail("invalid user id: %v", err))
+	userID, bindErr := bind.PublicID(c, "id")
+	if bindErr != nil {
+		response.Error(c, bindErr)
 		return
 	}
 
-	user, err := h.userService.GetUserByID(c, uint(userID))
+	user, err := h.userService.GetUserByPublicID(c, userID)
 	if err != nil {
 		response.Error(c, errcode.ErrUserNotFound.WithError(err))
 		return
 	}
 
+	response.ETag(c, user.Version)
+	response.Success(c, user)
+}
+
+type createRequest struct {
+	Username string `json:"username" binding:"required,min=1,max=64"`
+	Password string `json:"password" binding:"required,min=8,max=72"`
+}
+
+// CreateUser 创建用户
+// @Summary 创建用户
+// @Description 创建用户, 密码以 bcrypt 哈希保存
+// @Tags API.admin
+// @Accept json
+// @Produce json
+// @Param body body createRequest true "用户名和密码"
+// @Success 200 {object} model.User
+// @Header 200 {string} ETag "用户版本"
+// @Failure 400
+// @Failure 409
+// @Router /api/admin/user [post]
+func (h *handler) CreateUser(c *gin.Context) {
+	var req createRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, errcode.ErrParams.WithError(err))
+		return
+	}
+
+	user, err := h.userService.CreateUser(c, req.Username, req.Password)
+	if err != nil {
+		response.Error(c, userError(err))
+		return
+	}
+
+	response.ETag(c, user.Version)
+	response.Success(c, user)
+}
+
+type updateRequest struct {
+	Username *string `json:"username" binding:"omitempty,min=1,max=64"`
+}
+
+// UpdateUser 修改用户
+// @Summary 修改用户
+// @Description 修改用户, 仅限用户本人或管理员. 需在 If-Match 中带上获取用户时返回的 ETag, 用户已被其他请求修改时返回 409
+// @Tags API.user
+// @Accept json
+// @Produce json
+// @Param id path string true "用户ID"
+// @Param If-Match header string true "用户的 ETag"
+// @Param body body updateRequest true "要修改的字段"
+// @Success 200 {object} model.User
+// @Header 200 {string} ETag "用户新版本"
+// @Failure 400
+// @Failure 403
+// @Failure 404
+// @Failure 409
+// @Failure 428
+// @Router /api/user/{id} [patch]
+func (h *handler) UpdateUser(c *gin.Context) {
+	userID, bindErr := bind.PublicID(c, "id")
+	if bindErr != nil {
+		response.Error(c, bindErr)
+		return
+	}
+	if bindErr = h.authorize(c, userID); bindErr != nil {
+		response.Error(c, bindErr)
+		return
+	}
+	version, bindErr := bind.IfMatch(c)
+	if bindErr != nil {
+		response.Error(c, bindErr)
+		return
+	}
+
+	var req updateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, errcode.ErrParams.WithError(err))
+		return
+	}
+
+	user, err := h.userService.UpdateUser(c, userID, version, service.UserUpdate{Username: req.Username})
+	if err != nil {
+		response.Error(c, userError(err))
+		return
+	}
+
+	response.ETag(c, user.Version)
 	response.Success(c, user)
 }
 
+// DeleteUser 删除用户
+// @Summary 删除用户
+// @Description 软删除用户, 仅限用户本人或管理员, 可通过恢复接口找回
+// @Tags API.user
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Param id path string true "用户ID"
+// @Success 200
+// @Failure 400
+// @Failure 403
+// @Failure 404
+// @Router /api/user/{id} [delete]
+func (h *handler) DeleteUser(c *gin.Context) {
+	userID, bindErr := bind.PublicID(c, "id")
+	if bindErr != nil {
+		response.Error(c, bindErr)
+		return
+	}
+
+	if bindErr = h.authorize(c, userID); bindErr != nil {
+		response.Error(c, bindErr)
+		return
+	}
+
+	if err := h.userService.DeleteUser(c, userID); err != nil {
+		response.Error(c, userError(err))
+		return
+	}
+
+	response.Success(c, nil)
+}
+
+// RestoreUser 恢复用户
+// @Summary 恢复用户
+// @Description 恢复被软删除的用户
+// @Tags API.admin
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Param id path string true "用户ID"
+// @Success 200
+// @Failure 400
+// @Failure 404
+// @Router /api/admin/user/{id}/restore [post]
+func (h *handler) RestoreUser(c *gin.Context) {
+	userID, bindErr := bind.PublicID(c, "id")
+	if bindErr != nil {
+		response.Error(c, bindErr)
+		return
+	}
+
+	if err := h.userService.RestoreUser(c, userID); err != nil {
+		response.Error(c, userError(err))
+		return
+	}
+
+	response.Success(c, nil)
+}
+
+// PurgeUser 彻底删除用户
+// @Summary 彻底删除用户
+// @Description 永久删除用户, 无法恢复. 同一用户同时只能有一个删除请求, 其余等待 5 秒后返回 409
+// @Tags API.admin
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Param id path string true "用户ID"
+// @Success 200
+// @Failure 400
+// @Failure 404
+// @Failure 409
+// @Router /api/admin/user/{id}/purge [delete]
+func (h *handler) PurgeUser(c *gin.Context) {
+	userID, bindErr := bind.PublicID(c, "id")
+	if bindErr != nil {
+		response.Error(c, bindErr)
+		return
+	}
+
+	if err := h.userService.PurgeUser(c, userID); err != nil {
+		response.Error(c, userError(err))
+		return
+	}
+
+	response.Success(c, nil)
+}
+
+type searchRequest struct {
+	Q        string `form:"q" binding:"required,max=256"`
+	Cursor   string `form:"cursor"`
+	PageSize int    `form:"page_size" binding:"omitempty,min=1"`
+}
+
+// searchHit is a matching user as seen by any other user, the public part of
+// model.User only.
+type searchHit struct {
+	ID       string  `json:"id" example:"01ARYZ6S41TSV4RRFFQ69G5FAV"`
+	Username string  `json:"username" example:"JohnDoe"`
+	Avatar   string  `json:"avatar" example:"01ARYZ6S41TSV4RRFFQ69G5FAV"`
+	Rank     float64 `json:"rank" example:"0.6"`
+	// Highlight holds the indexed columns HTML escaped, the matches
+	// between <mark> and </mark>.
+	Highlight map[string]string `json:"highlight"`
+}
+
+type searchResponse struct {
+	Items      []searchHit `json:"items"`
+	NextCursor string      `json:"next_cursor,omitempty"`
+}
+
+// SearchUsers 搜索用户
+// @Summary 搜索用户
+// @Description 按用户名全文搜索用户, 匹配以查询中每个词开头的词, 相关度高的在前. highlight 中的字段已做 HTML 转义, 匹配部分以 <mark> 标出. 翻页时带上前一页返回的 next_cursor. 开关 user_search 关闭时返回 404
+// @Tags API.user
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Param q query string true "搜索词"
+// @Param cursor query string false "翻页游标"
+// @Param page_size query int false "每页数量"
+// @Success 200 {object} searchResponse
+// @Failure 400
+// @Failure 404
+// @Router /api/users/search [get]
+func (h *handler) SearchUsers(c *gin.Context) {
+	var req searchRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		response.Error(c, errcode.ErrParams.WithError(err))
+		return
+	}
+
+	if req.PageSize == 0 {
+		req.PageSize = defaultPageSize
+	}
+	if req.PageSize > maxPageSize {
+		req.PageSize = maxPageSize
+	}
+
+	page, err := h.userService.SearchUsers(c, req.Q, req.PageSize, req.Cursor)
+	if err != nil {
+		if errors.Is(err, db.ErrInvalidCursor) {
+			response.Error(c, errcode.ErrParams.WithError(err))
+			return
+		}
+		response.Error(c, errcode.ErrInternal.WithError(err))
+		return
+	}
+
+	resp := searchResponse{Items: make([]searchHit, 0, len(page.Items)), NextCursor: page.NextCursor}
+	for _, hit := range page.Items {
+		resp.Items = append(resp.Items, searchHit{
+			ID:        hit.Item.PublicID,
+			Username:  hit.Item.Username,
+			Avatar:    hit.Item.Avatar,
+			Rank:      hit.Rank,
+			Highlight: hit.Highlight,
+		})
+	}
+	response.Success(c, resp)
+}
+
+type importRequest struct {
+	Format    string `form:"format" binding:"omitempty,oneof=csv ndjson"`
+	DryRun    bool   `form:"dry_run"`
+	BatchSize int    `form:"batch_size" binding:"omitempty,min=1,max=1000"`
+}
+
+// ImportUsers 批量导入用户
+// @Summary 批量导入用户
+// @Description 从请求体流式导入用户, CSV 需有 username 和 password 列, NDJSON 每行一个含这两个字段的对象. 每批一个事务, 校验失败或用户名已存在的行跳过并在报告中列出行号和原因. dry_run=true 时只校验不创建. 大文件建议使用 base-cmd user import
+// @Tags API.admin
+// @Accept text/csv
+// @Accept application/x-ndjson
+// @Produce json
+// @Param format query string false "格式, 默认按 Content-Type" Enums(csv, ndjson)
+// @Param dry_run query bool false "只校验不创建"
+// @Param batch_size query int false "每批行数, 默认 100"
+// @Success 200 {object} service.ImportReport
+// @Failure 400
+// @Router /api/admin/users/import [post]
+func (h *handler) ImportUsers(c *gin.Context) {
+	var req importRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		response.Error(c, errcode.ErrParams.WithError(err))
+		return
+	}
+	if req.Format == "" {
+		switch c.ContentType() {
+		case "text/csv":
+			req.Format = service.FormatCSV
+		case "application/x-ndjson", "application/ndjson":
+			req.Format = service.FormatNDJSON
+		default:
+			response.Error(c, errcode.ErrParams.WithError(errors.New("format or a csv or ndjson Content-Type is required")))
+			return
+		}
+	}
+
+	report, err := h.userService.ImportUsers(c, c.Request.Body, service.ImportOptions{
+		Format:    req.Format,
+		DryRun:    req.DryRun,
+		BatchSize: req.BatchSize,
+	})
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidImport) {
+			response.Error(c, errcode.ErrParams.WithError(err))
+			return
+		}
+		response.Error(c, errcode.ErrInternal.WithError(err))
+		return
+	}
+
+	response.Success(c, report)
+}
+
+type exportRequest struct {
+	Format         string    `form:"format" binding:"omitempty,oneof=csv ndjson"`
+	UsernamePrefix string    `form:"username_prefix"`
+	From           time.Time `form:"from" time_format:"2006-01-02T15:04:05Z07:00"`
+	To             time.Time `form:"to" time_format:"2006-01-02T15:04:05Z07:00"`
+	Deleted        bool      `form:"deleted"`
+}
+
+// ExportUsers 批量导出用户
+// @Summary 批量导出用户
+// @Description 按 id 顺序流式导出用户, 不含密码. 默认 CSV
+// @Tags API.admin
+// @Accept application/x-www-form-urlencoded
+// @Produce text/csv
+// @Produce application/x-ndjson
+// @Param format query string false "格式" Enums(csv, ndjson)
+// @Param username_prefix query string false "用户名前缀"
+// @Param from query string false "创建时间起 RFC3339"
+// @Param to query string false "创建时间止 RFC3339"
+// @Param deleted query bool false "包含已删除用户"
+// @Success 200
+// @Failure 400
+// @Router /api/admin/users/export [get]
+func (h *handler) ExportUsers(c *gin.Context) {
+	var req exportRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		response.Error(c, errcode.ErrParams.WithError(err))
+		return
+	}
+
+	contentType := "text/csv"
+	if req.Format == "" {
+		req.Format = service.FormatCSV
+	}
+	if req.Format == service.FormatNDJSON {
+		contentType = "application/x-ndjson"
+	}
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="users.%s"`, req.Format))
+	c.Status(http.StatusOK)
+
+	// the status is sent with the first rows, a later failure cuts the
+	// stream short
+	_, err := h.userService.ExportUsers(c, c.Writer, service.ExportOptions{
+		Format: req.Format,
+		Filter: db.UserFilter{
+			UsernamePrefix: req.UsernamePrefix,
+			CreatedFrom:    req.From,
+			CreatedTo:      req.To,
+			Deleted:        req.Deleted,
+		},
+	})
+	if err != nil {
+		_ = c.Error(err)
+	}
+}
+
 func (h *handler) i() {}
+
+// authorize only lets the user publicID itself or an admin change it.
+func (h *handler) authorize(c *gin.Context, publicID string) errcode.SvrError {
+	if context.HasRole(c, model.RoleAdmin) {
+		return nil
+	}
+	user, err := h.userService.GetUserByPublicID(c, publicID)
+	if err != nil {
+		return userError(err)
+	}
+	if uint64(user.ID) != context.GetUserID(c) {
+		return errcode.ErrForbidden
+	}
+	return nil
+}
+
+func userError(err error) errcode.SvrError {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return errcode.ErrUserNotFound.WithError(err)
+	}
+	if errors.Is(err, db.ErrConflict) {
+		return errcode.ErrConflict.WithError(err)
+	}
+	if errors.Is(err, service.ErrUsernameTaken) {
+		return errcode.ErrUsernameTaken.WithError(err)
+	}
+	return errcode.ErrInternal.WithError(err)
+}
@@ -0,0 +1,42 @@
+// Package bind decodes request parameters shared by the api handlers.
+package bind
+
+import (
+	"github.com/gin-gonic/gin"
+	"go-server-template/internal/server/errcode"
+	"go-server-template/pkg/ulid"
+	"strconv"
+	"strings"
+)
+
+// PublicID reads the path parameter name as a public id, malformed ids
+// are reported as errcode.ErrParams.
+func PublicID(c *gin.Context, name string) (string, errcode.SvrError) {
+	id, err := ulid.Parse(c.Param(name))
+	if err != nil {
+		return "", errcode.ErrParams.WithDetail("invalid %s: %q", name, c.Param(name))
+	}
+	return id, nil
+}
+
+// IfMatch reads the version a conditional update expects from the If-Match
+// header, as written by response.ETag. A missing header is reported as
+// errcode.ErrPreconditionRequired; "*" matches any version and yields 0.
+func IfMatch(c *gin.Context) (uint64, errcode.SvrError) {
+	header := strings.TrimSpace(c.GetHeader("If-Match"))
+	if header == "" {
+		return 0, errcode.ErrPreconditionRequired
+	}
+	if header == "*" {
+		return 0, nil
+	}
+
+	tag, err := strconv.Unquote(strings.TrimPrefix(header, "W/"))
+	if err == nil {
+		var version uint64
+		if version, err = strconv.ParseUint(tag, 10, 64); err == nil && version > 0 {
+			return version, nil
+		}
+	}
+	return 0, errcode.ErrParams.WithDetail("invalid If-Match: %s", header)
+}
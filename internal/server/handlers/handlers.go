@@ -1,6 +1,15 @@
 package handlers
 
 import (
+	"go-server-template/internal/server/handlers/api/audit"
+	"go-server-template/internal/server/handlers/api/database"
+	"go-server-template/internal/server/handlers/api/file"
+	"go-server-template/internal/server/handlers/api/flag"
+	"go-server-template/internal/server/handlers/api/job"
+	"go-server-template/internal/server/handlers/api/me"
+	"go-server-template/internal/server/handlers/api/outbox"
+	"go-server-template/internal/server/handlers/api/setting"
+	"go-server-template/internal/server/handlers/api/task"
 	"go-server-template/internal/server/handlers/api/user"
 	"go-server-template/internal/service"
 )
@@ -8,3 +17,39 @@ import (
 func User() user.Handler {
 	return user.New(service.Get())
 }
+
+func Audit() audit.Handler {
+	return audit.New(service.Get())
+}
+
+func Me() me.Handler {
+	return me.New(service.Get())
+}
+
+func File() file.Handler {
+	return file.New(service.Get())
+}
+
+func Database() database.Handler {
+	return database.New(service.Get())
+}
+
+func Outbox() outbox.Handler {
+	return outbox.New(service.Get())
+}
+
+func Job() job.Handler {
+	return job.New(service.Get())
+}
+
+func Task() task.Handler {
+	return task.New(service.Get())
+}
+
+func Setting() setting.Handler {
+	return setting.New(service.Get())
+}
+
+func Flag() flag.Handler {
+	return flag.New(service.Get())
+}
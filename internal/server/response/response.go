@@ -5,6 +5,7 @@ import (
 	"go-server-template/internal/server/errcode"
 	"go-server-template/pkg/context"
 	"net/http"
+	"strconv"
 )
 
 type Response struct {
@@ -67,3 +68,9 @@ func Error(c *gin.Context, err errcode.SvrError) {
 
 	c.JSON(err.HttpCode(), response)
 }
+
+// ETag sets the ETag header to the version of an optimistically locked
+// resource, clients send it back in If-Match to update it.
+func ETag(c *gin.Context, version uint64) {
+	c.Header("ETag", strconv.Quote(strconv.FormatUint(version, 10)))
+}
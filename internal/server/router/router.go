@@ -2,8 +2,11 @@ package router
 
 import (
 	"github.com/gin-gonic/gin"
+	middleware_internal "go-server-template/internal/middleware"
+	"go-server-template/internal/model"
 	"go-server-template/internal/server/handlers"
 	"go-server-template/pkg/middleware"
+	"time"
 )
 
 func Load(e *gin.Engine, middlewares ...gin.HandlerFunc) {
@@ -13,6 +16,53 @@ func Load(e *gin.Engine, middlewares ...gin.HandlerFunc) {
 		api := e.Group("/api")
 		{
 			api.GET("/user/:id", middleware.Alias("/user/:id"), handlers.User().GetUser)
+			api.GET("/users/search", middleware.Alias("/users/search"), middleware_internal.Auth(), middleware_internal.Flag("user_search"), handlers.User().SearchUsers)
+			api.PATCH("/user/:id", middleware.Alias("/user/:id"), middleware_internal.Auth(), handlers.User().UpdateUser)
+			api.DELETE("/user/:id", middleware.Alias("/user/:id"), middleware_internal.Auth(), handlers.User().DeleteUser)
+		}
+
+		me := api.Group("/me", middleware_internal.Auth())
+		{
+			me.GET("/export", middleware.Alias("/me/export"), handlers.Me().Export)
+			me.DELETE("", middleware.Alias("/me"), handlers.Me().Erase)
+			me.POST("/avatar", middleware.Alias("/me/avatar"), handlers.File().UploadAvatar)
+			me.PUT("/password", middleware.Alias("/me/password"), handlers.Me().ChangePassword)
+			me.GET("/flags", middleware.Alias("/me/flags"), handlers.Flag().MyFlags)
+		}
+
+		api.GET("/settings", middleware.Alias("/settings"), handlers.Setting().PublicSettings)
+
+		api.GET("/files/:id/download", middleware.Alias("/files/:id/download"), middleware_internal.SignedURL(), handlers.File().Download)
+		files := api.Group("/files", middleware_internal.Auth())
+		{
+			files.POST("", middleware.Alias("/files"), handlers.File().Upload)
+			files.GET("/:id/url", middleware.Alias("/files/:id/url"), handlers.File().GetURL)
+			files.DELETE("/:id", middleware.Alias("/files/:id"), handlers.File().Delete)
+		}
+
+		admin := api.Group("/admin", middleware_internal.Auth(), middleware_internal.Role(model.RoleAdmin))
+		{
+			admin.GET("/audit", middleware.Alias("/admin/audit"), handlers.Audit().ListAuditLogs)
+			admin.GET("/db/stats", middleware.Alias("/admin/db/stats"), handlers.Database().Stats)
+			admin.GET("/outbox", middleware.Alias("/admin/outbox"), handlers.Outbox().ListEvents)
+			admin.POST("/outbox/:id/replay", middleware.Alias("/admin/outbox/:id/replay"), handlers.Outbox().ReplayEvent)
+			admin.GET("/jobs", middleware.Alias("/admin/jobs"), handlers.Job().ListJobs)
+			admin.POST("/jobs/:id/retry", middleware.Alias("/admin/jobs/:id/retry"), handlers.Job().RetryJob)
+			admin.POST("/jobs/:id/cancel", middleware.Alias("/admin/jobs/:id/cancel"), handlers.Job().CancelJob)
+			admin.GET("/tasks", middleware.Alias("/admin/tasks"), handlers.Task().Status)
+			admin.GET("/settings", middleware.Alias("/admin/settings"), handlers.Setting().ListSettings)
+			admin.GET("/settings/:key", middleware.Alias("/admin/settings/:key"), handlers.Setting().GetSetting)
+			admin.PUT("/settings/:key", middleware.Alias("/admin/settings/:key"), handlers.Setting().SetSetting)
+			admin.DELETE("/settings/:key", middleware.Alias("/admin/settings/:key"), handlers.Setting().ResetSetting)
+			admin.GET("/settings/:key/history", middleware.Alias("/admin/settings/:key/history"), handlers.Setting().ListHistory)
+			admin.GET("/flags", middleware.Alias("/admin/flags"), handlers.Flag().ListFlags)
+			admin.PUT("/flags/:key", middleware.Alias("/admin/flags/:key"), handlers.Flag().SaveFlag)
+			admin.DELETE("/flags/:key", middleware.Alias("/admin/flags/:key"), handlers.Flag().DeleteFlag)
+			admin.POST("/user", middleware.Alias("/admin/user"), handlers.User().CreateUser)
+			admin.POST("/users/import", middleware.Alias("/admin/users/import"), handlers.User().ImportUsers)
+			admin.GET("/users/export", middleware.Alias("/admin/users/export"), handlers.User().ExportUsers)
+			admin.POST("/user/:id/restore", middleware.Alias("/admin/user/:id/restore"), handlers.User().RestoreUser)
+			admin.DELETE("/user/:id/purge", middleware.Alias("/admin/user/:id/purge"), middleware_internal.Lock("user.purge.:id", 5*time.Second, "id"), handlers.User().PurgeUser)
 		}
 	}
 }
@@ -0,0 +1,415 @@
+package router
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"go-server-template/internal/bootstrap"
+	"go-server-template/internal/conf"
+	"go-server-template/internal/db/dbtest"
+	"go-server-template/internal/flags"
+	"go-server-template/internal/model"
+	"go-server-template/internal/search"
+	"go-server-template/internal/service"
+	"go-server-template/pkg/app"
+	"go-server-template/pkg/logger"
+	"go-server-template/pkg/storage"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	testSecret = "test-secret"
+	// adminID is the id of the admin tokens, no user has it
+	adminID = 1000
+)
+
+type testServer struct {
+	t  *testing.T
+	e  *gin.Engine
+	db *gorm.DB
+}
+
+// newTestServer serves the routes on an in-memory database.
+func newTestServer(t *testing.T) *testServer {
+	logger.Init("zap")
+	gin.SetMode(gin.TestMode)
+
+	old := conf.Conf
+	conf.Conf = conf.InitDefaultConfig()
+	conf.Conf.JWT.Secret = testSecret
+	t.Cleanup(func() { conf.Conf = old })
+
+	dB := dbtest.Open(t, new(model.User), new(model.OutboxEvent), new(model.FeatureFlag), new(model.File), new(model.AuditLog))
+	_ = dB.Use(&bootstrap.SearchPlugin{})
+	if err := search.Migrate(dB, new(model.User)); err != nil {
+		t.Fatal(err)
+	}
+	if err := flags.Init(conf.Conf.Flags); err != nil {
+		t.Fatal(err)
+	}
+	storage.Init(storage.NewMemoryStorage())
+	service.Init(dB)
+
+	e := gin.New()
+	Load(e)
+	return &testServer{t: t, e: e, db: dB}
+}
+
+// token returns the bearer token of the user id with roles.
+func (s *testServer) token(id uint, roles ...string) string {
+	token, err := app.Sign(context.Background(), map[string]interface{}{"user_id": id, "roles": roles}, testSecret, time.Hour)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	return token
+}
+
+// do serves the request and returns the response. header holds pairs of
+// names and values.
+func (s *testServer) do(method, path, token string, body interface{}, header ...string) *httptest.ResponseRecorder {
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			s.t.Fatal(err)
+		}
+		r = bytes.NewReader(b)
+	}
+	req := httptest.NewRequest(method, path, r)
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+
+	w := httptest.NewRecorder()
+	s.e.ServeHTTP(w, req)
+	return w
+}
+
+// upload posts content as the file field of a multipart form.
+func (s *testServer) upload(path, token, name string, content []byte) *httptest.ResponseRecorder {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("file", name)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	_, _ = part.Write(content)
+	_ = form.Close()
+
+	req := httptest.NewRequest(http.MethodPost, path, &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	s.e.ServeHTTP(w, req)
+	return w
+}
+
+// createUser creates a user through the admin api and returns it.
+func (s *testServer) createUser(username string) *model.User {
+	w := s.do(http.MethodPost, "/api/admin/user", s.token(adminID, "admin"), map[string]string{"username": username, "password": "password"})
+	if w.Code != http.StatusOK {
+		s.t.Fatalf("failed to create %s: %d %s", username, w.Code, w.Body)
+	}
+	var resp struct {
+		Data model.User `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		s.t.Fatal(err)
+	}
+
+	// the ids of the tokens are internal ids
+	user := resp.Data
+	if err := s.db.Where("public_id = ?", user.PublicID).First(&user).Error; err != nil {
+		s.t.Fatal(err)
+	}
+	return &user
+}
+
+func TestUserResponsesHidePassword(t *testing.T) {
+	s := newTestServer(t)
+	admin := s.token(adminID, "admin")
+	user := s.createUser("ann")
+
+	get := s.do(http.MethodGet, "/api/user/"+user.PublicID, "", nil)
+	for _, tt := range []struct {
+		name string
+		w    *httptest.ResponseRecorder
+	}{
+		{"create", s.do(http.MethodPost, "/api/admin/user", admin, map[string]string{"username": "bob", "password": "password"})},
+		{"get", get},
+		{"update", s.do(http.MethodPatch, "/api/user/"+user.PublicID, admin, map[string]string{"username": "ann lee"}, "If-Match", get.Header().Get("ETag"))},
+		{"search", s.do(http.MethodGet, "/api/users/search?q=ann", admin, nil)},
+	} {
+		if tt.w.Code != http.StatusOK || !strings.Contains(tt.w.Body.String(), `"username":"`) {
+			t.Fatalf("%s: unexpected response %d %s", tt.name, tt.w.Code, tt.w.Body)
+		}
+		if strings.Contains(tt.w.Body.String(), `"password"`) {
+			t.Fatalf("%s: the response holds the password: %s", tt.name, tt.w.Body)
+		}
+		if strings.Contains(tt.w.Body.String(), `"created_by"`) || strings.Contains(tt.w.Body.String(), `"updated_by"`) {
+			t.Fatalf("%s: the response holds internal user ids: %s", tt.name, tt.w.Body)
+		}
+	}
+
+	// other users only see the public part of a user
+	var search struct {
+		Data struct {
+			Items []map[string]interface{} `json:"items"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(s.do(http.MethodGet, "/api/users/search?q=ann", admin, nil).Body.Bytes(), &search); err != nil {
+		t.Fatal(err)
+	}
+	if len(search.Data.Items) != 1 {
+		t.Fatalf("expected ann lee to be found, got %v", search.Data.Items)
+	}
+	for key := range search.Data.Items[0] {
+		switch key {
+		case "id", "username", "avatar", "rank", "highlight":
+		default:
+			t.Errorf("unexpected field %s in a search hit", key)
+		}
+	}
+}
+
+func TestAdminRequiresRole(t *testing.T) {
+	s := newTestServer(t)
+	for _, tt := range []struct {
+		token string
+		code  int
+	}{
+		{"", http.StatusUnauthorized},
+		{s.token(2), http.StatusForbidden},
+		{s.token(2, "editor"), http.StatusForbidden},
+		{s.token(2, "editor", "admin"), http.StatusOK},
+	} {
+		if w := s.do(http.MethodGet, "/api/admin/outbox", tt.token, nil); w.Code != tt.code {
+			t.Fatalf("expected %d, got %d %s", tt.code, w.Code, w.Body)
+		}
+	}
+	if w := s.do(http.MethodPost, "/api/admin/user", s.token(2), map[string]string{"username": "eve", "password": "password"}); w.Code != http.StatusForbidden {
+		t.Fatalf("expected a non-admin not to create users, got %d", w.Code)
+	}
+}
+
+func TestAuditActionFilter(t *testing.T) {
+	s := newTestServer(t)
+	admin := s.token(adminID, "admin")
+	for _, action := range []string{"create", "update", "delete", "erase"} {
+		if w := s.do(http.MethodGet, "/api/admin/audit?action="+action, admin, nil); w.Code != http.StatusOK {
+			t.Fatalf("expected to filter on %s, got %d %s", action, w.Code, w.Body)
+		}
+	}
+	if w := s.do(http.MethodGet, "/api/admin/audit?action=read", admin, nil); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected an unknown action to be refused, got %d", w.Code)
+	}
+}
+
+func TestDatabaseStats(t *testing.T) {
+	s := newTestServer(t)
+	if w := s.do(http.MethodGet, "/api/admin/db/stats", s.token(2), nil); w.Code != http.StatusForbidden {
+		t.Fatalf("expected a non-admin not to read the stats, got %d", w.Code)
+	}
+
+	w := s.do(http.MethodGet, "/api/admin/db/stats", s.token(adminID, "admin"), nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("failed to read the stats: %d %s", w.Code, w.Body)
+	}
+	var resp struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"max_open_connections", "in_use", "idle", "wait_count", "wait_duration_ms", "saturated"} {
+		if _, ok := resp.Data[key]; !ok {
+			t.Errorf("expected %s in the stats, got %v", key, resp.Data)
+		}
+	}
+	if resp.Data["max_open_connections"] != float64(1) {
+		t.Errorf("expected the pool of the test database, got %v", resp.Data["max_open_connections"])
+	}
+}
+
+func TestFlagGatesSearch(t *testing.T) {
+	s := newTestServer(t)
+	admin, beta, user := s.token(adminID, "admin"), s.token(2, "beta"), s.token(3)
+	if w := s.do(http.MethodGet, "/api/users/search?q=ann", user, nil); w.Code != http.StatusOK {
+		t.Fatalf("expected the search to be on by default, got %d %s", w.Code, w.Body)
+	}
+
+	// only admins change the flags
+	off := map[string]interface{}{"enabled": false, "default": map[string]string{"variant": "on"}}
+	if w := s.do(http.MethodPut, "/api/admin/flags/user_search", user, off); w.Code != http.StatusForbidden {
+		t.Fatalf("expected a non-admin not to change flags, got %d", w.Code)
+	}
+	if w := s.do(http.MethodPut, "/api/admin/flags/user_search", admin, off); w.Code != http.StatusOK {
+		t.Fatalf("failed to switch the search off: %d %s", w.Code, w.Body)
+	}
+	if w := s.do(http.MethodGet, "/api/users/search?q=ann", user, nil); w.Code != http.StatusNotFound {
+		t.Fatalf("expected the search to be gone, got %d", w.Code)
+	}
+
+	// back on for the beta testers only
+	rollout := map[string]interface{}{
+		"enabled": true,
+		"rules":   []map[string]interface{}{{"roles": []string{"beta"}, "variant": "on"}},
+		"default": map[string]string{"variant": "off"},
+	}
+	if w := s.do(http.MethodPut, "/api/admin/flags/user_search", admin, rollout); w.Code != http.StatusOK {
+		t.Fatalf("failed to roll the search out: %d %s", w.Code, w.Body)
+	}
+	for token, code := range map[string]int{beta: http.StatusOK, user: http.StatusNotFound} {
+		if w := s.do(http.MethodGet, "/api/users/search?q=ann", token, nil); w.Code != code {
+			t.Fatalf("expected %d, got %d", code, w.Code)
+		}
+	}
+}
+
+func TestUpdateUser(t *testing.T) {
+	s := newTestServer(t)
+	ann, bob := s.createUser("ann"), s.createUser("bob")
+	path := "/api/user/" + ann.PublicID
+	rename := func(username string) map[string]string { return map[string]string{"username": username} }
+
+	get := s.do(http.MethodGet, path, "", nil)
+	etag := get.Header().Get("ETag")
+	if etag != `"1"` {
+		t.Fatalf("expected the ETag of the first version, got %q", etag)
+	}
+
+	for _, tt := range []struct {
+		name    string
+		token   string
+		ifMatch string
+		code    int
+	}{
+		{"another user", s.token(bob.ID), etag, http.StatusForbidden},
+		{"no If-Match", s.token(ann.ID), "", http.StatusPreconditionRequired},
+		{"invalid If-Match", s.token(ann.ID), "v1", http.StatusBadRequest},
+	} {
+		var header []string
+		if tt.ifMatch != "" {
+			header = []string{"If-Match", tt.ifMatch}
+		}
+		if w := s.do(http.MethodPatch, path, tt.token, rename("eve"), header...); w.Code != tt.code {
+			t.Fatalf("%s: expected %d, got %d %s", tt.name, tt.code, w.Code, w.Body)
+		}
+	}
+
+	w := s.do(http.MethodPatch, path, s.token(ann.ID), rename("ann lee"), "If-Match", etag)
+	if w.Code != http.StatusOK || w.Header().Get("ETag") != `"2"` {
+		t.Fatalf("expected the owner to rename the user, got %d %q %s", w.Code, w.Header().Get("ETag"), w.Body)
+	}
+	// the ETag read before the rename is stale
+	if w = s.do(http.MethodPatch, path, s.token(ann.ID), rename("ann marie"), "If-Match", etag); w.Code != http.StatusConflict {
+		t.Fatalf("expected a conflict, got %d %s", w.Code, w.Body)
+	}
+	if w = s.do(http.MethodPatch, path, s.token(adminID, "admin"), rename("ann marie"), "If-Match", `"2"`); w.Code != http.StatusOK || w.Header().Get("ETag") != `"3"` {
+		t.Fatalf("expected an admin to rename the user, got %d %s", w.Code, w.Body)
+	}
+	if got := s.do(http.MethodGet, path, "", nil); !strings.Contains(got.Body.String(), `"username":"ann marie"`) || got.Header().Get("ETag") != `"3"` {
+		t.Fatalf("unexpected user %s", got.Body)
+	}
+}
+
+func TestDeleteUser(t *testing.T) {
+	s := newTestServer(t)
+	ann, bob, eve := s.createUser("ann"), s.createUser("bob"), s.createUser("eve")
+
+	if w := s.do(http.MethodDelete, "/api/user/"+ann.PublicID, s.token(bob.ID), nil); w.Code != http.StatusForbidden {
+		t.Fatalf("expected another user not to delete the user, got %d", w.Code)
+	}
+	if w := s.do(http.MethodGet, "/api/user/"+ann.PublicID, "", nil); w.Code != http.StatusOK {
+		t.Fatalf("expected the user to be kept, got %d", w.Code)
+	}
+
+	for _, tt := range []struct {
+		user  *model.User
+		token string
+	}{
+		{ann, s.token(ann.ID)},
+		{eve, s.token(adminID, "admin")},
+	} {
+		if w := s.do(http.MethodDelete, "/api/user/"+tt.user.PublicID, tt.token, nil); w.Code != http.StatusOK {
+			t.Fatalf("expected %s to be deleted, got %d %s", tt.user.Username, w.Code, w.Body)
+		}
+		if w := s.do(http.MethodGet, "/api/user/"+tt.user.PublicID, "", nil); w.Code != http.StatusNotFound {
+			t.Fatalf("expected %s to be gone, got %d", tt.user.Username, w.Code)
+		}
+	}
+}
+
+func TestFiles(t *testing.T) {
+	s := newTestServer(t)
+	ann, bob := s.createUser("ann"), s.createUser("bob")
+
+	w := s.upload("/api/files", s.token(ann.ID), "note.txt", []byte("hello"))
+	if w.Code != http.StatusOK {
+		t.Fatalf("failed to upload: %d %s", w.Code, w.Body)
+	}
+	var uploaded struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &uploaded); err != nil {
+		t.Fatal(err)
+	}
+	id, _ := uploaded.Data["id"].(string)
+	if _, ok := uploaded.Data["owner_id"]; ok || id == "" {
+		t.Fatalf("unexpected file %v", uploaded.Data)
+	}
+
+	if w = s.upload("/api/files", s.token(ann.ID), "page.html", []byte("<html><body>x</body></html>")); w.Code != http.StatusUnsupportedMediaType {
+		t.Fatalf("expected the html to be refused, got %d %s", w.Code, w.Body)
+	}
+	if w = s.upload("/api/me/avatar", s.token(ann.ID), "note.png", []byte("hello")); w.Code != http.StatusUnsupportedMediaType {
+		t.Fatalf("expected an avatar to be an image, got %d %s", w.Code, w.Body)
+	}
+
+	if w = s.do(http.MethodGet, "/api/files/"+id+"/url", s.token(bob.ID), nil); w.Code != http.StatusForbidden {
+		t.Fatalf("expected another user not to get the url, got %d", w.Code)
+	}
+	w = s.do(http.MethodGet, "/api/files/"+id+"/url", s.token(ann.ID), nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("failed to get the url: %d %s", w.Code, w.Body)
+	}
+	var signed struct {
+		Data struct {
+			URL string `json:"url"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &signed); err != nil {
+		t.Fatal(err)
+	}
+
+	w = s.do(http.MethodGet, signed.Data.URL, "", nil)
+	if w.Code != http.StatusOK || w.Body.String() != "hello" || w.Header().Get("X-Content-Type-Options") != "nosniff" {
+		t.Fatalf("failed to download: %d %s %v", w.Code, w.Body, w.Header())
+	}
+	if w = s.do(http.MethodGet, "/api/files/"+id+"/download", "", nil); w.Code != http.StatusForbidden {
+		t.Fatalf("expected an unsigned download to be refused, got %d", w.Code)
+	}
+
+	if w = s.do(http.MethodDelete, "/api/files/"+id, s.token(bob.ID), nil); w.Code != http.StatusForbidden {
+		t.Fatalf("expected another user not to delete the file, got %d", w.Code)
+	}
+	if w = s.do(http.MethodDelete, "/api/files/"+id, s.token(ann.ID), nil); w.Code != http.StatusOK {
+		t.Fatalf("failed to delete: %d %s", w.Code, w.Body)
+	}
+	if w = s.do(http.MethodGet, signed.Data.URL, "", nil); w.Code != http.StatusNotFound {
+		t.Fatalf("expected the deleted file to be gone, got %d", w.Code)
+	}
+}
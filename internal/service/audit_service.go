@@ -0,0 +1,112 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"go-server-template/internal/db"
+	"go-server-template/internal/model"
+	"gorm.io/gorm"
+	"sort"
+)
+
+const auditVerifyBatchSize = 500
+
+func init() {
+	// audit entries are never erased, PrivacyService.Erase pseudonymizes them
+	RegisterPrivacy("audit_logs", exportAuditLogs, nil)
+}
+
+// AuditChainError reports the first audit log entry whose hash chain is broken.
+type AuditChainError struct {
+	ID     uint
+	Reason string
+}
+
+func (e *AuditChainError) Error() string {
+	return fmt.Sprintf("audit chain broken at entry %d: %s", e.ID, e.Reason)
+}
+
+type AuditService interface {
+	ListAuditLogs(ctx context.Context, filter db.AuditFilter) (logs []*model.AuditLog, total int64, err error)
+
+	// VerifyChain recomputes every hash of the audit chain and returns the
+	// number of verified entries, or an *AuditChainError at the first mismatch.
+	// Erased entries are checked against the last erasure entry listing them.
+	VerifyChain(ctx context.Context) (checked int64, err error)
+
+	i()
+}
+
+type auditService struct {
+	db *gorm.DB
+}
+
+func newAudit(s *service) AuditService {
+	return &auditService{
+		db: s.db,
+	}
+}
+
+func (s *auditService) ListAuditLogs(ctx context.Context, filter db.AuditFilter) (logs []*model.AuditLog, total int64, err error) {
+	return db.ListAuditLogs(ctx, filter)
+}
+
+func (s *auditService) VerifyChain(ctx context.Context) (checked int64, err error) {
+	var prevHash string
+	// the content digests of the erased entries, and the ones recorded for
+	// them by the erasure entries, which come later in the chain
+	erased, recorded := make(map[uint]string), make(map[uint]string)
+	err = db.ScanAuditLogs(ctx, auditVerifyBatchSize, func(logs []*model.AuditLog) error {
+		for _, l := range logs {
+			if l.PrevHash != prevHash {
+				return &AuditChainError{ID: l.ID, Reason: "previous hash does not match"}
+			}
+			if l.Erased {
+				erased[l.ID] = l.ContentDigest()
+			} else if l.ContentDigest() != l.Digest {
+				return &AuditChainError{ID: l.ID, Reason: "content does not match its digest"}
+			}
+			if l.ComputeHash() != l.Hash {
+				return &AuditChainError{ID: l.ID, Reason: "entry does not match its hash"}
+			}
+			if l.Action == model.AuditActionErase {
+				var erasure model.AuditErasure
+				if err := json.Unmarshal([]byte(l.After), &erasure); err != nil {
+					return &AuditChainError{ID: l.ID, Reason: "malformed erasure"}
+				}
+				for id, digest := range erasure.Entries {
+					recorded[id] = digest
+				}
+			}
+			prevHash = l.Hash
+			checked++
+		}
+		return nil
+	})
+	if err != nil {
+		return checked, err
+	}
+
+	ids := make([]uint, 0, len(erased))
+	for id := range erased {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	for _, id := range ids {
+		digest, ok := recorded[id]
+		if !ok {
+			return checked, &AuditChainError{ID: id, Reason: "erased without an erasure entry"}
+		}
+		if digest != erased[id] {
+			return checked, &AuditChainError{ID: id, Reason: "erased content does not match its erasure entry"}
+		}
+	}
+	return checked, nil
+}
+
+func (s *auditService) i() {}
+
+func exportAuditLogs(ctx context.Context, user *model.User) (interface{}, error) {
+	return db.ListAuditLogsOfUser(ctx, user.ID)
+}
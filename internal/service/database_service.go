@@ -0,0 +1,37 @@
+package service
+
+import (
+	"context"
+	"go-server-template/internal/db"
+	"gorm.io/gorm"
+)
+
+type DatabaseService interface {
+	// Stats returns the current connection pool statistics.
+	Stats(ctx context.Context) (*db.PoolStats, error)
+	// Reencrypt encrypts the encrypted columns of the tables of values again
+	// under the primary key, and recomputes their blind indexes.
+	Reencrypt(ctx context.Context, batchSize int, dryRun bool, values ...interface{}) (*db.ReencryptStats, error)
+
+	i()
+}
+
+type databaseService struct {
+	db *gorm.DB
+}
+
+func newDatabase(s *service) DatabaseService {
+	return &databaseService{
+		db: s.db,
+	}
+}
+
+func (s *databaseService) Stats(ctx context.Context) (*db.PoolStats, error) {
+	return db.Stats()
+}
+
+func (s *databaseService) Reencrypt(ctx context.Context, batchSize int, dryRun bool, values ...interface{}) (*db.ReencryptStats, error) {
+	return db.Reencrypt(ctx, batchSize, dryRun, values...)
+}
+
+func (s *databaseService) i() {}
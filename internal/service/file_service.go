@@ -0,0 +1,218 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"go-server-template/internal/conf"
+	"go-server-template/internal/db"
+	"go-server-template/internal/model"
+	"go-server-template/pkg/app"
+	"go-server-template/pkg/logger"
+	"go-server-template/pkg/storage"
+	"go-server-template/pkg/ulid"
+	"gorm.io/gorm"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// sniffLen is the number of bytes http.DetectContentType looks at.
+const sniffLen = 512
+
+var (
+	ErrFileTooLarge      = errors.New("file too large")
+	ErrFileType          = errors.New("file type not allowed")
+	ErrFileQuotaExceeded = errors.New("file quota exceeded")
+)
+
+func init() {
+	RegisterPrivacy("files", exportFiles, eraseFiles)
+}
+
+type FileService interface {
+	// Upload stores a file for the owner. The content type is sniffed from the
+	// content and must be allowed by the storage config, as well as the size
+	// and the owner's quota.
+	Upload(ctx context.Context, ownerID uint, kind, name string, r io.Reader, size int64) (*model.File, error)
+
+	GetFile(ctx context.Context, publicID string) (*model.File, error)
+
+	// Open returns the content of the file, the caller must close it.
+	Open(ctx context.Context, file *model.File) (io.ReadCloser, error)
+
+	DeleteFile(ctx context.Context, file *model.File) error
+
+	// SignURL returns a time limited download url of the file.
+	SignURL(file *model.File) (url string, expires time.Time)
+
+	// SetAvatar uploads an image and makes it the user's avatar, replacing the previous one.
+	SetAvatar(ctx context.Context, userID uint, name string, r io.Reader, size int64) (*model.File, error)
+
+	i()
+}
+
+type fileService struct {
+	db      *gorm.DB
+	storage storage.Storage
+}
+
+func newFile(s *service) FileService {
+	return &fileService{
+		db:      s.db,
+		storage: storage.GetStorage(),
+	}
+}
+
+func (s *fileService) Upload(ctx context.Context, ownerID uint, kind, name string, r io.Reader, size int64) (*model.File, error) {
+	cfg := conf.Conf.Storage
+	if size <= 0 || size > cfg.MaxSize {
+		return nil, ErrFileTooLarge
+	}
+
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(r, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	head = head[:n]
+
+	contentType := http.DetectContentType(head)
+	if !allowedType(contentType, cfg.AllowedTypes) {
+		return nil, fmt.Errorf("%w: %s", ErrFileType, contentType)
+	}
+	if kind == model.FileKindAvatar && !strings.HasPrefix(contentType, "image/") {
+		return nil, fmt.Errorf("%w: %s", ErrFileType, contentType)
+	}
+
+	used, err := db.SumFileSize(ctx, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.UserQuota > 0 && used+size > cfg.UserQuota {
+		return nil, ErrFileQuotaExceeded
+	}
+
+	file := &model.File{
+		OwnerID:     ownerID,
+		Kind:        kind,
+		Name:        name,
+		ContentType: contentType,
+		Size:        size,
+	}
+	file.PublicID = ulid.New()
+	file.Key = kind + "/" + file.PublicID
+
+	content := io.MultiReader(bytes.NewReader(head), r)
+	if err = s.storage.Put(ctx, file.Key, content, size, contentType); err != nil {
+		return nil, err
+	}
+
+	if err = db.CreateFile(ctx, file); err != nil {
+		_ = s.storage.Delete(ctx, file.Key)
+		return nil, err
+	}
+	return file, nil
+}
+
+func (s *fileService) GetFile(ctx context.Context, publicID string) (*model.File, error) {
+	return db.GetFileByPublicID(ctx, publicID)
+}
+
+func (s *fileService) Open(ctx context.Context, file *model.File) (io.ReadCloser, error) {
+	r, _, err := s.storage.Get(ctx, file.Key)
+	return r, err
+}
+
+func (s *fileService) DeleteFile(ctx context.Context, file *model.File) error {
+	if err := db.DeleteFile(ctx, file.ID); err != nil {
+		return err
+	}
+	return s.storage.Delete(ctx, file.Key)
+}
+
+func (s *fileService) SignURL(file *model.File) (string, time.Time) {
+	path := DownloadPath(file)
+	expires := time.Now().Add(time.Duration(conf.Conf.Storage.URLExpire) * time.Second)
+	return path + "?" + app.SignURL(path, expires, conf.Conf.Storage.SignSecret).Encode(), expires
+}
+
+func (s *fileService) SetAvatar(ctx context.Context, userID uint, name string, r io.Reader, size int64) (*model.File, error) {
+	user, err := db.Users().Get(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := s.Upload(ctx, userID, model.FileKindAvatar, name, r, size)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = db.Users().UpdateAvatar(ctx, user, file.PublicID); err != nil {
+		_ = s.DeleteFile(ctx, file)
+		return nil, err
+	}
+	invalidateUser(ctx, user)
+
+	if user.Avatar != "" {
+		if old, err := db.GetFileByPublicID(ctx, user.Avatar); err == nil {
+			_ = s.DeleteFile(ctx, old)
+		}
+	}
+	return file, nil
+}
+
+func (s *fileService) i() {}
+
+// DownloadPath is the route serving the file content, see middleware.SignedURL.
+func DownloadPath(file *model.File) string {
+	return "/api/files/" + file.PublicID + "/download"
+}
+
+// allowedType compares media types without their parameters.
+func allowedType(contentType string, allowed []string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, a := range allowed {
+		if t, _, err := mime.ParseMediaType(a); err == nil && t == mediaType {
+			return true
+		}
+	}
+	return false
+}
+
+func exportFiles(ctx context.Context, user *model.User) (interface{}, error) {
+	return db.ListFilesOfOwner(ctx, user.ID)
+}
+
+func eraseFiles(ctx context.Context, user *model.User, pseudonym string) error {
+	files, err := db.ListFilesOfOwner(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(files))
+	for _, f := range files {
+		if err = db.DeleteFile(ctx, f.ID); err != nil {
+			return err
+		}
+		keys = append(keys, f.Key)
+	}
+
+	// the content goes once the erasure committed, a rollback restores the
+	// rows and they must still point to their content
+	db.AfterCommit(ctx, func() {
+		store := storage.GetStorage()
+		for _, key := range keys {
+			if err := store.Delete(ctx, key); err != nil && !errors.Is(err, storage.ErrNotFound) {
+				logger.GetLogger().Errorf("Failed to delete the content %s of an erased file: %s", key, err.Error())
+			}
+		}
+	})
+	return nil
+}
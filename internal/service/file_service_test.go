@@ -0,0 +1,185 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"go-server-template/internal/conf"
+	"go-server-template/internal/db"
+	"go-server-template/internal/db/dbtest"
+	"go-server-template/internal/model"
+	"go-server-template/pkg/app"
+	"go-server-template/pkg/logger"
+	"go-server-template/pkg/storage"
+	"io"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// pngHeader is enough for http.DetectContentType to sniff image/png.
+var pngHeader = []byte("\x89PNG\r\n\x1a\n")
+
+func openFileService(t *testing.T) *fileService {
+	logger.Init("zap")
+	old := conf.Conf
+	conf.Conf = conf.InitDefaultConfig()
+	t.Cleanup(func() { conf.Conf = old })
+
+	dB := dbtest.Open(t, new(model.User), new(model.File), new(model.OutboxEvent))
+	return &fileService{db: dB, storage: storage.Init(storage.NewMemoryStorage())}
+}
+
+func upload(s *fileService, ownerID uint, kind string, content []byte) (*model.File, error) {
+	return s.Upload(context.Background(), ownerID, kind, "name", bytes.NewReader(content), int64(len(content)))
+}
+
+func TestFileUpload(t *testing.T) {
+	s := openFileService(t)
+	ctx := context.Background()
+
+	file, err := upload(s, 1, model.FileKindAttachment, []byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file.ContentType != "text/plain; charset=utf-8" || file.Key != model.FileKindAttachment+"/"+file.PublicID {
+		t.Fatalf("unexpected file %+v", file)
+	}
+	r, err := s.Open(ctx, file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, _ := io.ReadAll(r)
+	_ = r.Close()
+	if string(content) != "hello" {
+		t.Fatalf("expected the sniffed bytes to be stored too, got %q", content)
+	}
+
+	if _, err = upload(s, 1, model.FileKindAttachment, []byte("<html><body>x</body></html>")); !errors.Is(err, ErrFileType) {
+		t.Fatalf("expected the sniffed type to be refused, got %v", err)
+	}
+	if _, err = upload(s, 1, model.FileKindAvatar, []byte("hello")); !errors.Is(err, ErrFileType) {
+		t.Fatalf("expected an avatar to be an image, got %v", err)
+	}
+
+	conf.Conf.Storage.MaxSize = 8
+	if _, err = upload(s, 1, model.FileKindAttachment, []byte("too large")); !errors.Is(err, ErrFileTooLarge) {
+		t.Fatalf("expected ErrFileTooLarge, got %v", err)
+	}
+	conf.Conf.Storage.MaxSize = 1 << 20
+
+	conf.Conf.Storage.UserQuota = 8
+	if _, err = upload(s, 1, model.FileKindAttachment, []byte("hello")); !errors.Is(err, ErrFileQuotaExceeded) {
+		t.Fatalf("expected ErrFileQuotaExceeded, got %v", err)
+	}
+	if _, err = upload(s, 2, model.FileKindAttachment, []byte("hello")); err != nil {
+		t.Fatalf("expected the quota to be per owner, got %v", err)
+	}
+
+	if err = s.DeleteFile(ctx, file); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.GetFile(ctx, file.PublicID); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Fatalf("expected the file to be deleted, got %v", err)
+	}
+	if _, _, err = s.storage.Get(ctx, file.Key); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("expected the content to be deleted, got %v", err)
+	}
+}
+
+func TestFileSignURL(t *testing.T) {
+	s := openFileService(t)
+	file, err := upload(s, 1, model.FileKindAttachment, []byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signed, expires := s.SignURL(file)
+	path, rawQuery, _ := strings.Cut(signed, "?")
+	if path != DownloadPath(file) {
+		t.Fatalf("unexpected path %s", path)
+	}
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = app.VerifyURL(path, query, conf.Conf.Storage.SignSecret, time.Now()); err != nil {
+		t.Fatalf("expected a valid signature, got %v", err)
+	}
+	if err = app.VerifyURL(path, query, conf.Conf.Storage.SignSecret, expires.Add(time.Second)); !errors.Is(err, app.ErrURLExpired) {
+		t.Fatalf("expected the url to expire after %s, got %v", expires, err)
+	}
+}
+
+func TestSetAvatar(t *testing.T) {
+	s := openFileService(t)
+	ctx := context.Background()
+	user := &model.User{Username: "alice"}
+	if err := db.Users().Create(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := s.SetAvatar(ctx, user.ID, "a.png", bytes.NewReader(pngHeader), int64(len(pngHeader)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := s.SetAvatar(ctx, user.ID, "b.png", bytes.NewReader(pngHeader), int64(len(pngHeader)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := db.Users().Get(ctx, user.ID)
+	if err != nil || got.Avatar != second.PublicID {
+		t.Fatalf("expected the new avatar, got %+v (%v)", got, err)
+	}
+	if _, err = s.GetFile(ctx, first.PublicID); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Fatalf("expected the previous avatar to be deleted, got %v", err)
+	}
+	if second.Kind != model.FileKindAvatar || second.OwnerID != user.ID {
+		t.Fatalf("unexpected avatar %+v", second)
+	}
+}
+
+func TestEraseFiles(t *testing.T) {
+	s := openFileService(t)
+	ctx := context.Background()
+	user := &model.User{Username: "alice"}
+	if err := db.Users().Create(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+	file, err := upload(s, user.ID, model.FileKindAttachment, []byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a failure later in the erasure keeps the rows and their content
+	errBoom := errors.New("boom")
+	err = InTx(ctx, func(ctx context.Context) error {
+		if err := eraseFiles(ctx, user, "erased"); err != nil {
+			return err
+		}
+		return errBoom
+	})
+	if !errors.Is(err, errBoom) {
+		t.Fatalf("expected the erasure to fail, got %v", err)
+	}
+	if _, err = s.GetFile(ctx, file.PublicID); err != nil {
+		t.Fatalf("expected the file to be kept, got %v", err)
+	}
+	if _, _, err = s.storage.Get(ctx, file.Key); err != nil {
+		t.Fatalf("expected the content to be kept, got %v", err)
+	}
+
+	err = InTx(ctx, func(ctx context.Context) error {
+		return eraseFiles(ctx, user, "erased")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = s.storage.Get(ctx, file.Key); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("expected the content to be deleted once committed, got %v", err)
+	}
+}
@@ -0,0 +1,60 @@
+package service
+
+import (
+	"context"
+	"go-server-template/internal/flags"
+	"gorm.io/gorm"
+)
+
+type FlagService interface {
+	List(ctx context.Context) ([]*flags.Definition, error)
+
+	// Save stores f, overriding the flag of the config with the same key.
+	// flags.ErrInvalid is returned for a flag that does not validate.
+	Save(ctx context.Context, f *flags.Flag) error
+
+	// Delete deletes the stored flag key, gorm.ErrRecordNotFound is
+	// returned when it is not stored.
+	Delete(ctx context.Context, key string) error
+
+	// Evaluate evaluates every flag for the subject of ctx.
+	Evaluate(ctx context.Context) map[string]*flags.Evaluation
+
+	i()
+}
+
+type flagService struct {
+	db *gorm.DB
+}
+
+func newFlag(s *service) FlagService {
+	return &flagService{
+		db: s.db,
+	}
+}
+
+func (s *flagService) List(ctx context.Context) ([]*flags.Definition, error) {
+	return flags.List(ctx)
+}
+
+func (s *flagService) Save(ctx context.Context, f *flags.Flag) error {
+	if err := flags.Save(ctx, f); err != nil {
+		return err
+	}
+	flags.Invalidate()
+	return nil
+}
+
+func (s *flagService) Delete(ctx context.Context, key string) error {
+	if err := flags.Delete(ctx, key); err != nil {
+		return err
+	}
+	flags.Invalidate()
+	return nil
+}
+
+func (s *flagService) Evaluate(ctx context.Context) map[string]*flags.Evaluation {
+	return flags.All(ctx)
+}
+
+func (s *flagService) i() {}
@@ -0,0 +1,52 @@
+package service
+
+import (
+	"context"
+	"go-server-template/internal/db"
+	"go-server-template/internal/model"
+	"gorm.io/gorm"
+)
+
+type JobService interface {
+	ListJobs(ctx context.Context, filter db.JobFilter) (jobs []*model.Job, total int64, err error)
+
+	// RetryJob queues a dead or canceled job again with a fresh count of
+	// attempts, db.ErrJobState is returned for a job in another state.
+	RetryJob(ctx context.Context, jobID string) (*model.Job, error)
+
+	// CancelJob cancels a pending job, db.ErrJobState is returned for a job
+	// in another state.
+	CancelJob(ctx context.Context, jobID string) (*model.Job, error)
+
+	i()
+}
+
+type jobService struct {
+	db *gorm.DB
+}
+
+func newJob(s *service) JobService {
+	return &jobService{
+		db: s.db,
+	}
+}
+
+func (s *jobService) ListJobs(ctx context.Context, filter db.JobFilter) (jobs []*model.Job, total int64, err error) {
+	return db.ListJobs(ctx, filter)
+}
+
+func (s *jobService) RetryJob(ctx context.Context, jobID string) (*model.Job, error) {
+	if err := db.RetryJob(ctx, jobID); err != nil {
+		return nil, err
+	}
+	return db.GetJob(db.UsePrimary(ctx), jobID)
+}
+
+func (s *jobService) CancelJob(ctx context.Context, jobID string) (*model.Job, error) {
+	if err := db.CancelJob(ctx, jobID); err != nil {
+		return nil, err
+	}
+	return db.GetJob(db.UsePrimary(ctx), jobID)
+}
+
+func (s *jobService) i() {}
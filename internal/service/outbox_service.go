@@ -0,0 +1,41 @@
+package service
+
+import (
+	"context"
+	"go-server-template/internal/db"
+	"go-server-template/internal/model"
+	"gorm.io/gorm"
+)
+
+type OutboxService interface {
+	ListEvents(ctx context.Context, filter db.OutboxFilter) (events []*model.OutboxEvent, total int64, err error)
+
+	// ReplayEvent queues the event eventID for delivery again with a fresh
+	// count of attempts, typically after it was dead.
+	ReplayEvent(ctx context.Context, eventID string) (*model.OutboxEvent, error)
+
+	i()
+}
+
+type outboxService struct {
+	db *gorm.DB
+}
+
+func newOutbox(s *service) OutboxService {
+	return &outboxService{
+		db: s.db,
+	}
+}
+
+func (s *outboxService) ListEvents(ctx context.Context, filter db.OutboxFilter) (events []*model.OutboxEvent, total int64, err error) {
+	return db.ListOutboxEvents(ctx, filter)
+}
+
+func (s *outboxService) ReplayEvent(ctx context.Context, eventID string) (*model.OutboxEvent, error) {
+	if err := db.ReplayOutboxEvent(ctx, eventID); err != nil {
+		return nil, err
+	}
+	return db.GetOutboxEvent(db.UsePrimary(ctx), eventID)
+}
+
+func (s *outboxService) i() {}
@@ -0,0 +1,134 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"go-server-template/internal/conf"
+	"go-server-template/internal/db"
+	"go-server-template/internal/model"
+	"gorm.io/gorm"
+	"sync"
+	"time"
+)
+
+// Exporter returns what a module stores about the user, it becomes one
+// section of the user's data export.
+type Exporter func(ctx context.Context, user *model.User) (interface{}, error)
+
+// Eraser anonymizes what a module stores about the user. Rows that must be
+// kept, aggregates for instance, should reference pseudonym instead of the user.
+type Eraser func(ctx context.Context, user *model.User, pseudonym string) error
+
+type privacyModule struct {
+	name   string
+	export Exporter
+	erase  Eraser
+}
+
+var (
+	privacyMux     sync.RWMutex
+	privacyModules []*privacyModule
+)
+
+// RegisterPrivacy registers the exporter and eraser of the module name,
+// either may be nil. Modules call it from init for their own tables.
+func RegisterPrivacy(name string, export Exporter, erase Eraser) {
+	privacyMux.Lock()
+	defer privacyMux.Unlock()
+
+	privacyModules = append(privacyModules, &privacyModule{name: name, export: export, erase: erase})
+}
+
+// DataExport is everything we store about a user.
+type DataExport struct {
+	ExportedAt time.Time              `json:"exported_at"`
+	UserID     string                 `json:"user_id"`
+	Sections   map[string]interface{} `json:"sections"`
+}
+
+type PrivacyService interface {
+	// Export collects the sections of every registered module.
+	Export(ctx context.Context, userID uint) (*DataExport, error)
+
+	// Erase runs every registered eraser, then pseudonymizes the user's audit
+	// log entries which are kept for compliance, all in one transaction.
+	Erase(ctx context.Context, userID uint) error
+
+	i()
+}
+
+type privacyService struct {
+	db *gorm.DB
+}
+
+func newPrivacy(s *service) PrivacyService {
+	return &privacyService{
+		db: s.db,
+	}
+}
+
+func (s *privacyService) Export(ctx context.Context, userID uint) (*DataExport, error) {
+	user, err := db.Users().Get(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	export := &DataExport{
+		ExportedAt: time.Now(),
+		UserID:     user.PublicID,
+		Sections:   make(map[string]interface{}),
+	}
+
+	privacyMux.RLock()
+	defer privacyMux.RUnlock()
+
+	for _, m := range privacyModules {
+		if m.export == nil {
+			continue
+		}
+		data, err := m.export(ctx, user)
+		if err != nil {
+			return nil, err
+		}
+		export.Sections[m.name] = data
+	}
+	return export, nil
+}
+
+func (s *privacyService) Erase(ctx context.Context, userID uint) error {
+	user, err := db.Users().Get(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	// collected before the erasers clear them from the user row
+	pii := model.PIIValues(user)
+	pseudonym := Pseudonym(user)
+
+	privacyMux.RLock()
+	defer privacyMux.RUnlock()
+
+	return InTx(ctx, func(ctx context.Context) error {
+		for _, m := range privacyModules {
+			if m.erase == nil {
+				continue
+			}
+			if err := m.erase(ctx, user, pseudonym); err != nil {
+				return err
+			}
+		}
+
+		return db.PseudonymizeAuditLogs(ctx, user.ID, pii, pseudonym)
+	})
+}
+
+func (s *privacyService) i() {}
+
+// Pseudonym returns the stable pseudonym that replaces the user in erased data.
+func Pseudonym(user *model.User) string {
+	mac := hmac.New(sha256.New, []byte(conf.Conf.JWT.Secret))
+	mac.Write([]byte(user.PublicID))
+	return "erased-" + hex.EncodeToString(mac.Sum(nil))[:16]
+}
@@ -1,11 +1,17 @@
 package service
 
-import "gorm.io/gorm"
+import (
+	"go-server-template/internal/conf"
+	"gorm.io/gorm"
+)
 
 var svc *service
 
 func Init(db *gorm.DB) {
 	svc = &service{db: db}
+	if conf.Conf != nil {
+		userCache = newUserCache(conf.Conf.Cache)
+	}
 }
 
 func Get() Service {
@@ -17,6 +23,24 @@ var _ Service = (*service)(nil)
 type Service interface {
 	User() UserService
 
+	Audit() AuditService
+
+	Privacy() PrivacyService
+
+	File() FileService
+
+	Database() DatabaseService
+
+	Outbox() OutboxService
+
+	Job() JobService
+
+	Task() TaskService
+
+	Setting() SettingService
+
+	Flag() FlagService
+
 	i()
 }
 type service struct {
@@ -27,4 +51,40 @@ func (s *service) User() UserService {
 	return newUser(s)
 }
 
+func (s *service) Audit() AuditService {
+	return newAudit(s)
+}
+
+func (s *service) Privacy() PrivacyService {
+	return newPrivacy(s)
+}
+
+func (s *service) File() FileService {
+	return newFile(s)
+}
+
+func (s *service) Database() DatabaseService {
+	return newDatabase(s)
+}
+
+func (s *service) Outbox() OutboxService {
+	return newOutbox(s)
+}
+
+func (s *service) Job() JobService {
+	return newJob(s)
+}
+
+func (s *service) Task() TaskService {
+	return newTask(s)
+}
+
+func (s *service) Setting() SettingService {
+	return newSetting(s)
+}
+
+func (s *service) Flag() FlagService {
+	return newFlag(s)
+}
+
 func (s *service) i() {}
@@ -0,0 +1,103 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"go-server-template/internal/db"
+	"go-server-template/internal/model"
+	"go-server-template/internal/setting"
+	"gorm.io/gorm"
+	"unicode/utf8"
+)
+
+var (
+	// SignupEnabled tells the frontend whether to offer the signup.
+	SignupEnabled = setting.Define("signup.enabled", true,
+		setting.Public(), setting.WithDescription("是否开放注册"))
+
+	// SiteBanner is shown on top of every page while not empty.
+	SiteBanner = setting.Define("site.banner", "",
+		setting.Public(), setting.WithDescription("站点横幅, 为空时不显示"),
+		setting.WithValidator(func(v string) error {
+			if utf8.RuneCountInString(v) > 500 {
+				return errors.New("longer than 500 characters")
+			}
+			return nil
+		}))
+)
+
+type SettingService interface {
+	List(ctx context.Context) ([]*setting.Entry, error)
+
+	Get(ctx context.Context, key string) (*setting.Entry, error)
+
+	// Set stores value as the setting key while it still has version, 0
+	// matching any version. setting.ErrUnknown, setting.ErrInvalid or
+	// db.ErrConflict are returned when the key is not defined, the value
+	// does not fit its schema or the setting changed meanwhile.
+	Set(ctx context.Context, key string, value json.RawMessage, version uint64) (*setting.Entry, error)
+
+	// Reset gives the setting key its default value again, with the same
+	// errors as Set.
+	Reset(ctx context.Context, key string, version uint64) (*setting.Entry, error)
+
+	History(ctx context.Context, filter db.SettingChangeFilter) (changes []*model.SettingChange, total int64, err error)
+
+	// PublicValues returns the current values of the public settings.
+	PublicValues(ctx context.Context) map[string]json.RawMessage
+
+	i()
+}
+
+type settingService struct {
+	db *gorm.DB
+}
+
+func newSetting(s *service) SettingService {
+	return &settingService{
+		db: s.db,
+	}
+}
+
+func (s *settingService) List(ctx context.Context) ([]*setting.Entry, error) {
+	return setting.List(ctx)
+}
+
+func (s *settingService) Get(ctx context.Context, key string) (*setting.Entry, error) {
+	return setting.Get(ctx, key)
+}
+
+func (s *settingService) Set(ctx context.Context, key string, value json.RawMessage, version uint64) (entry *setting.Entry, err error) {
+	err = InTx(ctx, func(ctx context.Context) error {
+		entry, err = setting.Set(ctx, key, value, version)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	setting.Invalidate()
+	return entry, nil
+}
+
+func (s *settingService) Reset(ctx context.Context, key string, version uint64) (entry *setting.Entry, err error) {
+	err = InTx(ctx, func(ctx context.Context) error {
+		entry, err = setting.Reset(ctx, key, version)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	setting.Invalidate()
+	return entry, nil
+}
+
+func (s *settingService) History(ctx context.Context, filter db.SettingChangeFilter) (changes []*model.SettingChange, total int64, err error) {
+	return db.ListSettingChanges(ctx, filter)
+}
+
+func (s *settingService) PublicValues(ctx context.Context) map[string]json.RawMessage {
+	return setting.PublicValues(ctx)
+}
+
+func (s *settingService) i() {}
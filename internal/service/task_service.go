@@ -0,0 +1,50 @@
+package service
+
+import (
+	"context"
+	"go-server-template/internal/db"
+	"go-server-template/internal/schedule"
+	"gorm.io/gorm"
+	"time"
+)
+
+// cleanupRetention is how long delivered events and finished jobs are kept.
+const cleanupRetention = 7 * 24 * time.Hour
+
+func init() {
+	schedule.Register("outbox.cleanup", "@daily", cleanupOutbox, schedule.WithJitter(5*time.Minute))
+	schedule.Register("jobs.cleanup", "@daily", cleanupJobs, schedule.WithJitter(5*time.Minute))
+}
+
+type TaskService interface {
+	// Status returns the scheduler leader and the state of every task.
+	Status(ctx context.Context) (*schedule.Status, error)
+
+	i()
+}
+
+type taskService struct {
+	db *gorm.DB
+}
+
+func newTask(s *service) TaskService {
+	return &taskService{
+		db: s.db,
+	}
+}
+
+func (s *taskService) Status(ctx context.Context) (*schedule.Status, error) {
+	return schedule.GetStatus(db.UsePrimary(ctx))
+}
+
+func (s *taskService) i() {}
+
+func cleanupOutbox(ctx context.Context) error {
+	_, err := db.DeleteDeliveredOutboxEvents(ctx, time.Now().Add(-cleanupRetention))
+	return err
+}
+
+func cleanupJobs(ctx context.Context) error {
+	_, err := db.DeleteFinishedJobs(ctx, time.Now().Add(-cleanupRetention))
+	return err
+}
@@ -0,0 +1,89 @@
+package service
+
+import (
+	"context"
+	"go-server-template/internal/db"
+	"go-server-template/pkg/retry"
+	"gorm.io/gorm"
+	"time"
+)
+
+const txMaxRetries = 3
+
+// txRetryBackoff waits 20-40ms before the first retry, doubled per retry.
+var txRetryBackoff = retry.Backoff{Initial: 40 * time.Millisecond, Jitter: true}
+
+// InTx runs fn in a transaction carried by the context given to fn, every
+// repository call made with that context joins it.
+//
+// The transaction is rolled back when fn returns an error or panics. A nested
+// InTx runs in a savepoint, so its failure only rolls back its own work.
+// Serialization failures and deadlocks of the outermost transaction are
+// retried with backoff, fn must therefore be safe to run again. The
+// functions given to db.AfterCommit run once the outermost one committed.
+func InTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if tx, depth, ok := db.TxFrom(ctx); ok {
+		return inSavePoint(ctx, tx, depth+1, fn)
+	}
+
+	var err error
+	for attempt := 0; ; attempt++ {
+		err = inTx(ctx, fn)
+		if err == nil || !db.IsRetryable(err) || attempt >= txMaxRetries {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(txRetryBackoff.Wait(attempt + 1)):
+		}
+	}
+}
+
+func inTx(ctx context.Context, fn func(ctx context.Context) error) (err error) {
+	tx := db.Conn(ctx).Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+			panic(r)
+		}
+	}()
+
+	ctx = db.WithTx(ctx, tx)
+	if err = fn(ctx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err = tx.Commit().Error; err != nil {
+		return err
+	}
+	db.Committed(ctx)
+	return nil
+}
+
+func inSavePoint(ctx context.Context, tx *gorm.DB, depth int, fn func(ctx context.Context) error) (err error) {
+	name := db.SavePointName(depth)
+	if err = tx.SavePoint(name).Error; err != nil {
+		return err
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			tx.RollbackTo(name)
+			panic(r)
+		}
+	}()
+
+	if err = fn(db.WithTx(ctx, tx)); err != nil {
+		if rbErr := tx.RollbackTo(name).Error; rbErr != nil {
+			return rbErr
+		}
+		return err
+	}
+	return nil
+}
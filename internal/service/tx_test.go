@@ -0,0 +1,111 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"go-server-template/internal/db"
+	"go-server-template/internal/db/dbtest"
+	"go-server-template/internal/model"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	"gorm.io/gorm"
+)
+
+func openTxDB(t *testing.T) {
+	dbtest.Open(t, new(model.User))
+}
+
+func countUsers(t *testing.T) int64 {
+	n, err := db.Users().Count(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestInTx(t *testing.T) {
+	openTxDB(t)
+	ctx := context.Background()
+	errBoom := errors.New("boom")
+
+	err := InTx(ctx, func(ctx context.Context) error {
+		return db.Users().Create(ctx, &model.User{Username: "committed"})
+	})
+	if err != nil || countUsers(t) != 1 {
+		t.Fatalf("expected a committed user, got %v", err)
+	}
+
+	err = InTx(ctx, func(ctx context.Context) error {
+		if err := db.Users().Create(ctx, &model.User{Username: "rolled back"}); err != nil {
+			return err
+		}
+		return errBoom
+	})
+	if !errors.Is(err, errBoom) || countUsers(t) != 1 {
+		t.Fatalf("expected the error to roll back, got %v", err)
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("expected the panic to propagate")
+			}
+		}()
+		_ = InTx(ctx, func(ctx context.Context) error {
+			_ = db.Users().Create(ctx, &model.User{Username: "panicked"})
+			panic(errBoom)
+		})
+	}()
+	if countUsers(t) != 1 {
+		t.Fatal("expected the panic to roll back")
+	}
+
+	err = InTx(ctx, func(ctx context.Context) error {
+		if err := db.Users().Create(ctx, &model.User{Username: "outer"}); err != nil {
+			return err
+		}
+		nestedErr := InTx(ctx, func(ctx context.Context) error {
+			_ = db.Users().Create(ctx, &model.User{Username: "inner"})
+			return errBoom
+		})
+		if !errors.Is(nestedErr, errBoom) {
+			t.Errorf("expected the nested error, got %v", nestedErr)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = db.Users().First(ctx, db.Filter{Field: "username", Op: db.OpEq, Value: "inner"}); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Fatalf("expected the savepoint to roll back the inner user, got %v", err)
+	}
+	if countUsers(t) != 2 {
+		t.Fatal("expected the outer user to be committed")
+	}
+}
+
+func TestInTxRetry(t *testing.T) {
+	openTxDB(t)
+
+	attempts := 0
+	err := InTx(context.Background(), func(ctx context.Context) error {
+		attempts++
+		if attempts < 3 {
+			return &mysql.MySQLError{Number: 1213, Message: "Deadlock found when trying to get lock"}
+		}
+		return nil
+	})
+	if err != nil || attempts != 3 {
+		t.Fatalf("expected success on the third attempt, got %d attempts and %v", attempts, err)
+	}
+
+	attempts = 0
+	err = InTx(context.Background(), func(ctx context.Context) error {
+		attempts++
+		return errors.New("not retryable")
+	})
+	if err == nil || attempts != 1 {
+		t.Fatalf("expected a single attempt, got %d", attempts)
+	}
+}
@@ -0,0 +1,75 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"go-server-template/internal/db"
+	"go-server-template/internal/event"
+	"go-server-template/internal/model"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrUsernameTaken    = errors.New("username already taken")
+	ErrPasswordMismatch = errors.New("password mismatch")
+)
+
+// hashPassword returns the bcrypt hash the users keep of their password.
+func hashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return string(hash), err
+}
+
+func (s *userService) CreateUser(ctx context.Context, username, password string) (*model.User, error) {
+	hash, err := hashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+
+	user := &model.User{Username: username, Password: hash}
+	err = InTx(ctx, func(ctx context.Context) error {
+		taken, err := s.users.UsernameTaken(ctx, username)
+		if err != nil {
+			return err
+		}
+		if taken {
+			return ErrUsernameTaken
+		}
+		if err = s.users.Create(ctx, user); err != nil {
+			// a concurrent create took the username since the check
+			if db.IsUniqueViolation(err) {
+				return ErrUsernameTaken
+			}
+			return err
+		}
+		// the id may be cached as missing
+		invalidateUser(ctx, user)
+		return event.Publish(ctx, event.UserCreated{UserID: user.PublicID})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (s *userService) ChangePassword(ctx context.Context, userID uint, current, password string) error {
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	return InTx(ctx, func(ctx context.Context) error {
+		user, err := s.users.Get(ctx, userID)
+		if err != nil {
+			return err
+		}
+		if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(current)) != nil {
+			return ErrPasswordMismatch
+		}
+		if err = s.users.Update(ctx, user, map[string]interface{}{"password": hash}); err != nil {
+			return err
+		}
+		invalidateUser(ctx, user)
+		return event.Publish(ctx, event.PasswordChanged{UserID: user.PublicID})
+	})
+}
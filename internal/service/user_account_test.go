@@ -0,0 +1,65 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"go-server-template/internal/db"
+	"go-server-template/internal/model"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+func TestCreateUserRace(t *testing.T) {
+	openUserCache(t)
+	ctx := context.Background()
+	s := &userService{users: db.Users()}
+
+	// another request creates the same username between the check and the insert
+	raced := false
+	err := db.GetDB().Callback().Create().Before("gorm:create").Register("test:race", func(tx *gorm.DB) {
+		if user, ok := tx.Statement.Dest.(*model.User); ok && !raced {
+			raced = true
+			if err := tx.Session(&gorm.Session{NewDB: true}).Create(&model.User{Username: user.Username}).Error; err != nil {
+				_ = tx.AddError(err)
+			}
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = s.CreateUser(ctx, "alice", "password"); !errors.Is(err, ErrUsernameTaken) {
+		t.Fatalf("expected the username to be taken, got %v", err)
+	}
+}
+
+func TestCreateUserAndChangePassword(t *testing.T) {
+	openUserCache(t)
+	ctx := context.Background()
+	s := &userService{users: db.Users()}
+
+	user, err := s.CreateUser(ctx, "alice", "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Password == "password" {
+		t.Fatal("expected the password to be hashed")
+	}
+	if _, err = s.CreateUser(ctx, "alice", "password"); !errors.Is(err, ErrUsernameTaken) {
+		t.Fatalf("expected the username to be taken, got %v", err)
+	}
+
+	if err = s.ChangePassword(ctx, user.ID, "wrong", "new password"); !errors.Is(err, ErrPasswordMismatch) {
+		t.Fatalf("expected a mismatch, got %v", err)
+	}
+	if err = s.ChangePassword(ctx, user.ID, "password", "new password"); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.ChangePassword(ctx, user.ID, "password", "other password"); !errors.Is(err, ErrPasswordMismatch) {
+		t.Fatalf("expected the old password to be rejected, got %v", err)
+	}
+	if err = s.ChangePassword(ctx, user.ID, "new password", "other password"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -2,29 +2,216 @@ package service
 
 import (
 	"context"
+	"go-server-template/internal/conf"
 	"go-server-template/internal/db"
 	"go-server-template/internal/model"
+	"go-server-template/internal/search"
+	"go-server-template/pkg/cache"
+	"go-server-template/pkg/logger"
 	"gorm.io/gorm"
+	"io"
+	"strconv"
+	"time"
 )
 
+func init() {
+	RegisterPrivacy("user", exportUser, eraseUser)
+}
+
+// userCache caches the users by id for GetUserByID and by public id for
+// GetUserByPublicID, disabled until Init. Every write to a user must call
+// invalidateUser.
+var userCache = newUserCache(conf.Cache{})
+
+func newUserCache(config conf.Cache) *cache.Cache[model.User] {
+	return cache.New[model.User]("user",
+		cache.WithTTL(time.Duration(config.UserTTL)*time.Second),
+		cache.WithNegative(gorm.ErrRecordNotFound, time.Duration(config.NegativeTTL)*time.Second),
+	)
+}
+
+// userKey is the cache key of the user by id.
+func userKey(id uint) string {
+	return strconv.FormatUint(uint64(id), 10)
+}
+
+// publicUserKey is the cache key of the user by public id, which cannot
+// collide with an id.
+func publicUserKey(publicID string) string {
+	return "public:" + publicID
+}
+
+// invalidateUser drops the cached users, by id and by public id, once the
+// transaction of ctx committed, or right away without one.
+func invalidateUser(ctx context.Context, users ...*model.User) {
+	keys := make([]string, 0, 2*len(users))
+	for _, user := range users {
+		keys = append(keys, userKey(user.ID), publicUserKey(user.PublicID))
+	}
+	db.AfterCommit(ctx, func() {
+		if err := userCache.Delete(ctx, keys...); err != nil {
+			logger.GetLogger().Errorf("Failed to invalidate the cached users %v: %s", keys, err.Error())
+		}
+	})
+}
+
 type UserService interface {
+	// GetUserByID returns the user, from the cache unless ctx carries a
+	// transaction. gorm.ErrRecordNotFound is returned for a missing or soft
+	// deleted user.
 	GetUserByID(ctx context.Context, id uint) (user *model.User, err error)
 
+	// GetUserByPublicID is GetUserByID for the public id of the user.
+	GetUserByPublicID(ctx context.Context, publicID string) (user *model.User, err error)
+
+	// CreateUser creates a user with the bcrypt hash of password and
+	// publishes event.UserCreated. ErrUsernameTaken is returned when another
+	// user, deleted or not, has username.
+	CreateUser(ctx context.Context, username, password string) (*model.User, error)
+
+	// ChangePassword replaces the password of the user when current matches
+	// it, or else returns ErrPasswordMismatch, and publishes
+	// event.PasswordChanged.
+	ChangePassword(ctx context.Context, userID uint, current, password string) error
+
+	// UpdateUser applies update to the user if it still has version, 0 skips
+	// the check. db.ErrConflict is returned when the user changed meanwhile.
+	UpdateUser(ctx context.Context, publicID string, version uint64, update UserUpdate) (*model.User, error)
+
+	// DeleteUser soft deletes the user.
+	DeleteUser(ctx context.Context, publicID string) error
+
+	// RestoreUser brings back a soft deleted user.
+	RestoreUser(ctx context.Context, publicID string) error
+
+	// PurgeUser permanently deletes the user.
+	PurgeUser(ctx context.Context, publicID string) error
+
+	// SearchUsers returns up to limit users matching q, the best ranked
+	// first. Cursor is the NextCursor of the previous page.
+	SearchUsers(ctx context.Context, q string, limit int, cursor string) (*db.Page[search.Hit[model.User]], error)
+
+	// ImportUsers creates the users read from r, a CSV file with username
+	// and password columns or an NDJSON stream of such objects, by batches
+	// of a transaction each. The rows failing validation or whose username
+	// is taken are reported and skipped, an error is only returned when
+	// reading r or writing a batch fails, along with the report so far.
+	ImportUsers(ctx context.Context, r io.Reader, opts ImportOptions) (*ImportReport, error)
+
+	// ExportUsers writes the users matching opts.Filter to w, without their
+	// credentials, and returns how many were written.
+	ExportUsers(ctx context.Context, w io.Writer, opts ExportOptions) (int, error)
+
 	i()
 }
 
+// UserUpdate holds the user fields to change, nil fields are kept.
+type UserUpdate struct {
+	Username *string
+}
+
 type userService struct {
-	db *gorm.DB
+	db    *gorm.DB
+	users *db.UserRepository
 }
 
 func newUser(s *service) UserService {
 	return &userService{
-		db: s.db,
+		db:    s.db,
+		users: db.Users(),
 	}
 }
 
 func (s *userService) GetUserByID(ctx context.Context, id uint) (user *model.User, err error) {
-	return db.GetUserByID(ctx, id)
+	// the transaction may hold uncommitted writes of the user
+	if _, _, ok := db.TxFrom(ctx); ok {
+		return s.users.Get(ctx, id)
+	}
+	return userCache.Get(ctx, userKey(id), func(ctx context.Context) (*model.User, error) {
+		// a lagging replica would put the user as it was before a write back
+		return s.users.Get(db.UsePrimary(ctx), id)
+	})
+}
+
+func (s *userService) GetUserByPublicID(ctx context.Context, publicID string) (user *model.User, err error) {
+	if _, _, ok := db.TxFrom(ctx); ok {
+		return s.users.GetByPublicID(ctx, publicID)
+	}
+	return userCache.Get(ctx, publicUserKey(publicID), func(ctx context.Context) (*model.User, error) {
+		return s.users.GetByPublicID(db.UsePrimary(ctx), publicID)
+	})
+}
+
+func (s *userService) UpdateUser(ctx context.Context, publicID string, version uint64, update UserUpdate) (*model.User, error) {
+	user, err := s.users.GetByPublicID(ctx, publicID)
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string]interface{})
+	if update.Username != nil {
+		values["username"] = *update.Username
+	}
+	if len(values) == 0 {
+		if version != 0 && version != user.Version {
+			return nil, db.ErrConflict
+		}
+		return user, nil
+	}
+
+	if version != 0 {
+		user.Version = version
+	}
+
+	if err = s.users.Update(ctx, user, values); err != nil {
+		return nil, err
+	}
+	invalidateUser(ctx, user)
+	return s.users.GetByPublicID(db.UsePrimary(ctx), publicID)
+}
+
+func (s *userService) DeleteUser(ctx context.Context, publicID string) error {
+	return s.write(ctx, publicID, s.users.DeleteByPublicID)
+}
+
+func (s *userService) RestoreUser(ctx context.Context, publicID string) error {
+	return s.write(ctx, publicID, s.users.Restore)
+}
+
+func (s *userService) PurgeUser(ctx context.Context, publicID string) error {
+	return s.write(ctx, publicID, s.users.Purge)
+}
+
+// write runs fn on the user and invalidates it, its id is looked up first
+// since fn may remove it.
+func (s *userService) write(ctx context.Context, publicID string, fn func(ctx context.Context, publicID string) error) error {
+	id, err := s.users.IDByPublicID(ctx, publicID)
+	if err != nil {
+		return err
+	}
+	if err = fn(ctx, publicID); err != nil {
+		return err
+	}
+	invalidateUser(ctx, &model.User{Base: model.Base{ID: id, PublicID: publicID}})
+	return nil
+}
+
+func (s *userService) SearchUsers(ctx context.Context, q string, limit int, cursor string) (*db.Page[search.Hit[model.User]], error) {
+	return search.Search[model.User](ctx, q, limit, cursor)
 }
 
 func (s *userService) i() {}
+
+func exportUser(ctx context.Context, user *model.User) (interface{}, error) {
+	// credentials are not personal data worth handing out
+	u := *user
+	u.Password = ""
+	return &u, nil
+}
+
+func eraseUser(ctx context.Context, user *model.User, pseudonym string) error {
+	if err := db.Users().Anonymize(ctx, user, pseudonym); err != nil {
+		return err
+	}
+	invalidateUser(ctx, user)
+	return nil
+}
@@ -0,0 +1,157 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"go-server-template/internal/conf"
+	"go-server-template/internal/db"
+	"go-server-template/internal/model"
+	"go-server-template/pkg/cache"
+	"go-server-template/pkg/logger"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+func openUserCache(t *testing.T) {
+	logger.Init("zap")
+	openTxDB(t)
+	if err := db.GetDB().AutoMigrate(new(model.OutboxEvent)); err != nil {
+		t.Fatal(err)
+	}
+	old := userCache
+	userCache = newUserCache(conf.Cache{UserTTL: 60, NegativeTTL: 60})
+	cache.Init(cache.NewMemoryBackend(0, 0))
+	t.Cleanup(func() {
+		userCache = old
+		cache.Init(nil)
+	})
+}
+
+// renameBehind changes the username without going through the service, as
+// another replica would.
+func renameBehind(t *testing.T, id uint, username string) {
+	err := db.Conn(context.Background()).Model(&model.User{}).Where("id = ?", id).Update("username", username).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUserCache(t *testing.T) {
+	openUserCache(t)
+	ctx := context.Background()
+	s := &userService{users: db.Users()}
+
+	user, err := s.CreateUser(ctx, "alice", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.GetUserByID(ctx, user.ID); err != nil {
+		t.Fatal(err)
+	}
+	renameBehind(t, user.ID, "behind")
+	cached, err := s.GetUserByID(ctx, user.ID)
+	if err != nil || cached.Username != "alice" || cached.Password == "" {
+		t.Fatalf("expected the cached user, got %+v (%v)", cached, err)
+	}
+
+	// a transaction reads through and the write is seen once committed
+	err = InTx(ctx, func(ctx context.Context) error {
+		if u, err := s.GetUserByID(ctx, user.ID); err != nil || u.Username != "behind" {
+			t.Errorf("expected the transaction to read the database, got %+v (%v)", u, err)
+		}
+		username := "bob"
+		if _, err := s.UpdateUser(ctx, user.PublicID, 0, UserUpdate{Username: &username}); err != nil {
+			return err
+		}
+		if u, _ := s.GetUserByID(context.Background(), user.ID); u.Username != "alice" {
+			t.Errorf("expected the cache to be kept until the commit, got %s", u.Username)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u, _ := s.GetUserByID(ctx, user.ID); u.Username != "bob" {
+		t.Fatalf("expected the cache to be invalidated by the commit, got %s", u.Username)
+	}
+
+	// deleted users are cached as missing until restored
+	if err = s.DeleteUser(ctx, user.PublicID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.GetUserByID(ctx, user.ID); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Fatalf("expected the deleted user to be missing, got %v", err)
+	}
+	if err = db.Conn(ctx).Unscoped().Model(&model.User{}).Where("id = ?", user.ID).Update("deleted_at", nil).Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.GetUserByID(ctx, user.ID); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Fatalf("expected the missing user to be cached, got %v", err)
+	}
+	if err = s.DeleteUser(ctx, user.PublicID); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.RestoreUser(ctx, user.PublicID); err != nil {
+		t.Fatal(err)
+	}
+	if u, err := s.GetUserByID(ctx, user.ID); err != nil || u.Username != "bob" {
+		t.Fatalf("expected the restored user, got %+v (%v)", u, err)
+	}
+
+	if err = s.PurgeUser(ctx, user.PublicID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.GetUserByID(ctx, user.ID); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Fatalf("expected the purged user to be missing, got %v", err)
+	}
+}
+
+func TestUserCachePublicID(t *testing.T) {
+	openUserCache(t)
+	ctx := context.Background()
+	s := &userService{users: db.Users()}
+
+	user, err := s.CreateUser(ctx, "alice", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.GetUserByPublicID(ctx, user.PublicID); err != nil {
+		t.Fatal(err)
+	}
+	renameBehind(t, user.ID, "behind")
+	if u, err := s.GetUserByPublicID(ctx, user.PublicID); err != nil || u.Username != "alice" {
+		t.Fatalf("expected the cached user, got %+v (%v)", u, err)
+	}
+
+	username := "bob"
+	if _, err = s.UpdateUser(ctx, user.PublicID, 0, UserUpdate{Username: &username}); err != nil {
+		t.Fatal(err)
+	}
+	if u, _ := s.GetUserByPublicID(ctx, user.PublicID); u.Username != "bob" {
+		t.Fatalf("expected the update to invalidate the public id, got %s", u.Username)
+	}
+
+	if err = s.DeleteUser(ctx, user.PublicID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.GetUserByPublicID(ctx, user.PublicID); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Fatalf("expected the deleted user to be missing, got %v", err)
+	}
+	if err = s.RestoreUser(ctx, user.PublicID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.GetUserByPublicID(ctx, user.PublicID); err != nil {
+		t.Fatalf("expected the restored user, got %v", err)
+	}
+
+	if user, err = s.users.Get(ctx, user.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err = eraseUser(ctx, user, "erased"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.GetUserByPublicID(ctx, user.PublicID); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Fatalf("expected the erased user to be missing, got %v", err)
+	}
+}
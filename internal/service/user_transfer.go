@@ -0,0 +1,441 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go-server-template/internal/db"
+	"go-server-template/internal/event"
+	"go-server-template/internal/model"
+	"golang.org/x/sync/errgroup"
+	"io"
+	"runtime"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// The formats of ImportUsers and ExportUsers.
+const (
+	FormatCSV    = "csv"
+	FormatNDJSON = "ndjson"
+)
+
+const (
+	defaultImportBatch = 100
+	maxImportBatch     = 1000
+	// maxImportErrors bounds the errors kept in an ImportReport, the rows
+	// failing past it are only counted.
+	maxImportErrors = 1000
+	// maxImportLine bounds an NDJSON line.
+	maxImportLine = 64 << 10
+	exportBatch   = 500
+)
+
+var (
+	ErrUnsupportedFormat = errors.New("unsupported format")
+	// ErrInvalidImport is returned when the input as a whole cannot be
+	// read, a row failing is reported in the ImportReport instead.
+	ErrInvalidImport = errors.New("invalid import")
+)
+
+// ImportOptions configures ImportUsers.
+type ImportOptions struct {
+	Format string
+	// DryRun validates the rows, including whether their username is taken,
+	// without creating any user.
+	DryRun bool
+	// BatchSize is the number of rows created per transaction, 100 by
+	// default and at most 1000.
+	BatchSize int
+}
+
+// ImportReport is the outcome of ImportUsers.
+type ImportReport struct {
+	Rows int `json:"rows" example:"3"`
+	// Created counts the users created, or that would be in a dry run.
+	Created int           `json:"created" example:"2"`
+	Failed  int           `json:"failed" example:"1"`
+	DryRun  bool          `json:"dry_run"`
+	Errors  []ImportError `json:"errors"`
+	// Truncated reports that only the first 1000 errors are listed.
+	Truncated bool `json:"truncated"`
+}
+
+// ImportError is a row which was not imported.
+type ImportError struct {
+	// Line is the line of the row in the input, starting at 1.
+	Line     int    `json:"line" example:"3"`
+	Username string `json:"username,omitempty" example:"JohnDoe"`
+	Error    string `json:"error" example:"username already taken"`
+}
+
+func (r *ImportReport) fail(row *importRow, err error) {
+	r.Failed++
+	if len(r.Errors) == maxImportErrors {
+		r.Truncated = true
+		return
+	}
+	r.Errors = append(r.Errors, ImportError{Line: row.line, Username: row.Username, Error: err.Error()})
+}
+
+// ExportOptions configures ExportUsers.
+type ExportOptions struct {
+	Format string
+	Filter db.UserFilter
+}
+
+// importRow is a user to import, a column not listed is ignored.
+type importRow struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+
+	line int
+	err  error
+	hash string
+}
+
+// userRecord is an exported user, without its credentials.
+type userRecord struct {
+	ID        string `json:"id"`
+	Username  string `json:"username"`
+	Avatar    string `json:"avatar"`
+	CreatedAt string `json:"created_at"`
+	UpdatedAt string `json:"updated_at"`
+	DeletedAt string `json:"deleted_at,omitempty"`
+}
+
+var userColumns = []string{"id", "username", "avatar", "created_at", "updated_at", "deleted_at"}
+
+func newUserRecord(user *model.User) *userRecord {
+	r := &userRecord{
+		ID:        user.PublicID,
+		Username:  user.Username,
+		Avatar:    user.Avatar,
+		CreatedAt: user.CreatedAt.UTC().Format(time.RFC3339Nano),
+		UpdatedAt: user.UpdatedAt.UTC().Format(time.RFC3339Nano),
+	}
+	if user.DeletedAt.Valid {
+		r.DeletedAt = user.DeletedAt.Time.UTC().Format(time.RFC3339Nano)
+	}
+	return r
+}
+
+func (r *userRecord) values() []string {
+	return []string{r.ID, r.Username, r.Avatar, r.CreatedAt, r.UpdatedAt, r.DeletedAt}
+}
+
+func (s *userService) ImportUsers(ctx context.Context, r io.Reader, opts ImportOptions) (*ImportReport, error) {
+	next, err := newRowReader(r, opts.Format)
+	if err != nil {
+		return nil, err
+	}
+	size := opts.BatchSize
+	if size <= 0 {
+		size = defaultImportBatch
+	}
+	if size > maxImportBatch {
+		size = maxImportBatch
+	}
+
+	report := &ImportReport{DryRun: opts.DryRun, Errors: make([]ImportError, 0)}
+	// the line of the first row of every username, a file repeating one
+	// is refused past its first row
+	seen := make(map[string]int)
+	batch := make([]*importRow, 0, size)
+	for {
+		row, err := next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return report, err
+		}
+		report.Rows++
+		if row.err == nil {
+			row.err = validateImportRow(row)
+		}
+		if row.err == nil {
+			if line, ok := seen[row.Username]; ok {
+				row.err = fmt.Errorf("username repeated from line %d", line)
+			} else {
+				seen[row.Username] = row.line
+			}
+		}
+		if row.err != nil {
+			report.fail(row, row.err)
+			continue
+		}
+
+		if batch = append(batch, row); len(batch) == size {
+			if err = s.importBatch(ctx, batch, opts.DryRun, report); err != nil {
+				return report, err
+			}
+			batch = batch[:0]
+		}
+	}
+	if err = s.importBatch(ctx, batch, opts.DryRun, report); err != nil {
+		return report, err
+	}
+	return report, nil
+}
+
+// importBatch creates the users of rows in a transaction, leaving out the
+// ones whose username is taken.
+func (s *userService) importBatch(ctx context.Context, rows []*importRow, dryRun bool, report *ImportReport) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	rows, err := s.untaken(ctx, rows, report)
+	if err != nil {
+		return err
+	}
+	if dryRun || len(rows) == 0 {
+		report.Created += len(rows)
+		return nil
+	}
+	// hashing takes the most time, out of the transaction
+	if err = hashPasswords(ctx, rows); err != nil {
+		return err
+	}
+
+	var users []*model.User
+	var late []*importRow
+	err = InTx(ctx, func(ctx context.Context) error {
+		users, late = users[:0], late[:0]
+		// taken by another writer since the check above
+		taken, err := s.users.TakenUsernames(ctx, usernames(rows))
+		if err != nil {
+			return err
+		}
+		for _, row := range rows {
+			if taken[row.Username] {
+				late = append(late, row)
+				continue
+			}
+			users = append(users, &model.User{Username: row.Username, Password: row.hash})
+		}
+		if err = s.users.CreateAll(ctx, users); err != nil {
+			return err
+		}
+
+		for _, user := range users {
+			if err = event.Publish(ctx, event.UserCreated{UserID: user.PublicID}); err != nil {
+				return err
+			}
+		}
+		// the ids may be cached as missing
+		invalidateUser(ctx, users...)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	report.Created += len(users)
+	for _, row := range late {
+		report.fail(row, ErrUsernameTaken)
+	}
+	return nil
+}
+
+// untaken reports the rows whose username is taken and returns the others.
+func (s *userService) untaken(ctx context.Context, rows []*importRow, report *ImportReport) ([]*importRow, error) {
+	taken, err := s.users.TakenUsernames(ctx, usernames(rows))
+	if err != nil {
+		return nil, err
+	}
+	kept := rows[:0]
+	for _, row := range rows {
+		if taken[row.Username] {
+			report.fail(row, ErrUsernameTaken)
+			continue
+		}
+		kept = append(kept, row)
+	}
+	return kept, nil
+}
+
+func usernames(rows []*importRow) []string {
+	names := make([]string, len(rows))
+	for i, row := range rows {
+		names[i] = row.Username
+	}
+	return names
+}
+
+func hashPasswords(ctx context.Context, rows []*importRow) error {
+	g, ctx := errgroup.WithContext(ctx)
+	g.SetLimit(runtime.GOMAXPROCS(0))
+	for _, row := range rows {
+		row := row
+		g.Go(func() error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			var err error
+			row.hash, err = hashPassword(row.Password)
+			return err
+		})
+	}
+	return g.Wait()
+}
+
+// validateImportRow applies the rules of the user creation API.
+func validateImportRow(row *importRow) error {
+	if n := utf8.RuneCountInString(row.Username); n < 1 || n > 64 {
+		return errors.New("username must have 1 to 64 characters")
+	}
+	if !utf8.ValidString(row.Username) || !utf8.ValidString(row.Password) {
+		return errors.New("invalid UTF-8")
+	}
+	// bcrypt only hashes the first 72 bytes
+	if utf8.RuneCountInString(row.Password) < 8 || len(row.Password) > 72 {
+		return errors.New("password must have at least 8 characters and at most 72 bytes")
+	}
+	return nil
+}
+
+// newRowReader returns a function reading the rows of r one by one, io.EOF
+// after the last. A row failing to parse is returned with its err set.
+func newRowReader(r io.Reader, format string) (func() (*importRow, error), error) {
+	switch format {
+	case FormatCSV:
+		return newCSVReader(r)
+	case FormatNDJSON:
+		return newNDJSONReader(r), nil
+	}
+	return nil, fmt.Errorf("%w: %q", ErrUnsupportedFormat, format)
+}
+
+// newCSVReader reads a CSV file whose header names the columns, in any
+// order.
+func newCSVReader(r io.Reader) (func() (*importRow, error), error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("%w: missing header", ErrInvalidImport)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidImport, err.Error())
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		if i == 0 {
+			name = strings.TrimPrefix(name, "\ufeff")
+		}
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range []string{"username", "password"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("%w: missing column %s", ErrInvalidImport, name)
+		}
+	}
+
+	return func() (*importRow, error) {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return nil, io.EOF
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			return &importRow{line: parseErr.StartLine, err: parseErr.Err}, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := cr.FieldPos(0)
+		row := &importRow{line: line}
+		if len(record) != len(header) {
+			row.err = fmt.Errorf("expected %d fields, got %d", len(header), len(record))
+		}
+		field := func(name string) string {
+			if i := columns[name]; i < len(record) {
+				return record[i]
+			}
+			return ""
+		}
+		row.Username, row.Password = field("username"), field("password")
+		return row, nil
+	}, nil
+}
+
+// newNDJSONReader reads a JSON object per line, skipping the blank lines.
+func newNDJSONReader(r io.Reader) func() (*importRow, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 4096), maxImportLine)
+	line := 0
+	return func() (*importRow, error) {
+		for scanner.Scan() {
+			line++
+			text := bytes.TrimSpace(scanner.Bytes())
+			if len(text) == 0 {
+				continue
+			}
+			row := &importRow{line: line}
+			if err := json.Unmarshal(text, row); err != nil {
+				row.err = errors.New("invalid JSON")
+			}
+			return row, nil
+		}
+		if err := scanner.Err(); err != nil {
+			if errors.Is(err, bufio.ErrTooLong) {
+				return nil, fmt.Errorf("%w: line %d is longer than %d bytes", ErrInvalidImport, line+1, maxImportLine)
+			}
+			return nil, err
+		}
+		return nil, io.EOF
+	}
+}
+
+func (s *userService) ExportUsers(ctx context.Context, w io.Writer, opts ExportOptions) (int, error) {
+	var write func(r *userRecord) error
+	var flush func() error
+	switch opts.Format {
+	case FormatCSV:
+		cw := csv.NewWriter(w)
+		if err := cw.Write(userColumns); err != nil {
+			return 0, err
+		}
+		write = func(r *userRecord) error { return cw.Write(r.values()) }
+		flush = func() error {
+			cw.Flush()
+			return cw.Error()
+		}
+	case FormatNDJSON:
+		bw := bufio.NewWriter(w)
+		enc := json.NewEncoder(bw)
+		write = func(r *userRecord) error { return enc.Encode(r) }
+		flush = bw.Flush
+	default:
+		return 0, fmt.Errorf("%w: %q", ErrUnsupportedFormat, opts.Format)
+	}
+
+	count := 0
+	err := s.users.Each(ctx, opts.Filter, exportBatch, func(users []*model.User) error {
+		for _, user := range users {
+			if err := write(newUserRecord(user)); err != nil {
+				return err
+			}
+		}
+		count += len(users)
+		if err := flush(); err != nil {
+			return err
+		}
+		// hand every batch to the client as it comes
+		if f, ok := w.(interface{ Flush() }); ok {
+			f.Flush()
+		}
+		return nil
+	})
+	if err != nil {
+		return count, err
+	}
+	return count, flush()
+}
@@ -0,0 +1,141 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go-server-template/internal/db"
+	"go-server-template/internal/model"
+	"strings"
+	"testing"
+)
+
+func TestImportUsers(t *testing.T) {
+	openUserCache(t)
+	ctx := context.Background()
+	s := &userService{users: db.Users()}
+	if _, err := s.CreateUser(ctx, "taken", "password"); err != nil {
+		t.Fatal(err)
+	}
+
+	input := "\ufeffPassword,username,note\n" +
+		"password1,alice,first\n" +
+		"short,bob,\n" +
+		"password3,taken,\n" +
+		"password4,alice,again\n" +
+		"password6,dave,\n" +
+		"password7,erin\n" +
+		"password8,frank,\n" +
+		"\"password9,gina\n"
+
+	report, err := s.ImportUsers(ctx, strings.NewReader(input), ImportOptions{Format: FormatCSV, DryRun: true, BatchSize: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Rows != 8 || report.Created != 3 || report.Failed != 5 || countUsers(t) != 1 {
+		t.Fatalf("unexpected dry run %+v with %d users", report, countUsers(t))
+	}
+	lines := make([]int, len(report.Errors))
+	for i, e := range report.Errors {
+		lines[i] = e.Line
+	}
+	// the taken username is found once its batch is full, the unterminated
+	// quote swallows the rest of the file
+	if fmt.Sprint(lines) != "[3 4 5 7 9]" {
+		t.Fatalf("unexpected errors %+v", report.Errors)
+	}
+
+	report, err = s.ImportUsers(ctx, strings.NewReader(input), ImportOptions{Format: FormatCSV, BatchSize: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Created != 3 || report.Failed != 5 || countUsers(t) != 4 {
+		t.Fatalf("unexpected import %+v with %d users", report, countUsers(t))
+	}
+	alice, err := s.users.First(ctx, db.Filter{Field: "username", Op: db.OpEq, Value: "alice"})
+	if err != nil || alice.Password == "password1" || alice.PublicID == "" {
+		t.Fatalf("expected alice with a hashed password, got %+v (%v)", alice, err)
+	}
+	var events int64
+	if err = db.Conn(ctx).Model(new(model.OutboxEvent)).Count(&events).Error; err != nil || events != 4 {
+		t.Fatalf("expected an event per created user, got %d (%v)", events, err)
+	}
+
+	// NDJSON
+	input = `{"username":"hugo","password":"password1","extra":1}` + "\n\n" +
+		`{"username":"gina"` + "\n" +
+		`{"username":"alice","password":"password1"}` + "\n"
+	report, err = s.ImportUsers(ctx, strings.NewReader(input), ImportOptions{Format: FormatNDJSON})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Created != 1 || len(report.Errors) != 2 || report.Errors[0].Line != 3 || report.Errors[1].Error != ErrUsernameTaken.Error() {
+		t.Fatalf("unexpected import %+v", report)
+	}
+
+	if _, err = s.ImportUsers(ctx, strings.NewReader("name,password\n"), ImportOptions{Format: FormatCSV}); !errors.Is(err, ErrInvalidImport) {
+		t.Fatalf("expected the missing column to be refused, got %v", err)
+	}
+	if _, err = s.ImportUsers(ctx, strings.NewReader(""), ImportOptions{Format: "xml"}); !errors.Is(err, ErrUnsupportedFormat) {
+		t.Fatalf("expected the format to be refused, got %v", err)
+	}
+}
+
+func TestExportUsers(t *testing.T) {
+	openUserCache(t)
+	ctx := context.Background()
+	s := &userService{users: db.Users()}
+	for _, username := range []string{"a_1", "ab", "b", "a%"} {
+		if _, err := s.CreateUser(ctx, username, "password"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	deleted, _ := s.users.First(ctx, db.Filter{Field: "username", Op: db.OpEq, Value: "ab"})
+	if err := s.DeleteUser(ctx, deleted.PublicID); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	n, err := s.ExportUsers(ctx, &buf, ExportOptions{Format: FormatCSV})
+	if err != nil || n != 3 {
+		t.Fatalf("expected 3 users, got %d (%v)", n, err)
+	}
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(records[0], ",") != "id,username,avatar,created_at,updated_at,deleted_at" || records[1][1] != "a_1" {
+		t.Fatalf("unexpected export %v", records)
+	}
+	for _, record := range records {
+		if strings.Contains(strings.Join(record, ","), "$2a$") {
+			t.Fatal("expected the password hashes to be left out")
+		}
+	}
+
+	// the wildcards of the prefix match themselves only
+	buf.Reset()
+	filter := db.UserFilter{UsernamePrefix: "a_", Deleted: true}
+	if n, err = s.ExportUsers(ctx, &buf, ExportOptions{Format: FormatNDJSON, Filter: filter}); err != nil || n != 1 {
+		t.Fatalf("expected a_1 only, got %d (%v): %s", n, err, buf.String())
+	}
+
+	buf.Reset()
+	filter = db.UserFilter{UsernamePrefix: "a", Deleted: true}
+	if n, err = s.ExportUsers(ctx, &buf, ExportOptions{Format: FormatNDJSON, Filter: filter}); err != nil || n != 3 {
+		t.Fatalf("expected the deleted user too, got %d (%v)", n, err)
+	}
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var record userRecord
+		if err = dec.Decode(&record); err != nil {
+			t.Fatal(err)
+		}
+		if (record.Username == "ab") != (record.DeletedAt != "") {
+			t.Fatalf("unexpected %+v", record)
+		}
+	}
+}
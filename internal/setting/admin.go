@@ -0,0 +1,182 @@
+package setting
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"go-server-template/internal/db"
+	"go-server-template/internal/model"
+	pkgctx "go-server-template/pkg/context"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Entry is a setting along with its current value, as shown to the admins.
+type Entry struct {
+	*Definition
+	Value json.RawMessage `json:"value" swaggertype:"object"`
+	// Stored is false while the setting has its default value, Version is
+	// then 0.
+	Stored  bool   `json:"stored" example:"true"`
+	Version uint64 `json:"version" example:"1"`
+	// UpdatedBy is the public id of the user who last wrote the value.
+	UpdatedBy string     `json:"updated_by" example:"01ARYZ6S41TSV4RRFFQ69G5FAV"`
+	UpdatedAt *time.Time `json:"updated_at"`
+
+	updatedBy uint64
+}
+
+func newEntry(d *Definition, row *model.Setting) *Entry {
+	e := &Entry{Definition: d, Value: d.Default}
+	if row != nil {
+		if _, err := d.Decode([]byte(row.Value)); err == nil {
+			e.Value = json.RawMessage(row.Value)
+		}
+		e.Stored = true
+		e.Version = row.Version
+		e.updatedBy = row.UpdatedBy
+		e.UpdatedAt = &row.UpdatedAt
+	}
+	return e
+}
+
+// resolveUpdatedBy fills the public ids of the users who wrote the entries.
+func resolveUpdatedBy(ctx context.Context, entries ...*Entry) error {
+	ids := make([]uint64, 0, len(entries))
+	for _, e := range entries {
+		ids = append(ids, e.updatedBy)
+	}
+	publicIDs, err := db.Users().PublicIDs(ctx, ids)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		e.UpdatedBy = publicIDs[e.updatedBy]
+	}
+	return nil
+}
+
+// List returns every defined setting with its stored value, read from the
+// database rather than the cache.
+func List(ctx context.Context) ([]*Entry, error) {
+	rows, err := db.ListSettings(db.UsePrimary(ctx))
+	if err != nil {
+		return nil, err
+	}
+	stored := make(map[string]*model.Setting, len(rows))
+	for _, row := range rows {
+		stored[row.Key] = row
+	}
+
+	defs := Definitions()
+	entries := make([]*Entry, 0, len(defs))
+	for _, d := range defs {
+		entries = append(entries, newEntry(d, stored[d.Key]))
+	}
+	return entries, resolveUpdatedBy(ctx, entries...)
+}
+
+// Get returns the setting key with its stored value, ErrUnknown is
+// returned for a key that is not defined.
+func Get(ctx context.Context, key string) (*Entry, error) {
+	d, ok := Lookup(key)
+	if !ok {
+		return nil, ErrUnknown
+	}
+	row, err := db.FindSetting(db.UsePrimary(ctx), key)
+	if err != nil {
+		return nil, err
+	}
+	entry := newEntry(d, row)
+	return entry, resolveUpdatedBy(ctx, entry)
+}
+
+// Set stores value as the setting key while it still has version, 0
+// matching any version, and records the change. It should run in a
+// transaction, after which Invalidate must be called.
+//
+// ErrUnknown, ErrInvalid or db.ErrConflict are returned when the key is not
+// defined, the value does not fit its schema or the setting changed
+// meanwhile.
+func Set(ctx context.Context, key string, value json.RawMessage, version uint64) (*Entry, error) {
+	d, ok := Lookup(key)
+	if !ok {
+		return nil, ErrUnknown
+	}
+	decoded, err := d.Decode(value)
+	if err != nil {
+		return nil, err
+	}
+	// stored compact, whatever the formatting of the request
+	if value, err = json.Marshal(decoded); err != nil {
+		return nil, err
+	}
+
+	old, saved, err := db.SaveSetting(ctx, key, string(value), version)
+	if err != nil {
+		return nil, err
+	}
+
+	change := &model.SettingChange{Key: key, Action: model.AuditActionCreate, NewValue: &saved.Value, Version: saved.Version}
+	if old != nil {
+		change.Action = model.AuditActionUpdate
+		change.OldValue = &old.Value
+	}
+	if err = record(ctx, change); err != nil {
+		return nil, err
+	}
+	entry := newEntry(d, saved)
+	return entry, resolveUpdatedBy(ctx, entry)
+}
+
+// Reset deletes the stored value of the setting key while it still has
+// version, 0 matching any version, so it has its default again, and
+// records the change. A setting that is not stored is left as is. It should
+// run in a transaction, after which Invalidate must be called.
+func Reset(ctx context.Context, key string, version uint64) (*Entry, error) {
+	d, ok := Lookup(key)
+	if !ok {
+		return nil, ErrUnknown
+	}
+
+	old, err := db.DeleteSetting(ctx, key, version)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		if version != 0 {
+			return nil, db.ErrConflict
+		}
+		return newEntry(d, nil), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	change := &model.SettingChange{Key: key, Action: model.AuditActionDelete, OldValue: &old.Value, Version: old.Version + 1}
+	if err = record(ctx, change); err != nil {
+		return nil, err
+	}
+	return newEntry(d, nil), nil
+}
+
+func record(ctx context.Context, change *model.SettingChange) error {
+	change.ActorID = pkgctx.UserIDFrom(ctx)
+	change.RequestID = pkgctx.RequestIDFrom(ctx)
+	return db.CreateSettingChange(ctx, change)
+}
+
+// PublicValues returns the current values of the public settings.
+func PublicValues(ctx context.Context) map[string]json.RawMessage {
+	values := make(map[string]json.RawMessage)
+	for _, d := range Definitions() {
+		if !d.Public {
+			continue
+		}
+		values[d.Key] = d.Default
+		if v, ok := current(ctx, d.Key); ok {
+			if raw, err := json.Marshal(v); err == nil {
+				values[d.Key] = raw
+			}
+		}
+	}
+	return values
+}
@@ -0,0 +1,61 @@
+package setting
+
+import (
+	"context"
+	"go-server-template/internal/conf"
+	"go-server-template/internal/db"
+	"go-server-template/pkg/cache"
+	"go-server-template/pkg/logger"
+	"time"
+)
+
+// defaultCacheTTL is used until Init.
+const defaultCacheTTL = 30 * time.Second
+
+// stored keeps the decoded values of the stored settings.
+var stored = cache.NewSnapshot(defaultCacheTTL, loadValues)
+
+// Init configures the cache as settings says.
+func Init(settings conf.Settings) {
+	stored.SetTTL(time.Duration(settings.CacheTTL) * time.Second)
+}
+
+// Invalidate drops the cached values, the next read loads them again. It
+// is called after every write, once its transaction committed.
+func Invalidate() {
+	stored.Invalidate()
+}
+
+// current returns the stored value of the setting key.
+func current(ctx context.Context, key string) (interface{}, bool) {
+	values, err := stored.Get(ctx)
+	if err != nil {
+		logger.GetLogger().Errorf("Failed to load settings, using the defaults: %s", err.Error())
+		return nil, false
+	}
+	v, ok := values[key]
+	return v, ok
+}
+
+func loadValues(ctx context.Context) (map[string]interface{}, error) {
+	// read outside the transaction of ctx, which may hold uncommitted writes
+	rows, err := db.ListSettings(db.WithoutTx(ctx))
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string]interface{}, len(rows))
+	for _, row := range rows {
+		d, ok := Lookup(row.Key)
+		if !ok {
+			continue
+		}
+		v, err := d.Decode([]byte(row.Value))
+		if err != nil {
+			// e.g. the type of the setting changed since it was stored
+			logger.GetLogger().Warnf("Ignoring the stored value of setting %s: %s", row.Key, err.Error())
+			continue
+		}
+		values[row.Key] = v
+	}
+	return values, nil
+}
@@ -0,0 +1,185 @@
+// Package setting holds the runtime settings, values such as a banner
+// message that change without a deploy.
+//
+// A setting is defined once by the module using it, with its Go type as its
+// schema, a default and optional validators. Its value is stored as JSON in
+// the settings table and read through an in-memory cache of the whole
+// table, which is dropped on every write of this replica and reloaded after
+// the configured TTL on the others.
+package setting
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"sync"
+)
+
+var (
+	ErrUnknown = errors.New("unknown setting")
+	ErrInvalid = errors.New("invalid setting value")
+)
+
+// Definition is the schema of a setting.
+type Definition struct {
+	Key         string `json:"key" example:"site.banner"`
+	Description string `json:"description" example:"站点横幅"`
+	// Type is the JSON type of the value: boolean, integer, number,
+	// string, array or object.
+	Type    string          `json:"type" example:"string"`
+	Default json.RawMessage `json:"default" swaggertype:"object"`
+	// Public settings are readable without authorization.
+	Public bool `json:"public" example:"true"`
+
+	goType     reflect.Type
+	validators []func(v interface{}) error
+}
+
+// Decode checks that raw is a valid value of the setting and returns it.
+func (d *Definition) Decode(raw []byte) (interface{}, error) {
+	if bytes.Equal(bytes.TrimSpace(raw), []byte("null")) {
+		return nil, fmt.Errorf("%w: %s must not be null", ErrInvalid, d.Key)
+	}
+
+	v := reflect.New(d.goType)
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v.Interface()); err != nil {
+		return nil, fmt.Errorf("%w: %s must be a %s: %s", ErrInvalid, d.Key, d.Type, err.Error())
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("%w: %s has trailing data", ErrInvalid, d.Key)
+	}
+
+	value := v.Elem().Interface()
+	for _, validate := range d.validators {
+		if err := validate(value); err != nil {
+			return nil, fmt.Errorf("%w: %s: %s", ErrInvalid, d.Key, err.Error())
+		}
+	}
+	return value, nil
+}
+
+type Option func(*Definition)
+
+// WithDescription describes the setting to the admins.
+func WithDescription(description string) Option {
+	return func(d *Definition) {
+		d.Description = description
+	}
+}
+
+// Public makes the setting readable without authorization, e.g. by the
+// frontend.
+func Public() Option {
+	return func(d *Definition) {
+		d.Public = true
+	}
+}
+
+// WithValidator rejects the values of type T for which validate fails.
+func WithValidator[T any](validate func(v T) error) Option {
+	return func(d *Definition) {
+		d.validators = append(d.validators, func(v interface{}) error {
+			return validate(v.(T))
+		})
+	}
+}
+
+// Setting is the typed accessor of a defined setting.
+type Setting[T any] struct {
+	def      *Definition
+	fallback T
+}
+
+var (
+	definitionsMux sync.RWMutex
+	definitions    = make(map[string]*Definition)
+)
+
+// Define defines the setting key of type T. It is meant to be called from
+// a package variable and panics on a key defined twice, a default that does
+// not pass the validators or a type that is not JSON.
+func Define[T any](key string, def T, opts ...Option) *Setting[T] {
+	d := &Definition{Key: key, goType: reflect.TypeOf(&def).Elem()}
+	d.Type = jsonType(d.goType)
+	for _, opt := range opts {
+		opt(d)
+	}
+
+	raw, err := json.Marshal(def)
+	if err != nil {
+		panic(fmt.Sprintf("setting: %s: %s", key, err.Error()))
+	}
+	if _, err = d.Decode(raw); err != nil {
+		panic(fmt.Sprintf("setting: default of %s: %s", key, err.Error()))
+	}
+	d.Default = raw
+
+	definitionsMux.Lock()
+	defer definitionsMux.Unlock()
+	if _, ok := definitions[key]; ok {
+		panic(fmt.Sprintf("setting: %s defined twice", key))
+	}
+	definitions[key] = d
+	return &Setting[T]{def: d, fallback: def}
+}
+
+func jsonType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.String:
+		return "string"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	default:
+		return "object"
+	}
+}
+
+// Definitions returns the defined settings sorted by key.
+func Definitions() []*Definition {
+	definitionsMux.RLock()
+	defer definitionsMux.RUnlock()
+
+	list := make([]*Definition, 0, len(definitions))
+	for _, d := range definitions {
+		list = append(list, d)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Key < list[j].Key })
+	return list
+}
+
+// Lookup returns the definition of the setting key.
+func Lookup(key string) (*Definition, bool) {
+	definitionsMux.RLock()
+	defer definitionsMux.RUnlock()
+	d, ok := definitions[key]
+	return d, ok
+}
+
+// Key returns the key of the setting.
+func (s *Setting[T]) Key() string {
+	return s.def.Key
+}
+
+// Get returns the value of the setting, its default when it is not stored
+// or the settings cannot be read. A slice or map value is shared by the
+// callers and must not be modified.
+func (s *Setting[T]) Get(ctx context.Context) T {
+	if v, ok := current(ctx, s.def.Key); ok {
+		return v.(T)
+	}
+	return s.fallback
+}
@@ -0,0 +1,184 @@
+package setting
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"go-server-template/internal/db"
+	"go-server-template/internal/db/dbtest"
+	"go-server-template/internal/model"
+	pkgctx "go-server-template/pkg/context"
+	"go-server-template/pkg/logger"
+	"strings"
+	"testing"
+	"time"
+)
+
+type limits struct {
+	PerMinute int `json:"per_minute"`
+	Burst     int `json:"burst"`
+}
+
+func openSettings(t *testing.T) {
+	logger.Init("zap")
+	dbtest.Open(t, new(model.Setting), new(model.SettingChange))
+	Invalidate()
+}
+
+func define[T any](t *testing.T, key string, def T, opts ...Option) *Setting[T] {
+	s := Define(key, def, opts...)
+	t.Cleanup(func() {
+		definitionsMux.Lock()
+		delete(definitions, key)
+		definitionsMux.Unlock()
+	})
+	return s
+}
+
+func TestDecode(t *testing.T) {
+	s := define(t, "test.limits", limits{PerMinute: 60, Burst: 10},
+		WithValidator(func(v limits) error {
+			if v.Burst > v.PerMinute {
+				return errors.New("burst above the rate")
+			}
+			return nil
+		}))
+	if s.def.Type != "object" || string(s.def.Default) != `{"per_minute":60,"burst":10}` {
+		t.Fatalf("unexpected definition %+v", s.def)
+	}
+
+	for _, raw := range []string{
+		`null`,
+		`"60"`,
+		`{"per_minute":60,"burst":10,"extra":1}`,
+		`{"per_minute":1.5}`,
+		`{"per_minute":10,"burst":20}`,
+		`{"per_minute":60} {}`,
+	} {
+		if _, err := s.def.Decode([]byte(raw)); !errors.Is(err, ErrInvalid) {
+			t.Errorf("%s: expected ErrInvalid, got %v", raw, err)
+		}
+	}
+	v, err := s.def.Decode([]byte(`{"per_minute":120,"burst":20}`))
+	if err != nil || v.(limits) != (limits{PerMinute: 120, Burst: 20}) {
+		t.Fatalf("unexpected value %v (%v)", v, err)
+	}
+}
+
+func TestSetAndGet(t *testing.T) {
+	openSettings(t)
+	ctx := context.Background()
+	enabled := define(t, "test.enabled", true, Public())
+	rate := define(t, "test.rate", 60)
+
+	if !enabled.Get(ctx) || rate.Get(ctx) != 60 {
+		t.Fatal("expected the defaults")
+	}
+
+	entry, err := Set(ctx, "test.enabled", json.RawMessage(` false `), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !entry.Stored || entry.Version != 1 || string(entry.Value) != "false" {
+		t.Fatalf("unexpected entry %+v", entry)
+	}
+	// the cache still has the previous values until it is invalidated
+	if !enabled.Get(ctx) {
+		t.Fatal("expected the cached value")
+	}
+	Invalidate()
+	if enabled.Get(ctx) {
+		t.Fatal("expected the new value after the invalidation")
+	}
+	if v := PublicValues(ctx); len(v) != 1 || string(v["test.enabled"]) != "false" {
+		t.Fatalf("unexpected public values %s", v)
+	}
+
+	if _, err = Set(ctx, "test.rate", json.RawMessage(`"fast"`), 0); !errors.Is(err, ErrInvalid) {
+		t.Fatalf("expected ErrInvalid, got %v", err)
+	}
+	if _, err = Set(ctx, "test.unknown", json.RawMessage(`1`), 0); !errors.Is(err, ErrUnknown) {
+		t.Fatalf("expected ErrUnknown, got %v", err)
+	}
+
+	// a stale version is rejected
+	if _, err = Set(ctx, "test.enabled", json.RawMessage(`true`), 2); !errors.Is(err, db.ErrConflict) {
+		t.Fatalf("expected a conflict, got %v", err)
+	}
+	if entry, err = Set(ctx, "test.enabled", json.RawMessage(`true`), 1); err != nil || entry.Version != 2 {
+		t.Fatalf("expected version 2, got %+v (%v)", entry, err)
+	}
+	if _, err = Reset(ctx, "test.enabled", 1); !errors.Is(err, db.ErrConflict) {
+		t.Fatalf("expected a conflict, got %v", err)
+	}
+	if entry, err = Reset(ctx, "test.enabled", 2); err != nil || entry.Stored || string(entry.Value) != "true" {
+		t.Fatalf("expected the default back, got %+v (%v)", entry, err)
+	}
+
+	changes, total, err := db.ListSettingChanges(ctx, db.SettingChangeFilter{Key: "test.enabled", Limit: 10})
+	if err != nil || total != 3 {
+		t.Fatalf("expected 3 changes, got %d (%v)", total, err)
+	}
+	if changes[0].Action != model.AuditActionDelete || changes[0].NewValue != nil || *changes[0].OldValue != "true" ||
+		changes[2].Action != model.AuditActionCreate || changes[2].OldValue != nil || *changes[2].NewValue != "false" {
+		t.Fatalf("unexpected history %+v %+v", changes[0], changes[2])
+	}
+}
+
+func TestPublicActorIDs(t *testing.T) {
+	openSettings(t)
+	if err := db.GetDB().AutoMigrate(new(model.User)); err != nil {
+		t.Fatal(err)
+	}
+	admin := &model.User{Username: "admin"}
+	if err := db.Users().Create(context.Background(), admin); err != nil {
+		t.Fatal(err)
+	}
+	ctx := pkgctx.WithUserID(context.Background(), uint64(admin.ID))
+	define(t, "test.banner", "")
+
+	if _, err := Set(ctx, "test.banner", json.RawMessage(`"hello"`), 0); err != nil {
+		t.Fatal(err)
+	}
+	// stamped by bootstrap.ActorPlugin in the application
+	if err := db.GetDB().Model(&model.Setting{}).Where("name = ?", "test.banner").UpdateColumn("updated_by", admin.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	entry, err := Get(ctx, "test.banner")
+	if err != nil || entry.UpdatedBy != admin.PublicID {
+		t.Fatalf("expected the public id of the writer, got %+v (%v)", entry, err)
+	}
+	changes, _, err := db.ListSettingChanges(ctx, db.SettingChangeFilter{Key: "test.banner", Limit: 10})
+	if err != nil || len(changes) != 1 || changes[0].Actor != admin.PublicID {
+		t.Fatalf("expected the public id of the actor, got %+v (%v)", changes, err)
+	}
+	b, _ := json.Marshal(changes[0])
+	if strings.Contains(string(b), `"id"`) {
+		t.Fatalf("expected no internal id in %s", b)
+	}
+}
+
+func TestCacheTTL(t *testing.T) {
+	openSettings(t)
+	ctx := context.Background()
+	banner := define(t, "test.banner", "")
+
+	stored.SetTTL(20 * time.Millisecond)
+	t.Cleanup(func() { stored.SetTTL(defaultCacheTTL) })
+
+	if banner.Get(ctx) != "" {
+		t.Fatal("expected the default")
+	}
+	// written by another replica, this one has no invalidation
+	if _, _, err := db.SaveSetting(ctx, "test.banner", `"hello"`, 0); err != nil {
+		t.Fatal(err)
+	}
+	if banner.Get(ctx) != "" {
+		t.Fatal("expected the cached value")
+	}
+	time.Sleep(30 * time.Millisecond)
+	if banner.Get(ctx) != "hello" {
+		t.Fatal("expected the value once the cache expired")
+	}
+}
@@ -18,6 +18,10 @@ var (
 
 type Payload struct {
 	UserID uint64
+	// Roles and Tenant are read from the optional "roles" and "tenant"
+	// claims.
+	Roles  []string
+	Tenant string
 }
 
 func secretFunc(secret string) jwt.Keyfunc {
@@ -50,6 +54,14 @@ func Parse(tokenString string, secret string) (*Payload, error) {
 
 	payloads := &Payload{}
 	payloads.UserID = uint64(claims["user_id"].(float64))
+	if roles, ok := claims["roles"].([]interface{}); ok {
+		for _, role := range roles {
+			if r, ok := role.(string); ok {
+				payloads.Roles = append(payloads.Roles, r)
+			}
+		}
+	}
+	payloads.Tenant, _ = claims["tenant"].(string)
 
 	return payloads, nil
 }
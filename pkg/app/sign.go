@@ -0,0 +1,54 @@
+package app
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+var (
+	ErrURLExpired   = errors.New("the signed url has expired")
+	ErrURLSignature = errors.New("the signed url signature is invalid")
+)
+
+const (
+	expiresParam   = "expires"
+	signatureParam = "signature"
+)
+
+// SignURL returns the query that authorizes a request to path until expires.
+func SignURL(path string, expires time.Time, secret string) url.Values {
+	exp := strconv.FormatInt(expires.Unix(), 10)
+	return url.Values{
+		expiresParam:   []string{exp},
+		signatureParam: []string{urlSignature(path, exp, secret)},
+	}
+}
+
+// VerifyURL checks a query produced by SignURL for path.
+func VerifyURL(path string, query url.Values, secret string, now time.Time) error {
+	exp := query.Get(expiresParam)
+	expires, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil {
+		return ErrURLSignature
+	}
+
+	expected := urlSignature(path, exp, secret)
+	if !hmac.Equal([]byte(expected), []byte(query.Get(signatureParam))) {
+		return ErrURLSignature
+	}
+	if now.Unix() > expires {
+		return ErrURLExpired
+	}
+	return nil
+}
+
+func urlSignature(path, expires, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(path + "\n" + expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,38 @@
+package app
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSignURL(t *testing.T) {
+	now := time.Now()
+	path := "/api/files/01HZX/download"
+	query := SignURL(path, now.Add(time.Minute), "secret")
+
+	if err := VerifyURL(path, query, "secret", now); err != nil {
+		t.Fatalf("expected the signed url to be valid, got %v", err)
+	}
+	if err := VerifyURL(path, query, "secret", now.Add(2*time.Minute)); !errors.Is(err, ErrURLExpired) {
+		t.Fatalf("expected ErrURLExpired, got %v", err)
+	}
+	if err := VerifyURL(path, query, "other", now); !errors.Is(err, ErrURLSignature) {
+		t.Fatalf("expected another secret to be refused, got %v", err)
+	}
+	if err := VerifyURL("/api/files/01HZY/download", query, "secret", now); !errors.Is(err, ErrURLSignature) {
+		t.Fatalf("expected another path to be refused, got %v", err)
+	}
+
+	// extending the expiry invalidates the signature
+	extended := SignURL(path, now.Add(time.Minute), "secret")
+	extended.Set(expiresParam, SignURL(path, now.Add(time.Hour), "secret").Get(expiresParam))
+	if err := VerifyURL(path, extended, "secret", now); !errors.Is(err, ErrURLSignature) {
+		t.Fatalf("expected a changed expiry to be refused, got %v", err)
+	}
+
+	query.Del(expiresParam)
+	if err := VerifyURL(path, query, "secret", now); !errors.Is(err, ErrURLSignature) {
+		t.Fatalf("expected a missing expiry to be refused, got %v", err)
+	}
+}
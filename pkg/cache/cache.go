@@ -0,0 +1,301 @@
+// Package cache caches values by key on a pluggable backend, an LRU kept in
+// memory or a server speaking the Redis protocol.
+//
+// A Cache loads the missing values itself, the concurrent misses of a key
+// sharing a single load, and may remember that a value does not exist. The
+// reads made on behalf of a request are recorded in its trace along with its
+// SQL statements.
+package cache
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"errors"
+	pkgctx "go-server-template/pkg/context"
+	"go-server-template/pkg/logger"
+	"go-server-template/pkg/trace"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	None   = "none"
+	Memory = "memory"
+	Redis  = "redis"
+)
+
+// Backend stores opaque values by key for a limited time.
+type Backend interface {
+	// Get returns the value of key, ok is false when it is missing or
+	// expired.
+	Get(ctx context.Context, key string) (value []byte, ok bool, err error)
+
+	// Set stores value under key for ttl, 0 meaning until evicted.
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+
+	// Delete removes the keys, deleting a missing key is not an error.
+	Delete(ctx context.Context, keys ...string) error
+}
+
+var globalBackend Backend
+
+func GetBackend() Backend {
+	return globalBackend
+}
+
+// Init sets the backend returned by GetBackend, nil disables the caches
+// using it.
+func Init(b Backend) Backend {
+	globalBackend = b
+	return b
+}
+
+// The first byte of a stored entry.
+const (
+	entryValue    byte = 'v'
+	entryNotFound byte = 'n'
+)
+
+// DefaultLoadTimeout bounds a load when the cache sets no timeout of its own.
+const DefaultLoadTimeout = 10 * time.Second
+
+type options struct {
+	backend     Backend
+	ttl         time.Duration
+	notFound    error
+	negativeTTL time.Duration
+	loadTimeout time.Duration
+}
+
+type Option func(*options)
+
+// WithBackend makes the cache use b rather than the backend of GetBackend.
+func WithBackend(b Backend) Option {
+	return func(o *options) {
+		o.backend = b
+	}
+}
+
+// WithTTL keeps the values for ttl, the cache is disabled without it.
+func WithTTL(ttl time.Duration) Option {
+	return func(o *options) {
+		o.ttl = ttl
+	}
+}
+
+// WithNegative remembers for ttl that a value does not exist, when its load
+// returns an error matching notFound. Such a hit returns notFound.
+func WithNegative(notFound error, ttl time.Duration) Option {
+	return func(o *options) {
+		o.notFound = notFound
+		o.negativeTTL = ttl
+	}
+}
+
+// WithLoadTimeout bounds a load, which is shared by the concurrent misses of
+// its key and thus not canceled with the caller that started it.
+func WithLoadTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.loadTimeout = timeout
+	}
+}
+
+// Cache caches the values of type T under the keys prefixed with its name.
+// The values are gob encoded, every Get returns a copy of its own.
+type Cache[T any] struct {
+	name  string
+	opts  options
+	group singleflight.Group
+	// generation grows on every deletion, so a load started before a write
+	// does not put the older value back.
+	generation atomic.Uint64
+}
+
+func New[T any](name string, opts ...Option) *Cache[T] {
+	c := &Cache[T]{name: name}
+	for _, opt := range opts {
+		opt(&c.opts)
+	}
+	return c
+}
+
+func (c *Cache[T]) backend() Backend {
+	if c.opts.ttl <= 0 {
+		return nil
+	}
+	if c.opts.backend != nil {
+		return c.opts.backend
+	}
+	return GetBackend()
+}
+
+func (c *Cache[T]) key(key string) string {
+	return c.name + ":" + key
+}
+
+// Get returns the value of key, calling load when it is not cached. The
+// concurrent misses of key wait for the first one to load it, each as long as
+// its own ctx allows. The load gets the values of the first ctx but neither
+// its deadline nor its cancellation, see WithLoadTimeout. A backend failing
+// is logged and the value loaded anyway.
+func (c *Cache[T]) Get(ctx context.Context, key string, load func(ctx context.Context) (*T, error)) (*T, error) {
+	backend := c.backend()
+	if backend == nil {
+		return load(ctx)
+	}
+
+	start := time.Now()
+	key = c.key(key)
+	data, ok, err := backend.Get(ctx, key)
+	if err != nil {
+		logger.GetLogger().Warnf("Failed to read cache %s: %s", key, err.Error())
+		v, err := load(ctx)
+		record(ctx, key, trace.CacheError, start)
+		return v, err
+	}
+	if ok {
+		v, err := c.decode(data)
+		if err == nil || errors.Is(err, c.opts.notFound) {
+			result := trace.CacheHit
+			if err != nil {
+				result = trace.CacheNegativeHit
+			}
+			record(ctx, key, result, start)
+			return v, err
+		}
+		logger.GetLogger().Warnf("Ignoring cache entry %s: %s", key, err.Error())
+	}
+
+	generation := c.generation.Load()
+	loaded := c.group.DoChan(key, func() (interface{}, error) {
+		loadCtx, cancel := context.WithTimeout(detach(ctx), c.loadTimeout())
+		defer cancel()
+		return c.load(loadCtx, backend, key, generation, load)
+	})
+
+	var res singleflight.Result
+	select {
+	case <-ctx.Done():
+		record(ctx, key, trace.CacheError, start)
+		return nil, ctx.Err()
+	case res = <-loaded:
+	}
+	result := trace.CacheMiss
+	if res.Shared {
+		result = trace.CacheShared
+	}
+	record(ctx, key, result, start)
+	if res.Err != nil {
+		return nil, res.Err
+	}
+	return c.decode(res.Val.([]byte))
+}
+
+func (c *Cache[T]) loadTimeout() time.Duration {
+	if c.opts.loadTimeout <= 0 {
+		return DefaultLoadTimeout
+	}
+	return c.opts.loadTimeout
+}
+
+// detached keeps the values of a context, without its deadline and its
+// cancellation.
+type detached struct {
+	parent context.Context
+}
+
+func detach(ctx context.Context) context.Context {
+	return detached{parent: ctx}
+}
+
+func (d detached) Deadline() (time.Time, bool)       { return time.Time{}, false }
+func (d detached) Done() <-chan struct{}             { return nil }
+func (d detached) Err() error                        { return nil }
+func (d detached) Value(key interface{}) interface{} { return d.parent.Value(key) }
+
+// load calls load and stores its outcome, which is returned encoded so each
+// waiting caller decodes a copy of its own.
+func (c *Cache[T]) load(ctx context.Context, backend Backend, key string, generation uint64, load func(ctx context.Context) (*T, error)) ([]byte, error) {
+	v, err := load(ctx)
+	var (
+		data []byte
+		ttl  time.Duration
+	)
+	switch {
+	case err == nil:
+		var buf bytes.Buffer
+		buf.WriteByte(entryValue)
+		if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+			return nil, err
+		}
+		data, ttl = buf.Bytes(), c.opts.ttl
+	case c.opts.notFound != nil && errors.Is(err, c.opts.notFound) && c.opts.negativeTTL > 0:
+		data, ttl = []byte{entryNotFound}, c.opts.negativeTTL
+	default:
+		return nil, err
+	}
+
+	if c.generation.Load() == generation {
+		if err := backend.Set(ctx, key, data, ttl); err != nil {
+			logger.GetLogger().Warnf("Failed to write cache %s: %s", key, err.Error())
+		}
+	}
+	return data, nil
+}
+
+func (c *Cache[T]) decode(data []byte) (*T, error) {
+	if len(data) == 0 {
+		return nil, errors.New("empty entry")
+	}
+	switch data[0] {
+	case entryNotFound:
+		if c.opts.notFound == nil {
+			return nil, errors.New("unexpected negative entry")
+		}
+		return nil, c.opts.notFound
+	case entryValue:
+		v := new(T)
+		if err := gob.NewDecoder(bytes.NewReader(data[1:])).Decode(v); err != nil {
+			return nil, err
+		}
+		return v, nil
+	}
+	return nil, errors.New("unknown entry")
+}
+
+// Delete drops the cached values of keys. It must be called after every
+// write of the values, once its transaction committed.
+func (c *Cache[T]) Delete(ctx context.Context, keys ...string) error {
+	c.generation.Add(1)
+	full := make([]string, len(keys))
+	for i, key := range keys {
+		full[i] = c.key(key)
+		// the later misses must not wait for a load started before
+		c.group.Forget(full[i])
+	}
+
+	backend := c.backend()
+	if backend == nil || len(keys) == 0 {
+		return nil
+	}
+	return backend.Delete(ctx, full...)
+}
+
+// record appends the read of key to the trace of the request behind ctx.
+func record(ctx context.Context, key, result string, start time.Time) {
+	c, ok := pkgctx.GinContext(ctx)
+	if !ok {
+		return
+	}
+	if t := trace.GetTrace(c); t != nil {
+		t.AppendCache(&trace.Cache{
+			Timestamp:   time.Now().Format(time.RFC3339),
+			Key:         key,
+			Result:      result,
+			CostSeconds: time.Since(start).Milliseconds(),
+		})
+	}
+}
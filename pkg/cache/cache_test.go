@@ -0,0 +1,265 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"go-server-template/pkg/logger"
+	"go-server-template/pkg/trace"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type item struct {
+	ID   uint
+	Name string
+}
+
+var errNotFound = errors.New("not found")
+
+func TestMemoryBackend(t *testing.T) {
+	ctx := context.Background()
+	b := NewMemoryBackend(3, 10).(*memoryBackend)
+	now := time.Now()
+	b.now = func() time.Time { return now }
+
+	_ = b.Set(ctx, "a", []byte("1"), 0)
+	_ = b.Set(ctx, "b", []byte("2"), time.Second)
+	_ = b.Set(ctx, "c", []byte("3"), 0)
+	if _, ok, _ := b.Get(ctx, "a"); !ok {
+		t.Fatal("expected a")
+	}
+
+	// b is now the least recently used
+	_ = b.Set(ctx, "d", []byte("4"), 0)
+	if _, ok, _ := b.Get(ctx, "b"); ok {
+		t.Fatal("expected b to be evicted by the entry limit")
+	}
+
+	// the size limit evicts the least recently used until the value fits
+	_ = b.Set(ctx, "e", []byte("12345678"), 0)
+	if _, ok, _ := b.Get(ctx, "c"); ok || b.size > 10 {
+		t.Fatalf("expected c to be evicted by the size limit, size %d", b.size)
+	}
+	if _, ok, _ := b.Get(ctx, "e"); !ok {
+		t.Fatal("expected e")
+	}
+	if _ = b.Set(ctx, "f", make([]byte, 11), 0); b.lru.Len() != 3 {
+		t.Fatal("a value above the size limit must not be stored")
+	}
+
+	_ = b.Set(ctx, "g", []byte("7"), time.Second)
+	now = now.Add(time.Second)
+	if _, ok, _ := b.Get(ctx, "g"); ok {
+		t.Fatal("expected g to be expired")
+	}
+
+	_ = b.Delete(ctx, "e", "missing")
+	if _, ok, _ := b.Get(ctx, "e"); ok || b.size != 1 {
+		t.Fatalf("expected e to be deleted, size %d", b.size)
+	}
+}
+
+func TestCache(t *testing.T) {
+	logger.Init("zap")
+	ctx := context.Background()
+	c := New[item]("item", WithBackend(NewMemoryBackend(0, 0)), WithTTL(time.Minute), WithNegative(errNotFound, time.Minute))
+
+	var loads atomic.Int32
+	load := func(id uint) func(ctx context.Context) (*item, error) {
+		return func(ctx context.Context) (*item, error) {
+			loads.Add(1)
+			if id == 0 {
+				return nil, errNotFound
+			}
+			return &item{ID: id, Name: "first"}, nil
+		}
+	}
+
+	v, err := c.Get(ctx, "1", load(1))
+	if err != nil || v.Name != "first" {
+		t.Fatalf("unexpected %v (%v)", v, err)
+	}
+	v.Name = "changed"
+	if v, _ = c.Get(ctx, "1", load(1)); v.Name != "first" || loads.Load() != 1 {
+		t.Fatalf("expected an unchanged copy from the cache, got %v after %d loads", v, loads.Load())
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err = c.Get(ctx, "0", load(0)); !errors.Is(err, errNotFound) {
+			t.Fatalf("expected not found, got %v", err)
+		}
+	}
+	if loads.Load() != 2 {
+		t.Fatalf("expected the missing value to be cached, got %d loads", loads.Load())
+	}
+
+	// other errors are not cached
+	failing := func(ctx context.Context) (*item, error) {
+		loads.Add(1)
+		return nil, errors.New("boom")
+	}
+	_, _ = c.Get(ctx, "2", failing)
+	_, _ = c.Get(ctx, "2", failing)
+	if loads.Load() != 4 {
+		t.Fatalf("expected errors to be loaded again, got %d loads", loads.Load())
+	}
+
+	if err = c.Delete(ctx, "1", "0"); err != nil {
+		t.Fatal(err)
+	}
+	_, _ = c.Get(ctx, "1", load(1))
+	_, _ = c.Get(ctx, "0", load(0))
+	if loads.Load() != 6 {
+		t.Fatalf("expected the deleted keys to be loaded again, got %d loads", loads.Load())
+	}
+
+	// disabled without a ttl
+	disabled := New[item]("item", WithBackend(NewMemoryBackend(0, 0)))
+	_, _ = disabled.Get(ctx, "1", load(1))
+	_, _ = disabled.Get(ctx, "1", load(1))
+	if loads.Load() != 8 {
+		t.Fatalf("expected a disabled cache to always load, got %d loads", loads.Load())
+	}
+}
+
+func TestCacheSingleflight(t *testing.T) {
+	logger.Init("zap")
+	c := New[item]("item", WithBackend(NewMemoryBackend(0, 0)), WithTTL(time.Minute))
+
+	var loads atomic.Int32
+	release := make(chan struct{})
+	load := func(ctx context.Context) (*item, error) {
+		loads.Add(1)
+		<-release
+		return &item{ID: 1}, nil
+	}
+
+	const callers = 10
+	var started, done sync.WaitGroup
+	results := make([]*item, callers)
+	for i := 0; i < callers; i++ {
+		started.Add(1)
+		done.Add(1)
+		go func(i int) {
+			defer done.Done()
+			started.Done()
+			results[i], _ = c.Get(context.Background(), "1", load)
+		}(i)
+	}
+	started.Wait()
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	done.Wait()
+
+	if loads.Load() != 1 {
+		t.Fatalf("expected a single load, got %d", loads.Load())
+	}
+	for i, v := range results {
+		if v == nil || v.ID != 1 || (i > 0 && v == results[0]) {
+			t.Fatalf("expected a copy of the value for every caller, got %v", v)
+		}
+	}
+}
+
+func TestCacheDetachedLoad(t *testing.T) {
+	logger.Init("zap")
+	c := New[item]("item", WithBackend(NewMemoryBackend(0, 0)), WithTTL(time.Minute), WithLoadTimeout(time.Second))
+
+	type key struct{}
+	first, cancel := context.WithCancel(context.WithValue(context.Background(), key{}, "first"))
+	loading, release := make(chan struct{}), make(chan struct{})
+	var loadErr error
+	load := func(ctx context.Context) (*item, error) {
+		close(loading)
+		<-release
+		if deadline, ok := ctx.Deadline(); !ok || time.Until(deadline) > time.Second {
+			loadErr = errors.New("expected the load timeout")
+		} else if ctx.Err() != nil || ctx.Value(key{}) != "first" {
+			loadErr = errors.New("expected the values of the first caller without its cancellation")
+		}
+		return &item{ID: 1}, loadErr
+	}
+
+	firstErr := make(chan error)
+	go func() {
+		_, err := c.Get(first, "1", load)
+		firstErr <- err
+	}()
+	<-loading
+	cancel()
+	if err := <-firstErr; !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the first caller to give up with its context, got %v", err)
+	}
+
+	// the next miss waits for the load started by the first caller
+	second := make(chan *item)
+	go func() {
+		v, _ := c.Get(context.Background(), "1", nil)
+		second <- v
+	}()
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	if v := <-second; v == nil || v.ID != 1 || loadErr != nil {
+		t.Fatalf("expected the shared load to complete, got %v (%v)", v, loadErr)
+	}
+}
+
+func TestCacheInvalidateDuringLoad(t *testing.T) {
+	logger.Init("zap")
+	ctx := context.Background()
+	c := New[item]("item", WithBackend(NewMemoryBackend(0, 0)), WithTTL(time.Minute))
+
+	loading, release := make(chan struct{}), make(chan struct{})
+	go func() {
+		_, _ = c.Get(ctx, "1", func(ctx context.Context) (*item, error) {
+			close(loading)
+			<-release
+			return &item{ID: 1, Name: "stale"}, nil
+		})
+	}()
+	<-loading
+	// a write committed while the older value is loaded
+	_ = c.Delete(ctx, "1")
+	v, _ := c.Get(ctx, "1", func(ctx context.Context) (*item, error) {
+		return &item{ID: 1, Name: "fresh"}, nil
+	})
+	close(release)
+	if v.Name != "fresh" {
+		t.Fatalf("expected the later miss not to wait for the older load, got %v", v)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	if v, _ = c.Get(ctx, "1", nil); v.Name != "fresh" {
+		t.Fatalf("expected the older load not to be cached, got %v", v)
+	}
+}
+
+func TestCacheTrace(t *testing.T) {
+	logger.Init("zap")
+	c := New[item]("item", WithBackend(NewMemoryBackend(0, 0)), WithTTL(time.Minute), WithNegative(errNotFound, time.Minute))
+
+	g, _ := gin.CreateTestContext(httptest.NewRecorder())
+	tr := trace.New("")
+	g.Set(trace.Header, tr)
+
+	load := func(ctx context.Context) (*item, error) { return &item{ID: 1}, nil }
+	_, _ = c.Get(g, "1", load)
+	_, _ = c.Get(g, "1", load)
+	_, _ = c.Get(g, "0", func(ctx context.Context) (*item, error) { return nil, errNotFound })
+	_, _ = c.Get(g, "0", nil)
+
+	want := []string{trace.CacheMiss, trace.CacheHit, trace.CacheMiss, trace.CacheNegativeHit}
+	if len(tr.Caches) != len(want) {
+		t.Fatalf("expected %d cache reads in the trace, got %d", len(want), len(tr.Caches))
+	}
+	for i, r := range tr.Caches {
+		if r.Result != want[i] || r.Key == "" {
+			t.Fatalf("read %d: expected %s, got %+v", i, want[i], r)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+var _ Backend = (*memoryBackend)(nil)
+
+type memoryEntry struct {
+	key       string
+	value     []byte
+	expiresAt time.Time
+}
+
+// memoryBackend is an LRU bounded by its number of entries and their total
+// size, the least recently used entries being evicted first.
+type memoryBackend struct {
+	mux        sync.Mutex
+	maxEntries int
+	maxBytes   int64
+	size       int64
+	lru        *list.List // front is the most recently used
+	entries    map[string]*list.Element
+	now        func() time.Time
+}
+
+// NewMemoryBackend returns a Backend kept in memory holding up to maxEntries
+// values of up to maxBytes in total, 0 meaning no limit.
+func NewMemoryBackend(maxEntries int, maxBytes int64) Backend {
+	return &memoryBackend{
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+		lru:        list.New(),
+		entries:    make(map[string]*list.Element),
+		now:        time.Now,
+	}
+}
+
+func (b *memoryBackend) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	e, ok := b.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+	entry := e.Value.(*memoryEntry)
+	if !entry.expiresAt.IsZero() && !b.now().Before(entry.expiresAt) {
+		b.remove(e)
+		return nil, false, nil
+	}
+	b.lru.MoveToFront(e)
+	return entry.value, true, nil
+}
+
+func (b *memoryBackend) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	if e, ok := b.entries[key]; ok {
+		b.remove(e)
+	}
+	if b.maxBytes > 0 && int64(len(value)) > b.maxBytes {
+		// would evict everything else and still not fit
+		return nil
+	}
+
+	entry := &memoryEntry{key: key, value: value}
+	if ttl > 0 {
+		entry.expiresAt = b.now().Add(ttl)
+	}
+	b.entries[key] = b.lru.PushFront(entry)
+	b.size += int64(len(value))
+
+	for (b.maxEntries > 0 && b.lru.Len() > b.maxEntries) || (b.maxBytes > 0 && b.size > b.maxBytes) {
+		b.remove(b.lru.Back())
+	}
+	return nil
+}
+
+func (b *memoryBackend) Delete(ctx context.Context, keys ...string) error {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	for _, key := range keys {
+		if e, ok := b.entries[key]; ok {
+			b.remove(e)
+		}
+	}
+	return nil
+}
+
+func (b *memoryBackend) remove(e *list.Element) {
+	entry := b.lru.Remove(e).(*memoryEntry)
+	delete(b.entries, entry.key)
+	b.size -= int64(len(entry.value))
+}
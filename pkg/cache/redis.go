@@ -0,0 +1,258 @@
+package cache
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+// RedisConfig configures a backend speaking the Redis protocol (Redis,
+// Valkey, KeyDB...).
+type RedisConfig struct {
+	// Addr is the host:port of the server.
+	Addr     string
+	Password string
+	DB       int
+	// PoolSize is the number of idle connections kept open.
+	PoolSize int
+	// Timeout bounds the dial and every command, in addition to the
+	// deadline of its context.
+	Timeout time.Duration
+}
+
+var _ Backend = (*redisBackend)(nil)
+
+// RedisError is an error reply of the server.
+type RedisError string
+
+func (e RedisError) Error() string {
+	return "redis: " + string(e)
+}
+
+type redisBackend struct {
+	cfg  RedisConfig
+	idle chan *redisConn
+}
+
+type redisConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+	w    *bufio.Writer
+}
+
+// NewRedisBackend returns a Backend storing the values on a Redis server.
+// The connections are opened on demand.
+func NewRedisBackend(cfg RedisConfig) (Backend, error) {
+	if cfg.Addr == "" {
+		return nil, errors.New("cache: missing redis address")
+	}
+	if cfg.PoolSize <= 0 {
+		cfg.PoolSize = 10
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = time.Second
+	}
+	return &redisBackend{cfg: cfg, idle: make(chan *redisConn, cfg.PoolSize)}, nil
+}
+
+func (b *redisBackend) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	reply, err := b.do(ctx, "GET", []byte(key))
+	if err != nil {
+		return nil, false, err
+	}
+	if reply == nil {
+		return nil, false, nil
+	}
+	value, ok := reply.([]byte)
+	if !ok {
+		return nil, false, fmt.Errorf("redis: unexpected reply %v to GET", reply)
+	}
+	return value, true, nil
+}
+
+func (b *redisBackend) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	args := [][]byte{[]byte(key), value}
+	if ttl > 0 {
+		args = append(args, []byte("PX"), []byte(strconv.FormatInt(ttl.Milliseconds(), 10)))
+	}
+	_, err := b.do(ctx, "SET", args...)
+	return err
+}
+
+func (b *redisBackend) Delete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	args := make([][]byte, len(keys))
+	for i, key := range keys {
+		args[i] = []byte(key)
+	}
+	_, err := b.do(ctx, "DEL", args...)
+	return err
+}
+
+// do sends a command on an idle connection and returns its reply, a
+// RedisError for an error reply. The connection is dropped on any other
+// error since its state is unknown.
+func (b *redisBackend) do(ctx context.Context, command string, args ...[]byte) (interface{}, error) {
+	c, err := b.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	reply, err := c.do(b.deadline(ctx), command, args...)
+	var redisErr RedisError
+	if err != nil && !errors.As(err, &redisErr) {
+		_ = c.conn.Close()
+		return nil, err
+	}
+	b.put(c)
+	return reply, err
+}
+
+func (b *redisBackend) deadline(ctx context.Context) time.Time {
+	deadline := time.Now().Add(b.cfg.Timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		return d
+	}
+	return deadline
+}
+
+func (b *redisBackend) get(ctx context.Context) (*redisConn, error) {
+	select {
+	case c := <-b.idle:
+		return c, nil
+	default:
+	}
+
+	dialer := net.Dialer{Deadline: b.deadline(ctx)}
+	conn, err := dialer.DialContext(ctx, "tcp", b.cfg.Addr)
+	if err != nil {
+		return nil, err
+	}
+	c := &redisConn{conn: conn, r: bufio.NewReader(conn), w: bufio.NewWriter(conn)}
+	if b.cfg.Password != "" {
+		if _, err = c.do(b.deadline(ctx), "AUTH", []byte(b.cfg.Password)); err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+	}
+	if b.cfg.DB != 0 {
+		if _, err = c.do(b.deadline(ctx), "SELECT", []byte(strconv.Itoa(b.cfg.DB))); err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func (b *redisBackend) put(c *redisConn) {
+	select {
+	case b.idle <- c:
+	default:
+		_ = c.conn.Close()
+	}
+}
+
+func (c *redisConn) do(deadline time.Time, command string, args ...[]byte) (interface{}, error) {
+	if err := c.conn.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+	if err := writeCommand(c.w, command, args...); err != nil {
+		return nil, err
+	}
+	if err := c.w.Flush(); err != nil {
+		return nil, err
+	}
+	return readReply(c.r)
+}
+
+// writeCommand writes the command as an array of bulk strings.
+func writeCommand(w *bufio.Writer, command string, args ...[]byte) error {
+	fmt.Fprintf(w, "*%d\r\n$%d\r\n%s\r\n", len(args)+1, len(command), command)
+	for _, arg := range args {
+		fmt.Fprintf(w, "$%d\r\n", len(arg))
+		w.Write(arg)
+		if _, err := w.WriteString("\r\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readReply reads a reply, returned as a string for a status, an int64 for
+// an integer, a []byte for a bulk string, nil for a null bulk string and a
+// []interface{} for an array.
+func readReply(r *bufio.Reader) (interface{}, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 {
+		return nil, errors.New("redis: empty reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return string(line[1:]), nil
+	case '-':
+		return nil, RedisError(line[1:])
+	case ':':
+		return strconv.ParseInt(string(line[1:]), 10, 64)
+	case '$':
+		n, err := strconv.Atoi(string(line[1:]))
+		if err != nil || n < -1 {
+			return nil, fmt.Errorf("redis: invalid bulk length %q", line[1:])
+		}
+		if n == -1 {
+			return nil, nil
+		}
+		buf := make([]byte, n+2)
+		if _, err = io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		if buf[n] != '\r' || buf[n+1] != '\n' {
+			return nil, fmt.Errorf("redis: bulk string of %d bytes not terminated", n)
+		}
+		return buf[:n], nil
+	case '*':
+		n, err := strconv.Atoi(string(line[1:]))
+		if err != nil || n < -1 {
+			return nil, fmt.Errorf("redis: invalid array length %q", line[1:])
+		}
+		if n == -1 {
+			return nil, nil
+		}
+		items := make([]interface{}, n)
+		for i := range items {
+			// an error item is a value of the array, not a failure
+			item, err := readReply(r)
+			var redisErr RedisError
+			if err != nil && !errors.As(err, &redisErr) {
+				return nil, err
+			}
+			if err != nil {
+				item = redisErr
+			}
+			items[i] = item
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("redis: unknown reply %q", line)
+}
+
+func readLine(r *bufio.Reader) ([]byte, error) {
+	line, err := r.ReadSlice('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return nil, fmt.Errorf("redis: malformed line %q", line)
+	}
+	return line[:len(line)-2], nil
+}
@@ -0,0 +1,262 @@
+package cache
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRedis is a local stand-in for a Redis server, it answers the commands
+// used by the backend from a memory backend.
+type fakeRedis struct {
+	t        *testing.T
+	listener net.Listener
+	password string
+	store    Backend
+
+	mux      sync.Mutex
+	commands []string
+	conns    int
+}
+
+func newFakeRedis(t *testing.T, password string) *fakeRedis {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeRedis{t: t, listener: l, password: password, store: NewMemoryBackend(0, 0)}
+	t.Cleanup(func() { _ = l.Close() })
+	go f.serve()
+	return f
+}
+
+func (f *fakeRedis) serve() {
+	for {
+		conn, err := f.listener.Accept()
+		if err != nil {
+			return
+		}
+		f.mux.Lock()
+		f.conns++
+		f.mux.Unlock()
+		go f.handle(conn)
+	}
+}
+
+func (f *fakeRedis) handle(conn net.Conn) {
+	defer conn.Close()
+	r, w := bufio.NewReader(conn), bufio.NewWriter(conn)
+	authorized := f.password == ""
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			fmt.Fprint(w, "-ERR protocol error\r\n")
+			_ = w.Flush()
+			return
+		}
+		name := strings.ToUpper(string(args[0]))
+		f.mux.Lock()
+		f.commands = append(f.commands, name)
+		f.mux.Unlock()
+
+		ctx := context.Background()
+		switch {
+		case name == "AUTH":
+			authorized = string(args[1]) == f.password
+			if !authorized {
+				fmt.Fprint(w, "-WRONGPASS invalid password\r\n")
+				break
+			}
+			fmt.Fprint(w, "+OK\r\n")
+		case !authorized:
+			fmt.Fprint(w, "-NOAUTH Authentication required.\r\n")
+		case name == "SELECT":
+			fmt.Fprint(w, "+OK\r\n")
+		case name == "GET":
+			value, ok, _ := f.store.Get(ctx, string(args[1]))
+			if !ok {
+				fmt.Fprint(w, "$-1\r\n")
+				break
+			}
+			fmt.Fprintf(w, "$%d\r\n%s\r\n", len(value), value)
+		case name == "SET":
+			var ttl time.Duration
+			if len(args) == 5 && strings.ToUpper(string(args[3])) == "PX" {
+				ms, _ := strconv.Atoi(string(args[4]))
+				ttl = time.Duration(ms) * time.Millisecond
+			}
+			_ = f.store.Set(ctx, string(args[1]), args[2], ttl)
+			fmt.Fprint(w, "+OK\r\n")
+		case name == "DEL":
+			keys := make([]string, 0, len(args)-1)
+			for _, arg := range args[1:] {
+				keys = append(keys, string(arg))
+			}
+			_ = f.store.Delete(ctx, keys...)
+			fmt.Fprintf(w, ":%d\r\n", len(keys))
+		default:
+			fmt.Fprintf(w, "-ERR unknown command '%s'\r\n", name)
+		}
+		if err = w.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// readCommand reads a command as sent by a client, an array of bulk strings.
+// It is written apart from readReply so the tests do not check the backend
+// against itself.
+func readCommand(r *bufio.Reader) ([][]byte, error) {
+	var n int
+	if _, err := fmt.Fscanf(r, "*%d\r\n", &n); err != nil || n <= 0 {
+		return nil, fmt.Errorf("expected an array, got %v", err)
+	}
+	args := make([][]byte, n)
+	for i := range args {
+		var size int
+		if _, err := fmt.Fscanf(r, "$%d\r\n", &size); err != nil {
+			return nil, err
+		}
+		args[i] = make([]byte, size+2)
+		if _, err := io.ReadFull(r, args[i]); err != nil {
+			return nil, err
+		}
+		if !bytes.HasSuffix(args[i], []byte("\r\n")) {
+			return nil, errors.New("unterminated bulk string")
+		}
+		args[i] = args[i][:size]
+	}
+	return args, nil
+}
+
+func TestWriteCommand(t *testing.T) {
+	var buf bytes.Buffer
+	w := bufio.NewWriter(&buf)
+	if err := writeCommand(w, "SET", []byte("k"), []byte("a\r\nb\x00"), []byte("")); err != nil {
+		t.Fatal(err)
+	}
+	_ = w.Flush()
+	if want := "*4\r\n$3\r\nSET\r\n$1\r\nk\r\n$5\r\na\r\nb\x00\r\n$0\r\n\r\n"; buf.String() != want {
+		t.Fatalf("got %q, want %q", buf.String(), want)
+	}
+}
+
+func TestReadReply(t *testing.T) {
+	for _, tt := range []struct {
+		raw  string
+		want interface{}
+		err  string
+	}{
+		{raw: "+OK\r\n", want: "OK"},
+		{raw: ":42\r\n", want: int64(42)},
+		{raw: ":-1\r\n", want: int64(-1)},
+		{raw: "$5\r\na\r\nb\x00\r\n", want: []byte("a\r\nb\x00")},
+		{raw: "$0\r\n\r\n", want: []byte{}},
+		{raw: "$-1\r\n", want: nil},
+		{raw: "*-1\r\n", want: nil},
+		{raw: "*0\r\n", want: []interface{}{}},
+		{raw: "*3\r\n$1\r\na\r\n:2\r\n-ERR in array\r\n", want: []interface{}{[]byte("a"), int64(2), RedisError("ERR in array")}},
+		{raw: "*2\r\n*1\r\n+x\r\n$-1\r\n", want: []interface{}{[]interface{}{"x"}, nil}},
+		{raw: "-WRONGTYPE bad key\r\n", err: "WRONGTYPE bad key"},
+		{raw: "+OK\n", err: "malformed line"},
+		{raw: "$3\r\nabcde", err: "not terminated"},
+		{raw: "$3\r\nab", err: "EOF"},
+		{raw: "$-2\r\n", err: "invalid bulk length"},
+		{raw: "*x\r\n", err: "invalid array length"},
+		{raw: "?\r\n", err: "unknown reply"},
+		{raw: "\r\n", err: "empty reply"},
+	} {
+		got, err := readReply(bufio.NewReader(strings.NewReader(tt.raw)))
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%q: expected an error with %q, got %v (%v)", tt.raw, tt.err, got, err)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q: got %#v (%v), want %#v", tt.raw, got, err, tt.want)
+		}
+	}
+}
+
+func TestRedisBackend(t *testing.T) {
+	f := newFakeRedis(t, "secret")
+	b, err := NewRedisBackend(RedisConfig{Addr: f.listener.Addr().String(), Password: "secret", DB: 2, PoolSize: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	if _, ok, err := b.Get(ctx, "missing"); ok || err != nil {
+		t.Fatalf("expected a miss, got %v (%v)", ok, err)
+	}
+	// binary values with line breaks survive the round trip
+	value := []byte("a\r\nb\x00c")
+	if err = b.Set(ctx, "k", value, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	got, ok, err := b.Get(ctx, "k")
+	if err != nil || !ok || string(got) != string(value) {
+		t.Fatalf("unexpected %q, %v (%v)", got, ok, err)
+	}
+	if err = b.Delete(ctx, "k", "other"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ = b.Get(ctx, "k"); ok {
+		t.Fatal("expected k to be deleted")
+	}
+
+	f.mux.Lock()
+	commands, conns := strings.Join(f.commands, " "), f.conns
+	f.mux.Unlock()
+	if commands != "AUTH SELECT GET SET GET DEL GET" || conns != 1 {
+		t.Fatalf("expected a single authenticated connection, got %d running %s", conns, commands)
+	}
+
+	wrong, _ := NewRedisBackend(RedisConfig{Addr: f.listener.Addr().String(), Password: "wrong"})
+	var redisErr RedisError
+	if _, _, err = wrong.Get(ctx, "k"); !errors.As(err, &redisErr) {
+		t.Fatalf("expected the error reply of the server, got %v", err)
+	}
+}
+
+func TestRedisCache(t *testing.T) {
+	f := newFakeRedis(t, "")
+	b, _ := NewRedisBackend(RedisConfig{Addr: f.listener.Addr().String()})
+	c := New[item]("item", WithBackend(b), WithTTL(time.Minute), WithNegative(errNotFound, time.Minute))
+	ctx := context.Background()
+
+	loads := 0
+	load := func(ctx context.Context) (*item, error) {
+		loads++
+		return &item{ID: 1, Name: "first"}, nil
+	}
+	for i := 0; i < 2; i++ {
+		if v, err := c.Get(ctx, "1", load); err != nil || v.Name != "first" {
+			t.Fatalf("unexpected %v (%v)", v, err)
+		}
+	}
+	_ = c.Delete(ctx, "1")
+	_, _ = c.Get(ctx, "1", load)
+	if loads != 2 {
+		t.Fatalf("expected 2 loads, got %d", loads)
+	}
+
+	// an unreachable server degrades to loading every time
+	_ = f.listener.Close()
+	down, _ := NewRedisBackend(RedisConfig{Addr: f.listener.Addr().String(), Timeout: 100 * time.Millisecond})
+	c = New[item]("item", WithBackend(down), WithTTL(time.Minute))
+	if v, err := c.Get(ctx, "1", load); err != nil || v == nil || loads != 3 {
+		t.Fatalf("expected the value to be loaded, got %v (%v)", v, err)
+	}
+}
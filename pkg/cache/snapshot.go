@@ -0,0 +1,81 @@
+package cache
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Snapshot keeps in memory a value loaded as a whole, the rows of a small
+// table for instance, for a TTL. A single load runs at a time, the
+// concurrent reads of a stale value wait for its result.
+type Snapshot[T any] struct {
+	load func(ctx context.Context) (T, error)
+
+	mux      sync.RWMutex
+	ttl      time.Duration
+	value    T
+	loaded   bool
+	loadedAt time.Time
+	// generation grows on every invalidation, so a load started before a
+	// write does not put the older value back.
+	generation uint64
+
+	loading sync.Mutex
+}
+
+// NewSnapshot returns a snapshot of the value returned by load, kept for ttl.
+func NewSnapshot[T any](ttl time.Duration, load func(ctx context.Context) (T, error)) *Snapshot[T] {
+	return &Snapshot[T]{load: load, ttl: ttl}
+}
+
+// SetTTL changes how long a loaded value is kept, 0 loads it on every Get.
+func (s *Snapshot[T]) SetTTL(ttl time.Duration) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.ttl = ttl
+}
+
+// Invalidate drops the value, the next Get loads it again. It must be called
+// after every write of the value, once its transaction committed.
+func (s *Snapshot[T]) Invalidate() {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	var zero T
+	s.value, s.loaded = zero, false
+	s.generation++
+}
+
+// Get returns the value, loading it when it is missing or older than the TTL.
+func (s *Snapshot[T]) Get(ctx context.Context) (T, error) {
+	if value, _, ok := s.fresh(); ok {
+		return value, nil
+	}
+
+	// a single load at a time, the others wait for its result
+	s.loading.Lock()
+	defer s.loading.Unlock()
+	value, generation, ok := s.fresh()
+	if ok {
+		return value, nil
+	}
+
+	value, err := s.load(ctx)
+	if err != nil {
+		return value, err
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if s.generation == generation {
+		s.value, s.loaded = value, true
+		s.loadedAt = time.Now()
+	}
+	return value, nil
+}
+
+func (s *Snapshot[T]) fresh() (T, uint64, bool) {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	return s.value, s.generation, s.loaded && time.Since(s.loadedAt) < s.ttl
+}
@@ -0,0 +1,104 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSnapshot(t *testing.T) {
+	ctx := context.Background()
+	var loads atomic.Int32
+	fail := false
+	s := NewSnapshot(time.Minute, func(ctx context.Context) (int32, error) {
+		if fail {
+			return 0, errors.New("boom")
+		}
+		return loads.Add(1), nil
+	})
+
+	if v, err := s.Get(ctx); err != nil || v != 1 {
+		t.Fatalf("unexpected %d (%v)", v, err)
+	}
+	if v, _ := s.Get(ctx); v != 1 {
+		t.Fatalf("expected the value to be kept, got %d", v)
+	}
+
+	s.Invalidate()
+	if v, _ := s.Get(ctx); v != 2 {
+		t.Fatalf("expected the value to be loaded again, got %d", v)
+	}
+
+	// errors are not kept
+	s.Invalidate()
+	fail = true
+	if _, err := s.Get(ctx); err == nil {
+		t.Fatal("expected the load to fail")
+	}
+	fail = false
+	if v, _ := s.Get(ctx); v != 3 {
+		t.Fatalf("expected the value to be loaded after the failure, got %d", v)
+	}
+
+	s.SetTTL(0)
+	if v, _ := s.Get(ctx); v != 4 {
+		t.Fatalf("expected every get to load without a ttl, got %d", v)
+	}
+}
+
+func TestSnapshotConcurrentLoads(t *testing.T) {
+	ctx := context.Background()
+	var loads atomic.Int32
+	release := make(chan struct{})
+	s := NewSnapshot(time.Minute, func(ctx context.Context) (int32, error) {
+		<-release
+		return loads.Add(1), nil
+	})
+
+	var done sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		done.Add(1)
+		go func() {
+			defer done.Done()
+			_, _ = s.Get(ctx)
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	done.Wait()
+	if loads.Load() != 1 {
+		t.Fatalf("expected a single load, got %d", loads.Load())
+	}
+}
+
+func TestSnapshotInvalidateDuringLoad(t *testing.T) {
+	ctx := context.Background()
+	loading, release := make(chan struct{}), make(chan struct{})
+	value := "stale"
+	s := NewSnapshot(time.Minute, func(ctx context.Context) (string, error) {
+		if value == "stale" {
+			close(loading)
+			<-release
+		}
+		return value, nil
+	})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, _ = s.Get(ctx)
+	}()
+	<-loading
+	// a write committed while the older value is loaded
+	s.Invalidate()
+	close(release)
+	<-done
+
+	value = "fresh"
+	if v, _ := s.Get(ctx); v != "fresh" {
+		t.Fatalf("expected the older load not to be kept, got %s", v)
+	}
+}
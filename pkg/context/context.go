@@ -1,6 +1,9 @@
 package context
 
 import (
+	stdctx "context"
+	"go-server-template/pkg/trace"
+
 	"github.com/gin-gonic/gin"
 )
 
@@ -8,8 +11,12 @@ const (
 	_RequestID = "request_id"
 	_Alias     = "_alias_"
 	_UserID    = "_user_id_"
+	_Roles     = "_roles_"
+	_Tenant    = "_tenant_"
 )
 
+type userIDKey struct{}
+
 func GetRequestID(c *gin.Context) string {
 	if v, ok := c.Get(_RequestID); ok {
 		if requestID, ok := v.(string); ok {
@@ -44,4 +51,110 @@ func GetUserID(c *gin.Context) uint64 {
 		}
 	}
 	return 0
-}
\ No newline at end of file
+}
+
+func SetRoles(c *gin.Context, roles []string) {
+	c.Set(_Roles, roles)
+}
+
+func GetRoles(c *gin.Context) []string {
+	if v, ok := c.Get(_Roles); ok {
+		if roles, ok := v.([]string); ok {
+			return roles
+		}
+	}
+	return nil
+}
+
+// HasRole reports whether the authorized user has role.
+func HasRole(c *gin.Context, role string) bool {
+	for _, r := range GetRoles(c) {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+func SetTenant(c *gin.Context, tenant string) {
+	c.Set(_Tenant, tenant)
+}
+
+func GetTenant(c *gin.Context) string {
+	if v, ok := c.Get(_Tenant); ok {
+		if tenant, ok := v.(string); ok {
+			return tenant
+		}
+	}
+	return ""
+}
+
+// GinContext returns the *gin.Context carried by ctx, either directly or
+// wrapped by std context values (e.g. gorm's Statement.Context).
+func GinContext(ctx stdctx.Context) (*gin.Context, bool) {
+	if ctx == nil {
+		return nil, false
+	}
+	if c, ok := ctx.(*gin.Context); ok {
+		return c, true
+	}
+	c, ok := ctx.Value(gin.ContextKey).(*gin.Context)
+	return c, ok
+}
+
+// RequestIDFrom returns the request id of the request behind ctx.
+func RequestIDFrom(ctx stdctx.Context) string {
+	if c, ok := GinContext(ctx); ok {
+		return GetRequestID(c)
+	}
+	return ""
+}
+
+// TraceIDFrom returns the trace id of the request behind ctx.
+func TraceIDFrom(ctx stdctx.Context) string {
+	if c, ok := GinContext(ctx); ok {
+		if t := trace.GetTrace(c); t != nil {
+			return t.ID()
+		}
+	}
+	return ""
+}
+
+// WithUserID returns a std context acting on behalf of userID, for work
+// that runs outside a request such as commands and background jobs.
+func WithUserID(ctx stdctx.Context, userID uint64) stdctx.Context {
+	return stdctx.WithValue(ctx, userIDKey{}, userID)
+}
+
+// UserIDFrom returns the user id set by WithUserID, or else the authorized
+// user id of the request behind ctx.
+func UserIDFrom(ctx stdctx.Context) uint64 {
+	if ctx == nil {
+		return 0
+	}
+	if userID, ok := ctx.Value(userIDKey{}).(uint64); ok {
+		return userID
+	}
+	if c, ok := GinContext(ctx); ok {
+		return GetUserID(c)
+	}
+	return 0
+}
+
+// RolesFrom returns the roles of the authorized user of the request behind
+// ctx.
+func RolesFrom(ctx stdctx.Context) []string {
+	if c, ok := GinContext(ctx); ok {
+		return GetRoles(c)
+	}
+	return nil
+}
+
+// TenantFrom returns the tenant of the authorized user of the request behind
+// ctx.
+func TenantFrom(ctx stdctx.Context) string {
+	if c, ok := GinContext(ctx); ok {
+		return GetTenant(c)
+	}
+	return ""
+}
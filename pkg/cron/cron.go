@@ -0,0 +1,235 @@
+// Package cron parses cron expressions and computes their activation times.
+//
+// An expression has five fields: minute, hour, day of month, month and day
+// of week. A field is "*", a value, a range "a-b", a step "*/n" or "a-b/n",
+// or a comma separated list of them. Months and days of week may be written
+// as jan-dec and sun-sat, 7 is sunday too. As in the classic cron, a day
+// matches when either the day of month or the day of week matches if both are
+// restricted.
+//
+// The macros @yearly, @annually, @monthly, @weekly, @daily, @midnight and
+// @hourly are accepted, as well as "@every <duration>", e.g. "@every 90s".
+package cron
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalid = errors.New("invalid cron expression")
+
+// Schedule returns the activation times of an expression.
+type Schedule interface {
+	// Next returns the first activation strictly after t, or the zero time
+	// when there is none.
+	Next(t time.Time) time.Time
+}
+
+var macros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+type bounds struct {
+	min, max uint
+	names    map[string]uint
+}
+
+var (
+	minutes = bounds{0, 59, nil}
+	hours   = bounds{0, 23, nil}
+	days    = bounds{1, 31, nil}
+	months  = bounds{1, 12, map[string]uint{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	weekdays = bounds{0, 7, map[string]uint{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+// Parse parses spec, see the package documentation.
+func Parse(spec string) (Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	if strings.HasPrefix(spec, "@every ") {
+		d, err := time.ParseDuration(strings.TrimSpace(strings.TrimPrefix(spec, "@every ")))
+		if err != nil || d < time.Second {
+			return nil, fmt.Errorf("%w: %q, @every needs a duration of at least 1s", ErrInvalid, spec)
+		}
+		return Every(d), nil
+	}
+	if expanded, ok := macros[strings.ToLower(spec)]; ok {
+		spec = expanded
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("%w: %q, expected 5 fields, got %d", ErrInvalid, spec, len(fields))
+	}
+
+	s := &SpecSchedule{}
+	var err error
+	if s.minute, err = parseField(fields[0], minutes); err != nil {
+		return nil, err
+	}
+	if s.hour, err = parseField(fields[1], hours); err != nil {
+		return nil, err
+	}
+	if s.dom, err = parseField(fields[2], days); err != nil {
+		return nil, err
+	}
+	if s.month, err = parseField(fields[3], months); err != nil {
+		return nil, err
+	}
+	if s.dow, err = parseField(fields[4], weekdays); err != nil {
+		return nil, err
+	}
+	// 7 is sunday too
+	if s.dow&(1<<7) != 0 {
+		s.dow = s.dow&^(1<<7) | 1
+	}
+	s.domStar = fields[2] == "*" || fields[2] == "?"
+	s.dowStar = fields[4] == "*" || fields[4] == "?"
+	return s, nil
+}
+
+// MustParse is Parse panicking on error, for expressions known at compile time.
+func MustParse(spec string) Schedule {
+	s, err := Parse(spec)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// parseField returns the bit set of the values matched by field.
+func parseField(field string, b bounds) (uint64, error) {
+	var set uint64
+	for _, part := range strings.Split(field, ",") {
+		bits, err := parseRange(part, b)
+		if err != nil {
+			return 0, err
+		}
+		set |= bits
+	}
+	return set, nil
+}
+
+func parseRange(part string, b bounds) (uint64, error) {
+	rangePart, stepPart, hasStep := strings.Cut(part, "/")
+
+	var start, end uint
+	switch {
+	case rangePart == "*" || rangePart == "?":
+		start, end = b.min, b.max
+		if b.max == 7 {
+			// sunday once is enough
+			end = 6
+		}
+	default:
+		low, high, isRange := strings.Cut(rangePart, "-")
+		var err error
+		if start, err = parseValue(low, b); err != nil {
+			return 0, err
+		}
+		end = start
+		if isRange {
+			if end, err = parseValue(high, b); err != nil {
+				return 0, err
+			}
+		} else if hasStep {
+			// "a/n" runs from a to the maximum
+			end = b.max
+		}
+	}
+	if start > end {
+		return 0, fmt.Errorf("%w: %q, range start above its end", ErrInvalid, part)
+	}
+
+	step := uint(1)
+	if hasStep {
+		n, err := strconv.ParseUint(stepPart, 10, 8)
+		if err != nil || n == 0 {
+			return 0, fmt.Errorf("%w: %q, bad step", ErrInvalid, part)
+		}
+		step = uint(n)
+	}
+
+	var set uint64
+	for v := start; v <= end; v += step {
+		set |= 1 << v
+	}
+	return set, nil
+}
+
+func parseValue(s string, b bounds) (uint, error) {
+	if v, ok := b.names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+	n, err := strconv.ParseUint(s, 10, 8)
+	if err != nil || uint(n) < b.min || uint(n) > b.max {
+		return 0, fmt.Errorf("%w: %q, expected a value in %d-%d", ErrInvalid, s, b.min, b.max)
+	}
+	return uint(n), nil
+}
+
+// SpecSchedule is a parsed five fields expression, evaluated in the location
+// of the time given to Next.
+type SpecSchedule struct {
+	minute, hour, dom, month, dow uint64
+	domStar, dowStar              bool
+}
+
+// maxYears bounds the search of Next, e.g. "0 0 30 2 *" never activates.
+const maxYears = 5
+
+func (s *SpecSchedule) Next(t time.Time) time.Time {
+	loc := t.Location()
+	t = t.Add(time.Minute - time.Duration(t.Second())*time.Second - time.Duration(t.Nanosecond()))
+	limit := t.AddDate(maxYears, 0, 0)
+
+	for t.Before(limit) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+func (s *SpecSchedule) dayMatches(t time.Time) bool {
+	domMatch := s.dom&(1<<uint(t.Day())) != 0
+	dowMatch := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domStar || s.dowStar {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
+
+// Every activates at a fixed interval from the time given to Next.
+type Every time.Duration
+
+func (e Every) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(e))
+}
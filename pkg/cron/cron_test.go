@@ -0,0 +1,49 @@
+package cron
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestNext(t *testing.T) {
+	from := time.Date(2024, time.January, 31, 10, 17, 30, 0, time.UTC) // a wednesday
+	tests := map[string]string{
+		"* * * * *":             "2024-01-31T10:18:00Z",
+		"*/15 * * * *":          "2024-01-31T10:30:00Z",
+		"5 10 * * *":            "2024-02-01T10:05:00Z",
+		"0 0 1 * *":             "2024-02-01T00:00:00Z",
+		"0 9 * * mon-fri":       "2024-02-01T09:00:00Z",
+		"0 9 * * sun":           "2024-02-04T09:00:00Z",
+		"0 9 * * 7":             "2024-02-04T09:00:00Z",
+		"0 0 29 feb *":          "2024-02-29T00:00:00Z",
+		"0 12 13 * fri":         "2024-02-02T12:00:00Z", // day of month or day of week
+		"30 8-18/4 * jan,mar *": "2024-01-31T12:30:00Z",
+		"@hourly":               "2024-01-31T11:00:00Z",
+		"@weekly":               "2024-02-04T00:00:00Z",
+		"@yearly":               "2025-01-01T00:00:00Z",
+		"@every 90s":            "2024-01-31T10:19:00Z",
+	}
+	for spec, want := range tests {
+		s, err := Parse(spec)
+		if err != nil {
+			t.Errorf("%s: %v", spec, err)
+			continue
+		}
+		if got := s.Next(from).Format(time.RFC3339); got != want {
+			t.Errorf("%s: got %s, want %s", spec, got, want)
+		}
+	}
+
+	if next := MustParse("0 0 30 2 *").Next(from); !next.IsZero() {
+		t.Errorf("february 30th never comes, got %s", next)
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *", "5-1 * * * *", "*/0 * * * *", "@every 10ms", "@often"} {
+		if _, err := Parse(spec); !errors.Is(err, ErrInvalid) {
+			t.Errorf("%q: expected ErrInvalid, got %v", spec, err)
+		}
+	}
+}
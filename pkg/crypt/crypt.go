@@ -0,0 +1,229 @@
+// Package crypt encrypts column values with AES-256-GCM under envelope keys.
+//
+// Every value is sealed with a random data key, itself sealed with a key
+// encryption key of the Keyring. The id of that key travels with the value,
+// so the keys can be rotated: a new primary key encrypts the new values
+// while the former ones still decrypt the older values until they are
+// encrypted again.
+//
+// A sealed value reads
+//
+//	enc:v1:<key id>:<base64 sealed data key>:<base64 sealed value>
+//
+// where each sealed part is its GCM nonce followed by the ciphertext.
+//
+// Both parts authenticate the header along with a binding, where the value is
+// stored, so a value copied into another column fails to decrypt. The
+// Serializer binds the table and the column. The primary key of the row is
+// not bound, it is unknown before an auto-increment insert, so a value can
+// still be moved between the rows of its column.
+package crypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	prefix  = "enc:v1:"
+	keySize = 32
+	// blindSize is the bytes of HMAC kept by a blind index, enough to tell
+	// the values apart without fingerprinting them exactly.
+	blindSize = 16
+)
+
+var (
+	ErrNotConfigured = errors.New("crypt: encryption is not configured")
+	ErrNoBlindKey    = errors.New("crypt: no blind index key")
+	ErrUnknownKey    = errors.New("crypt: unknown key id")
+	ErrInvalid       = errors.New("crypt: invalid ciphertext")
+)
+
+var validKeyID = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,64}$`)
+
+// Keyring holds the key encryption keys by id.
+type Keyring struct {
+	primary string
+	keys    map[string]cipher.AEAD
+	blind   []byte
+}
+
+// NewKeyring returns a Keyring encrypting with the key primary of keys, each
+// of them 32 bytes. blindKey is the HMAC key of the blind indexes, they are
+// unavailable when it is empty.
+func NewKeyring(primary string, keys map[string][]byte, blindKey []byte) (*Keyring, error) {
+	k := &Keyring{primary: primary, keys: make(map[string]cipher.AEAD, len(keys)), blind: blindKey}
+	for id, key := range keys {
+		if !validKeyID.MatchString(id) {
+			return nil, fmt.Errorf("crypt: invalid key id %q", id)
+		}
+		if len(key) != keySize {
+			return nil, fmt.Errorf("crypt: key %s must be %d bytes, got %d", id, keySize, len(key))
+		}
+		aead, err := newAEAD(key)
+		if err != nil {
+			return nil, err
+		}
+		k.keys[id] = aead
+	}
+	if _, ok := k.keys[primary]; !ok {
+		return nil, fmt.Errorf("%w: primary %q", ErrUnknownKey, primary)
+	}
+	return k, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Primary returns the id of the key encrypting the new values.
+func (k *Keyring) Primary() string {
+	return k.primary
+}
+
+// Encrypt seals plaintext under the primary key, for the place binding, see
+// Binding.
+func (k *Keyring) Encrypt(plaintext []byte, binding string) (string, error) {
+	dataKey := make([]byte, keySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", err
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return "", err
+	}
+	header := prefix + k.primary + ":"
+	// the key id and the binding are authenticated with both parts
+	additional := []byte(header + binding)
+	wrapped, err := seal(k.keys[k.primary], dataKey, additional)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := seal(aead, plaintext, additional)
+	if err != nil {
+		return "", err
+	}
+	return header + base64.RawStdEncoding.EncodeToString(wrapped) + ":" + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt opens a value sealed by Encrypt for binding with any key of the
+// Keyring.
+func (k *Keyring) Decrypt(ciphertext, binding string) ([]byte, error) {
+	id, ok := KeyID(ciphertext)
+	if !ok {
+		return nil, ErrInvalid
+	}
+	kek, ok := k.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownKey, id)
+	}
+	header := prefix + id + ":"
+	parts := strings.Split(strings.TrimPrefix(ciphertext, header), ":")
+	if len(parts) != 2 {
+		return nil, ErrInvalid
+	}
+	wrapped, err := base64.RawStdEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, ErrInvalid
+	}
+	sealed, err := base64.RawStdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrInvalid
+	}
+
+	additional := []byte(header + binding)
+	dataKey, err := open(kek, wrapped, additional)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, ErrInvalid
+	}
+	return open(aead, sealed, additional)
+}
+
+// BlindIndex returns a keyed hash of value for equality lookups on the
+// encrypted column, the same value hashing differently in each column.
+func (k *Keyring) BlindIndex(column, value string) (string, error) {
+	if len(k.blind) == 0 {
+		return "", ErrNoBlindKey
+	}
+	mac := hmac.New(sha256.New, k.blind)
+	mac.Write([]byte(column))
+	mac.Write([]byte{0})
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil)[:blindSize]), nil
+}
+
+func seal(aead cipher.AEAD, plaintext, additional []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, additional), nil
+}
+
+func open(aead cipher.AEAD, sealed, additional []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, ErrInvalid
+	}
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], additional)
+	if err != nil {
+		return nil, ErrInvalid
+	}
+	return plaintext, nil
+}
+
+// IsEncrypted reports whether value was sealed by a Keyring, other values
+// are plaintext written before their column was encrypted.
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, prefix)
+}
+
+// KeyID returns the id of the key which sealed value.
+func KeyID(value string) (string, bool) {
+	if !IsEncrypted(value) {
+		return "", false
+	}
+	id, _, ok := strings.Cut(strings.TrimPrefix(value, prefix), ":")
+	return id, ok && id != ""
+}
+
+var globalKeyring *Keyring
+
+func GetKeyring() *Keyring {
+	return globalKeyring
+}
+
+// Init sets the Keyring of the Serializer and BlindIndex, nil disables the
+// encryption.
+func Init(k *Keyring) *Keyring {
+	globalKeyring = k
+	return k
+}
+
+// BlindIndex returns the blind index of value in column with the Keyring of
+// Init, for lookups such as
+//
+//	index, err := crypt.BlindIndex("phone", phone)
+//	db.Where("phone_index = ?", index)
+func BlindIndex(column, value string) (string, error) {
+	if globalKeyring == nil {
+		return "", ErrNotConfigured
+	}
+	return globalKeyring.BlindIndex(column, value)
+}
@@ -0,0 +1,163 @@
+package crypt
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	gormLogger "gorm.io/gorm/logger"
+)
+
+func testKey(b byte) []byte {
+	return bytes.Repeat([]byte{b}, keySize)
+}
+
+func TestKeyring(t *testing.T) {
+	old, err := NewKeyring("k1", map[string][]byte{"k1": testKey(1)}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := old.Encrypt([]byte("+33 6 12 34 56 78"), "users.phone")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsEncrypted(sealed) || strings.Contains(sealed, "12 34") {
+		t.Fatalf("unexpected ciphertext %s", sealed)
+	}
+	if id, ok := KeyID(sealed); !ok || id != "k1" {
+		t.Fatalf("expected key k1, got %q", id)
+	}
+	again, _ := old.Encrypt([]byte("+33 6 12 34 56 78"), "users.phone")
+	if again == sealed {
+		t.Fatal("expected a random data key per value")
+	}
+
+	// rotated: k2 encrypts, k1 still decrypts
+	rotated, err := NewKeyring("k2", map[string][]byte{"k1": testKey(1), "k2": testKey(2)}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext, err := rotated.Decrypt(sealed, "users.phone")
+	if err != nil || string(plaintext) != "+33 6 12 34 56 78" {
+		t.Fatalf("expected the former key to decrypt, got %q (%v)", plaintext, err)
+	}
+	resealed, _ := rotated.Encrypt(plaintext, "users.phone")
+	if id, _ := KeyID(resealed); id != "k2" {
+		t.Fatalf("expected the primary key, got %s", id)
+	}
+	if _, err = old.Decrypt(resealed, "users.phone"); !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("expected an unknown key, got %v", err)
+	}
+
+	// the key id is authenticated
+	forged := strings.Replace(sealed, "enc:v1:k1:", "enc:v1:k2:", 1)
+	if _, err = rotated.Decrypt(forged, "users.phone"); !errors.Is(err, ErrInvalid) {
+		t.Fatalf("expected the forged key id to be refused, got %v", err)
+	}
+	// so is the binding, the value does not decrypt in another column
+	if _, err = rotated.Decrypt(sealed, "users.email"); !errors.Is(err, ErrInvalid) {
+		t.Fatalf("expected the value of another column to be refused, got %v", err)
+	}
+	tampered := sealed[:len(sealed)-2] + "AA"
+	if _, err = rotated.Decrypt(tampered, "users.phone"); !errors.Is(err, ErrInvalid) {
+		t.Fatalf("expected the tampered value to be refused, got %v", err)
+	}
+
+	if _, err = NewKeyring("k3", map[string][]byte{"k1": testKey(1)}, nil); !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("expected the missing primary to be refused, got %v", err)
+	}
+	if _, err = NewKeyring("k1", map[string][]byte{"k1": testKey(1)[:16]}, nil); err == nil {
+		t.Fatal("expected the short key to be refused")
+	}
+	if _, err = NewKeyring("k:1", map[string][]byte{"k:1": testKey(1)}, nil); err == nil {
+		t.Fatal("expected the key id separator to be refused")
+	}
+}
+
+func TestBlindIndex(t *testing.T) {
+	k, _ := NewKeyring("k1", map[string][]byte{"k1": testKey(1)}, nil)
+	if _, err := k.BlindIndex("phone", "1"); !errors.Is(err, ErrNoBlindKey) {
+		t.Fatalf("expected no blind key, got %v", err)
+	}
+
+	k, _ = NewKeyring("k1", map[string][]byte{"k1": testKey(1)}, []byte("blind"))
+	a, _ := k.BlindIndex("phone", "1")
+	b, _ := k.BlindIndex("phone", "1")
+	c, _ := k.BlindIndex("email", "1")
+	if a != b || a == c || len(a) != 2*blindSize {
+		t.Fatalf("unexpected indexes %s %s %s", a, b, c)
+	}
+
+	// the indexes do not depend on the encryption keys
+	rotated, _ := NewKeyring("k2", map[string][]byte{"k2": testKey(2)}, []byte("blind"))
+	if d, _ := rotated.BlindIndex("phone", "1"); d != a {
+		t.Fatal("expected the index to survive the rotation")
+	}
+}
+
+type contact struct {
+	ID    uint
+	Phone string  `gorm:"serializer:encrypted"`
+	Email *string `gorm:"serializer:encrypted"`
+	Note  []byte  `gorm:"serializer:encrypted"`
+}
+
+func TestSerializer(t *testing.T) {
+	dB, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: gormLogger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = dB.AutoMigrate(new(contact)); err != nil {
+		t.Fatal(err)
+	}
+
+	Init(nil)
+	if err = dB.Create(&contact{Phone: "1"}).Error; !errors.Is(err, ErrNotConfigured) {
+		t.Fatalf("expected the encryption to be required, got %v", err)
+	}
+
+	k, _ := NewKeyring("k1", map[string][]byte{"k1": testKey(1)}, nil)
+	Init(k)
+	t.Cleanup(func() { Init(nil) })
+
+	email := "a@example.com"
+	if err = dB.Create(&contact{Phone: "1", Email: &email, Note: []byte("note")}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err = dB.Create(&contact{}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	var raw struct {
+		Phone string
+		Email *string
+	}
+	dB.Table("contacts").Where("id = 1").Take(&raw)
+	if !IsEncrypted(raw.Phone) || raw.Email == nil || !IsEncrypted(*raw.Email) {
+		t.Fatalf("expected encrypted columns, got %+v", raw)
+	}
+	dB.Table("contacts").Where("id = 2").Take(&raw)
+	if raw.Phone != "" || raw.Email != nil {
+		t.Fatalf("expected the empty values to be kept, got %+v", raw)
+	}
+
+	// a plaintext value written before the encryption
+	dB.Exec("INSERT INTO contacts (id, phone) VALUES (3, '2')")
+
+	var contacts []contact
+	if err = dB.Order("id").Find(&contacts).Error; err != nil {
+		t.Fatal(err)
+	}
+	if c := contacts[0]; c.Phone != "1" || c.Email == nil || *c.Email != email || string(c.Note) != "note" {
+		t.Fatalf("unexpected %+v", c)
+	}
+	if c := contacts[1]; c.Phone != "" || c.Email != nil || len(c.Note) != 0 {
+		t.Fatalf("unexpected %+v", c)
+	}
+	if contacts[2].Phone != "2" {
+		t.Fatalf("expected the plaintext to be read as is, got %+v", contacts[2])
+	}
+}
@@ -0,0 +1,137 @@
+package crypt
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"gorm.io/gorm/schema"
+)
+
+// SerializerName is the name of Serializer in the gorm tags:
+//
+//	Phone string `gorm:"serializer:encrypted"`
+const SerializerName = "encrypted"
+
+func init() {
+	schema.RegisterSerializer(SerializerName, Serializer{})
+}
+
+var _ schema.SerializerInterface = Serializer{}
+
+// Serializer stores string, *string and []byte fields encrypted with the
+// Keyring of Init. Empty values are stored as they are, and values read
+// without the prefix of a sealed value are taken as plaintext, so a column
+// can be encrypted in place before running `base-cmd db reencrypt`. gorm
+// leaves out the serializers of the values written by a map, so those need a
+// callback encrypting them with Value.
+type Serializer struct{}
+
+func (Serializer) Scan(ctx context.Context, field *schema.Field, dst reflect.Value, dbValue interface{}) error {
+	fieldValue := reflect.New(field.FieldType)
+	if dbValue != nil {
+		var text string
+		switch v := dbValue.(type) {
+		case string:
+			text = v
+		case []byte:
+			text = string(v)
+		default:
+			return fmt.Errorf("crypt: failed to scan %#v into %s", dbValue, field.Name)
+		}
+
+		plaintext := []byte(text)
+		if IsEncrypted(text) {
+			if globalKeyring == nil {
+				return ErrNotConfigured
+			}
+			var err error
+			if plaintext, err = globalKeyring.Decrypt(text, Binding(field)); err != nil {
+				return fmt.Errorf("failed to decrypt %s: %w", field.Name, err)
+			}
+		}
+
+		switch fieldValue.Elem().Kind() {
+		case reflect.String:
+			fieldValue.Elem().SetString(string(plaintext))
+		case reflect.Slice:
+			fieldValue.Elem().SetBytes(plaintext)
+		case reflect.Ptr:
+			s := string(plaintext)
+			fieldValue.Elem().Set(reflect.ValueOf(&s))
+		default:
+			return fmt.Errorf("crypt: unsupported type %s of %s", field.FieldType, field.Name)
+		}
+	}
+	field.ReflectValueOf(ctx, dst).Set(fieldValue.Elem())
+	return nil
+}
+
+func (Serializer) Value(ctx context.Context, field *schema.Field, dst reflect.Value, fieldValue interface{}) (interface{}, error) {
+	var plaintext []byte
+	switch v := fieldValue.(type) {
+	case string:
+		plaintext = []byte(v)
+	case []byte:
+		plaintext = v
+	case *string:
+		if v == nil {
+			return nil, nil
+		}
+		plaintext = []byte(*v)
+	default:
+		return nil, fmt.Errorf("crypt: unsupported type %T of %s", fieldValue, field.Name)
+	}
+	if len(plaintext) == 0 {
+		return "", nil
+	}
+	if globalKeyring == nil {
+		return nil, ErrNotConfigured
+	}
+	return globalKeyring.Encrypt(plaintext, Binding(field))
+}
+
+// Binding returns the binding of the values of field, its table and column.
+func Binding(field *schema.Field) string {
+	return field.Schema.Table + "." + field.DBName
+}
+
+// BlindTag is the struct tag naming the field a blind index is computed of:
+//
+//	Phone      string `gorm:"serializer:encrypted"`
+//	PhoneIndex string `gorm:"index" blind:"Phone"`
+const BlindTag = "blind"
+
+// BlindField is a blind index field of a schema and the field it indexes.
+type BlindField struct {
+	Index  *schema.Field
+	Source *schema.Field
+}
+
+// EncryptedFields returns the fields of s stored with Serializer.
+func EncryptedFields(s *schema.Schema) []*schema.Field {
+	var fields []*schema.Field
+	for _, f := range s.Fields {
+		if f.DBName != "" && f.TagSettings["SERIALIZER"] == SerializerName {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+// BlindFields returns the blind index fields of s.
+func BlindFields(s *schema.Schema) ([]BlindField, error) {
+	var fields []BlindField
+	for _, f := range s.Fields {
+		name := f.Tag.Get(BlindTag)
+		if name == "" {
+			continue
+		}
+		source := s.LookUpField(name)
+		if source == nil || source.DBName == "" || f.DBName == "" {
+			return nil, fmt.Errorf("crypt: blind index %s.%s of unknown field %s", s.Name, f.Name, name)
+		}
+		fields = append(fields, BlindField{Index: f, Source: source})
+	}
+	return fields, nil
+}
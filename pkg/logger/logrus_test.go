@@ -2,6 +2,9 @@ package logger
 
 import (
 	"errors"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 )
@@ -43,8 +46,9 @@ func TestLogrusLogger(t *testing.T) {
 }
 
 func TestLogrusLoggerWithFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "test.log")
 	// Create a new Logrus logger with a file output
-	logger, err := NewLogrusLogger(WithFileP("test.log"), WithEncodingJson())
+	logger, err := NewLogrusLogger(WithFileP(file), WithEncodingJson())
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -52,4 +56,9 @@ func TestLogrusLoggerWithFile(t *testing.T) {
 
 	err = errors.New("pkg error")
 	logger.WithField("param1", "value1").WithField("param2", "value2").Error(err)
+	logger.Sync()
+
+	if b, _ := os.ReadFile(file); !strings.Contains(string(b), `"msg":"pkg error"`) {
+		t.Fatalf("expected the entry in the file, got %s", b)
+	}
 }
@@ -2,6 +2,9 @@ package logger
 
 import (
 	"errors"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 )
@@ -46,7 +49,8 @@ func TestZapLogger(t *testing.T) {
 }
 
 func TestZapLoggerWithFile(t *testing.T) {
-	logger, err := NewZapLogger(WithFileP("test.log"), WithEncodingJson())
+	file := filepath.Join(t.TempDir(), "test.log")
+	logger, err := NewZapLogger(WithFileP(file), WithEncodingJson())
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -56,4 +60,9 @@ func TestZapLoggerWithFile(t *testing.T) {
 
 	logger.WithField("para1", "value1").WithField("para2", "value2").
 		Info(err)
+	logger.Sync()
+
+	if b, _ := os.ReadFile(file); !strings.Contains(string(b), `"para2":"value2"`) {
+		t.Fatalf("expected the entry in the file, got %s", b)
+	}
 }
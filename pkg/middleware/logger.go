@@ -110,6 +110,7 @@ func LoggerWithConfig(conf LoggerConfig) gin.HandlerFunc {
 			WithField("response_at", t.ResponseAt.Format(time.DateTime)).
 			WithField("costs", t.Latency.Microseconds()).
 			WithField("sql", t.SQLs).
+			WithField("cache", t.Caches).
 			Info("trace info")
 	}
 }
@@ -0,0 +1,110 @@
+package middleware
+
+import (
+	"go-server-template/pkg/context"
+	"go-server-template/pkg/logger"
+	"go-server-template/pkg/trace"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// QueryBudgetHeader lists the budget violations of a request, see
+// QueryBudgetConfig.ExposeHeader.
+const QueryBudgetHeader = "X-Query-Budget"
+
+// QueryBudgetConfig defines the config for QueryBudget middleware.
+type QueryBudgetConfig struct {
+	// Default applies to every route.
+	Default trace.Budget
+
+	// Routes overrides the non-zero fields of Default per route alias.
+	Routes map[string]trace.Budget
+
+	// ExposeHeader adds the violations found before the response is written
+	// as the QueryBudgetHeader header. Meant for development.
+	ExposeHeader bool
+}
+
+func (conf QueryBudgetConfig) budget(alias string) trace.Budget {
+	if b, ok := conf.Routes[alias]; ok {
+		return conf.Default.Merge(b)
+	}
+	return conf.Default
+}
+
+type budgetWriter struct {
+	gin.ResponseWriter
+	once  sync.Once
+	check func()
+}
+
+func (w *budgetWriter) WriteHeader(code int) {
+	w.once.Do(w.check)
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *budgetWriter) WriteHeaderNow() {
+	w.once.Do(w.check)
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+func (w *budgetWriter) Write(b []byte) (int, error) {
+	w.once.Do(w.check)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *budgetWriter) WriteString(s string) (int, error) {
+	w.once.Do(w.check)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// QueryBudget analyzes the statements recorded into the trace of each request
+// by the Logger middleware. Likely N+1 queries and requests exceeding their
+// query count or time budget are logged with the route alias.
+func QueryBudget(conf QueryBudgetConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		t := trace.GetTrace(c)
+		if t == nil {
+			c.Next()
+			return
+		}
+
+		if conf.ExposeHeader {
+			c.Writer = &budgetWriter{
+				ResponseWriter: c.Writer,
+				check: func() {
+					violations := t.CheckBudget(conf.budget(context.GetAlias(c)))
+					if len(violations) == 0 {
+						return
+					}
+					values := make([]string, len(violations))
+					for i, v := range violations {
+						values[i] = v.String()
+					}
+					c.Writer.Header().Set(QueryBudgetHeader, strings.Join(values, "; "))
+				},
+			}
+		}
+
+		c.Next()
+
+		alias := context.GetAlias(c)
+		violations := t.CheckBudget(conf.budget(alias))
+		if len(violations) == 0 {
+			return
+		}
+
+		path := alias
+		if path == "" {
+			path = c.Request.URL.Path
+		}
+		logger.GetLogger().
+			WithField("method", c.Request.Method).
+			WithField("path", path).
+			WithField("trace_id", t.Identifier).
+			WithField("violations", violations).
+			Warn("query budget exceeded")
+	}
+}
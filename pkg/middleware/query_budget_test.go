@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"go-server-template/pkg/logger"
+	"go-server-template/pkg/trace"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestQueryBudget(t *testing.T) {
+	logger.Init("zap")
+	gin.SetMode(gin.TestMode)
+
+	e := gin.New()
+	e.Use(
+		LoggerWithConfig(LoggerConfig{Filter: func(*gin.Context) bool { return false }}),
+		QueryBudget(QueryBudgetConfig{
+			Default:      trace.Budget{RepeatThreshold: 2},
+			Routes:       map[string]trace.Budget{"/relaxed": {RepeatThreshold: 10}},
+			ExposeHeader: true,
+		}),
+	)
+	handler := func(c *gin.Context) {
+		for i := 0; i < 3; i++ {
+			trace.GetTrace(c).AppendSQL(&trace.SQL{SQL: "SELECT * FROM users WHERE id = 1"})
+		}
+		c.JSON(http.StatusOK, gin.H{"code": 0})
+	}
+	e.GET("/strict", Alias("/strict"), handler)
+	e.GET("/relaxed", Alias("/relaxed"), handler)
+
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/strict", nil))
+	if got, want := w.Header().Get(QueryBudgetHeader), "n+1 3x select * from users where id = ?"; got != want {
+		t.Errorf("got header %q, want %q", got, want)
+	}
+
+	w = httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/relaxed", nil))
+	if got := w.Header().Get(QueryBudgetHeader); got != "" {
+		t.Errorf("route budget should allow the repeats, got header %q", got)
+	}
+}
@@ -0,0 +1,49 @@
+// Package retry computes when failed work is tried again.
+package retry
+
+import (
+	"math/rand"
+	"time"
+)
+
+// Backoff waits Initial after the first attempt, doubled after each further
+// one up to Max, 0 being no cap.
+type Backoff struct {
+	Initial time.Duration
+	Max     time.Duration
+	// Jitter draws the wait in the upper half of it instead, so that the
+	// clients failing together do not retry together.
+	Jitter bool
+}
+
+// Wait returns the wait after attempt, counted from 1.
+func (b Backoff) Wait(attempt int) time.Duration {
+	wait := b.Initial
+	for i := 1; i < attempt && wait > 0 && (b.Max <= 0 || wait < b.Max); i++ {
+		wait *= 2
+	}
+	if b.Max > 0 && wait > b.Max {
+		wait = b.Max
+	}
+	if wait <= 0 {
+		return 0
+	}
+	if b.Jitter {
+		return wait/2 + time.Duration(rand.Int63n(int64(wait/2)+1))
+	}
+	return wait
+}
+
+// Policy is the retry policy of queued work.
+type Policy struct {
+	Backoff
+	// MaxAttempts is the number of attempts before the work is dead, 0
+	// retries forever.
+	MaxAttempts int
+}
+
+// Next returns when to try again after attempt failed at now, dead when it
+// was the last one.
+func (p Policy) Next(now time.Time, attempt int) (next time.Time, dead bool) {
+	return now.Add(p.Wait(attempt)), p.MaxAttempts > 0 && attempt >= p.MaxAttempts
+}
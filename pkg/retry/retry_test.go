@@ -0,0 +1,47 @@
+package retry
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	b := Backoff{Initial: time.Second, Max: 5 * time.Second}
+	for attempt, want := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 4: 5 * time.Second, 100: 5 * time.Second} {
+		if got := b.Wait(attempt); got != want {
+			t.Errorf("attempt %d: got %s, want %s", attempt, got, want)
+		}
+	}
+
+	// uncapped, the wait keeps doubling
+	if got := (Backoff{Initial: time.Millisecond}).Wait(11); got != 1024*time.Millisecond {
+		t.Errorf("got %s, want 1.024s", got)
+	}
+	if got := (Backoff{Max: time.Second}).Wait(3); got != 0 {
+		t.Errorf("expected no wait without an initial one, got %s", got)
+	}
+
+	b.Jitter = true
+	for attempt, want := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 9: 5 * time.Second} {
+		for i := 0; i < 20; i++ {
+			if got := b.Wait(attempt); got < want/2 || got > want {
+				t.Fatalf("attempt %d: got %s, want within [%s, %s]", attempt, got, want/2, want)
+			}
+		}
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	p := Policy{Backoff: Backoff{Initial: time.Second}, MaxAttempts: 3}
+	if next, dead := p.Next(now, 2); dead || !next.Equal(now.Add(2*time.Second)) {
+		t.Fatalf("expected a retry in 2s, got %s (dead %v)", next, dead)
+	}
+	if _, dead := p.Next(now, 3); !dead {
+		t.Fatal("expected the third attempt to be the last")
+	}
+	p.MaxAttempts = 0
+	if _, dead := p.Next(now, 100); dead {
+		t.Fatal("expected to retry forever")
+	}
+}
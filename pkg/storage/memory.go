@@ -0,0 +1,78 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+var _ Storage = (*memoryStorage)(nil)
+
+type memoryObject struct {
+	data []byte
+	info Object
+}
+
+type memoryStorage struct {
+	mux     sync.RWMutex
+	objects map[string]*memoryObject
+}
+
+// NewMemoryStorage returns a Storage kept in memory, for tests and development.
+func NewMemoryStorage() Storage {
+	return &memoryStorage{objects: make(map[string]*memoryObject)}
+}
+
+func (s *memoryStorage) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	if !validKey(key) {
+		return ErrInvalidKey
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r, size))
+	if err != nil {
+		return err
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.objects[key] = &memoryObject{
+		data: data,
+		info: Object{Key: key, Size: int64(len(data)), ContentType: contentType, ModTime: time.Now()},
+	}
+	return nil
+}
+
+func (s *memoryStorage) Get(ctx context.Context, key string) (io.ReadCloser, *Object, error) {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+
+	obj, ok := s.objects[key]
+	if !ok {
+		return nil, nil, ErrNotFound
+	}
+	info := obj.info
+	return io.NopCloser(bytes.NewReader(obj.data)), &info, nil
+}
+
+func (s *memoryStorage) Stat(ctx context.Context, key string) (*Object, error) {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+
+	obj, ok := s.objects[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	info := obj.info
+	return &info, nil
+}
+
+func (s *memoryStorage) Delete(ctx context.Context, key string) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	delete(s.objects, key)
+	return nil
+}
@@ -0,0 +1,67 @@
+// Package storage stores opaque blobs by key on a pluggable backend.
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"time"
+)
+
+var (
+	ErrNotFound   = errors.New("storage: object not found")
+	ErrInvalidKey = errors.New("storage: invalid key")
+)
+
+const (
+	Local  = "local"
+	Memory = "memory"
+	S3     = "s3"
+)
+
+// Object describes a stored blob.
+type Object struct {
+	Key         string
+	Size        int64
+	ContentType string
+	ModTime     time.Time
+}
+
+type Storage interface {
+	// Put stores size bytes read from r under key, replacing any previous object.
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+
+	// Get opens the object, the caller must close the reader.
+	Get(ctx context.Context, key string) (io.ReadCloser, *Object, error)
+
+	Stat(ctx context.Context, key string) (*Object, error)
+
+	// Delete removes the object, deleting a missing object is not an error.
+	Delete(ctx context.Context, key string) error
+}
+
+var globalStorage Storage
+
+func GetStorage() Storage {
+	return globalStorage
+}
+
+// Init sets the storage returned by GetStorage.
+func Init(s Storage) Storage {
+	globalStorage = s
+	return s
+}
+
+// validKey rejects empty keys, absolute keys and keys escaping their root.
+func validKey(key string) bool {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return false
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func testStorage(t *testing.T, s Storage) {
+	ctx := context.Background()
+	content := "hello storage"
+
+	if err := s.Put(ctx, "users/1/hello.txt", strings.NewReader(content), int64(len(content)), "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+
+	r, obj, err := s.Get(ctx, "users/1/hello.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(r)
+	_ = r.Close()
+	if string(data) != content || obj.Size != int64(len(content)) {
+		t.Fatalf("unexpected object %q %+v", data, obj)
+	}
+
+	obj, err = s.Stat(ctx, "users/1/hello.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if obj.Size != int64(len(content)) || !strings.HasPrefix(obj.ContentType, "text/plain") {
+		t.Fatalf("unexpected stat %+v", obj)
+	}
+
+	if err = s.Delete(ctx, "users/1/hello.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Delete(ctx, "users/1/hello.txt"); err != nil {
+		t.Fatalf("deleting a missing object: %v", err)
+	}
+	if _, _, err = s.Get(ctx, "users/1/hello.txt"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	if _, err = s.Stat(ctx, "users/1/hello.txt"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+
+	for _, key := range []string{"", "/etc/passwd", "../escape", "a/../../b", "a//b"} {
+		if err = s.Put(ctx, key, strings.NewReader("x"), 1, ""); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Put(%q): expected ErrInvalidKey, got %v", key, err)
+		}
+	}
+}
+
+func TestMemoryStorage(t *testing.T) {
+	testStorage(t, NewMemoryStorage())
+}
+
+func TestLocalStorage(t *testing.T) {
+	s, err := NewLocalStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStorage(t, s)
+}
@@ -0,0 +1,119 @@
+package trace
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	ViolationRepeat   = "n+1"
+	ViolationQueries  = "queries"
+	ViolationDuration = "duration"
+)
+
+var (
+	shapeStringRe = regexp.MustCompile(`'(?:[^']|'')*'`)
+	shapeParamRe  = regexp.MustCompile(`\$\d+`)
+	shapeNumberRe = regexp.MustCompile(`\b\d+(?:\.\d+)?\b`)
+	shapeListRe   = regexp.MustCompile(`\(\s*\?(?:\s*,\s*\?)*\s*\)`)
+	shapeTupleRe  = regexp.MustCompile(`\(\?\)(?:\s*,\s*\(\?\))+`)
+	shapeSpaceRe  = regexp.MustCompile(`\s+`)
+)
+
+// Shape normalizes a statement so that the same query with other arguments
+// has the same shape: literals and placeholders become ?, IN lists and
+// multi-row VALUES collapse to a single (?).
+func Shape(sql string) string {
+	s := shapeStringRe.ReplaceAllString(sql, "?")
+	s = shapeParamRe.ReplaceAllString(s, "?")
+	s = shapeNumberRe.ReplaceAllString(s, "?")
+	s = shapeListRe.ReplaceAllString(s, "(?)")
+	s = shapeTupleRe.ReplaceAllString(s, "(?)")
+	s = shapeSpaceRe.ReplaceAllString(s, " ")
+	return strings.ToLower(strings.TrimSpace(s))
+}
+
+// Budget limits the statements of one request. Zero fields are not checked.
+type Budget struct {
+	RepeatThreshold int           // 同一形状的 SQL 超过该次数视为 N+1
+	MaxQueries      int           // 最多执行的 SQL 条数
+	MaxDuration     time.Duration // SQL 总耗时
+}
+
+// Merge returns b with the non-zero fields of override.
+func (b Budget) Merge(override Budget) Budget {
+	if override.RepeatThreshold != 0 {
+		b.RepeatThreshold = override.RepeatThreshold
+	}
+	if override.MaxQueries != 0 {
+		b.MaxQueries = override.MaxQueries
+	}
+	if override.MaxDuration != 0 {
+		b.MaxDuration = override.MaxDuration
+	}
+	return b
+}
+
+// Violation is a budget a request exceeded.
+type Violation struct {
+	Kind  string `json:"kind"`            // n+1, queries or duration
+	Shape string `json:"shape,omitempty"` // 重复的 SQL 形状, 仅 n+1
+	Value int64  `json:"value"`           // 实际次数或耗时(毫秒)
+	Limit int64  `json:"limit"`           // 限制
+}
+
+func (v Violation) String() string {
+	if v.Kind == ViolationRepeat {
+		return fmt.Sprintf("%s %dx %s", v.Kind, v.Value, v.Shape)
+	}
+	return fmt.Sprintf("%s %d>%d", v.Kind, v.Value, v.Limit)
+}
+
+// CheckBudget analyzes the statements recorded so far against b.
+func (t *Trace) CheckBudget(b Budget) []Violation {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+
+	var (
+		violations []Violation
+		total      int64
+		counts     = make(map[string]int64)
+	)
+	for _, sql := range t.SQLs {
+		total += sql.CostSeconds
+		shape := sql.Shape
+		if shape == "" {
+			shape = Shape(sql.SQL)
+		}
+		counts[shape]++
+	}
+
+	if b.RepeatThreshold > 0 {
+		shapes := make([]string, 0, len(counts))
+		for shape, n := range counts {
+			if n > int64(b.RepeatThreshold) {
+				shapes = append(shapes, shape)
+			}
+		}
+		sort.Strings(shapes)
+		for _, shape := range shapes {
+			violations = append(violations, Violation{
+				Kind: ViolationRepeat, Shape: shape, Value: counts[shape], Limit: int64(b.RepeatThreshold),
+			})
+		}
+	}
+	if b.MaxQueries > 0 && len(t.SQLs) > b.MaxQueries {
+		violations = append(violations, Violation{
+			Kind: ViolationQueries, Value: int64(len(t.SQLs)), Limit: int64(b.MaxQueries),
+		})
+	}
+	if limit := b.MaxDuration.Milliseconds(); limit > 0 && total > limit {
+		violations = append(violations, Violation{
+			Kind: ViolationDuration, Value: total, Limit: limit,
+		})
+	}
+	return violations
+}
@@ -0,0 +1,47 @@
+package trace
+
+import (
+	"testing"
+	"time"
+)
+
+func TestShape(t *testing.T) {
+	tests := map[string]string{
+		"SELECT * FROM `users` WHERE `users`.`id` = 12 AND name = 'o''neil'": "select * from `users` where `users`.`id` = ? and name = ?",
+		`SELECT * FROM "files" WHERE owner_id IN ($1,$2, $3)`:                `select * from "files" where owner_id in (?)`,
+		"INSERT INTO t (a,b) VALUES (?,?),(?,?),\n (?,?)":                    "insert into t (a,b) values (?)",
+		"SELECT * FROM t1 WHERE sp_1 = 1.5 LIMIT 10":                         "select * from t1 where sp_1 = ? limit ?",
+	}
+	for sql, want := range tests {
+		if got := Shape(sql); got != want {
+			t.Errorf("Shape(%q)\n got %q\nwant %q", sql, got, want)
+		}
+	}
+}
+
+func TestCheckBudget(t *testing.T) {
+	tr := New("")
+	for i := 0; i < 4; i++ {
+		tr.AppendSQL(&SQL{SQL: "SELECT * FROM files WHERE id = " + string(rune('1'+i)), CostSeconds: 30})
+	}
+	tr.AppendSQL(&SQL{SQL: "SELECT * FROM users", CostSeconds: 10})
+
+	if v := tr.CheckBudget(Budget{RepeatThreshold: 4, MaxQueries: 5, MaxDuration: time.Second}); len(v) != 0 {
+		t.Fatalf("expected no violations, got %v", v)
+	}
+
+	v := tr.CheckBudget(Budget{RepeatThreshold: 3, MaxQueries: 4, MaxDuration: 100 * time.Millisecond})
+	if len(v) != 3 {
+		t.Fatalf("expected 3 violations, got %v", v)
+	}
+	if v[0].Kind != ViolationRepeat || v[0].Value != 4 || v[0].Shape != "select * from files where id = ?" {
+		t.Errorf("unexpected n+1 violation: %+v", v[0])
+	}
+	if v[1].String() != "queries 5>4" || v[2].String() != "duration 130>100" {
+		t.Errorf("unexpected violations: %s, %s", v[1], v[2])
+	}
+
+	if v = tr.CheckBudget(Budget{RepeatThreshold: 3}.Merge(Budget{RepeatThreshold: 10})); len(v) != 0 {
+		t.Errorf("route override should raise the threshold, got %v", v)
+	}
+}
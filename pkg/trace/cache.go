@@ -0,0 +1,17 @@
+package trace
+
+// The results of a Cache read.
+const (
+	CacheHit         = "hit"          // 命中
+	CacheNegativeHit = "negative_hit" // 命中不存在的记录
+	CacheMiss        = "miss"         // 未命中, 已加载
+	CacheShared      = "shared"       // 未命中, 与并发的请求共用一次加载
+	CacheError       = "error"        // 缓存不可用, 已直接加载
+)
+
+type Cache struct {
+	Timestamp   string `json:"timestamp"`    // 时间，格式：2006-01-02 15:04:05
+	Key         string `json:"key"`          // 缓存键
+	Result      string `json:"result"`       // 结果, 见上面的常量
+	CostSeconds int64  `json:"cost_seconds"` // 执行时长(单位毫秒), 未命中时包含加载的时长
+}
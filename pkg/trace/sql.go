@@ -1,9 +1,12 @@
 package trace
 
 type SQL struct {
-	Timestamp   string `json:"timestamp"`     // 时间，格式：2006-01-02 15:04:05
-	Stack       string `json:"stack"`         // 文件地址和行号
-	SQL         string `json:"sql"`           // SQL 语句
-	Rows        int64  `json:"rows_affected"` // 影响行数
-	CostSeconds int64  `json:"cost_seconds"`  // 执行时长(单位毫秒)
+	Timestamp   string `json:"timestamp"`      // 时间，格式：2006-01-02 15:04:05
+	Stack       string `json:"stack"`          // 文件地址和行号
+	SQL         string `json:"sql"`            // SQL 语句
+	Rows        int64  `json:"rows_affected"`  // 影响行数
+	CostSeconds int64  `json:"cost_seconds"`   // 执行时长(单位毫秒)
+	Node        string `json:"node"`           // 执行节点, primary 或只读副本
+	Shape       string `json:"-"`              // 归一化后的 SQL, 见 Shape
+	Plan        string `json:"plan,omitempty"` // 慢查询的执行计划
 }
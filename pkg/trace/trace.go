@@ -24,6 +24,7 @@ type T interface {
 	WithResponse(*gin.Context, *bytes.Buffer) *Trace
 	//AppendDialog(dialog *Dialog) *Trace
 	AppendSQL(sql *SQL) *Trace
+	AppendCache(cache *Cache) *Trace
 	//AppendRedis(redis *Redis) *Trace
 }
 
@@ -38,7 +39,8 @@ type Trace struct {
 	Response *Response `json:"response"`
 	//ThirdPartyRequests []*Dialog `json:"third_party_requests"` // 调用第三方接口的信息
 	//Debugs             []*Debug  `json:"debugs"`               // 调试信息
-	SQLs []*SQL `json:"sqls"` // 执行的 SQL 信息
+	SQLs   []*SQL   `json:"sqls"`   // 执行的 SQL 信息
+	Caches []*Cache `json:"caches"` // 缓存读取信息
 	//Redis              []*Redis  `json:"redis"`                // 执行的 Redis 信息
 	// Success shows if the request is successful.
 	Success bool `json:"success"`
@@ -175,6 +177,19 @@ func (t *Trace) AppendSQL(sql *SQL) *Trace {
 	return t
 }
 
+// AppendCache 追加缓存读取
+func (t *Trace) AppendCache(cache *Cache) *Trace {
+	if cache == nil {
+		return t
+	}
+
+	t.mux.Lock()
+	defer t.mux.Unlock()
+
+	t.Caches = append(t.Caches, cache)
+	return t
+}
+
 // AppendRedis 追加 Redis
 //func (t *Trace) AppendRedis(redis *Redis) *Trace {
 //	if redis == nil {
@@ -0,0 +1,106 @@
+// Package ulid generates Universally Unique Lexicographically Sortable
+// Identifiers, see https://github.com/ulid/spec.
+// They are used as opaque public ids so sequential primary keys never leave
+// the server.
+package ulid
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+	"strings"
+	"time"
+)
+
+const (
+	// Length is the length of an encoded ULID.
+	Length = 26
+
+	// encoding is Crockford's base32 alphabet
+	encoding = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+)
+
+var ErrInvalid = errors.New("invalid ulid")
+
+var decoding [256]byte
+
+func init() {
+	for i := range decoding {
+		decoding[i] = 0xFF
+	}
+	for i := 0; i < len(encoding); i++ {
+		decoding[encoding[i]] = byte(i)
+		decoding[strings.ToLower(encoding[i : i+1])[0]] = byte(i)
+	}
+}
+
+// New returns a new ULID for the current time, it panics if the system
+// random source fails.
+func New() string {
+	id, err := Make(time.Now(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	return id
+}
+
+// Make returns a ULID made of t and 80 bits read from entropy.
+func Make(t time.Time, entropy io.Reader) (string, error) {
+	var b [16]byte
+	var ms [8]byte
+	binary.BigEndian.PutUint64(ms[:], uint64(t.UnixMilli()))
+	copy(b[:6], ms[2:])
+
+	if _, err := io.ReadFull(entropy, b[6:]); err != nil {
+		return "", err
+	}
+
+	return encode(b), nil
+}
+
+// Parse validates s and returns it in canonical upper case form.
+func Parse(s string) (string, error) {
+	if len(s) != Length {
+		return "", ErrInvalid
+	}
+	// the first character carries only 3 bits, anything above 7 overflows 128 bits
+	if decoding[s[0]] > 7 {
+		return "", ErrInvalid
+	}
+	for i := 0; i < len(s); i++ {
+		if decoding[s[i]] == 0xFF {
+			return "", ErrInvalid
+		}
+	}
+	return strings.ToUpper(s), nil
+}
+
+// Time returns the timestamp component of a valid ULID.
+func Time(s string) (time.Time, error) {
+	s, err := Parse(s)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	// the first 10 characters encode the 48 bits timestamp
+	var ms uint64
+	for i := 0; i < 10; i++ {
+		ms = ms<<5 | uint64(decoding[s[i]])
+	}
+	return time.UnixMilli(int64(ms)), nil
+}
+
+// encode writes the 128 bits of b as 26 base32 characters, most significant first.
+func encode(b [16]byte) string {
+	hi := binary.BigEndian.Uint64(b[:8])
+	lo := binary.BigEndian.Uint64(b[8:])
+
+	out := make([]byte, Length)
+	for i := Length - 1; i >= 0; i-- {
+		out[i] = encoding[lo&0x1F]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(out)
+}
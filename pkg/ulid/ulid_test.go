@@ -0,0 +1,56 @@
+package ulid
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestMake(t *testing.T) {
+	ts := time.UnixMilli(1469918176385)
+	id, err := Make(ts, bytes.NewReader(make([]byte, 10)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != "01ARYZ6S410000000000000000" {
+		t.Fatalf("unexpected ulid %s", id)
+	}
+
+	got, err := Time(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Equal(ts) {
+		t.Fatalf("expected %s, got %s", ts, got)
+	}
+}
+
+func TestNewIsSortable(t *testing.T) {
+	a := New()
+	time.Sleep(2 * time.Millisecond)
+	b := New()
+	if a >= b {
+		t.Fatalf("expected %s < %s", a, b)
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in    string
+		valid bool
+	}{
+		{"01ARYZ6S410000000000000000", true},
+		{"01aryz6s410000000000000000", true},
+		{"01ARYZ6S41000000000000000", false},
+		{"81ARYZ6S410000000000000000", false},
+		{"01ARYZ6S41000000000000000U", false},
+		{"1", false},
+	}
+
+	for _, tt := range tests {
+		_, err := Parse(tt.in)
+		if (err == nil) != tt.valid {
+			t.Errorf("Parse(%q) valid = %v, want %v", tt.in, err == nil, tt.valid)
+		}
+	}
+}